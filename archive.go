@@ -0,0 +1,207 @@
+package sharding
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ArchiveDest is where Archive moves rows to. Exactly one of the fields
+// must be set.
+type ArchiveDest struct {
+	// Table is the archive table in the shard schema with the same columns
+	// in the same order as the archived table, e.g. "events_archive".
+	Table string
+	// Create returns the writer for a batch of rows archived from the
+	// shard, e.g. a file in an object store. Rows are written in the CSV
+	// format with a header line and are deleted only when the writer is
+	// closed without an error. It is not called for empty batches.
+	Create func(shardID int64, batch int) (io.WriteCloser, error)
+}
+
+// ArchiveOptions configures Archive.
+type ArchiveOptions struct {
+	// KeyColumn uniquely identifies rows of the table. Rows are archived
+	// in order of the key. Default is "id".
+	KeyColumn string
+	// BatchSize is the number of rows moved in a transaction.
+	// Default is 1000.
+	BatchSize int
+	// Concurrency is the number of shards archived concurrently on every
+	// database server. Default is AutoConcurrency.
+	Concurrency int
+	// Pause is the delay between batches on a shard.
+	Pause time.Duration
+}
+
+// ArchiveResult is the outcome of Archive.
+type ArchiveResult struct {
+	Table string
+	// Rows is the number of archived rows indexed by shard id.
+	Rows []int
+	// Total is the number of archived rows on all shards.
+	Total int
+}
+
+// Archive moves rows of the table matching the predicate from every shard
+// to the dest in batches until no rows match, e.g. to enforce a retention
+// policy:
+//
+//	res, err := cl.Archive(ctx, "events", "created_at < ?", sharding.ArchiveDest{
+//		Table: "events_archive",
+//	}, nil, time.Now().AddDate(-1, 0, 0))
+//
+// Every batch is deleted and written to the dest in a transaction that is
+// rolled back unless the number of rows written to the dest matches the
+// number of deleted rows. Batches archived before an error stay archived;
+// the result counts them.
+func (cl *Cluster) Archive(
+	ctx context.Context,
+	table, predicate string,
+	dest ArchiveDest,
+	opt *ArchiveOptions,
+	params ...interface{},
+) (*ArchiveResult, error) {
+	if (dest.Table == "") == (dest.Create == nil) {
+		return nil, errors.New("sharding: exactly one of ArchiveDest.Table and ArchiveDest.Create is required")
+	}
+	if opt == nil {
+		opt = new(ArchiveOptions)
+	}
+	key := opt.KeyColumn
+	if key == "" {
+		key = "id"
+	}
+	batchSize := opt.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	// Rows to archive are locked so concurrent updates can't change
+	// the batch between the delete and the write.
+	deleteQuery := `
+		DELETE FROM ?SHARD.? WHERE ? IN (
+			SELECT ? FROM ?SHARD.? WHERE ? ORDER BY ? LIMIT ? FOR UPDATE
+		)
+		RETURNING *`
+	deleteParams := []interface{}{
+		pg.Ident(table), pg.Ident(key),
+		pg.Ident(key), pg.Ident(table), pg.SafeQuery(predicate, params...), pg.Ident(key), batchSize,
+	}
+
+	res := &ArchiveResult{
+		Table: table,
+		Rows:  make([]int, cl.nshards),
+	}
+	var total int64
+	err := cl.ForEachShardContext(ctx, &ForEachOptions{
+		Concurrency: opt.Concurrency,
+	}, func(ctx context.Context, shard *pg.DB) error {
+		shardID := shard.Param("SHARD_ID").(int64)
+		for batch := 0; ; batch++ {
+			var n int
+			err := shard.RunInTransaction(ctx, func(tx *pg.Tx) error {
+				var err error
+				if dest.Table != "" {
+					n, err = archiveToTable(ctx, tx, dest.Table, deleteQuery, deleteParams)
+				} else {
+					n, err = archiveToWriter(tx, shardID, batch, dest.Create, deleteQuery, deleteParams)
+				}
+				return err
+			})
+			if err != nil {
+				return WrapShardError(shard, err)
+			}
+
+			res.Rows[shardID] += n
+			atomic.AddInt64(&total, int64(n))
+			if n < batchSize {
+				return nil
+			}
+
+			if opt.Pause > 0 {
+				select {
+				case <-time.After(opt.Pause):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	})
+	res.Total = int(total)
+
+	destName := dest.Table
+	if destName == "" {
+		destName = "writer"
+	}
+	auditErr := cl.audit(ctx, "archive", map[string]interface{}{
+		"table":     table,
+		"predicate": predicate,
+		"dest":      destName,
+		"rows":      res.Total,
+	}, err)
+	if err != nil {
+		return res, err
+	}
+	return res, auditErr
+}
+
+func archiveToTable(
+	ctx context.Context, tx *pg.Tx, destTable, deleteQuery string, deleteParams []interface{},
+) (int, error) {
+	query := `
+		WITH moved AS (` + deleteQuery + `),
+		inserted AS (INSERT INTO ?SHARD.? SELECT * FROM moved RETURNING 1)
+		SELECT (SELECT count(*) FROM moved), (SELECT count(*) FROM inserted)`
+	params := append(deleteParams[:len(deleteParams):len(deleteParams)], pg.Ident(destTable))
+
+	var deleted, inserted int
+	_, err := tx.QueryOneContext(ctx, pg.Scan(&deleted, &inserted), query, params...)
+	if err != nil {
+		return 0, err
+	}
+	if deleted != inserted {
+		return 0, fmt.Errorf("sharding: archived %d rows, but deleted %d", inserted, deleted)
+	}
+	return deleted, nil
+}
+
+func archiveToWriter(
+	tx *pg.Tx,
+	shardID int64,
+	batch int,
+	create func(shardID int64, batch int) (io.WriteCloser, error),
+	deleteQuery string,
+	deleteParams []interface{},
+) (int, error) {
+	// The batch is buffered so the writer is not created for empty batches.
+	var buf bytes.Buffer
+	res, err := tx.CopyTo(&buf, "COPY ("+deleteQuery+") TO STDOUT WITH (FORMAT csv, HEADER)",
+		deleteParams...)
+	if err != nil {
+		return 0, err
+	}
+	n := res.RowsAffected()
+	if n == 0 {
+		return 0, nil
+	}
+
+	w, err := create(shardID, batch)
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.Write(buf.Bytes())
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
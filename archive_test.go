@@ -0,0 +1,101 @@
+package sharding_test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Archive", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("moves rows to the archive table", func() {
+		cluster.SetResult(shardingtest.AllShards, "WITH moved", &shardingtest.Result{
+			Columns: []string{"deleted", "inserted"},
+			Rows:    [][]interface{}{{0, 0}},
+		})
+		cluster.SetResult(1, "WITH moved", &shardingtest.Result{
+			Columns: []string{"deleted", "inserted"},
+			Rows:    [][]interface{}{{3, 3}},
+		})
+
+		res, err := cluster.Archive(ctx, "events", "account_id = ?", sharding.ArchiveDest{
+			Table: "events_archive",
+		}, &sharding.ArchiveOptions{BatchSize: 5}, 7)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(&sharding.ArchiveResult{
+			Table: "events",
+			Rows:  []int{0, 3},
+			Total: 3,
+		}))
+
+		queries := cluster.Queries(1)
+		Expect(queries).To(ContainElement(And(
+			ContainSubstring(`DELETE FROM shard1."events" WHERE "id" IN`),
+			ContainSubstring(`WHERE account_id = 7 ORDER BY "id" LIMIT 5 FOR UPDATE`),
+			ContainSubstring(`INSERT INTO shard1."events_archive" SELECT * FROM moved`),
+		)))
+		Expect(queries).To(ContainElement("COMMIT"))
+	})
+
+	It("rolls back batches that are not verified", func() {
+		cluster.SetResult(shardingtest.AllShards, "WITH moved", &shardingtest.Result{
+			Columns: []string{"deleted", "inserted"},
+			Rows:    [][]interface{}{{2, 1}},
+		})
+
+		res, err := cluster.Archive(ctx, "events", "true", sharding.ArchiveDest{
+			Table: "events_archive",
+		}, nil)
+		Expect(err).To(MatchError(ContainSubstring("archived 1 rows, but deleted 2")))
+		Expect(res.Total).To(Equal(0))
+		Expect(cluster.Queries(0)).To(ContainElement("ROLLBACK"))
+	})
+
+	It("writes rows to the writer", func() {
+		cluster.SetResult(0, "COPY (", &shardingtest.Result{
+			CopyData: "1,a\n2,b\n",
+		})
+
+		var mu sync.Mutex
+		written := make(map[int64]*bytes.Buffer)
+		res, err := cluster.Archive(ctx, "events", "true", sharding.ArchiveDest{
+			Create: func(shardID int64, batch int) (io.WriteCloser, error) {
+				Expect(batch).To(Equal(0))
+				mu.Lock()
+				defer mu.Unlock()
+				buf := new(bytes.Buffer)
+				written[shardID] = buf
+				return nopCloser{buf}, nil
+			},
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Rows).To(Equal([]int{2, 0}))
+		Expect(written).To(HaveLen(1))
+		Expect(written[0].String()).To(Equal("1,a\n2,b\n"))
+		Expect(cluster.Queries(0)).To(ContainElement(And(
+			HavePrefix("COPY ("),
+			ContainSubstring(`DELETE FROM shard0."events"`),
+			HaveSuffix("TO STDOUT WITH (FORMAT csv, HEADER)"),
+		)))
+	})
+
+	It("requires exactly one destination", func() {
+		_, err := cluster.Archive(ctx, "events", "true", sharding.ArchiveDest{}, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,150 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// AuditEntry is a record of an administrative operation.
+type AuditEntry struct {
+	Time time.Time
+	// Actor is set with WithAuditActor.
+	Actor string
+	// Action is the name of the operation, e.g. "add_db".
+	Action string
+	Params map[string]interface{}
+	// Err is the error message when the operation failed.
+	Err string
+}
+
+// AuditSink persists audit entries.
+type AuditSink interface {
+	WriteAudit(ctx context.Context, cl *Cluster, entry *AuditEntry) error
+}
+
+// AuditSinkFunc is an adapter to use ordinary functions as AuditSink.
+type AuditSinkFunc func(ctx context.Context, cl *Cluster, entry *AuditEntry) error
+
+func (fn AuditSinkFunc) WriteAudit(ctx context.Context, cl *Cluster, entry *AuditEntry) error {
+	return fn(ctx, cl, entry)
+}
+
+// WithAuditSink enables the audit trail of administrative operations
+// performed through the cluster, e.g. AddDB, RemoveDB, ReplaceDB, health
+// changes made with SetHealthy and SetHealthyContext, provisioning,
+// snapshots, and storage settings.
+func WithAuditSink(sink AuditSink) Option {
+	return func(cl *Cluster) {
+		cl.auditSink = sink
+	}
+}
+
+// AuditError is returned when the operation succeeded but the audit sink
+// failed to record it. Use errors.As to tell it apart from the failure
+// of the operation itself.
+type AuditError struct {
+	Action string
+	Err    error
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("sharding: audit %s: %s", e.Action, e.Err)
+}
+
+func (e *AuditError) Unwrap() error {
+	return e.Err
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor returns a context that attributes operations performed
+// with it to the actor, e.g. a user name or a job name.
+func WithAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// AuditActor returns the actor set with WithAuditActor.
+func AuditActor(ctx context.Context) string {
+	actor, _ := ctx.Value(auditActorKey{}).(string)
+	return actor
+}
+
+// Audit records the operation in the audit trail. Applications can use it
+// to record their own operations, e.g. migrations. It is a no-op when
+// the cluster has no audit sink.
+func (cl *Cluster) Audit(ctx context.Context, action string, params map[string]interface{}) error {
+	return cl.audit(ctx, action, params, nil)
+}
+
+func (cl *Cluster) audit(ctx context.Context, action string, params map[string]interface{}, opErr error) error {
+	if cl.auditSink == nil {
+		return nil
+	}
+
+	entry := &AuditEntry{
+		Time:   time.Now(),
+		Actor:  AuditActor(ctx),
+		Action: action,
+		Params: params,
+	}
+	if opErr != nil {
+		entry.Err = opErr.Error()
+	}
+	if err := cl.auditSink.WriteAudit(ctx, cl, entry); err != nil {
+		return &AuditError{Action: action, Err: err}
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// AuditTable is an AuditSink that appends entries to the table on every
+// database server in the cluster.
+type AuditTable struct {
+	// Name of the table. Default is sharding_audit.
+	Name string
+}
+
+var _ AuditSink = (*AuditTable)(nil)
+
+func (t *AuditTable) name() pg.Ident {
+	if t.Name == "" {
+		return pg.Ident("sharding_audit")
+	}
+	return pg.Ident(t.Name)
+}
+
+// CreateTable creates the audit table on every database server.
+func (t *AuditTable) CreateTable(ctx context.Context, cl *Cluster) error {
+	return cl.ForEachDB(func(db *pg.DB) error {
+		_, err := db.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS ? (
+				id bigserial PRIMARY KEY,
+				time timestamptz NOT NULL,
+				actor text NOT NULL,
+				action text NOT NULL,
+				params jsonb,
+				error text
+			)
+		`, t.name())
+		return err
+	})
+}
+
+func (t *AuditTable) WriteAudit(ctx context.Context, cl *Cluster, entry *AuditEntry) error {
+	var errText interface{}
+	if entry.Err != "" {
+		errText = entry.Err
+	}
+
+	return cl.ForEachDB(func(db *pg.DB) error {
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO ? (time, actor, action, params, error)
+			VALUES (?, ?, ?, ?, ?)
+		`, t.name(), entry.Time, entry.Actor, entry.Action, entry.Params, errText)
+		return err
+	})
+}
@@ -0,0 +1,104 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	"github.com/go-pg/pg/v10"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Audit", func() {
+	var cluster *shardingtest.Cluster
+	var entries []*sharding.AuditEntry
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("records administrative operations", func() {
+		var mu sync.Mutex
+		entries = nil
+		cluster = shardingtest.NewCluster(2, sharding.WithAuditSink(sharding.AuditSinkFunc(
+			func(_ context.Context, _ *sharding.Cluster, entry *sharding.AuditEntry) error {
+				mu.Lock()
+				entries = append(entries, entry)
+				mu.Unlock()
+				return nil
+			})))
+		cluster.SetQueryError(1, "CREATE SCHEMA", &shardingtest.Error{Message: "disk is full"})
+
+		p := cluster.NewProvisioner(&sharding.ProvisionTemplate{
+			Queries: []string{"CREATE SCHEMA ?SHARD"},
+		})
+		err := p.Run(sharding.WithAuditActor(ctx, "deploy"))
+		Expect(err).To(HaveOccurred())
+
+		Expect(entries).To(HaveLen(2))
+		for _, entry := range entries {
+			Expect(entry.Actor).To(Equal("deploy"))
+			Expect(entry.Action).To(Equal("provision_shard"))
+			if entry.Params["shard_id"] == int64(1) {
+				Expect(entry.Err).To(Equal("sharding: shard 1 (shardingtest1): ERROR #XX000 disk is full"))
+			} else {
+				Expect(entry.Err).To(BeEmpty())
+			}
+		}
+	})
+
+	It("appends entries to the table on every server", func() {
+		cluster = shardingtest.NewCluster(2, sharding.WithAuditSink(&sharding.AuditTable{}))
+
+		err := cluster.Audit(sharding.WithAuditActor(ctx, "alice"), "migrate", map[string]interface{}{
+			"version": 3,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, shardID := range []int64{0, 1} {
+			queries := cluster.Queries(shardID)
+			Expect(queries).To(HaveLen(1))
+			Expect(queries[0]).To(ContainSubstring(`INSERT INTO "sharding_audit"`))
+			Expect(queries[0]).To(ContainSubstring(`'alice', 'migrate', '{"version":3}', NULL)`))
+		}
+	})
+})
+
+var _ = Describe("Audit of topology changes", func() {
+	It("records health changes and topology changes with the actor", func() {
+		db1 := pg.Connect(&pg.Options{Addr: "db1"})
+		db2 := pg.Connect(&pg.Options{Addr: "db2"})
+		sinkErr := errors.New("sink is down")
+		var entries []*sharding.AuditEntry
+		cl := sharding.NewCluster([]*pg.DB{db1}, 2, sharding.WithAuditSink(sharding.AuditSinkFunc(
+			func(_ context.Context, _ *sharding.Cluster, entry *sharding.AuditEntry) error {
+				entries = append(entries, entry)
+				if entry.Action == "add_db" {
+					return sinkErr
+				}
+				return nil
+			})))
+		defer cl.Close()
+
+		actx := sharding.WithAuditActor(ctx, "oncall")
+		Expect(cl.SetHealthyContext(actx, db1, false)).NotTo(HaveOccurred())
+		Expect(cl.SetHealthyContext(actx, db1, false)).NotTo(HaveOccurred())
+
+		err := cl.AddDB(actx, db2, nil)
+		var auditErr *sharding.AuditError
+		Expect(errors.As(err, &auditErr)).To(BeTrue())
+		Expect(auditErr.Action).To(Equal("add_db"))
+		Expect(errors.Is(err, sinkErr)).To(BeTrue())
+		Expect(cl.DBs()).To(Equal([]*pg.DB{db1, db2}))
+
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Actor).To(Equal("oncall"))
+		Expect(entries[0].Action).To(Equal("set_healthy"))
+		Expect(entries[0].Params).To(Equal(map[string]interface{}{"addr": "db1", "healthy": false}))
+		Expect(entries[1].Actor).To(Equal("oncall"))
+	})
+})
@@ -0,0 +1,279 @@
+package sharding
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// QueryRoute is the routing decision made by AutoRoute.
+type QueryRoute struct {
+	// Key is the shard key found in the query when Routed is true.
+	Key    int64
+	Routed bool
+	// Shards are the shard of the key or, when the query can't be routed,
+	// every shard of the cluster, i.e. the query must be scattered and
+	// results gathered, e.g. with ForEachRow.
+	Shards []*pg.DB
+}
+
+// AutoRoute inspects the query for the value of the key column using
+// ShardKeyFromQuery and returns the shard of the key like Shard or every
+// shard when the query can't be routed to a single shard.
+func (cl *Cluster) AutoRoute(keyColumn, query string, params ...interface{}) *QueryRoute {
+	key, ok := ShardKeyFromQuery(keyColumn, query, params...)
+	if !ok {
+		return &QueryRoute{
+			Shards: cl.Shards(nil),
+		}
+	}
+	return &QueryRoute{
+		Key:    key,
+		Routed: true,
+		Shards: []*pg.DB{cl.Shard(key)},
+	}
+}
+
+// ShardKeyFromQuery returns the value of the key column, e.g. user_id,
+// compared for equality in the top-level WHERE clause of the query, e.g.
+//
+//	SELECT * FROM ?SHARD.posts WHERE user_id = ? AND id > ?
+//	UPDATE ?SHARD.posts AS p SET hidden = true WHERE p.user_id = 42
+//
+// The value can be an integer literal or a go-pg placeholder, i.e. ? or
+// ?0, for an integer param. It returns false when the key can't be found
+// safely: the WHERE clause is missing, has OR at the top level, compares
+// the key with an expression or different values, or the query inserts
+// rows, modifies rows in a CTE, or uses UNION, INTERSECT, or EXCEPT. It is
+// not a full SQL parser, so queries it does not understand are not routed.
+func ShardKeyFromQuery(keyColumn, query string, params ...interface{}) (int64, bool) {
+	toks := tokenizeSQL(query)
+	args := placeholderArgs(toks)
+
+	where := -1
+	depth := 0
+	for i, tok := range toks {
+		switch {
+		case tok.s == "(":
+			depth++
+		case tok.s == ")":
+			depth--
+		case tok.is("UNION"), tok.is("INTERSECT"), tok.is("EXCEPT"):
+			return 0, false
+		case tok.is("INSERT"), tok.is("MERGE"):
+			// Inserted rows are not filtered by the WHERE clause.
+			return 0, false
+		case depth > 0 && (tok.is("DELETE") || (tok.is("UPDATE") && !toks[i-1].is("FOR"))):
+			// Data-modifying CTEs and subqueries can write to other shards.
+			return 0, false
+		case tok.is("WHERE") && depth == 0 && where == -1:
+			where = i
+		}
+	}
+	if where == -1 {
+		return 0, false
+	}
+
+	var conjuncts [][]sqlToken
+	start := where + 1
+	depth = 0
+	between := false
+	end := len(toks)
+loop:
+	for i := where + 1; i < len(toks); i++ {
+		tok := toks[i]
+		switch {
+		case tok.s == "(":
+			depth++
+			continue
+		case tok.s == ")":
+			depth--
+			if depth < 0 {
+				end = i
+				break loop
+			}
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+
+		switch {
+		case tok.is("OR"):
+			return 0, false
+		case tok.is("BETWEEN"):
+			between = true
+		case tok.is("AND"):
+			if between {
+				between = false
+				continue
+			}
+			conjuncts = append(conjuncts, toks[start:i])
+			start = i + 1
+		case isWhereClauseEnd(tok):
+			end = i
+			break loop
+		}
+	}
+	conjuncts = append(conjuncts, toks[start:end])
+
+	var key int64
+	var found bool
+	for _, c := range conjuncts {
+		v, ok := keyPredicate(c, keyColumn, args, params)
+		if !ok {
+			continue
+		}
+		if found && v != key {
+			return 0, false
+		}
+		key, found = v, true
+	}
+	return key, found
+}
+
+func isWhereClauseEnd(tok sqlToken) bool {
+	for _, kw := range []string{
+		"GROUP", "HAVING", "WINDOW", "ORDER", "LIMIT", "OFFSET", "FETCH", "FOR", "RETURNING",
+	} {
+		if tok.is(kw) {
+			return true
+		}
+	}
+	return tok.s == ";"
+}
+
+// placeholderArgs returns the param index of every ? placeholder indexed
+// by the placeholder position in the query. Named params like ?SHARD are
+// skipped.
+func placeholderArgs(toks []sqlToken) map[int]int {
+	args := make(map[int]int)
+	var next int
+	for i, tok := range toks {
+		if tok.s != "?" {
+			continue
+		}
+		if i+1 < len(toks) && toks[i+1].pos == tok.pos+1 {
+			s := toks[i+1].s
+			if n, err := strconv.Atoi(s); err == nil {
+				args[tok.pos] = n
+				continue
+			}
+			if isIdent(s) && s[0] != '"' {
+				continue
+			}
+		}
+		args[tok.pos] = next
+		next++
+	}
+	return args
+}
+
+// keyPredicate returns the value of the conjunct that compares the key
+// column with a value, i.e. "[qualifier.]column = value" or the reverse.
+func keyPredicate(toks []sqlToken, keyColumn string, args map[int]int, params []interface{}) (int64, bool) {
+	eq := -1
+	for i, tok := range toks {
+		if tok.s == "=" {
+			if eq != -1 {
+				return 0, false
+			}
+			eq = i
+		}
+	}
+	if eq == -1 {
+		return 0, false
+	}
+
+	lhs, rhs := toks[:eq], toks[eq+1:]
+	if !isKeyColumn(lhs, keyColumn) {
+		lhs, rhs = rhs, lhs
+		if !isKeyColumn(lhs, keyColumn) {
+			return 0, false
+		}
+	}
+	return predicateValue(rhs, args, params)
+}
+
+func isKeyColumn(toks []sqlToken, keyColumn string) bool {
+	switch len(toks) {
+	case 1:
+	case 3:
+		if toks[1].s != "." || !isIdent(toks[0].s) {
+			return false
+		}
+		toks = toks[2:]
+	default:
+		return false
+	}
+
+	name := toks[0].s
+	if strings.HasPrefix(name, `"`) {
+		return strings.Trim(name, `"`) == keyColumn
+	}
+	return isIdent(name) && strings.EqualFold(name, keyColumn)
+}
+
+// predicateValue returns the value of the tokens that are an integer
+// literal or a placeholder optionally followed by a type cast.
+func predicateValue(toks []sqlToken, args map[int]int, params []interface{}) (int64, bool) {
+	// Strip a type cast, e.g. ?::bigint.
+	for i := 0; i+1 < len(toks); i++ {
+		if toks[i].s == ":" && toks[i+1].s == ":" {
+			if i+3 != len(toks) || !isIdent(toks[i+2].s) {
+				return 0, false
+			}
+			toks = toks[:i]
+			break
+		}
+	}
+
+	switch {
+	case len(toks) == 1 && isDigit(toks[0].s[0]):
+		n, err := strconv.ParseInt(toks[0].s, 10, 64)
+		return n, err == nil
+	case len(toks) == 2 && toks[0].s == "-" && toks[1].pos == toks[0].pos+1 && isDigit(toks[1].s[0]):
+		n, err := strconv.ParseInt("-"+toks[1].s, 10, 64)
+		return n, err == nil
+	case len(toks) == 1 && toks[0].s == "?",
+		len(toks) == 2 && toks[0].s == "?" && toks[1].pos == toks[0].pos+1 && isDigit(toks[1].s[0]):
+		ind, ok := args[toks[0].pos]
+		if !ok || ind >= len(params) {
+			return 0, false
+		}
+		return intParam(params[ind])
+	}
+	return 0, false
+}
+
+// intParam returns the param as int64 if it is an integer.
+func intParam(param interface{}) (int64, bool) {
+	switch v := param.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
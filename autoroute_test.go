@@ -0,0 +1,77 @@
+package sharding_test
+
+import (
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestShardKeyFromQuery(t *testing.T) {
+	tests := []struct {
+		query  string
+		params []interface{}
+		key    int64
+		ok     bool
+	}{
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = ?", []interface{}{7}, 7, true},
+		{"SELECT * FROM ?SHARD.posts WHERE id > ? AND user_id = ? LIMIT 10", []interface{}{1, int64(7)}, 7, true},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = ?1 AND id = ?0", []interface{}{1, uint32(7)}, 7, true},
+		{"SELECT * FROM ?SHARD.posts p WHERE ? = p.user_id", []interface{}{7}, 7, true},
+		{`SELECT * FROM ?SHARD.posts WHERE "user_id" = 42 ORDER BY id`, nil, 42, true},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = -3", nil, -3, true},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = ?::bigint", []interface{}{7}, 7, true},
+		{"SELECT * FROM ?SHARD.posts WHERE title = 'user_id = 1' AND user_id = ?", []interface{}{7}, 7, true},
+		{"SELECT * FROM ?SHARD.posts WHERE id BETWEEN ? AND ? AND user_id = ?", []interface{}{1, 2, 7}, 7, true},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = 7 AND (id = 1 OR id = 2)", nil, 7, true},
+		{"UPDATE ?SHARD.posts AS p SET hidden = true WHERE p.user_id = 42 RETURNING id", nil, 42, true},
+		{"DELETE FROM ?SHARD.posts WHERE user_id = ? AND user_id = ?", []interface{}{7, 7}, 7, true},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = 7 FOR UPDATE", nil, 7, true},
+
+		{"SELECT * FROM ?SHARD.posts", nil, 0, false},
+		{"SELECT * FROM ?SHARD.posts WHERE id = ?", []interface{}{7}, 0, false},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = ? OR id = 1", []interface{}{7}, 0, false},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = ? AND user_id = ?", []interface{}{7, 8}, 0, false},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id >= ?", []interface{}{7}, 0, false},
+		{"SELECT * FROM ?SHARD.posts WHERE NOT user_id = ?", []interface{}{7}, 0, false},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = ? + 1", []interface{}{7}, 0, false},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = ?", []interface{}{"7"}, 0, false},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = ?", nil, 0, false},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = 'abc'", nil, 0, false},
+		{"SELECT * FROM ?SHARD.posts WHERE user_id = ANY(?)", []interface{}{pg.Array([]int{1})}, 0, false},
+		{"SELECT * FROM (SELECT * FROM ?SHARD.posts WHERE user_id = 1) t", nil, 0, false},
+		{"SELECT id FROM ?SHARD.a WHERE user_id = 1 UNION SELECT id FROM ?SHARD.b", nil, 0, false},
+		{"WITH d AS (DELETE FROM ?SHARD.a RETURNING *) SELECT * FROM d WHERE user_id = 1", nil, 0, false},
+		{
+			"INSERT INTO ?SHARD.posts (id, user_id) VALUES (1, 2) ON CONFLICT (id) DO UPDATE SET title = 'x' " +
+				"WHERE posts.user_id = 3",
+			nil, 0, false,
+		},
+	}
+	for _, test := range tests {
+		key, ok := sharding.ShardKeyFromQuery("user_id", test.query, test.params...)
+		if ok != test.ok || key != test.key {
+			t.Errorf("%q: got %d, %v, wanted %d, %v", test.query, key, ok, test.key, test.ok)
+		}
+	}
+}
+
+func TestAutoRoute(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	cl := sharding.NewCluster([]*pg.DB{db}, 4)
+	defer cl.Close()
+
+	route := cl.AutoRoute("user_id", "SELECT * FROM ?SHARD.posts WHERE user_id = ?", 6)
+	if !route.Routed || route.Key != 6 {
+		t.Fatalf("got %+v, wanted key 6", route)
+	}
+	if len(route.Shards) != 1 || route.Shards[0] != cl.Shard(6) {
+		t.Fatalf("got %d shards, wanted the shard of the key", len(route.Shards))
+	}
+
+	route = cl.AutoRoute("user_id", "SELECT * FROM ?SHARD.posts WHERE id = ?", 6)
+	if route.Routed || len(route.Shards) != 4 {
+		t.Fatalf("got routed=%v and %d shards, wanted every shard", route.Routed, len(route.Shards))
+	}
+}
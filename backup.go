@@ -0,0 +1,265 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// BackupOptions configures Backup.
+type BackupOptions struct {
+	// Tables are names of the tables without the shard schema, e.g. "users".
+	Tables []string
+	// Create returns the writer for the dump of the table on the shard
+	// and the name of the artifact recorded in the manifest. The writer
+	// is closed when the dump is complete. See Cluster.BackupDir.
+	Create func(shardID int64, table string) (w io.WriteCloser, name string, err error)
+	// ConcurrencyPerDB limits the number of shards dumped concurrently
+	// on every database server. Default is 1.
+	ConcurrencyPerDB int
+	// Snapshot makes all shards on a database server read the same
+	// snapshot exported with pg_export_snapshot(). Shards on different
+	// servers are still read at slightly different times. Without it
+	// only tables of the same shard are consistent with each other.
+	Snapshot bool
+}
+
+// BackupManifest maps shards to the artifacts produced by Backup.
+type BackupManifest struct {
+	Time   time.Time     `json:"time"`
+	Tables []string      `json:"tables"`
+	Shards []BackupShard `json:"shards"` // ordered by shard id
+}
+
+// BackupShard describes the dump of a shard.
+type BackupShard struct {
+	ShardID int64  `json:"shard_id"`
+	Schema  string `json:"schema"`
+	DBAddr  string `json:"db_addr"`
+	// Snapshot is the id of the exported snapshot used to read the shard.
+	Snapshot  string           `json:"snapshot,omitempty"`
+	Artifacts []BackupArtifact `json:"artifacts"`
+}
+
+// BackupArtifact is the dump of a table in the CSV format with a header line.
+type BackupArtifact struct {
+	Table string `json:"table"`
+	Name  string `json:"name"`
+	Rows  int    `json:"rows"`
+}
+
+// BackupDir returns BackupOptions.Create func that writes dumps to files
+// named dir/schema/table.csv, e.g. dir/shard3/users.csv, where schema
+// is the shard schema name recorded in the manifest.
+func (cl *Cluster) BackupDir(dir string) func(shardID int64, table string) (io.WriteCloser, string, error) {
+	return func(shardID int64, table string) (io.WriteCloser, string, error) {
+		name := filepath.Join(cl.shardName(shardID), table+".csv")
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, "", err
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, "", err
+		}
+		return f, name, nil
+	}
+}
+
+// Backup dumps the tables of every shard using COPY in a REPEATABLE READ
+// transaction per shard. Shards on different database servers are dumped
+// concurrently. The first error stops the backup.
+func (cl *Cluster) Backup(ctx context.Context, opt *BackupOptions) (*BackupManifest, error) {
+	if opt.Create == nil {
+		return nil, errors.New("sharding: BackupOptions.Create is required")
+	}
+	concurrency := opt.ConcurrencyPerDB
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	t := cl.topology()
+	manifest := &BackupManifest{
+		Time:   time.Now(),
+		Tables: opt.Tables,
+		Shards: make([]BackupShard, len(t.shards)),
+	}
+
+	// The audit uses the caller ctx because the run ctx is cancelled
+	// on the first error.
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var errOnce sync.Once
+	var firstErr error
+	setErr := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	var wg sync.WaitGroup
+	for _, db := range t.servers {
+		wg.Add(1)
+		go func(db *pg.DB) {
+			defer wg.Done()
+			if err := cl.backupServer(runCtx, t, db, opt, concurrency, manifest); err != nil {
+				setErr(err)
+			}
+		}(db)
+	}
+	wg.Wait()
+
+	params := map[string]interface{}{
+		"tables":   opt.Tables,
+		"snapshot": opt.Snapshot,
+	}
+	auditErr := cl.audit(ctx, "backup", params, firstErr)
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return manifest, auditErr
+}
+
+// backupServer dumps shards of the db server filling their entries
+// in the manifest.
+func (cl *Cluster) backupServer(
+	ctx context.Context,
+	t *topology,
+	db *pg.DB,
+	opt *BackupOptions,
+	concurrency int,
+	manifest *BackupManifest,
+) error {
+	var snapshot string
+	if opt.Snapshot {
+		// The exporting transaction must stay open until every shard
+		// has imported the snapshot.
+		tx, err := db.BeginContext(ctx)
+		if err != nil {
+			return fmt.Errorf("sharding: export snapshot on %s: %w", db.Options().Addr, err)
+		}
+		defer tx.Close()
+
+		_, err = tx.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+		if err == nil {
+			_, err = tx.QueryOneContext(ctx, pg.Scan(&snapshot), "SELECT pg_export_snapshot()")
+		}
+		if err != nil {
+			return fmt.Errorf("sharding: export snapshot on %s: %w", db.Options().Addr, err)
+		}
+	}
+
+	var shards []*shardInfo
+	for i := range t.shards {
+		if t.dbs[t.shards[i].dbInd] == db {
+			shards = append(shards, &t.shards[i])
+		}
+	}
+
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, concurrency)
+
+	for _, info := range shards {
+		limit <- struct{}{}
+
+		mu.Lock()
+		stop := firstErr != nil
+		mu.Unlock()
+		if stop {
+			<-limit
+			break
+		}
+
+		wg.Add(1)
+		go func(info *shardInfo) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+
+			artifacts, err := backupShard(ctx, info.shard, snapshot, opt)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = WrapShardError(info.shard, err)
+				}
+				mu.Unlock()
+				return
+			}
+
+			// Every shard owns its entry so no locking is needed.
+			manifest.Shards[info.id] = BackupShard{
+				ShardID:   int64(info.id),
+				Schema:    shardSchema(info.shard),
+				DBAddr:    db.Options().Addr,
+				Snapshot:  snapshot,
+				Artifacts: artifacts,
+			}
+		}(info)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+func backupShard(
+	ctx context.Context, shard *pg.DB, snapshot string, opt *BackupOptions,
+) ([]BackupArtifact, error) {
+	shardID, _ := shard.Param("SHARD_ID").(int64)
+	artifacts := make([]BackupArtifact, 0, len(opt.Tables))
+
+	err := shard.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		_, err := tx.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+		if err != nil {
+			return err
+		}
+		if snapshot != "" {
+			_, err := tx.ExecContext(ctx, "SET TRANSACTION SNAPSHOT ?", snapshot)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, table := range opt.Tables {
+			artifact, err := backupTable(tx, shardID, table, opt)
+			if err != nil {
+				return err
+			}
+			artifacts = append(artifacts, artifact)
+		}
+		return nil
+	})
+	return artifacts, err
+}
+
+func backupTable(tx *pg.Tx, shardID int64, table string, opt *BackupOptions) (BackupArtifact, error) {
+	w, name, err := opt.Create(shardID, table)
+	if err != nil {
+		return BackupArtifact{}, err
+	}
+
+	res, err := tx.CopyTo(w, "COPY ?SHARD.? TO STDOUT WITH (FORMAT csv, HEADER)", pg.Ident(table))
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return BackupArtifact{}, err
+	}
+
+	return BackupArtifact{
+		Table: table,
+		Name:  name,
+		Rows:  res.RowsAffected(),
+	}, nil
+}
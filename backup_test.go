@@ -0,0 +1,132 @@
+package sharding_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+var _ = Describe("Backup", func() {
+	var cluster *shardingtest.Cluster
+	var mu sync.Mutex
+	var dumps map[string]*bytes.Buffer
+
+	create := func(shardID int64, table string) (io.WriteCloser, string, error) {
+		name := fmt.Sprintf("shard%d/%s", shardID, table)
+		buf := new(bytes.Buffer)
+		mu.Lock()
+		dumps[name] = buf
+		mu.Unlock()
+		return nopCloser{buf}, name, nil
+	}
+
+	BeforeEach(func() {
+		dumps = make(map[string]*bytes.Buffer)
+		cluster = shardingtest.NewCluster(2)
+		cluster.SetResult(shardingtest.AllShards, "COPY", &shardingtest.Result{
+			CopyData: "1\n2\n",
+		})
+		cluster.SetResult(shardingtest.AllShards, "pg_export_snapshot", &shardingtest.Result{
+			Columns: []string{"pg_export_snapshot"},
+			Rows:    [][]interface{}{{"00000003-1"}},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("dumps tables of every shard", func() {
+		manifest, err := cluster.Backup(ctx, &sharding.BackupOptions{
+			Tables: []string{"users", "posts"},
+			Create: create,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(manifest.Shards).To(HaveLen(2))
+		Expect(manifest.Shards[1]).To(Equal(sharding.BackupShard{
+			ShardID: 1,
+			Schema:  "shard1",
+			DBAddr:  "shardingtest1",
+			Artifacts: []sharding.BackupArtifact{
+				{Table: "users", Name: "shard1/users", Rows: 2},
+				{Table: "posts", Name: "shard1/posts", Rows: 2},
+			},
+		}))
+		Expect(dumps["shard0/users"].String()).To(Equal("1\n2\n"))
+
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"BEGIN",
+			"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+			`COPY shard1."users" TO STDOUT WITH (FORMAT csv, HEADER)`,
+			`COPY shard1."posts" TO STDOUT WITH (FORMAT csv, HEADER)`,
+			"COMMIT",
+		}))
+	})
+
+	It("reads exported snapshots", func() {
+		manifest, err := cluster.Backup(ctx, &sharding.BackupOptions{
+			Tables:   []string{"users"},
+			Create:   create,
+			Snapshot: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Shards[0].Snapshot).To(Equal("00000003-1"))
+
+		Expect(cluster.Queries(0)).To(Equal([]string{
+			"BEGIN",
+			"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+			"SELECT pg_export_snapshot()",
+			"BEGIN",
+			"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+			"SET TRANSACTION SNAPSHOT '00000003-1'",
+			`COPY shard0."users" TO STDOUT WITH (FORMAT csv, HEADER)`,
+			"COMMIT",
+			"ROLLBACK",
+		}))
+	})
+
+	It("returns shard errors", func() {
+		cluster.SetQueryError(1, "COPY", &shardingtest.Error{Message: "fake error"})
+
+		_, err := cluster.Backup(ctx, &sharding.BackupOptions{
+			Tables: []string{"users"},
+			Create: create,
+		})
+		Expect(err).To(MatchError("sharding: shard 1 (shardingtest1): ERROR #XX000 fake error"))
+	})
+	It("audits failed backups with the caller ctx", func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+		var auditCtxErr error
+		var entry *sharding.AuditEntry
+		cluster = shardingtest.NewCluster(2, sharding.WithAuditSink(sharding.AuditSinkFunc(
+			func(ctx context.Context, _ *sharding.Cluster, e *sharding.AuditEntry) error {
+				auditCtxErr = ctx.Err()
+				entry = e
+				return nil
+			})))
+		cluster.SetQueryError(1, "COPY", &shardingtest.Error{Message: "fake error"})
+
+		_, err := cluster.Backup(ctx, &sharding.BackupOptions{
+			Tables: []string{"users"},
+			Create: create,
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(auditCtxErr).NotTo(HaveOccurred())
+		Expect(entry.Err).To(Equal("sharding: shard 1 (shardingtest1): ERROR #XX000 fake error"))
+	})
+})
@@ -57,6 +57,49 @@ func BenchmarkCluster(b *testing.B) {
 	})
 }
 
+func benchmarkShard(b *testing.B, nshards int) {
+	db := benchmarkDB()
+	defer db.Close()
+
+	cluster := sharding.NewCluster([]*pg.DB{db}, nshards)
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		n := rand.Int63()
+		for pb.Next() {
+			_ = cluster.Shard(n)
+			n++
+		}
+	})
+}
+
+func BenchmarkShardPowerOfTwo(b *testing.B) {
+	benchmarkShard(b, 2048)
+}
+
+func BenchmarkShard(b *testing.B) {
+	benchmarkShard(b, 2000)
+}
+
+func BenchmarkSubClusterShard(b *testing.B) {
+	db := benchmarkDB()
+	defer db.Close()
+
+	cluster := sharding.NewCluster([]*pg.DB{db}, 2000)
+	subcluster := cluster.SubCluster(0, 40)
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		n := rand.Int63()
+		for pb.Next() {
+			_ = subcluster.Shard(n)
+			n++
+		}
+	})
+}
+
 var sink *sharding.SubCluster
 
 func BenchmarkSubCluster(b *testing.B) {
@@ -83,3 +126,46 @@ func BenchmarkNewUUID(b *testing.B) {
 		}
 	})
 }
+
+// benchmarkQuery has a positional param so go-pg can't take the fast path
+// for queries without params in both benchmarks.
+const benchmarkQuery = "SELECT id, name FROM ?SHARD.users WHERE shard_id = ?SHARD_ID AND id = ?"
+
+func BenchmarkFormatQuery(b *testing.B) {
+	db := benchmarkDB()
+	defer db.Close()
+
+	cluster := sharding.NewCluster([]*pg.DB{db}, 4)
+	shard := cluster.Shard(3)
+	fmter := shard.Formatter()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		var buf []byte
+		for pb.Next() {
+			buf = fmter.FormatQuery(buf[:0], benchmarkQuery, 123)
+		}
+	})
+}
+
+func BenchmarkTemplate(b *testing.B) {
+	db := benchmarkDB()
+	defer db.Close()
+
+	cluster := sharding.NewCluster([]*pg.DB{db}, 4)
+	shard := cluster.Shard(3)
+	fmter := shard.Formatter()
+	tmpl := cluster.Compile(benchmarkQuery)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		var buf []byte
+		for pb.Next() {
+			buf = fmter.FormatQuery(buf[:0], tmpl.String(shard), 123)
+		}
+	})
+}
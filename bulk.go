@@ -0,0 +1,150 @@
+package sharding
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// BulkLoaderOptions configures a BulkLoader.
+type BulkLoaderOptions struct {
+	// Table name without the shard schema, e.g. "users".
+	Table   string
+	Columns []string
+	// BatchSize is the number of rows sent to a shard with a single COPY.
+	// Default is 10000.
+	BatchSize int
+	// Concurrency is the maximum number of COPY commands running at the
+	// same time. Default is the number of database servers.
+	Concurrency int
+}
+
+// BulkLoader partitions records by shard key in memory and loads them
+// into the shards using concurrent COPY commands.
+type BulkLoader struct {
+	cl  *Cluster
+	ctx context.Context
+	opt *BulkLoaderOptions
+
+	mu      sync.Mutex
+	batches map[int64][][]interface{}
+
+	limit  chan struct{}
+	wg     sync.WaitGroup
+	errMu  sync.Mutex
+	err    error
+	loaded int64
+}
+
+// NewBulkLoader returns a loader that copies records into the table
+// of the cluster shards.
+func (cl *Cluster) NewBulkLoader(ctx context.Context, opt *BulkLoaderOptions) *BulkLoader {
+	cp := *opt
+	opt = &cp
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = 10000
+	}
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = len(cl.topology().servers)
+	}
+	return &BulkLoader{
+		cl:      cl,
+		ctx:     ctx,
+		opt:     opt,
+		batches: make(map[int64][][]interface{}),
+		limit:   make(chan struct{}, opt.Concurrency),
+	}
+}
+
+// Add adds a record with the values for the loader columns to the shard
+// picked by the key. A full batch is copied in the background and Add
+// blocks while the maximum number of COPY commands are running.
+// The values are copied so the caller can reuse the slice.
+// It returns an error if a previous batch has failed.
+func (l *BulkLoader) Add(key int64, values ...interface{}) error {
+	if err := l.Err(); err != nil {
+		return err
+	}
+
+	shardID := l.cl.shardID(key)
+	values = append([]interface{}(nil), values...)
+
+	l.mu.Lock()
+	batch := append(l.batches[shardID], values)
+	if len(batch) < l.opt.BatchSize {
+		l.batches[shardID] = batch
+		l.mu.Unlock()
+		return nil
+	}
+	delete(l.batches, shardID)
+	l.mu.Unlock()
+
+	l.copy(shardID, batch)
+	return nil
+}
+
+// Close copies remaining records, waits until all COPY commands are
+// finished, and returns the first error.
+func (l *BulkLoader) Close() error {
+	l.mu.Lock()
+	batches := l.batches
+	l.batches = make(map[int64][][]interface{})
+	l.mu.Unlock()
+
+	for shardID, batch := range batches {
+		if l.Err() != nil {
+			break
+		}
+		l.copy(shardID, batch)
+	}
+
+	l.wg.Wait()
+	return l.Err()
+}
+
+// Loaded returns the number of records copied so far.
+func (l *BulkLoader) Loaded() int64 {
+	return atomic.LoadInt64(&l.loaded)
+}
+
+// Err returns the first error that occurred while copying records.
+func (l *BulkLoader) Err() error {
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	return l.err
+}
+
+func (l *BulkLoader) copy(shardID int64, batch [][]interface{}) {
+	l.limit <- struct{}{}
+	l.wg.Add(1)
+	go func() {
+		defer func() {
+			<-l.limit
+			l.wg.Done()
+		}()
+
+		if err := l.copyBatch(l.cl.shardByID(shardID), batch); err != nil {
+			l.errMu.Lock()
+			if l.err == nil {
+				l.err = err
+			}
+			l.errMu.Unlock()
+			return
+		}
+		atomic.AddInt64(&l.loaded, int64(len(batch)))
+	}()
+}
+
+func (l *BulkLoader) copyBatch(shard *pg.DB, batch [][]interface{}) error {
+	var buf bytes.Buffer
+	var b []byte
+	for _, values := range batch {
+		b = appendCSVRow(b[:0], values)
+		buf.Write(b)
+	}
+	_, err := copyFromCSV(l.ctx, shard, l.opt.Table, l.opt.Columns, &buf)
+	return err
+}
@@ -0,0 +1,74 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BulkLoader", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("copies records into their shards in batches", func() {
+		loader := cluster.NewBulkLoader(ctx, &sharding.BulkLoaderOptions{
+			Table:       "users",
+			Columns:     []string{"id", "name"},
+			BatchSize:   2,
+			Concurrency: 1,
+		})
+		for i := int64(0); i < 5; i++ {
+			Expect(loader.Add(i, i, "user")).NotTo(HaveOccurred())
+		}
+		Expect(loader.Add(5, 5, nil)).NotTo(HaveOccurred())
+		Expect(loader.Close()).NotTo(HaveOccurred())
+		Expect(loader.Loaded()).To(Equal(int64(6)))
+
+		Expect(cluster.Queries(0)).To(Equal([]string{
+			`COPY shard0."users" ("id","name") FROM STDIN WITH (FORMAT csv)`,
+			`COPY shard0."users" ("id","name") FROM STDIN WITH (FORMAT csv)`,
+		}))
+		Expect(cluster.Copied(0)).To(Equal("\"0\",\"user\"\n\"2\",\"user\"\n\"4\",\"user\"\n"))
+		Expect(cluster.Copied(1)).To(Equal("\"1\",\"user\"\n\"3\",\"user\"\n\"5\",\n"))
+	})
+
+	It("does not keep or modify caller memory", func() {
+		opt := &sharding.BulkLoaderOptions{
+			Table:   "users",
+			Columns: []string{"id", "name"},
+		}
+		loader := cluster.NewBulkLoader(ctx, opt)
+		Expect(*opt).To(Equal(sharding.BulkLoaderOptions{
+			Table:   "users",
+			Columns: []string{"id", "name"},
+		}))
+
+		row := make([]interface{}, 2)
+		for _, id := range []int64{0, 2} {
+			row[0], row[1] = id, "user"
+			Expect(loader.Add(id, row...)).NotTo(HaveOccurred())
+		}
+		Expect(loader.Close()).NotTo(HaveOccurred())
+		Expect(cluster.Copied(0)).To(Equal("\"0\",\"user\"\n\"2\",\"user\"\n"))
+	})
+
+	It("returns copy errors", func() {
+		cluster.SetError(1, &shardingtest.Error{Message: "relation does not exist"})
+
+		loader := cluster.NewBulkLoader(ctx, &sharding.BulkLoaderOptions{
+			Table:   "users",
+			Columns: []string{"id"},
+		})
+		Expect(loader.Add(1, 1)).NotTo(HaveOccurred())
+		Expect(loader.Close()).To(MatchError("sharding: shard 1 (shardingtest1): ERROR #XX000 relation does not exist"))
+	})
+})
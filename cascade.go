@@ -0,0 +1,181 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// CascadeTable is a table with rows that depend on the cascade key.
+type CascadeTable struct {
+	// Table name without the shard schema, e.g. "comments".
+	Table string
+	// Column that references the key, e.g. "account_id".
+	Column string
+}
+
+// CascadeCleanup is a best-effort cleanup executed outside of the owning
+// shard, e.g. removing directory entries or rows on other shards.
+type CascadeCleanup struct {
+	Name string
+	Fn   func(ctx context.Context, cl *Cluster, key int64) error
+}
+
+// Cascade describes how to delete an entity, e.g. an account, with all
+// the data that depends on it.
+type Cascade struct {
+	// Tables are deleted in order in a single transaction on the shard
+	// owning the key, so dependent tables go first.
+	Tables []CascadeTable
+	// Cleanups are executed after the transaction is committed.
+	Cleanups []CascadeCleanup
+	// Shard returns the shard owning the key. Default is Cluster.Shard.
+	Shard func(key int64) *pg.DB
+	// MaxRetries is the number of times a failed cleanup is retried.
+	// Default is 3. -1 disables retries.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry. It doubles with
+	// every retry. Default is 100ms.
+	RetryBackoff time.Duration
+	// Audit, if not nil, receives the outcome of every cascade delete.
+	Audit func(ctx context.Context, res *CascadeResult)
+}
+
+// CascadeCleanupResult is the outcome of a cleanup.
+type CascadeCleanupResult struct {
+	Name     string
+	Attempts int
+	Err      error
+}
+
+// CascadeResult is the outcome of a cascade delete.
+type CascadeResult struct {
+	Model string
+	Key   int64
+	Time  time.Time
+	// Deleted is the number of rows deleted from every table. It is empty
+	// when the transaction is rolled back.
+	Deleted  map[string]int
+	Err      error
+	Cleanups []CascadeCleanupResult
+}
+
+// Complete reports whether the delete and all cleanups succeeded.
+func (res *CascadeResult) Complete() bool {
+	if res.Err != nil {
+		return false
+	}
+	for i := range res.Cleanups {
+		if res.Cleanups[i].Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// SetCascade registers the cascade for the model. Passing nil
+// removes the cascade.
+func (cl *Cluster) SetCascade(model string, c *Cascade) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if c == nil {
+		delete(cl.cascades, model)
+		return
+	}
+	if cl.cascades == nil {
+		cl.cascades = make(map[string]*Cascade)
+	}
+	cl.cascades[model] = c
+}
+
+// CascadeDelete deletes rows depending on the key using the cascade
+// registered for the model. Rows on the owning shard are deleted
+// transactionally and the returned error is the error of that transaction.
+// Cleanups are best-effort: they are retried and their failures are
+// reported in the result and to the Audit func.
+func (cl *Cluster) CascadeDelete(ctx context.Context, model string, key int64) (*CascadeResult, error) {
+	cl.mu.RLock()
+	c := cl.cascades[model]
+	cl.mu.RUnlock()
+	if c == nil {
+		return nil, errors.New("sharding: no cascade for model " + strconv.Quote(model))
+	}
+
+	res := &CascadeResult{
+		Model:   model,
+		Key:     key,
+		Time:    time.Now(),
+		Deleted: make(map[string]int),
+	}
+
+	shard := cl.Shard(key)
+	if c.Shard != nil {
+		shard = c.Shard(key)
+	}
+
+	// Counts are reported only when the transaction is committed.
+	deleted := make(map[string]int, len(c.Tables))
+	res.Err = shard.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		for _, t := range c.Tables {
+			r, err := tx.ExecContext(ctx, "DELETE FROM ?SHARD.? WHERE ? = ?",
+				pg.Ident(t.Table), pg.Ident(t.Column), key)
+			if err != nil {
+				return err
+			}
+			deleted[t.Table] = r.RowsAffected()
+		}
+		return nil
+	})
+	res.Err = WrapShardError(shard, res.Err)
+	if res.Err == nil {
+		res.Deleted = deleted
+		for i := range c.Cleanups {
+			res.Cleanups = append(res.Cleanups, c.cleanup(ctx, cl, &c.Cleanups[i], key))
+		}
+	}
+
+	if c.Audit != nil {
+		c.Audit(ctx, res)
+	}
+	return res, res.Err
+}
+
+func (c *Cascade) cleanup(
+	ctx context.Context, cl *Cluster, cleanup *CascadeCleanup, key int64,
+) CascadeCleanupResult {
+	maxRetries := c.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = 3
+	} else if maxRetries < 0 {
+		maxRetries = 0
+	}
+	backoff := c.RetryBackoff
+	if backoff == 0 {
+		backoff = 100 * time.Millisecond
+	}
+
+	res := CascadeCleanupResult{
+		Name: cleanup.Name,
+	}
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return res
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		res.Attempts++
+		res.Err = cleanup.Fn(ctx, cl, key)
+		if res.Err == nil {
+			break
+		}
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CascadeDelete", func() {
+	var cluster *shardingtest.Cluster
+	var audited []*sharding.CascadeResult
+	var attempts int
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+		audited = nil
+		attempts = 0
+
+		cluster.SetCascade("account", &sharding.Cascade{
+			Tables: []sharding.CascadeTable{
+				{Table: "comments", Column: "account_id"},
+				{Table: "accounts", Column: "id"},
+			},
+			Cleanups: []sharding.CascadeCleanup{{
+				Name: "directory",
+				Fn: func(ctx context.Context, cl *sharding.Cluster, key int64) error {
+					attempts++
+					if attempts == 1 {
+						return errors.New("directory is down")
+					}
+					_, err := cl.Shard(0).ExecContext(ctx, "DELETE FROM ?SHARD.directory WHERE key = ?", key)
+					return err
+				},
+			}},
+			RetryBackoff: time.Millisecond,
+			Audit: func(_ context.Context, res *sharding.CascadeResult) {
+				audited = append(audited, res)
+			},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("deletes rows on the owning shard and runs cleanups", func() {
+		cluster.SetResult(1, "comments", &shardingtest.Result{
+			Tag:          "DELETE",
+			RowsAffected: 3,
+		})
+
+		res, err := cluster.CascadeDelete(ctx, "account", 5)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Complete()).To(BeTrue())
+		Expect(res.Deleted).To(Equal(map[string]int{"comments": 3, "accounts": 0}))
+		Expect(res.Cleanups).To(Equal([]sharding.CascadeCleanupResult{{
+			Name:     "directory",
+			Attempts: 2,
+		}}))
+		Expect(audited).To(Equal([]*sharding.CascadeResult{res}))
+
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"BEGIN",
+			`DELETE FROM shard1."comments" WHERE "account_id" = 5`,
+			`DELETE FROM shard1."accounts" WHERE "id" = 5`,
+			"COMMIT",
+		}))
+		Expect(cluster.Queries(0)).To(Equal([]string{
+			"DELETE FROM shard0.directory WHERE key = 5",
+		}))
+	})
+
+	It("skips cleanups when the transaction fails", func() {
+		cluster.SetResult(1, "comments", &shardingtest.Result{
+			Tag:          "DELETE",
+			RowsAffected: 3,
+		})
+		cluster.SetQueryError(1, "accounts", &shardingtest.Error{Message: "locked"})
+
+		res, err := cluster.CascadeDelete(ctx, "account", 5)
+		Expect(err).To(MatchError("sharding: shard 1 (shardingtest1): ERROR #XX000 locked"))
+		Expect(res.Complete()).To(BeFalse())
+		Expect(res.Deleted).To(BeEmpty())
+		Expect(res.Cleanups).To(BeEmpty())
+		Expect(attempts).To(Equal(0))
+		Expect(audited).To(HaveLen(1))
+	})
+
+	It("requires a registered cascade", func() {
+		_, err := cluster.CascadeDelete(ctx, "user", 5)
+		Expect(err).To(MatchError(`sharding: no cascade for model "user"`))
+	})
+})
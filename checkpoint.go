@@ -0,0 +1,171 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// CheckpointStore persists shards completed by jobs run with
+// ForEachShardResumable.
+type CheckpointStore interface {
+	// Completed returns ids of the shards completed by the job.
+	Completed(ctx context.Context, jobID string) ([]int64, error)
+	// Complete records that the job completed the shard.
+	Complete(ctx context.Context, jobID string, shardID int64) error
+	// Reset forgets the shards completed by the job so it can run again.
+	Reset(ctx context.Context, jobID string) error
+}
+
+// ForEachShardResumable is like ForEachShardContext, but records shards
+// on which the fn returned nil in the store under the job id and skips
+// shards the job completed before, e.g. so a backfill that crashed
+// restarts on the remaining shards. Rerunning a completed job does
+// nothing until it is reset with CheckpointStore.Reset. The fn should
+// be idempotent because a shard is processed again when the process
+// crashes before the shard is recorded. Progress counts only the remaining
+// shards.
+func (cl *Cluster) ForEachShardResumable(
+	ctx context.Context,
+	jobID string,
+	store CheckpointStore,
+	opt *ForEachOptions,
+	fn func(ctx context.Context, shard *pg.DB) error,
+) error {
+	completed, err := store.Completed(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("sharding: can't load checkpoints of job %q: %w", jobID, err)
+	}
+
+	done := make([]bool, cl.nshards)
+	for _, id := range completed {
+		if id >= 0 && id < int64(cl.nshards) {
+			done[id] = true
+		}
+	}
+	ids := make([]int, 0, cl.nshards)
+	for id := range done {
+		if !done[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	return cl.topology().forEachShard(ctx, ids, opt, func(ctx context.Context, shard *pg.DB) error {
+		if err := fn(ctx, shard); err != nil {
+			return err
+		}
+		shardID := shard.Param("SHARD_ID").(int64)
+		if err := store.Complete(ctx, jobID, shardID); err != nil {
+			return fmt.Errorf("sharding: can't checkpoint shard %d of job %q: %w", shardID, jobID, err)
+		}
+		return nil
+	})
+}
+
+//------------------------------------------------------------------------------
+
+// MemoryCheckpointStore is a CheckpointStore that keeps checkpoints in
+// memory, e.g. for tests.
+type MemoryCheckpointStore struct {
+	mu   sync.Mutex
+	jobs map[string]map[int64]struct{}
+}
+
+var _ CheckpointStore = (*MemoryCheckpointStore)(nil)
+
+// NewMemoryCheckpointStore returns an empty store.
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{
+		jobs: make(map[string]map[int64]struct{}),
+	}
+}
+
+func (s *MemoryCheckpointStore) Completed(_ context.Context, jobID string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int64, 0, len(s.jobs[jobID]))
+	for id := range s.jobs[jobID] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (s *MemoryCheckpointStore) Complete(_ context.Context, jobID string, shardID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shards, ok := s.jobs[jobID]
+	if !ok {
+		shards = make(map[int64]struct{})
+		s.jobs[jobID] = shards
+	}
+	shards[shardID] = struct{}{}
+	return nil
+}
+
+func (s *MemoryCheckpointStore) Reset(_ context.Context, jobID string) error {
+	s.mu.Lock()
+	delete(s.jobs, jobID)
+	s.mu.Unlock()
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// PGCheckpointStore is a CheckpointStore that keeps checkpoints in
+// a PostgreSQL table with job_id, shard_id, and completed_at columns.
+type PGCheckpointStore struct {
+	db    *pg.DB
+	table string
+}
+
+var _ CheckpointStore = (*PGCheckpointStore)(nil)
+
+// NewPGCheckpointStore returns a store that uses the table in the db.
+// The db is usually a shard of the cluster dedicated to directory data,
+// in which case the table can be qualified with ?SHARD, e.g.
+// "?SHARD.checkpoints". The table name is not escaped.
+func NewPGCheckpointStore(db *pg.DB, table string) *PGCheckpointStore {
+	return &PGCheckpointStore{
+		db:    db,
+		table: table,
+	}
+}
+
+// CreateTable creates the checkpoints table.
+func (s *PGCheckpointStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+s.table+` (
+			job_id text NOT NULL,
+			shard_id bigint NOT NULL,
+			completed_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (job_id, shard_id)
+		)
+	`)
+	return err
+}
+
+func (s *PGCheckpointStore) Completed(ctx context.Context, jobID string) ([]int64, error) {
+	var ids []int64
+	_, err := s.db.QueryContext(ctx, &ids,
+		"SELECT shard_id FROM "+s.table+" WHERE job_id = ? ORDER BY shard_id", jobID)
+	return ids, err
+}
+
+func (s *PGCheckpointStore) Complete(ctx context.Context, jobID string, shardID int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO `+s.table+` (job_id, shard_id) VALUES (?, ?)
+		ON CONFLICT (job_id, shard_id) DO NOTHING
+	`, jobID, shardID)
+	return err
+}
+
+func (s *PGCheckpointStore) Reset(ctx context.Context, jobID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM "+s.table+" WHERE job_id = ?", jobID)
+	return err
+}
@@ -0,0 +1,97 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ForEachShardResumable", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	run := func(store sharding.CheckpointStore, failShard int64) ([]int64, error) {
+		var mu sync.Mutex
+		var ids []int64
+		err := cluster.ForEachShardResumable(ctx, "backfill", store, &sharding.ForEachOptions{
+			ContinueOnError: true,
+		}, func(ctx context.Context, shard *pg.DB) error {
+			shardID := shard.Param("SHARD_ID").(int64)
+			mu.Lock()
+			ids = append(ids, shardID)
+			mu.Unlock()
+			if shardID == failShard {
+				return errors.New("backfill failed")
+			}
+			return nil
+		})
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids, err
+	}
+
+	It("resumes on shards that were not completed", func() {
+		store := sharding.NewMemoryCheckpointStore()
+
+		ids, err := run(store, 2)
+		Expect(err).To(MatchError("backfill failed"))
+		Expect(ids).To(Equal([]int64{0, 1, 2, 3}))
+		Expect(store.Completed(ctx, "backfill")).To(Equal([]int64{0, 1, 3}))
+
+		ids, err = run(store, -1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids).To(Equal([]int64{2}))
+
+		ids, err = run(store, -1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids).To(BeEmpty())
+
+		Expect(store.Reset(ctx, "backfill")).NotTo(HaveOccurred())
+		ids, err = run(store, -1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids).To(Equal([]int64{0, 1, 2, 3}))
+	})
+
+	It("uses PostgreSQL table", func() {
+		store := sharding.NewPGCheckpointStore(cluster.Shard(0), "?SHARD.checkpoints")
+		cluster.SetResult(0, "SELECT shard_id", &shardingtest.Result{
+			Columns: []string{"shard_id"},
+			Rows:    [][]interface{}{{0}, {1}, {3}},
+		})
+
+		ids, err := run(store, -1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids).To(Equal([]int64{2}))
+
+		queries := cluster.Queries(0)
+		Expect(queries).To(HaveLen(2))
+		Expect(queries[0]).To(Equal(
+			"SELECT shard_id FROM shard0.checkpoints WHERE job_id = 'backfill' ORDER BY shard_id"))
+		Expect(queries[1]).To(ContainSubstring(
+			"INSERT INTO shard0.checkpoints (job_id, shard_id) VALUES ('backfill', 2)"))
+	})
+
+	It("fails when the shard can't be checkpointed", func() {
+		store := sharding.NewPGCheckpointStore(cluster.Shard(0), "?SHARD.checkpoints")
+		cluster.SetQueryError(0, "INSERT INTO", &shardingtest.Error{Message: "disk full"})
+
+		_, err := run(store, -1)
+		Expect(err).To(MatchError(ContainSubstring(`sharding: can't checkpoint shard`)))
+		Expect(err).To(MatchError(ContainSubstring("disk full")))
+	})
+})
@@ -0,0 +1,89 @@
+package sharding
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// KeyRange limits ChecksumTable to rows with Min <= Column < Max.
+type KeyRange struct {
+	Column string
+	Min    int64
+	Max    int64
+}
+
+// TableChecksum is the checksum of a table on a shard.
+type TableChecksum struct {
+	ShardID int64
+	DBAddr  string
+	Rows    int64
+	// Checksum is the md5 of the md5 hashes of the rows in the text
+	// representation. Tables with the same rows have the same checksum.
+	Checksum string
+	Err      error
+}
+
+// ChecksumReport is the result of ChecksumTable ordered by shard id.
+type ChecksumReport struct {
+	Table  string
+	Shards []TableChecksum
+}
+
+// Diff returns the ids of the shards that have a different number of rows
+// or checksum in the other report, e.g. computed on another cluster after
+// a migration. Shards that failed in either report are also returned.
+func (r *ChecksumReport) Diff(other *ChecksumReport) []int64 {
+	var ids []int64
+	for i := range r.Shards {
+		a := &r.Shards[i]
+		if i >= len(other.Shards) {
+			ids = append(ids, a.ShardID)
+			continue
+		}
+		b := &other.Shards[i]
+		if a.Err != nil || b.Err != nil || a.Rows != b.Rows || a.Checksum != b.Checksum {
+			ids = append(ids, a.ShardID)
+		}
+	}
+	return ids
+}
+
+// ChecksumTable concurrently computes the number of rows and the checksum
+// of the table on every shard, e.g. ChecksumTable(ctx, "users", nil). The
+// keyRange, if not nil, limits the rows. Checksums read the whole table
+// range so they should be computed on replicas or off-peak. The returned
+// error is the first shard error.
+func (cl *Cluster) ChecksumTable(ctx context.Context, table string, keyRange *KeyRange) (*ChecksumReport, error) {
+	report := &ChecksumReport{
+		Table:  table,
+		Shards: make([]TableChecksum, cl.nshards),
+	}
+
+	query := `
+		SELECT count(*), coalesce(md5(string_agg(md5(t::text), '' ORDER BY md5(t::text))), '')
+		FROM ?SHARD.? AS t`
+	params := []interface{}{pg.Ident(table)}
+	if keyRange != nil {
+		query += " WHERE t.? >= ? AND t.? < ?"
+		col := pg.Ident(keyRange.Column)
+		params = append(params, col, keyRange.Min, col, keyRange.Max)
+	}
+
+	err := cl.ForEachShardContext(ctx, &ForEachOptions{
+		ContinueOnError: true,
+	}, func(ctx context.Context, shard *pg.DB) error {
+		shardID := shard.Param("SHARD_ID").(int64)
+		c := &report.Shards[shardID]
+		c.ShardID = shardID
+		c.DBAddr = shard.Options().Addr
+
+		_, err := shard.QueryOneContext(ctx, pg.Scan(&c.Rows, &c.Checksum), query, params...)
+		if err != nil {
+			c.Err = WrapShardError(shard, err)
+			return c.Err
+		}
+		return nil
+	})
+	return report, err
+}
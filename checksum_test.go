@@ -0,0 +1,61 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChecksumTable", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(3)
+		cluster.SetResult(shardingtest.AllShards, "md5", &shardingtest.Result{
+			Columns: []string{"count", "md5"},
+			Rows:    [][]interface{}{{10, "abc"}},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("computes checksums of every shard", func() {
+		report, err := cluster.ChecksumTable(ctx, "users", &sharding.KeyRange{
+			Column: "id",
+			Min:    100,
+			Max:    200,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Shards).To(HaveLen(3))
+		Expect(report.Shards[1]).To(Equal(sharding.TableChecksum{
+			ShardID:  1,
+			DBAddr:   "shardingtest1",
+			Rows:     10,
+			Checksum: "abc",
+		}))
+
+		queries := cluster.Queries(1)
+		Expect(queries).To(HaveLen(1))
+		Expect(queries[0]).To(ContainSubstring(`FROM shard1."users" AS t WHERE t."id" >= 100 AND t."id" < 200`))
+	})
+
+	It("diffs reports", func() {
+		before, err := cluster.ChecksumTable(ctx, "users", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		cluster.SetResult(2, "md5", &shardingtest.Result{
+			Columns: []string{"count", "md5"},
+			Rows:    [][]interface{}{{10, "def"}},
+		})
+		cluster.SetError(0, &shardingtest.Error{Message: "fake error"})
+
+		after, err := cluster.ChecksumTable(ctx, "users", nil)
+		Expect(err).To(MatchError("sharding: shard 0 (shardingtest0): ERROR #XX000 fake error"))
+		Expect(before.Diff(after)).To(Equal([]int64{0, 2}))
+		Expect(before.Diff(before)).To(BeEmpty())
+	})
+})
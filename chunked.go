@@ -0,0 +1,86 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ExecChunkedOptions configures ExecChunked.
+type ExecChunkedOptions struct {
+	// Concurrency is the number of shards processed concurrently on every
+	// database server. Default is AutoConcurrency.
+	Concurrency int
+	// Pause is the delay between chunks on a shard that lets other
+	// queries take the locks released by the previous chunk.
+	Pause time.Duration
+	// Progress, if not nil, is called after every chunk with the shard id,
+	// the number of rows affected by the chunk, and the total number of
+	// rows affected on the shard. Calls are serialized.
+	Progress func(shardID int64, affected, total int)
+}
+
+// ExecChunked executes the UPDATE or DELETE query on every shard in
+// chunks of chunkSize rows until a chunk affects no rows, which keeps
+// transactions and row locks short. ?LIMIT in the query is substituted
+// with the chunkSize, e.g.
+//
+//	DELETE FROM ?SHARD.events WHERE id IN (
+//		SELECT id FROM ?SHARD.events WHERE created_at < ? LIMIT ?LIMIT
+//	)
+//
+// The query must eventually stop matching rows it has already processed
+// or ExecChunked never returns. It returns the total number of affected
+// rows on all shards.
+func (cl *Cluster) ExecChunked(
+	ctx context.Context, query string, chunkSize int, opt *ExecChunkedOptions, params ...interface{},
+) (int, error) {
+	if chunkSize <= 0 {
+		return 0, fmt.Errorf("sharding: chunk size must be positive, got %d", chunkSize)
+	}
+	if opt == nil {
+		opt = new(ExecChunkedOptions)
+	}
+
+	var total int64
+	var progressMu sync.Mutex
+	err := cl.ForEachShardContext(ctx, &ForEachOptions{
+		Concurrency: opt.Concurrency,
+	}, func(ctx context.Context, shard *pg.DB) error {
+		shardID := shard.Param("SHARD_ID").(int64)
+		shard = shard.WithParam("LIMIT", chunkSize)
+
+		var shardTotal int
+		for {
+			res, err := shard.ExecContext(ctx, query, params...)
+			if err != nil {
+				return WrapShardError(shard, err)
+			}
+
+			affected := res.RowsAffected()
+			shardTotal += affected
+			atomic.AddInt64(&total, int64(affected))
+			if opt.Progress != nil {
+				progressMu.Lock()
+				opt.Progress(shardID, affected, shardTotal)
+				progressMu.Unlock()
+			}
+			if affected == 0 {
+				return nil
+			}
+
+			if opt.Pause > 0 {
+				select {
+				case <-time.After(opt.Pause):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	})
+	return int(total), err
+}
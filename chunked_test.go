@@ -0,0 +1,65 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExecChunked", func() {
+	const query = `DELETE FROM ?SHARD.events WHERE id IN (
+		SELECT id FROM ?SHARD.events WHERE kind = ? LIMIT ?LIMIT)`
+
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("executes chunks until no rows are affected", func() {
+		cluster.SetResult(shardingtest.AllShards, "DELETE", &shardingtest.Result{
+			Tag:          "DELETE",
+			RowsAffected: 100,
+		})
+
+		totals := make(map[int64]int)
+		n, err := cluster.ExecChunked(ctx, query, 100, &sharding.ExecChunkedOptions{
+			Concurrency: 1,
+			Progress: func(shardID int64, affected, total int) {
+				totals[shardID] = total
+				// Shard 0 has 200 rows and shard 1 has 100.
+				if total == 200 || shardID == 1 {
+					cluster.SetResult(shardID, "DELETE", &shardingtest.Result{
+						Tag: "DELETE",
+					})
+				}
+			},
+		}, "click")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(300))
+		Expect(totals).To(Equal(map[int64]int{0: 200, 1: 100}))
+
+		queries := cluster.Queries(0)
+		Expect(queries).To(HaveLen(3))
+		Expect(queries[0]).To(ContainSubstring("WHERE kind = 'click' LIMIT 100)"))
+		Expect(cluster.Queries(1)).To(HaveLen(2))
+	})
+
+	It("returns shard errors", func() {
+		cluster.SetQueryError(1, "DELETE", &shardingtest.Error{Message: "deadlock"})
+
+		_, err := cluster.ExecChunked(ctx, query, 100, nil, "click")
+		Expect(err).To(MatchError("sharding: shard 1 (shardingtest1): ERROR #XX000 deadlock"))
+	})
+
+	It("rejects invalid chunk size", func() {
+		_, err := cluster.ExecChunked(ctx, query, 0, nil, "click")
+		Expect(err).To(MatchError("sharding: chunk size must be positive, got 0"))
+	})
+})
@@ -0,0 +1,389 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// CloneOptions configures CloneShard.
+type CloneOptions struct {
+	// Include, if not empty, lists the tables to clone. Default is every
+	// table of the shard.
+	Include []string
+	// Exclude lists the tables that are not cloned, e.g. large logs.
+	Exclude []string
+	// SchemaOnly creates tables and sequences without copying rows.
+	SchemaOnly bool
+	// Sample, if between 0 and 1, copies approximately the fraction of rows
+	// of every table using TABLESAMPLE BERNOULLI. Foreign keys are created
+	// NOT VALID because sampled rows can reference rows that were not
+	// sampled.
+	Sample float64
+}
+
+// ClonedTable is a table copied by CloneShard.
+type ClonedTable struct {
+	Table string
+	Rows  int
+}
+
+// CloneResult is the outcome of CloneShard.
+type CloneResult struct {
+	SrcShardID int64
+	DstShardID int64
+	Tables     []ClonedTable // ordered by name
+}
+
+// cloneColumn is a column definition read from the source shard.
+type cloneColumn struct {
+	Name    string
+	Type    string
+	NotNull bool
+	Default string
+}
+
+// cloneTable is a table definition read from the source shard.
+type cloneTable struct {
+	name        string
+	columns     []cloneColumn
+	constraints []string // ALTER TABLE ... ADD CONSTRAINT clauses
+	foreignKeys []string
+	indexes     []string // CREATE INDEX statements
+}
+
+// CloneShard copies tables, sequences, and rows of the shard srcID into
+// the shard dstID of the dst cluster, e.g. a staging cluster, streaming
+// rows with COPY. The source is read in a single REPEATABLE READ
+// transaction and the destination is written in a single transaction,
+// so a failed clone leaves no tables behind. Cloned tables must not exist
+// in the destination shard. Functions, views, and triggers are not cloned;
+// functions used by column defaults, e.g. ?SHARD.next_id(), must be
+// installed in the destination shard beforehand.
+func (cl *Cluster) CloneShard(
+	ctx context.Context, srcID int64, dst *Cluster, dstID int64, opt *CloneOptions,
+) (*CloneResult, error) {
+	if opt == nil {
+		opt = new(CloneOptions)
+	}
+	if opt.Sample < 0 || opt.Sample > 1 {
+		return nil, fmt.Errorf("sharding: sample must be between 0 and 1, got %v", opt.Sample)
+	}
+	if err := cl.checkShardIDRange(ShardID(srcID)); err != nil {
+		return nil, err
+	}
+	if err := dst.checkShardIDRange(ShardID(dstID)); err != nil {
+		return nil, err
+	}
+
+	src := cl.shardByID(srcID)
+	dstShard := dst.shardByID(dstID)
+	res := &CloneResult{
+		SrcShardID: srcID,
+		DstShardID: dstID,
+	}
+
+	err := src.RunInTransaction(ctx, func(srcTx *pg.Tx) error {
+		_, err := srcTx.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+		if err != nil {
+			return WrapShardError(src, err)
+		}
+
+		tables, err := cloneTables(ctx, srcTx, opt)
+		if err != nil {
+			return WrapShardError(src, err)
+		}
+		seqs, err := cloneSequences(ctx, srcTx)
+		if err != nil {
+			return WrapShardError(src, err)
+		}
+
+		rewrite := schemaRewriter(shardSchema(src), shardSchema(dstShard))
+		err = dstShard.RunInTransaction(ctx, func(dstTx *pg.Tx) error {
+			res.Tables, err = cloneInto(ctx, srcTx, dstTx, tables, seqs, rewrite, opt)
+			return err
+		})
+		return WrapShardError(dstShard, err)
+	})
+
+	auditErr := cl.audit(ctx, "clone_shard", map[string]interface{}{
+		"src_shard_id": srcID,
+		"dst_shard_id": dstID,
+		"dst_db_addr":  dstShard.Options().Addr,
+		"schema_only":  opt.SchemaOnly,
+		"sample":       opt.Sample,
+	}, err)
+	if err != nil {
+		return nil, err
+	}
+	return res, auditErr
+}
+
+func cloneTables(ctx context.Context, tx *pg.Tx, opt *CloneOptions) ([]*cloneTable, error) {
+	var names []string
+	_, err := tx.QueryContext(ctx, &names, `
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = '?SHARD' AND table_type = 'BASE TABLE'
+		ORDER BY table_name
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []*cloneTable
+	for _, name := range names {
+		if len(opt.Include) > 0 && !containsString(opt.Include, name) {
+			continue
+		}
+		if containsString(opt.Exclude, name) {
+			continue
+		}
+
+		t := &cloneTable{name: name}
+		if err := t.load(ctx, tx); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// load reads the definition of the table.
+func (t *cloneTable) load(ctx context.Context, tx *pg.Tx) error {
+	const relid = `(quote_ident('?SHARD') || '.' || quote_ident(?0))::regclass`
+
+	_, err := tx.QueryContext(ctx, &t.columns, `
+		SELECT a.attname AS name, format_type(a.atttypid, a.atttypmod) AS type,
+			a.attnotnull AS not_null, coalesce(pg_get_expr(d.adbin, d.adrelid), '') AS default
+		FROM pg_attribute AS a
+		LEFT JOIN pg_attrdef AS d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = `+relid+` AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum
+	`, t.name)
+	if err != nil {
+		return err
+	}
+
+	var constraints []cloneConstraint
+	_, err = tx.QueryContext(ctx, &constraints, `
+		SELECT conname AS name, contype AS type, pg_get_constraintdef(oid) AS def
+		FROM pg_constraint
+		WHERE conrelid = `+relid+`
+		ORDER BY contype = 'f', conname
+	`, t.name)
+	if err != nil {
+		return err
+	}
+	for _, c := range constraints {
+		clause := "ADD CONSTRAINT " + quoteIdent(c.Name) + " " + c.Def
+		if c.Type == "f" {
+			t.foreignKeys = append(t.foreignKeys, clause)
+		} else {
+			t.constraints = append(t.constraints, clause)
+		}
+	}
+
+	// Indexes that back constraints are created by the constraints.
+	_, err = tx.QueryContext(ctx, &t.indexes, `
+		SELECT pg_get_indexdef(i.indexrelid)
+		FROM pg_index AS i
+		WHERE i.indrelid = `+relid+`
+		AND NOT EXISTS (SELECT 1 FROM pg_constraint AS c WHERE c.conindid = i.indexrelid)
+		ORDER BY i.indexrelid
+	`, t.name)
+	return err
+}
+
+type cloneConstraint struct {
+	Name string
+	Type string
+	Def  string
+}
+
+type cloneSequence struct {
+	Name      string
+	LastValue *int64
+}
+
+func cloneSequences(ctx context.Context, tx *pg.Tx) ([]cloneSequence, error) {
+	var seqs []cloneSequence
+	_, err := tx.QueryContext(ctx, &seqs, `
+		SELECT sequencename AS name, last_value
+		FROM pg_sequences
+		WHERE schemaname = '?SHARD'
+		ORDER BY sequencename
+	`)
+	return seqs, err
+}
+
+func cloneInto(
+	ctx context.Context,
+	srcTx, dstTx *pg.Tx,
+	tables []*cloneTable,
+	seqs []cloneSequence,
+	rewrite func(string) string,
+	opt *CloneOptions,
+) ([]ClonedTable, error) {
+	if _, err := dstTx.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS ?SHARD"); err != nil {
+		return nil, err
+	}
+
+	// Sequences go first because column defaults use them.
+	for _, seq := range seqs {
+		if _, err := dstTx.ExecContext(ctx, "CREATE SEQUENCE IF NOT EXISTS ?SHARD.?",
+			pg.Ident(seq.Name)); err != nil {
+			return nil, err
+		}
+		if seq.LastValue != nil {
+			if _, err := dstTx.ExecContext(ctx, "SELECT setval('?SHARD.?', ?)",
+				pg.Ident(seq.Name), *seq.LastValue); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cloned := make([]ClonedTable, 0, len(tables))
+	for _, t := range tables {
+		if _, err := dstTx.ExecContext(ctx, t.createQuery(rewrite)); err != nil {
+			return nil, err
+		}
+
+		var rows int
+		if !opt.SchemaOnly {
+			var err error
+			rows, err = cloneRows(ctx, srcTx, dstTx, t.name, opt.Sample)
+			if err != nil {
+				return nil, err
+			}
+		}
+		cloned = append(cloned, ClonedTable{
+			Table: t.name,
+			Rows:  rows,
+		})
+	}
+
+	// Constraints and indexes are created after rows are copied, which is
+	// faster, and foreign keys after all tables exist.
+	for _, t := range tables {
+		for _, c := range t.constraints {
+			if _, err := dstTx.ExecContext(ctx, "ALTER TABLE ?SHARD.? "+rewrite(c),
+				pg.Ident(t.name)); err != nil {
+				return nil, err
+			}
+		}
+		for _, index := range t.indexes {
+			if _, err := dstTx.ExecContext(ctx, rewrite(index)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, t := range tables {
+		for _, fk := range t.foreignKeys {
+			query := "ALTER TABLE ?SHARD.? " + rewrite(fk)
+			if opt.Sample > 0 && opt.Sample < 1 {
+				query += " NOT VALID"
+			}
+			if _, err := dstTx.ExecContext(ctx, query, pg.Ident(t.name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return cloned, nil
+}
+
+func (t *cloneTable) createQuery(rewrite func(string) string) string {
+	var b strings.Builder
+	b.WriteString("CREATE TABLE ?SHARD.")
+	b.WriteString(quoteIdent(t.name))
+	b.WriteString(" (")
+	for i, c := range t.columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteIdent(c.Name))
+		b.WriteString(" ")
+		b.WriteString(c.Type)
+		if c.NotNull {
+			b.WriteString(" NOT NULL")
+		}
+		if c.Default != "" {
+			b.WriteString(" DEFAULT ")
+			b.WriteString(rewrite(c.Default))
+		}
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// cloneRows streams rows of the table from the source to the destination.
+func cloneRows(ctx context.Context, srcTx, dstTx *pg.Tx, table string, sample float64) (int, error) {
+	query := "COPY (SELECT * FROM ?SHARD.?"
+	params := []interface{}{pg.Ident(table)}
+	if sample > 0 && sample < 1 {
+		query += " TABLESAMPLE BERNOULLI (?)"
+		params = append(params, sample*100)
+	}
+	query += ") TO STDOUT"
+
+	pr, pw := io.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := srcTx.CopyTo(pw, query, params...)
+		_ = pw.CloseWithError(err)
+		errCh <- err
+	}()
+
+	res, err := dstTx.CopyFrom(pr, "COPY ?SHARD.? FROM STDIN", pg.Ident(table))
+	// Unblock the source when the destination fails.
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+	srcErr := <-errCh
+	if err != nil {
+		return 0, err
+	}
+	if srcErr != nil {
+		return 0, srcErr
+	}
+	return res.RowsAffected(), nil
+}
+
+// schemaRewriter returns a func that replaces references to objects
+// in the src schema with references to the dst schema in SQL returned
+// by pg_get_* functions.
+func schemaRewriter(src, dst string) func(string) string {
+	if src == dst {
+		return func(s string) string { return s }
+	}
+	re := regexp.MustCompile(`(^|[^\w$"])(` + regexp.QuoteMeta(src) + `|"` + regexp.QuoteMeta(src) + `")\.`)
+	ident := dst
+	if !simpleIdentRe.MatchString(dst) {
+		ident = quoteIdent(dst)
+	}
+	repl := "${1}" + strings.ReplaceAll(ident, "$", "$$") + "."
+	return func(s string) string {
+		return re.ReplaceAllString(s, repl)
+	}
+}
+
+// simpleIdentRe matches identifiers that PostgreSQL does not quote, except
+// reserved words.
+var simpleIdentRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// quoteIdent returns the quoted identifier.
+func quoteIdent(s string) string {
+	return string(types.AppendIdent(nil, s, 1))
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CloneShard", func() {
+	var src, dst *shardingtest.Cluster
+
+	BeforeEach(func() {
+		src = shardingtest.NewCluster(2)
+		dst = shardingtest.NewCluster(2)
+
+		src.SetResult(1, "information_schema.tables", &shardingtest.Result{
+			Columns: []string{"table_name"},
+			Rows:    [][]interface{}{{"logs"}, {"users"}},
+		})
+		src.SetResult(1, "pg_attribute", &shardingtest.Result{
+			Columns: []string{"name", "type", "not_null", "default"},
+			Rows: [][]interface{}{
+				{"id", "bigint", true, "nextval('shard1.users_id_seq'::regclass)"},
+				{"name", "text", false, ""},
+			},
+		})
+		src.SetResult(1, "pg_get_constraintdef", &shardingtest.Result{
+			Columns: []string{"name", "type", "def"},
+			Rows:    [][]interface{}{{"users_pkey", "p", "PRIMARY KEY (id)"}},
+		})
+		src.SetResult(1, "pg_get_indexdef", &shardingtest.Result{
+			Columns: []string{"pg_get_indexdef"},
+			Rows:    [][]interface{}{{"CREATE INDEX users_name_idx ON shard1.users USING btree (name)"}},
+		})
+		src.SetResult(1, "pg_sequences", &shardingtest.Result{
+			Columns: []string{"name", "last_value"},
+			Rows:    [][]interface{}{{"users_id_seq", 2}},
+		})
+		src.SetResult(1, "COPY (SELECT", &shardingtest.Result{
+			CopyData: "1\talice\n2\tbob\n",
+		})
+	})
+
+	AfterEach(func() {
+		Expect(src.Close()).NotTo(HaveOccurred())
+		Expect(dst.Close()).NotTo(HaveOccurred())
+	})
+
+	It("copies tables and rows", func() {
+		res, err := src.CloneShard(ctx, 1, dst.Cluster, 0, &sharding.CloneOptions{
+			Exclude: []string{"logs"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Tables).To(Equal([]sharding.ClonedTable{{Table: "users", Rows: 2}}))
+
+		Expect(src.Queries(1)).To(ContainElement(
+			`COPY (SELECT * FROM shard1."users") TO STDOUT`))
+		Expect(dst.Copied(0)).To(Equal("1\talice\n2\tbob\n"))
+		Expect(dst.Queries(0)).To(ContainElements(
+			`CREATE SCHEMA IF NOT EXISTS shard0`,
+			`CREATE SEQUENCE IF NOT EXISTS shard0."users_id_seq"`,
+			`SELECT setval('shard0."users_id_seq"', 2)`,
+			`CREATE TABLE shard0."users" ("id" bigint NOT NULL `+
+				`DEFAULT nextval('shard0.users_id_seq'::regclass), "name" text)`,
+			`COPY shard0."users" FROM STDIN`,
+			`ALTER TABLE shard0."users" ADD CONSTRAINT "users_pkey" PRIMARY KEY (id)`,
+			`CREATE INDEX users_name_idx ON shard0.users USING btree (name)`,
+			"COMMIT",
+		))
+	})
+
+	It("samples rows", func() {
+		_, err := src.CloneShard(ctx, 1, dst.Cluster, 0, &sharding.CloneOptions{
+			Include: []string{"users"},
+			Sample:  0.1,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src.Queries(1)).To(ContainElement(
+			`COPY (SELECT * FROM shard1."users" TABLESAMPLE BERNOULLI (10)) TO STDOUT`))
+	})
+
+	It("rolls back the destination on errors", func() {
+		dst.SetQueryError(0, "CREATE INDEX", &shardingtest.Error{Message: "boom"})
+
+		_, err := src.CloneShard(ctx, 1, dst.Cluster, 0, nil)
+		Expect(err).To(MatchError(ContainSubstring("boom")))
+		Expect(dst.Queries(0)).To(ContainElement("ROLLBACK"))
+	})
+
+	It("rejects shard ids out of range", func() {
+		_, err := src.CloneShard(ctx, 1, dst.Cluster, 2, nil)
+		Expect(err).To(MatchError(sharding.ErrShardIDOutOfRange))
+	})
+})
@@ -1,164 +1,633 @@
 package sharding
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-pg/pg/v10"
 )
 
 type shardInfo struct {
-	id    int
-	shard *pg.DB
-	dbInd int
+	id       int
+	shard    *pg.DB
+	dbInd    int
+	replicas []*pg.DB // the shard on the replicas of the db
 }
 
-// Cluster maps many (up to 2048) logical database shards implemented
-// using PostgreSQL schemas to far fewer physical PostgreSQL servers.
-type Cluster struct {
-	gen *IDGen
-
+// topology is an immutable snapshot of the shard assignment.
+type topology struct {
 	dbs     []*pg.DB
 	servers []*pg.DB // unique dbs
 
 	shards    []shardInfo
 	shardList []*pg.DB
+
+	inflight map[*pg.DB]*int64         // number of running queries per server
+	latency  map[*pg.DB]*serverLatency // query latencies per replica
+
+	sequential bool // see WithSequentialFanOut
 }
 
-// NewClusterWithGen returns new PostgreSQL cluster consisting of physical
-// dbs and running nshards logical shards.
-func NewClusterWithGen(dbs []*pg.DB, nshards int, gen *IDGen) *Cluster {
+// Cluster maps many (up to 2048) logical database shards implemented
+// using PostgreSQL schemas to far fewer physical PostgreSQL servers.
+type Cluster struct {
+	clusterConfig
+
+	stmts       stmtCache
+	shedAllowed uint64
+	listens     int64 // number of open ShardListeners
+	replicaNext uint64
+
+	topo   atomic.Value // *topology
+	topoMu sync.Mutex   // serializes topology updates
+
+	subclusters   atomic.Value // map[int][]*SubCluster indexed by size
+	subclustersMu sync.Mutex
+
+	mu        sync.RWMutex
+	listeners []*topologyListener
+	down      map[*pg.DB]struct{}
+	cascades  map[string]*Cascade
+}
+
+// clusterConfig is the configuration of a cluster set by NewClusterE
+// and Options. Clusters derived with withDBs copy it as a whole, so
+// state referenced by the config, e.g. shard stats, is shared.
+type clusterConfig struct {
+	gen       *IDGen
+	nshards   int
+	shardMod  divisor // nshards
+	placement Placement
+	strict    bool
+	strictIDs bool
+	scramble  bool
+	fastReads bool // pick replicas by latency
+	seqFanOut bool
+	nameFunc  func(id int64) string
+	labels    map[string][]int64  // sorted shard ids indexed by label
+	params    []customParam       // added with WithShardParam
+	replicas  map[*pg.DB][]*pg.DB // read replicas indexed by primary
+	optErr    error               // first error reported by an Option
+
+	onShardIDError func(err error)
+
+	tableCheck TableCheck
+	auditSink  AuditSink
+	shedPolicy ShedPolicy
+	quotas     *tenantQuotas
+	keys       KeyProvider
+	guards     []QueryGuard
+	fpBits     uint
+	idGens     *idGens
+	dualWrites *dualWrites
+	middleware *middlewareChain
+	detectors  *hotShardDetectors
+	debugLog   Logger
+	pgbouncer  bool
+
+	stats   []shardStats // indexed by shard id
+	latency *ewma
+	shedNow func() time.Time
+}
+
+// Option configures a Cluster.
+type Option func(cl *Cluster)
+
+// WithPlacement sets the strategy used to assign shards to databases.
+// The default is StickyPlacement, which is RoundRobinPlacement when
+// the cluster is created and moves as few shards as possible when
+// databases are added or removed.
+func WithPlacement(placement Placement) Option {
+	return func(cl *Cluster) {
+		cl.placement = placement
+	}
+}
+
+// WithStrictTopology requires the number of shards to be divisible by
+// the number of dbs so every db runs the same number of shards. By default
+// the remaining shards are spread so some dbs run one extra shard.
+func WithStrictTopology() Option {
+	return func(cl *Cluster) {
+		cl.strict = true
+	}
+}
+
+// WithShardNameFunc sets the func that returns the schema name of the
+// shard with the id, e.g. app1_shard_0003. ?SHARD is substituted with
+// the name. The default name is shard followed by the id, e.g. shard3.
+func WithShardNameFunc(fn func(id int64) string) Option {
+	return func(cl *Cluster) {
+		cl.nameFunc = fn
+	}
+}
+
+// WithSequentialFanOut makes methods that fan out to database servers,
+// e.g. ForEachDB and ForEachShard, process one server at a time and
+// ForEachShardContext process one shard at a time instead of spawning
+// goroutines per server, e.g. in tests or in environments with a few
+// connections and CPUs.
+func WithSequentialFanOut() Option {
+	return func(cl *Cluster) {
+		cl.seqFanOut = true
+	}
+}
+
+// ClusterOptions configures NewClusterE.
+type ClusterOptions struct {
+	// DBs are the physical database servers. A db can be listed several
+	// times to run proportionally more shards.
+	DBs []*pg.DB
+	// NumShards is the number of logical shards.
+	NumShards int
+	// IDGen is the generator of ids. Default is DefaultIDGen.
+	IDGen   *IDGen
+	Options []Option
+}
+
+// NewClusterE returns new PostgreSQL cluster consisting of physical dbs
+// and running logical shards or an error describing why the options
+// are invalid.
+func NewClusterE(opt *ClusterOptions) (*Cluster, error) {
+	gen := opt.IDGen
 	if gen == nil {
 		gen = DefaultIDGen
 	}
-	if len(dbs) == 0 {
-		panic("at least one db is required")
+	for i, db := range opt.DBs {
+		if db == nil {
+			return nil, fmt.Errorf("sharding: db %d is nil", i)
+		}
+	}
+	if opt.NumShards < 0 {
+		return nil, fmt.Errorf("sharding: number of shards must be positive, got %d", opt.NumShards)
+	}
+
+	cl := &Cluster{
+		clusterConfig: clusterConfig{
+			gen:       gen,
+			nshards:   opt.NumShards,
+			shardMod:  newDivisor(opt.NumShards),
+			placement: StickyPlacement,
+		},
+	}
+	for _, o := range opt.Options {
+		o(cl)
+	}
+	if cl.optErr != nil {
+		return nil, cl.optErr
+	}
+	if err := checkTopology(len(opt.DBs), cl.nshards, gen, cl.strict); err != nil {
+		return nil, err
+	}
+	if err := cl.checkShardNames(); err != nil {
+		return nil, err
+	}
+	if err := cl.checkShardLabels(); err != nil {
+		return nil, err
+	}
+	cl.stats = make([]shardStats, cl.nshards)
+	cl.latency = new(ewma)
+	cl.shedNow = time.Now
+	// Shards are not probed right after the cluster is created.
+	for i := range cl.stats {
+		cl.stats[i].last = cl.shedNow().UnixNano()
+	}
+	cl.idGens = &idGens{m: make(map[int64]*ShardIDGen)}
+	cl.dualWrites = new(dualWrites)
+	cl.middleware = new(middlewareChain)
+	cl.detectors = new(hotShardDetectors)
+
+	t, err := cl.newTopology(opt.DBs, nil)
+	if err != nil {
+		return nil, err
+	}
+	cl.topo.Store(t)
+
+	return cl, nil
+}
+
+// NewClusterWithGen returns new PostgreSQL cluster consisting of physical
+// dbs and running nshards logical shards. It panics if the arguments are
+// invalid; use NewClusterE to handle the error.
+func NewClusterWithGen(dbs []*pg.DB, nshards int, gen *IDGen, opts ...Option) *Cluster {
+	cl, err := NewClusterE(&ClusterOptions{
+		DBs:       dbs,
+		NumShards: nshards,
+		IDGen:     gen,
+		Options:   opts,
+	})
+	if err != nil {
+		panic(err.Error())
+	}
+	return cl
+}
+
+func NewCluster(dbs []*pg.DB, nshards int, opts ...Option) *Cluster {
+	return NewClusterWithGen(dbs, nshards, nil, opts...)
+}
+
+func checkTopology(ndbs, nshards int, gen *IDGen, strict bool) error {
+	if ndbs == 0 {
+		return errors.New("sharding: at least one db is required")
 	}
 	if nshards == 0 {
-		panic("at least one shard is required")
+		return errors.New("sharding: at least one shard is required")
 	}
-	if len(dbs) > gen.NumShards() || nshards > gen.NumShards() {
-		panic(fmt.Sprintf("too many shards"))
+	if ndbs > gen.NumShards() || nshards > gen.NumShards() {
+		return errors.New("sharding: too many shards")
 	}
-	if nshards < len(dbs) {
-		panic("number of shards must be greater or equal number of dbs")
+	if nshards < ndbs {
+		return errors.New("sharding: number of shards must be greater or equal number of dbs")
 	}
-	if nshards%len(dbs) != 0 {
-		panic("number of shards must be divideable by number of dbs")
+	if strict && nshards%ndbs != 0 {
+		return errors.New("sharding: number of shards must be divideable by number of dbs")
 	}
+	return nil
+}
 
-	cl := &Cluster{
-		gen:       gen,
+func (cl *Cluster) checkShardNames() error {
+	if cl.nameFunc == nil {
+		return nil
+	}
+	ids := make(map[string]int64, cl.nshards)
+	for id := int64(0); id < int64(cl.nshards); id++ {
+		name := cl.nameFunc(id)
+		if name == "" {
+			return fmt.Errorf("sharding: shard %d has empty name", id)
+		}
+		if other, ok := ids[name]; ok {
+			return fmt.Errorf("sharding: shard name %q is used by shards %d and %d", name, other, id)
+		}
+		ids[name] = id
+	}
+	return nil
+}
+
+func (cl *Cluster) newTopology(dbs []*pg.DB, prev *topology) (*topology, error) {
+	var prevInds []int
+	if prev != nil {
+		prevInds = make([]int, cl.nshards)
+		for i := range prev.shards {
+			prevInds[i] = dbIndex(dbs, prev.dbs, prev.shards[i].dbInd)
+		}
+	}
+	dbInds := cl.placement.Place(cl.nshards, len(dbs), prevInds)
+	if err := checkPlacement(dbInds, cl.nshards, len(dbs)); err != nil {
+		return nil, err
+	}
+	return cl.buildTopology(dbs, dbInds, prev), nil
+}
+
+// buildTopology assigns shards to the dbs with the indexes reusing
+// shards of the prev topology that stay on the same db.
+func (cl *Cluster) buildTopology(dbs []*pg.DB, dbInds []int, prev *topology) *topology {
+	t := &topology{
 		dbs:       dbs,
-		shards:    make([]shardInfo, nshards),
-		shardList: make([]*pg.DB, nshards),
+		shards:    make([]shardInfo, cl.nshards),
+		shardList: make([]*pg.DB, cl.nshards),
+		inflight:  make(map[*pg.DB]*int64),
+		latency:   make(map[*pg.DB]*serverLatency),
+
+		sequential: cl.seqFanOut,
 	}
-	cl.init()
 
-	return cl
+	for _, db := range dbs {
+		if _, ok := t.inflight[db]; ok {
+			continue
+		}
+		if prev != nil && prev.inflight[db] != nil {
+			t.inflight[db] = prev.inflight[db]
+		} else {
+			t.inflight[db] = new(int64)
+		}
+		t.servers = append(t.servers, db)
+	}
+
+	for i := 0; i < cl.nshards; i++ {
+		dbInd := dbInds[i]
+		db := dbs[dbInd]
+
+		var shard *pg.DB
+		if prev != nil && prev.dbs[prev.shards[i].dbInd] == db {
+			shard = prev.shards[i].shard
+		} else {
+			shard = cl.newShard(db, int64(i), t.inflight[db], nil)
+		}
+
+		t.shards[i] = shardInfo{
+			id:       i,
+			shard:    shard,
+			dbInd:    dbInd,
+			replicas: cl.replicaShards(t, prev, db, i),
+		}
+		t.shardList[i] = shard
+	}
+
+	return t
 }
 
-func NewCluster(dbs []*pg.DB, nshards int) *Cluster {
-	return NewClusterWithGen(dbs, nshards, nil)
+func checkPlacement(inds []int, nshards, ndbs int) error {
+	if len(inds) != nshards {
+		return fmt.Errorf("sharding: placement assigned %d shards, expected %d", len(inds), nshards)
+	}
+	for shardID, ind := range inds {
+		if ind < 0 || ind >= ndbs {
+			return fmt.Errorf("sharding: placement assigned shard %d to db %d out of %d dbs", shardID, ind, ndbs)
+		}
+	}
+	return nil
 }
 
-func (cl *Cluster) init() {
-	dbSet := make(map[*pg.DB]struct{})
-	for _, db := range cl.dbs {
-		if _, ok := dbSet[db]; ok {
-			continue
+// withDBs returns a cluster with the same configuration and shard
+// assignment that uses the db returned by the fn instead of every db.
+func (cl *Cluster) withDBs(fn func(db *pg.DB) *pg.DB) *Cluster {
+	t := cl.topology()
+
+	mapped := make(map[*pg.DB]*pg.DB, len(t.servers))
+	dbs := make([]*pg.DB, len(t.dbs))
+	for i, db := range t.dbs {
+		if _, ok := mapped[db]; !ok {
+			mapped[db] = fn(db)
+		}
+		dbs[i] = mapped[db]
+	}
+
+	inds := make([]int, len(t.shards))
+	for i := range t.shards {
+		inds[i] = t.shards[i].dbInd
+	}
+
+	cp := &Cluster{clusterConfig: cl.clusterConfig}
+	cp.replicas = make(map[*pg.DB][]*pg.DB, len(cl.replicas))
+	for primary, replicas := range cl.replicas {
+		mappedReplicas := make([]*pg.DB, len(replicas))
+		for i, replica := range replicas {
+			if _, ok := mapped[replica]; !ok {
+				mapped[replica] = fn(replica)
+			}
+			mappedReplicas[i] = mapped[replica]
 		}
-		dbSet[db] = struct{}{}
-		cl.servers = append(cl.servers, db)
+		cp.replicas[mapped[primary]] = mappedReplicas
 	}
 
-	for i := 0; i < len(cl.shards); i++ {
-		dbInd := i % len(cl.dbs)
-		shard := cl.newShard(cl.dbs[dbInd], int64(i))
-		cl.shards[i] = shardInfo{
-			id:    i,
-			shard: shard,
-			dbInd: dbInd,
+	// Registered listeners and cascades and the health state of the
+	// mapped dbs are carried over.
+	cl.mu.RLock()
+	cp.listeners = append(([]*topologyListener)(nil), cl.listeners...)
+	if len(cl.cascades) > 0 {
+		cp.cascades = make(map[string]*Cascade, len(cl.cascades))
+		for model, c := range cl.cascades {
+			cp.cascades[model] = c
+		}
+	}
+	for db := range cl.down {
+		if mappedDB, ok := mapped[db]; ok {
+			if cp.down == nil {
+				cp.down = make(map[*pg.DB]struct{})
+			}
+			cp.down[mappedDB] = struct{}{}
+		}
+	}
+	cl.mu.RUnlock()
+
+	// The copied assignment is always valid.
+	cp.placement = PlacementFunc(func(int, int, []int) []int {
+		return inds
+	})
+	topo, _ := cp.newTopology(dbs, nil)
+	cp.topo.Store(topo)
+	cp.placement = cl.placement
+
+	return cp
+}
+
+// dbIndex returns index of the db prevDBs[prevInd] in the dbs or -1.
+// The same index is preferred when the db is listed several times.
+func dbIndex(dbs, prevDBs []*pg.DB, prevInd int) int {
+	db := prevDBs[prevInd]
+	if prevInd < len(dbs) && dbs[prevInd] == db {
+		return prevInd
+	}
+	for i, d := range dbs {
+		if d == db {
+			return i
 		}
-		cl.shardList[i] = shard
 	}
+	return -1
+}
+
+func (cl *Cluster) topology() *topology {
+	return cl.topo.Load().(*topology)
 }
 
 func (cl *Cluster) IDGen() *IDGen {
 	return cl.gen
 }
 
-func (cl *Cluster) newShard(db *pg.DB, id int64) *pg.DB {
-	name := "shard" + strconv.FormatInt(id, 10)
-	return db.
+func shardName(id int64) string {
+	return "shard" + strconv.FormatInt(id, 10)
+}
+
+// shardName returns the schema name of the shard with the id.
+func (cl *Cluster) shardName(id int64) string {
+	if cl.nameFunc != nil {
+		return cl.nameFunc(id)
+	}
+	return shardName(id)
+}
+
+// shardSchema returns the schema name of the shard.
+func shardSchema(shard *pg.DB) string {
+	return string(shard.Param("SHARD").(pg.Safe))
+}
+
+// newShard returns the shard with the id on the db. The latency is
+// tracked for replicas.
+func (cl *Cluster) newShard(db *pg.DB, id int64, inflight *int64, latency *serverLatency) *pg.DB {
+	name := cl.shardName(id)
+	shard := db.
 		WithParam("shard_id", id).
 		WithParam("shard", pg.Safe(name)).
 		WithParam("epoch", cl.gen.epoch).
 		WithParam("SHARD_ID", id).
 		WithParam("SHARD", pg.Safe(name)).
 		WithParam("EPOCH", cl.gen.epoch)
+	for param, value := range cl.gen.params() {
+		shard = shard.WithParam(param, value)
+	}
+	shard = cl.withCustomParams(shard, id)
+	ctx := context.WithValue(shard.Context(), shardIDKey{}, id)
+	if cl.keys != nil {
+		ctx = context.WithValue(ctx, keyProviderKey{}, cl.keys)
+	}
+	shard = shard.WithContext(ctx)
+	shard.AddQueryHook(&shardHook{
+		cl:       cl,
+		shardID:  id,
+		schema:   name,
+		addr:     db.Options().Addr,
+		inflight: inflight,
+		latency:  latency,
+	})
+	return shard
 }
 
 func (cl *Cluster) Close() error {
-	var firstErr error
-	for _, db := range cl.servers {
+	firstErr := cl.stmts.close()
+	for _, db := range cl.topology().servers {
 		if err := db.Close(); err != nil && firstErr == nil {
 			firstErr = err
 		}
+		for _, replica := range cl.replicas[db] {
+			if err := replica.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
 	return firstErr
 }
 
 // DBs returns list of database servers in the cluster.
 func (cl *Cluster) DBs() []*pg.DB {
-	return cl.dbs
+	return cl.topology().dbs
 }
 
 // DB returns db id and db for the number.
 func (cl *Cluster) DB(number int64) (int, *pg.DB) {
-	idx := uint64(number)
-	idx %= uint64(len(cl.shards))
-	dbInd := cl.shards[idx].dbInd
-	return dbInd, cl.dbs[dbInd]
+	t := cl.topology()
+	dbInd := t.shards[cl.shardID(number)].dbInd
+	return dbInd, t.dbs[dbInd]
 }
 
 // Shards returns list of shards running in the db. If db is nil all
 // shards are returned.
 func (cl *Cluster) Shards(db *pg.DB) []*pg.DB {
+	t := cl.topology()
 	if db == nil {
-		return cl.shardList
+		return t.shardList
 	}
 
 	var shards []*pg.DB
-	for i := range cl.shards {
-		shard := &cl.shards[i]
-		if cl.dbs[shard.dbInd] == db {
+	for i := range t.shards {
+		shard := &t.shards[i]
+		if t.dbs[shard.dbInd] == db {
 			shards = append(shards, shard.shard)
 		}
 	}
 	return shards
 }
 
+// ShardInfo describes a shard and the database it is assigned to.
+type ShardInfo struct {
+	ID int64
+	// Schema is the name of the PostgreSQL schema, e.g. shard3.
+	Schema string
+	// DBIndex is the index of the database in DBs.
+	DBIndex int
+	// DBAddr is the address of the database.
+	DBAddr string
+	Shard  *pg.DB
+	// Labels are the labels set with WithShardLabel.
+	Labels []string
+}
+
+// ShardInfos returns information about every shard ordered by shard id.
+func (cl *Cluster) ShardInfos() []ShardInfo {
+	t := cl.topology()
+	infos := make([]ShardInfo, len(t.shards))
+	for i := range t.shards {
+		shard := &t.shards[i]
+		infos[i] = ShardInfo{
+			ID:      int64(shard.id),
+			Schema:  shardSchema(shard.shard),
+			DBIndex: shard.dbInd,
+			DBAddr:  t.dbs[shard.dbInd].Options().Addr,
+			Shard:   shard.shard,
+			Labels:  cl.ShardLabels(int64(shard.id)),
+		}
+	}
+	return infos
+}
+
 // Shard maps the number to the corresponding shard in the cluster.
+// The number is scrambled first when WithKeyScrambling is used.
 func (cl *Cluster) Shard(number int64) *pg.DB {
-	idx := uint64(number) % uint64(len(cl.shards))
-	return cl.shards[idx].shard
+	return cl.route(number, cl.shardID(number))
+}
+
+// shardByID returns the shard with the id. Ids out of the cluster range
+// wrap around.
+func (cl *Cluster) shardByID(id int64) *pg.DB {
+	return cl.route(id, id)
+}
+
+// route returns the shard for the number logging the key it was
+// derived from when WithDebugLogger is used.
+func (cl *Cluster) route(key interface{}, number int64) *pg.DB {
+	t := cl.topology()
+	shard := t.shards[cl.shardMod.mod(uint64(number))].shard
+	if cl.debugLog != nil {
+		cl.logRoute(key, shard)
+	}
+	return shard
+}
+
+// shardID maps the number to the corresponding shard id.
+func (cl *Cluster) shardID(number int64) int64 {
+	if cl.scramble {
+		number = ScrambleKey(number)
+	}
+	return cl.wrapShardID(number)
+}
+
+// wrapShardID maps the shard id out of the cluster range to a shard id
+// in the range.
+func (cl *Cluster) wrapShardID(id int64) int64 {
+	return int64(cl.shardMod.mod(uint64(id)))
 }
 
 // SplitShard uses SplitID to extract shard id from the id and then
-// returns corresponding Shard in the cluster.
+// returns corresponding Shard in the cluster. Shard ids out of the cluster
+// range wrap around unless WithStrictShardIDs is used.
 func (cl *Cluster) SplitShard(id int64) *pg.DB {
 	_, shardID, _ := cl.gen.SplitID(id)
-	return cl.Shard(shardID)
+	cl.strictShardID("id", id, shardID)
+	return cl.route(id, shardID)
+}
+
+// ShardByUUID uses UUID.ShardID to extract shard id from the uuid and then
+// returns corresponding Shard in the cluster. Shard ids out of the cluster
+// range wrap around unless WithStrictShardIDs is used.
+func (cl *Cluster) ShardByUUID(u UUID) *pg.DB {
+	shardID := u.ShardID()
+	cl.strictShardID("uuid", u, shardID)
+	return cl.route(u, shardID)
 }
 
 // ForEachDB concurrently calls the fn on each database in the cluster.
 func (cl *Cluster) ForEachDB(fn func(db *pg.DB) error) error {
+	return cl.topology().forEachDB(fn)
+}
+
+// ForEachDBSeq is like ForEachDB, but calls the fn on one database at
+// a time in the order of the cluster dbs.
+func (cl *Cluster) ForEachDBSeq(fn func(db *pg.DB) error) error {
+	return cl.topology().forEachDBSeq(fn)
+}
+
+func (t *topology) forEachDB(fn func(db *pg.DB) error) error {
+	if t.sequential {
+		return t.forEachDBSeq(fn)
+	}
+
 	errCh := make(chan error, 1)
 	var wg sync.WaitGroup
-	wg.Add(len(cl.servers))
-	for _, db := range cl.servers {
+	wg.Add(len(t.servers))
+	for _, db := range t.servers {
 		go func(db *pg.DB) {
 			defer wg.Done()
 			if err := fn(db); err != nil {
@@ -179,13 +648,24 @@ func (cl *Cluster) ForEachDB(fn func(db *pg.DB) error) error {
 	}
 }
 
+func (t *topology) forEachDBSeq(fn func(db *pg.DB) error) error {
+	var firstErr error
+	for _, db := range t.servers {
+		if err := fn(db); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 // ForEachShard concurrently calls the fn on each shard in the cluster.
 // It is the same as ForEachNShards(1, fn).
 func (cl *Cluster) ForEachShard(fn func(shard *pg.DB) error) error {
-	return cl.ForEachDB(func(db *pg.DB) error {
+	t := cl.topology()
+	return t.forEachDB(func(db *pg.DB) error {
 		var firstErr error
-		for i := range cl.shards {
-			shard := cl.shards[i].shard
+		for i := range t.shards {
+			shard := t.shards[i].shard
 
 			if shard.Options() != db.Options() {
 				continue
@@ -200,90 +680,193 @@ func (cl *Cluster) ForEachShard(fn func(shard *pg.DB) error) error {
 }
 
 // ForEachNShards concurrently calls the fn on each N shards in the cluster.
+// Use AutoConcurrency to adapt N to the database server load.
 func (cl *Cluster) ForEachNShards(n int, fn func(shard *pg.DB) error) error {
-	return cl.ForEachDB(func(db *pg.DB) error {
-		var wg sync.WaitGroup
-		errCh := make(chan error, 1)
-		limit := make(chan struct{}, n)
+	return cl.topology().forEachNShards(nil, n, fn)
+}
 
-		for i := range cl.shards {
-			shard := cl.shards[i].shard
+// forEachNShards calls the fn on every shard even if it fails.
+func (t *topology) forEachNShards(ids []int, n int, fn func(shard *pg.DB) error) error {
+	opt := &ForEachOptions{
+		Concurrency:     n,
+		ContinueOnError: true,
+	}
+	return t.forEachShard(context.Background(), ids, opt, func(_ context.Context, shard *pg.DB) error {
+		return fn(shard)
+	})
+}
 
-			if shard.Options() != db.Options() {
-				continue
-			}
+// ShardsWhere returns shards with ids matching the predicate ordered
+// by shard id.
+func (cl *Cluster) ShardsWhere(fn func(shardID int64) bool) []*pg.DB {
+	t := cl.topology()
+	var shards []*pg.DB
+	for i := range t.shards {
+		if fn(int64(t.shards[i].id)) {
+			shards = append(shards, t.shards[i].shard)
+		}
+	}
+	return shards
+}
 
-			limit <- struct{}{}
-			wg.Add(1)
-			go func(shard *pg.DB) {
-				defer func() {
-					<-limit
-					wg.Done()
-				}()
-				if err := fn(shard); err != nil {
-					select {
-					case errCh <- err:
-					default:
-					}
-				}
-			}(shard)
+// ForShards concurrently calls the fn on the shards with the ids using
+// one goroutine per database server like ForEachShard.
+func (cl *Cluster) ForShards(ids []int64, fn func(shard *pg.DB) error) error {
+	t := cl.topology()
+	selected := make([]bool, len(t.shards))
+	for _, id := range ids {
+		if id < 0 || id >= int64(len(t.shards)) {
+			return fmt.Errorf("sharding: shard id %d is out of range", id)
 		}
+		selected[id] = true
+	}
 
-		wg.Wait()
+	return t.forEachDB(func(db *pg.DB) error {
+		var firstErr error
+		for i := range t.shards {
+			shard := t.shards[i].shard
 
-		select {
-		case err := <-errCh:
-			return err
-		default:
-			return nil
+			if !selected[i] || shard.Options() != db.Options() {
+				continue
+			}
+
+			if err := fn(shard); err != nil && firstErr == nil {
+				firstErr = err
+			}
 		}
+		return firstErr
 	})
 }
 
 // SubCluster is a subset of the cluster.
 type SubCluster struct {
 	cl     *Cluster
-	shards []*shardInfo
+	ids    []int
+	idsMod divisor // len(ids)
+	// groupMod is the number of subclusters of the same size.
+	groupMod divisor
+
+	next uint64 // round robin counter for NewID
 }
 
 // SubCluster returns a subset of the cluster of the given size.
+// Subclusters are immutable and shared by all callers that request
+// the same subset. The size is clamped to the number of shards. When
+// the size does not divide the number of shards, the remaining shards
+// are not part of any subcluster; use SubClusterE to reject such sizes.
 func (cl *Cluster) SubCluster(number int64, size int) *SubCluster {
-	if size > len(cl.shards) {
-		size = len(cl.shards)
+	if size > cl.nshards {
+		size = cl.nshards
 	}
-	step := len(cl.shards) / size
-	clusterId := int(uint64(number)%uint64(step)) * size
-	shards := make([]*shardInfo, size)
-	for i := 0; i < size; i++ {
-		shards[i] = &cl.shards[clusterId+i]
+	subclusters := cl.subclustersOfSize(size)
+	return subclusters[subclusters[0].groupMod.mod(uint64(number))]
+}
+
+// SubClusterE is like SubCluster, but returns an error unless the size
+// is between 1 and the number of shards and divides the number of shards,
+// so every shard belongs to exactly one subcluster of the size.
+func (cl *Cluster) SubClusterE(number int64, size int) (*SubCluster, error) {
+	if size <= 0 || size > cl.nshards {
+		return nil, fmt.Errorf("sharding: subcluster size must be between 1 and %d, got %d",
+			cl.nshards, size)
+	}
+	if cl.nshards%size != 0 {
+		return nil, fmt.Errorf("sharding: subcluster size %d does not divide %d shards",
+			size, cl.nshards)
 	}
+	return cl.SubCluster(number, size), nil
+}
 
-	return &SubCluster{
-		cl:     cl,
-		shards: shards,
+func (cl *Cluster) subclustersOfSize(size int) []*SubCluster {
+	m, _ := cl.subclusters.Load().(map[int][]*SubCluster)
+	if subclusters, ok := m[size]; ok {
+		return subclusters
 	}
+
+	cl.subclustersMu.Lock()
+	defer cl.subclustersMu.Unlock()
+
+	m, _ = cl.subclusters.Load().(map[int][]*SubCluster)
+	if subclusters, ok := m[size]; ok {
+		return subclusters
+	}
+
+	step := cl.nshards / size
+	subclusters := make([]*SubCluster, step)
+	for i := range subclusters {
+		ids := make([]int, size)
+		for j := range ids {
+			ids[j] = i*size + j
+		}
+		subclusters[i] = &SubCluster{
+			cl:       cl,
+			ids:      ids,
+			idsMod:   newDivisor(size),
+			groupMod: newDivisor(step),
+		}
+	}
+
+	// Copy on write so readers don't need a lock.
+	newm := make(map[int][]*SubCluster, len(m)+1)
+	for k, v := range m {
+		newm[k] = v
+	}
+	newm[size] = subclusters
+	cl.subclusters.Store(newm)
+
+	return subclusters
 }
 
 // SplitShard uses SplitID to extract shard id from the id and then
 // returns corresponding Shard in the subcluster.
 func (cl *SubCluster) SplitShard(id int64) *pg.DB {
 	_, shardID, _ := cl.cl.gen.SplitID(id)
-	return cl.Shard(shardID)
+	return cl.route(id, shardID)
+}
+
+// ShardByUUID uses UUID.ShardID to extract shard id from the uuid and then
+// returns corresponding Shard in the subcluster.
+func (cl *SubCluster) ShardByUUID(u UUID) *pg.DB {
+	return cl.route(u, u.ShardID())
+}
+
+// IDGen returns the id generator of the shard the number maps to in the
+// subcluster. Ids generated by it are routed back to the same shard by
+// SplitShard of both the subcluster and the cluster.
+func (cl *SubCluster) IDGen(number int64) *ShardIDGen {
+	idx := cl.idsMod.mod(uint64(number))
+	return cl.cl.shardIDGen(int64(cl.ids[idx]))
+}
+
+// NewID returns an id for the time on one of the subcluster shards
+// chosen in round robin order.
+func (cl *SubCluster) NewID(tm time.Time) int64 {
+	n := atomic.AddUint64(&cl.next, 1) - 1
+	return cl.IDGen(int64(n % uint64(len(cl.ids)))).NextID(tm)
 }
 
 // Shard maps the number to the corresponding shard in the subscluster.
 func (cl *SubCluster) Shard(number int64) *pg.DB {
-	idx := uint64(number) % uint64(len(cl.shards))
-	return cl.shards[idx].shard
+	return cl.route(number, number)
+}
+
+func (cl *SubCluster) route(key interface{}, number int64) *pg.DB {
+	idx := cl.idsMod.mod(uint64(number))
+	shard := cl.cl.topology().shards[cl.ids[idx]].shard
+	if cl.cl.debugLog != nil {
+		cl.cl.logRoute(key, shard)
+	}
+	return shard
 }
 
 // ForEachShard concurrently calls the fn on each shard in the subcluster.
 // It is the same as ForEachNShards(1, fn).
 func (cl *SubCluster) ForEachShard(fn func(shard *pg.DB) error) error {
-	return cl.cl.ForEachDB(func(db *pg.DB) error {
+	t := cl.cl.topology()
+	return t.forEachDB(func(db *pg.DB) error {
 		var firstErr error
-		for i := range cl.shards {
-			shard := cl.shards[i].shard
+		for _, id := range cl.ids {
+			shard := t.shards[id].shard
 
 			if shard.Options() != db.Options() {
 				continue
@@ -298,42 +881,7 @@ func (cl *SubCluster) ForEachShard(fn func(shard *pg.DB) error) error {
 }
 
 // ForEachNShards concurrently calls the fn on each N shards in the subcluster.
+// Use AutoConcurrency to adapt N to the database server load.
 func (cl *SubCluster) ForEachNShards(n int, fn func(shard *pg.DB) error) error {
-	return cl.cl.ForEachDB(func(db *pg.DB) error {
-		var wg sync.WaitGroup
-		errCh := make(chan error, 1)
-		limit := make(chan struct{}, n)
-
-		for i := range cl.shards {
-			shard := cl.shards[i].shard
-
-			if shard.Options() != db.Options() {
-				continue
-			}
-
-			limit <- struct{}{}
-			wg.Add(1)
-			go func(shard *pg.DB) {
-				defer func() {
-					<-limit
-					wg.Done()
-				}()
-				if err := fn(shard); err != nil {
-					select {
-					case errCh <- err:
-					default:
-					}
-				}
-			}(shard)
-		}
-
-		wg.Wait()
-
-		select {
-		case err := <-errCh:
-			return err
-		default:
-			return nil
-		}
-	})
+	return cl.cl.topology().forEachNShards(cl.ids, n, fn)
 }
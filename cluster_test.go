@@ -1,6 +1,7 @@
 package sharding_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -16,6 +17,8 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+var ctx = context.Background()
+
 func TestGinkgo(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "sharding")
@@ -63,6 +66,72 @@ var _ = Describe("named params", func() {
 	})
 })
 
+var _ = Describe("Exists", func() {
+	var cluster *sharding.Cluster
+
+	BeforeEach(func() {
+		db := pg.Connect(&pg.Options{
+			User: "postgres",
+		})
+		cluster = sharding.NewCluster([]*pg.DB{db}, 4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("checks a single shard", func() {
+		ok, err := cluster.ExistsOnShard(ctx, 3, `SELECT 1 WHERE ?SHARD_ID = ?`, 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+
+		ok, err = cluster.ExistsOnShard(ctx, 2, `SELECT 1 WHERE ?SHARD_ID = ?`, 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("checks all shards", func() {
+		ok, err := cluster.ExistsAnywhere(ctx, `SELECT 1 WHERE ?SHARD_ID = ?`, 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+
+		ok, err = cluster.ExistsAnywhere(ctx, `SELECT 1 WHERE ?SHARD_ID = ?`, 4)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("Listen", func() {
+	var cluster *sharding.Cluster
+
+	BeforeEach(func() {
+		db := pg.Connect(&pg.Options{
+			User: "postgres",
+		})
+		cluster = sharding.NewCluster([]*pg.DB{db}, 4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("tags notifications with shard id", func() {
+		ln := cluster.ListenAll(ctx, "events")
+		defer ln.Close()
+
+		_, err := cluster.Shard(2).Exec(`SELECT pg_notify('?SHARD.events', 'hello')`)
+		Expect(err).NotTo(HaveOccurred())
+
+		var n sharding.ShardNotification
+		Eventually(ln.Channel()).Should(Receive(&n))
+		Expect(n).To(Equal(sharding.ShardNotification{
+			ShardID: 2,
+			Channel: "events",
+			Payload: "hello",
+		}))
+	})
+})
+
 var _ = Describe("Cluster", func() {
 	var db1, db2 *pg.DB
 	var cluster *sharding.Cluster
@@ -261,6 +330,30 @@ var _ = Describe("Cluster", func() {
 				Expect(shardIDs).To(Equal(test.shardIDs))
 			}
 		})
+
+		It("returns shared sub-clusters", func() {
+			Expect(cluster.SubCluster(1, 2)).To(BeIdenticalTo(cluster.SubCluster(5, 2)))
+			Expect(cluster.SubCluster(1, 2)).NotTo(BeIdenticalTo(cluster.SubCluster(2, 2)))
+			Expect(cluster.SubCluster(1, 8)).To(BeIdenticalTo(cluster.SubCluster(0, 16)))
+
+			allocs := testing.AllocsPerRun(100, func() {
+				_ = cluster.SubCluster(3, 2)
+			})
+			Expect(allocs).To(BeZero())
+		})
+
+		It("validates the size", func() {
+			subcl, err := cluster.SubClusterE(1, 4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subcl).To(BeIdenticalTo(cluster.SubCluster(1, 4)))
+
+			_, err = cluster.SubClusterE(0, 0)
+			Expect(err).To(MatchError("sharding: subcluster size must be between 1 and 8, got 0"))
+			_, err = cluster.SubClusterE(0, 16)
+			Expect(err).To(MatchError("sharding: subcluster size must be between 1 and 8, got 16"))
+			_, err = cluster.SubClusterE(0, 3)
+			Expect(err).To(MatchError("sharding: subcluster size 3 does not divide 8 shards"))
+		})
 	})
 })
 
@@ -319,3 +412,205 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+var _ = Describe("ShardsWhere", func() {
+	var cluster *sharding.Cluster
+
+	BeforeEach(func() {
+		db1 := pg.Connect(&pg.Options{Addr: "db1"})
+		db2 := pg.Connect(&pg.Options{Addr: "db2"})
+		cluster = sharding.NewCluster([]*pg.DB{db1, db2}, 8)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("selects shards by predicate", func() {
+		shards := cluster.ShardsWhere(func(shardID int64) bool {
+			return shardID%2 == 1
+		})
+		var ids []int64
+		for _, shard := range shards {
+			ids = append(ids, shardID(shard))
+		}
+		Expect(ids).To(Equal([]int64{1, 3, 5, 7}))
+	})
+
+	It("calls fn on the selected shards", func() {
+		var mu sync.Mutex
+		var ids []int64
+		err := cluster.ForShards([]int64{6, 1, 2}, func(shard *pg.DB) error {
+			mu.Lock()
+			ids = append(ids, shardID(shard))
+			mu.Unlock()
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids).To(ConsistOf(int64(1), int64(2), int64(6)))
+
+		err = cluster.ForShards([]int64{8}, func(shard *pg.DB) error {
+			return nil
+		})
+		Expect(err).To(MatchError("sharding: shard id 8 is out of range"))
+	})
+})
+
+var _ = Describe("NewClusterE", func() {
+	var db *pg.DB
+
+	BeforeEach(func() {
+		db = pg.Connect(&pg.Options{Addr: "db1"})
+	})
+
+	AfterEach(func() {
+		Expect(db.Close()).NotTo(HaveOccurred())
+	})
+
+	It("returns a cluster", func() {
+		cluster, err := sharding.NewClusterE(&sharding.ClusterOptions{
+			DBs:       []*pg.DB{db},
+			NumShards: 4,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Shards(nil)).To(HaveLen(4))
+	})
+
+	It("returns errors for invalid options", func() {
+		tests := []struct {
+			opt *sharding.ClusterOptions
+			err string
+		}{
+			{&sharding.ClusterOptions{NumShards: 4}, "sharding: at least one db is required"},
+			{&sharding.ClusterOptions{DBs: []*pg.DB{db, nil}, NumShards: 4}, "sharding: db 1 is nil"},
+			{&sharding.ClusterOptions{DBs: []*pg.DB{db}, NumShards: -1}, "sharding: number of shards must be positive, got -1"},
+			{&sharding.ClusterOptions{DBs: []*pg.DB{db}, NumShards: 4096}, "sharding: too many shards"},
+			{
+				&sharding.ClusterOptions{
+					DBs:       []*pg.DB{db},
+					NumShards: 4,
+					Options:   []sharding.Option{sharding.WithFingerprint(64)},
+				},
+				"sharding: fingerprint must be shorter than the sequence",
+			},
+			{
+				&sharding.ClusterOptions{
+					DBs:       []*pg.DB{db},
+					NumShards: 4,
+					Options: []sharding.Option{sharding.WithPlacement(sharding.PlacementFunc(
+						func(nshards, ndbs int, _ []int) []int {
+							return []int{0, 0, 1, 0}
+						},
+					))},
+				},
+				"sharding: placement assigned shard 2 to db 1 out of 1 dbs",
+			},
+		}
+		for _, test := range tests {
+			cluster, err := sharding.NewClusterE(test.opt)
+			Expect(err).To(MatchError(test.err))
+			Expect(cluster).To(BeNil())
+		}
+	})
+})
+
+var _ = Describe("ShardInfos", func() {
+	var cluster *sharding.Cluster
+
+	BeforeEach(func() {
+		db1 := pg.Connect(&pg.Options{Addr: "db1"})
+		db2 := pg.Connect(&pg.Options{Addr: "db2"})
+		cluster = sharding.NewCluster([]*pg.DB{db1, db2}, 4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("describes every shard", func() {
+		infos := cluster.ShardInfos()
+		Expect(infos).To(HaveLen(4))
+		for i, info := range infos {
+			Expect(info.ID).To(Equal(int64(i)))
+			Expect(info.Schema).To(Equal(fmt.Sprintf("shard%d", i)))
+			Expect(info.DBIndex).To(Equal(i % 2))
+			Expect(info.DBAddr).To(Equal(fmt.Sprintf("db%d", i%2+1)))
+			Expect(shardID(info.Shard)).To(Equal(int64(i)))
+		}
+	})
+})
+
+var _ = Describe("ShardByUUID", func() {
+	var cluster *sharding.Cluster
+
+	BeforeEach(func() {
+		db := pg.Connect(&pg.Options{Addr: "db1"})
+		cluster = sharding.NewCluster([]*pg.DB{db}, 8)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("returns shard of the uuid", func() {
+		u := sharding.NewUUID(5, time.Now())
+		Expect(shardID(cluster.ShardByUUID(u))).To(Equal(int64(5)))
+
+		u = sharding.NewUUID(13, time.Now())
+		Expect(shardID(cluster.ShardByUUID(u))).To(Equal(int64(5)))
+
+		subcl := cluster.SubCluster(1, 4)
+		Expect(shardID(subcl.ShardByUUID(u))).To(Equal(int64(5)))
+	})
+})
+
+var _ = Describe("SubCluster.NewID", func() {
+	var cluster *sharding.Cluster
+
+	BeforeEach(func() {
+		db := pg.Connect(&pg.Options{Addr: "db1"})
+		cluster = sharding.NewCluster([]*pg.DB{db}, 8)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("generates ids that are routed back to the subcluster", func() {
+		subcl := cluster.SubCluster(1, 4)
+		tm := time.Now()
+
+		seen := make(map[int64]bool)
+		for i := 0; i < 8; i++ {
+			id := subcl.NewID(tm)
+			Expect(seen[id]).To(BeFalse())
+			seen[id] = true
+
+			shard := shardID(subcl.SplitShard(id))
+			Expect(shard).To(BeNumerically(">=", 4))
+			Expect(shardID(cluster.SplitShard(id))).To(Equal(shard))
+		}
+
+		id := subcl.IDGen(6).NextID(tm)
+		Expect(shardID(subcl.SplitShard(id))).To(Equal(int64(6)))
+		Expect(shardID(cluster.SplitShard(id))).To(Equal(int64(6)))
+		Expect(seen[id]).To(BeFalse())
+	})
+
+	It("keeps ids in the subcluster with key scrambling", func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+		db := pg.Connect(&pg.Options{Addr: "db1"})
+		cluster = sharding.NewCluster([]*pg.DB{db}, 16, sharding.WithKeyScrambling())
+
+		subcl := cluster.SubCluster(0, 4)
+		tm := time.Now()
+		for i := 0; i < 8; i++ {
+			id := subcl.NewID(tm)
+			Expect(shardID(cluster.SplitShard(id))).To(BeNumerically("<", 4))
+		}
+		for number := int64(0); number < 4; number++ {
+			id := subcl.IDGen(number).NextID(tm)
+			Expect(shardID(cluster.SplitShard(id))).To(Equal(number))
+		}
+	})
+})
@@ -0,0 +1,156 @@
+// Package compat shims the Shard and Tx wrappers of the pre-Cluster
+// sharding API onto shards returned by sharding.Cluster, so code written
+// against the legacy API can be migrated incrementally.
+//
+// Deprecated: use *pg.DB shards returned by sharding.Cluster directly.
+package compat
+
+import (
+	"context"
+
+	"github.com/go-pg/sharding/v8"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// Cluster wraps sharding.Cluster to return legacy shards.
+type Cluster struct {
+	*sharding.Cluster
+}
+
+// Wrap returns the cluster with the legacy API.
+func Wrap(cl *sharding.Cluster) *Cluster {
+	return &Cluster{Cluster: cl}
+}
+
+// Shard maps the number to the corresponding legacy shard.
+func (cl *Cluster) Shard(number int64) *Shard {
+	return NewShard(cl.Cluster.Shard(number))
+}
+
+// SplitShard uses SplitID to extract shard id from the id and returns
+// the corresponding legacy shard.
+func (cl *Cluster) SplitShard(id int64) *Shard {
+	return NewShard(cl.Cluster.SplitShard(id))
+}
+
+// Shards returns legacy shards of the database server.
+func (cl *Cluster) Shards(db *pg.DB) []*Shard {
+	dbs := cl.Cluster.Shards(db)
+	shards := make([]*Shard, len(dbs))
+	for i, db := range dbs {
+		shards[i] = NewShard(db)
+	}
+	return shards
+}
+
+// Shard is the legacy shard type that wraps a cluster shard.
+type Shard struct {
+	db *pg.DB
+}
+
+// NewShard wraps the cluster shard.
+func NewShard(db *pg.DB) *Shard {
+	return &Shard{db: db}
+}
+
+// Id returns the shard id.
+func (s *Shard) Id() int64 {
+	return s.db.Param("SHARD_ID").(int64)
+}
+
+// Name returns the shard schema name.
+func (s *Shard) Name() string {
+	return string(s.db.Param("SHARD").(pg.Safe))
+}
+
+// DB returns the underlying cluster shard.
+func (s *Shard) DB() *pg.DB {
+	return s.db
+}
+
+func (s *Shard) String() string {
+	return s.Name()
+}
+
+func (s *Shard) Exec(query interface{}, params ...interface{}) (pg.Result, error) {
+	return s.db.Exec(query, params...)
+}
+
+func (s *Shard) ExecOne(query interface{}, params ...interface{}) (pg.Result, error) {
+	return s.db.ExecOne(query, params...)
+}
+
+func (s *Shard) Query(model, query interface{}, params ...interface{}) (pg.Result, error) {
+	return s.db.Query(model, query, params...)
+}
+
+func (s *Shard) QueryOne(model, query interface{}, params ...interface{}) (pg.Result, error) {
+	return s.db.QueryOne(model, query, params...)
+}
+
+func (s *Shard) Model(model ...interface{}) *orm.Query {
+	return s.db.Model(model...)
+}
+
+// Begin starts a transaction on the shard.
+func (s *Shard) Begin() (*Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{shard: s, tx: tx}, nil
+}
+
+// RunInTransaction runs the fn in a transaction on the shard. The
+// transaction is rolled back if the fn returns an error or panics.
+func (s *Shard) RunInTransaction(fn func(*Tx) error) error {
+	return s.db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		return fn(&Tx{shard: s, tx: tx})
+	})
+}
+
+// Tx is the legacy transaction type bound to a shard.
+type Tx struct {
+	shard *Shard
+	tx    *pg.Tx
+}
+
+// Shard returns the shard of the transaction.
+func (tx *Tx) Shard() *Shard {
+	return tx.shard
+}
+
+// Tx returns the underlying transaction.
+func (tx *Tx) Tx() *pg.Tx {
+	return tx.tx
+}
+
+func (tx *Tx) Exec(query interface{}, params ...interface{}) (pg.Result, error) {
+	return tx.tx.Exec(query, params...)
+}
+
+func (tx *Tx) ExecOne(query interface{}, params ...interface{}) (pg.Result, error) {
+	return tx.tx.ExecOne(query, params...)
+}
+
+func (tx *Tx) Query(model, query interface{}, params ...interface{}) (pg.Result, error) {
+	return tx.tx.Query(model, query, params...)
+}
+
+func (tx *Tx) QueryOne(model, query interface{}, params ...interface{}) (pg.Result, error) {
+	return tx.tx.QueryOne(model, query, params...)
+}
+
+func (tx *Tx) Model(model ...interface{}) *orm.Query {
+	return tx.tx.Model(model...)
+}
+
+func (tx *Tx) Commit() error {
+	return tx.tx.Commit()
+}
+
+func (tx *Tx) Rollback() error {
+	return tx.tx.Rollback()
+}
@@ -0,0 +1,49 @@
+package compat_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-pg/sharding/v8/compat"
+	"github.com/go-pg/sharding/v8/shardingtest"
+)
+
+func TestShard(t *testing.T) {
+	fake := shardingtest.NewCluster(4)
+	defer fake.Close()
+
+	cluster := compat.Wrap(fake.Cluster)
+	shard := cluster.Shard(6)
+	if shard.Id() != 2 || shard.Name() != "shard2" {
+		t.Fatalf("got %d %q", shard.Id(), shard.Name())
+	}
+
+	if _, err := shard.Exec("DELETE FROM ?SHARD.users"); err != nil {
+		t.Fatal(err)
+	}
+
+	errFailed := errors.New("failed")
+	err := shard.RunInTransaction(func(tx *compat.Tx) error {
+		if tx.Shard() != shard {
+			t.Fatal("tx is not bound to the shard")
+		}
+		if _, err := tx.Exec("UPDATE ?SHARD.users SET name = 'x'"); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if err != errFailed {
+		t.Fatalf("got %v, wanted %v", err, errFailed)
+	}
+
+	wanted := []string{
+		"DELETE FROM shard2.users",
+		"BEGIN",
+		"UPDATE shard2.users SET name = 'x'",
+		"ROLLBACK",
+	}
+	if got := fake.Queries(2); !reflect.DeepEqual(got, wanted) {
+		t.Fatalf("got %q, wanted %q", got, wanted)
+	}
+}
@@ -0,0 +1,145 @@
+package sharding
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// AutoConcurrency can be passed to ForEachNShards to adapt the number
+// of concurrently processed shards per database server during the run.
+// Concurrency starts at 1 and grows additively while shard latency stays
+// close to the best observed latency and the connection pool has spare
+// connections. It is halved when latency degrades, the pool times out,
+// or the fn returns an error. Use ForEachOptions.Adaptive to tune it.
+const AutoConcurrency = 0
+
+const (
+	// aimdLatencyFactor is how much slower than the best observed latency
+	// a shard can be before concurrency is decreased.
+	aimdLatencyFactor = 2
+)
+
+// AdaptiveOptions tune AutoConcurrency.
+type AdaptiveOptions struct {
+	// MaxConcurrency caps the number of concurrently processed shards per
+	// database server. Default is the pool size of the server.
+	MaxConcurrency int
+	// LatencyFactor is how much slower than the best observed latency
+	// a shard can be before concurrency is halved. Default is 2.
+	LatencyFactor float64
+	// OnLimit, if not nil, is called when the concurrency limit of
+	// a database server changes, e.g. to export it as a metric.
+	OnLimit func(db *pg.DB, limit int)
+}
+
+// aimdLimiter limits the number of concurrent calls on a database server
+// using additive increase / multiplicative decrease.
+type aimdLimiter struct {
+	db            *pg.DB
+	max           float64
+	latencyFactor float64
+	onLimit       func(db *pg.DB, limit int)
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	limit      float64
+	running    int
+	minLatency time.Duration
+	timeouts   uint32
+}
+
+func newAIMDLimiter(db *pg.DB, opt *AdaptiveOptions) *aimdLimiter {
+	if opt == nil {
+		opt = new(AdaptiveOptions)
+	}
+	max := db.Options().PoolSize
+	if opt.MaxConcurrency > 0 {
+		max = opt.MaxConcurrency
+	}
+	if max < 1 {
+		max = 1
+	}
+	latencyFactor := opt.LatencyFactor
+	if latencyFactor <= 0 {
+		latencyFactor = aimdLatencyFactor
+	}
+	l := &aimdLimiter{
+		db:            db,
+		max:           float64(max),
+		latencyFactor: latencyFactor,
+		onLimit:       opt.OnLimit,
+		limit:         1,
+		timeouts:      db.PoolStats().Timeouts,
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *aimdLimiter) acquire(stop <-chan struct{}) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.running >= int(l.limit) {
+		select {
+		case <-stop:
+			return false
+		default:
+		}
+		l.cond.Wait()
+	}
+	select {
+	case <-stop:
+		return false
+	default:
+	}
+	l.running++
+	return true
+}
+
+// wake wakes up goroutines waiting in acquire so they can see
+// the closed stop channel.
+func (l *aimdLimiter) wake() {
+	l.mu.Lock()
+	l.cond.Broadcast()
+	l.mu.Unlock()
+}
+
+func (l *aimdLimiter) release(latency time.Duration, err error) {
+	stats := l.db.PoolStats()
+
+	l.mu.Lock()
+	l.running--
+	prevLimit := int(l.limit)
+
+	if l.minLatency == 0 || latency < l.minLatency {
+		l.minLatency = latency
+	}
+
+	overloaded := err != nil ||
+		float64(latency) > l.latencyFactor*float64(l.minLatency) ||
+		stats.Timeouts != l.timeouts
+	l.timeouts = stats.Timeouts
+
+	if overloaded {
+		l.limit /= 2
+		if l.limit < 1 {
+			l.limit = 1
+		}
+	} else if stats.IdleConns > 0 || int(stats.TotalConns) < int(l.max) {
+		// Grow by one per round of limit calls.
+		l.limit += 1 / l.limit
+		if l.limit > l.max {
+			l.limit = l.max
+		}
+	}
+
+	limit := int(l.limit)
+	l.cond.Broadcast()
+	l.mu.Unlock()
+
+	if l.onLimit != nil && limit != prevLimit {
+		l.onLimit(l.db, limit)
+	}
+}
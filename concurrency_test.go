@@ -0,0 +1,170 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+)
+
+func TestForEachNShardsAuto(t *testing.T) {
+	cluster := shardingtest.NewCluster(8)
+	defer cluster.Close()
+
+	var mu sync.Mutex
+	seen := make(map[int64]int)
+	err := cluster.ForEachNShards(sharding.AutoConcurrency, func(shard *pg.DB) error {
+		mu.Lock()
+		seen[shard.Param("SHARD_ID").(int64)]++
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 8 {
+		t.Fatalf("got %d shards, wanted 8", len(seen))
+	}
+	for shardID, n := range seen {
+		if n != 1 {
+			t.Fatalf("shard %d is called %d times", shardID, n)
+		}
+	}
+
+	errFailed := errors.New("failed")
+	err = cluster.SubCluster(0, 4).ForEachNShards(sharding.AutoConcurrency, func(shard *pg.DB) error {
+		if shard.Param("SHARD_ID").(int64) == 2 {
+			return errFailed
+		}
+		return nil
+	})
+	if err != errFailed {
+		t.Fatalf("got %v, wanted %v", err, errFailed)
+	}
+}
+
+func TestForEachShardAdaptive(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	defer db.Close()
+	cluster := sharding.NewCluster([]*pg.DB{db}, 32)
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	limits := make(map[int]bool)
+	opt := &sharding.ForEachOptions{
+		Adaptive: &sharding.AdaptiveOptions{
+			MaxConcurrency: 2,
+			LatencyFactor:  1000,
+			OnLimit: func(_ *pg.DB, limit int) {
+				mu.Lock()
+				limits[limit] = true
+				mu.Unlock()
+			},
+		},
+	}
+	err := cluster.ForEachShardContext(ctx, opt, func(context.Context, *pg.DB) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning > 2 {
+		t.Fatalf("got %d concurrent shards, wanted at most 2", maxRunning)
+	}
+	if !limits[2] {
+		t.Fatalf("limit was not raised to 2: %v", limits)
+	}
+}
+
+func TestSequentialFanOut(t *testing.T) {
+	dbs := []*pg.DB{
+		pg.Connect(&pg.Options{Addr: "db1"}),
+		pg.Connect(&pg.Options{Addr: "db2"}),
+		pg.Connect(&pg.Options{Addr: "db3"}),
+	}
+	cluster := sharding.NewCluster(dbs, 12, sharding.WithSequentialFanOut())
+	defer cluster.Close()
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	enter := func() {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	exit := func() {
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}
+
+	err := cluster.ForEachDB(func(db *pg.DB) error {
+		enter()
+		defer exit()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &sharding.ForEachOptions{Concurrency: 4}
+	err = cluster.ForEachShardContext(context.Background(), opt, func(ctx context.Context, shard *pg.DB) error {
+		enter()
+		defer exit()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning != 1 {
+		t.Fatalf("got %d concurrent calls, wanted 1", maxRunning)
+	}
+}
+
+func TestForEachDBSeq(t *testing.T) {
+	dbs := []*pg.DB{
+		pg.Connect(&pg.Options{Addr: "db1"}),
+		pg.Connect(&pg.Options{Addr: "db2"}),
+		pg.Connect(&pg.Options{Addr: "db3"}),
+	}
+	cluster := sharding.NewCluster(dbs, 12)
+	defer cluster.Close()
+
+	errFailed := errors.New("failed")
+	var addrs []string
+	err := cluster.ForEachDBSeq(func(db *pg.DB) error {
+		addrs = append(addrs, db.Options().Addr)
+		if len(addrs) > 1 {
+			return errFailed
+		}
+		return nil
+	})
+	if err != errFailed {
+		t.Fatalf("got %v, wanted %v", err, errFailed)
+	}
+	if got := strings.Join(addrs, ","); got != "db1,db2,db3" {
+		t.Fatalf("got %s, wanted db1,db2,db3", got)
+	}
+}
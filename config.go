@@ -0,0 +1,255 @@
+package sharding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"gopkg.in/yaml.v2"
+)
+
+// ClusterConfig describes the cluster topology so identical clusters
+// can be constructed from shared config files.
+type ClusterConfig struct {
+	NumShards int `json:"nshards" yaml:"nshards"`
+	// Servers are listed in the order of Cluster.DBs. A server can be
+	// listed several times.
+	Servers []ServerConfig `json:"servers" yaml:"servers"`
+	// ShardMap is the index in the expanded list of DBs for every shard.
+	// Default is RoundRobinPlacement.
+	ShardMap ShardMap `json:"shard_map,omitempty" yaml:"shard_map,omitempty"`
+	// IDGen is the layout of ids. Default is DefaultIDGen.
+	IDGen *IDGenConfig `json:"id_gen,omitempty" yaml:"id_gen,omitempty"`
+	// ScrambleKeys enables WithKeyScrambling.
+	ScrambleKeys bool `json:"scramble_keys,omitempty" yaml:"scramble_keys,omitempty"`
+}
+
+// ServerConfig is a database server of the cluster.
+type ServerConfig struct {
+	// DSN is the server URL accepted by pg.ParseURL. Servers with
+	// the same DSN share the *pg.DB.
+	DSN string `json:"dsn" yaml:"dsn"`
+	// Weight is the number of times the server is listed in DBs, i.e.
+	// how many shards it runs relative to other servers. Default is 1.
+	Weight int `json:"weight,omitempty" yaml:"weight,omitempty"`
+	// Replicas are DSNs of read replicas of the server. They are added
+	// with WithReplicas so ReadShard routes reads to them.
+	Replicas []string `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+}
+
+// IDGenConfig is the layout of ids generated by IDGen.
+type IDGenConfig struct {
+	ShardBits uint      `json:"shard_bits" yaml:"shard_bits"`
+	SeqBits   uint      `json:"seq_bits" yaml:"seq_bits"`
+	Epoch     time.Time `json:"epoch" yaml:"epoch"`
+	// Unsigned selects the layout of NewUint64IDGen.
+	Unsigned bool `json:"unsigned,omitempty" yaml:"unsigned,omitempty"`
+	// PrecisionMS is the precision of time in milliseconds, see
+	// IDGen.WithPrecision. Default is 1.
+	PrecisionMS int64 `json:"precision_ms,omitempty" yaml:"precision_ms,omitempty"`
+}
+
+// ParseClusterConfig parses the cluster config in the JSON or YAML format.
+func ParseClusterConfig(b []byte) (*ClusterConfig, error) {
+	cfg := new(ClusterConfig)
+	var err error
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(b, cfg)
+	} else {
+		err = yaml.UnmarshalStrict(b, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sharding: can't parse cluster config: %w", err)
+	}
+	return cfg, nil
+}
+
+// NewCluster connects to the servers and returns the cluster.
+func (c *ClusterConfig) NewCluster(opts ...Option) (*Cluster, error) {
+	var gen *IDGen
+	if c.IDGen != nil {
+		timeBits := 64 - int(c.IDGen.ShardBits) - int(c.IDGen.SeqBits)
+		if timeBits <= 0 {
+			return nil, fmt.Errorf("sharding: id_gen uses %d bits, expected less than 64",
+				c.IDGen.ShardBits+c.IDGen.SeqBits)
+		}
+		if c.IDGen.Unsigned {
+			gen = NewUint64IDGen(uint(timeBits), c.IDGen.ShardBits, c.IDGen.SeqBits, c.IDGen.Epoch)
+		} else {
+			gen = NewIDGen(uint(timeBits), c.IDGen.ShardBits, c.IDGen.SeqBits, c.IDGen.Epoch)
+		}
+		if p := c.IDGen.PrecisionMS; p != 0 {
+			if p < 0 {
+				return nil, fmt.Errorf("sharding: id_gen precision_ms must be positive, got %d", p)
+			}
+			gen = gen.WithPrecision(time.Duration(p) * time.Millisecond)
+		}
+	}
+
+	var dbs []*pg.DB
+	var replicaOpts []Option
+	byDSN := make(map[string]*pg.DB, len(c.Servers))
+	closeAll := func() {
+		for _, db := range byDSN {
+			_ = db.Close()
+		}
+	}
+	connect := func(dsn string) (*pg.DB, bool, error) {
+		if db, ok := byDSN[dsn]; ok {
+			return db, false, nil
+		}
+		opt, err := pg.ParseURL(dsn)
+		if err != nil {
+			return nil, false, err
+		}
+		db := pg.Connect(opt)
+		byDSN[dsn] = db
+		return db, true, nil
+	}
+	for i := range c.Servers {
+		srv := &c.Servers[i]
+		db, created, err := connect(srv.DSN)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("sharding: server %d: %w", i, err)
+		}
+
+		// Replicas of a server listed several times are added once.
+		if created && len(srv.Replicas) > 0 {
+			replicas := make([]*pg.DB, len(srv.Replicas))
+			for j, replicaDSN := range srv.Replicas {
+				replicas[j], _, err = connect(replicaDSN)
+				if err != nil {
+					closeAll()
+					return nil, fmt.Errorf("sharding: server %d: replica %d: %w", i, j, err)
+				}
+			}
+			replicaOpts = append(replicaOpts, WithReplicas(db, replicas...))
+		}
+
+		weight := srv.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		for j := 0; j < weight; j++ {
+			dbs = append(dbs, db)
+		}
+	}
+
+	if c.ShardMap != nil {
+		if err := checkPlacement(c.ShardMap, c.NumShards, len(dbs)); err != nil {
+			closeAll()
+			return nil, err
+		}
+		opts = append([]Option{WithPlacement(c.ShardMap.Placement())}, opts...)
+	}
+	if c.ScrambleKeys {
+		opts = append([]Option{WithKeyScrambling()}, opts...)
+	}
+	opts = append(replicaOpts, opts...)
+
+	cl, err := NewClusterE(&ClusterOptions{
+		DBs:       dbs,
+		NumShards: c.NumShards,
+		IDGen:     gen,
+		Options:   opts,
+	})
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	return cl, nil
+}
+
+// Config returns the config of the cluster. Passwords are not included
+// in the server DSNs.
+func (cl *Cluster) Config() *ClusterConfig {
+	t := cl.topology()
+	cfg := &ClusterConfig{
+		NumShards:    cl.nshards,
+		ScrambleKeys: cl.scramble,
+	}
+
+	for i := 0; i < len(t.dbs); {
+		j := i + 1
+		for j < len(t.dbs) && t.dbs[j] == t.dbs[i] {
+			j++
+		}
+		srv := ServerConfig{
+			DSN: dsn(t.dbs[i].Options()),
+		}
+		if j-i > 1 {
+			srv.Weight = j - i
+		}
+		for _, replica := range cl.replicas[t.dbs[i]] {
+			srv.Replicas = append(srv.Replicas, dsn(replica.Options()))
+		}
+		cfg.Servers = append(cfg.Servers, srv)
+		i = j
+	}
+
+	m := cl.ShardMap()
+	for i, ind := range m {
+		if ind != i%len(t.dbs) {
+			cfg.ShardMap = m
+			break
+		}
+	}
+
+	if g := cl.gen; g.shardBits != DefaultIDGen.shardBits ||
+		g.seqBits != DefaultIDGen.seqBits || g.epoch != DefaultIDGen.epoch || g.unsigned || g.tick != 1 {
+		cfg.IDGen = &IDGenConfig{
+			ShardBits: g.shardBits,
+			SeqBits:   g.seqBits,
+			Epoch:     time.Unix(0, g.epoch*int64(time.Millisecond)).UTC(),
+			Unsigned:  g.unsigned,
+		}
+		if g.tick != 1 {
+			cfg.IDGen.PrecisionMS = g.tick
+		}
+	}
+	return cfg
+}
+
+// MarshalConfig returns the config of the cluster in the JSON format,
+// which is also valid YAML.
+func (cl *Cluster) MarshalConfig() ([]byte, error) {
+	return json.MarshalIndent(cl.Config(), "", "  ")
+}
+
+// dsn returns the URL of the database without the password.
+func dsn(opt *pg.Options) string {
+	u := &url.URL{
+		Scheme: "postgres",
+		Host:   opt.Addr,
+		Path:   "/" + opt.Database,
+	}
+	if opt.User != "" {
+		u.User = url.User(opt.User)
+	}
+	if host, port, err := net.SplitHostPort(opt.Addr); err == nil && port == "5432" {
+		u.Host = host
+	}
+
+	q := url.Values{}
+	switch {
+	case opt.TLSConfig == nil:
+		q.Set("sslmode", "disable")
+	case !opt.TLSConfig.InsecureSkipVerify:
+		q.Set("sslmode", "verify-full")
+	}
+	if opt.ApplicationName != "" {
+		q.Set("application_name", opt.ApplicationName)
+	}
+	// pg.Connect sets the DialTimeout to 5 seconds by default.
+	if opt.DialTimeout != 5*time.Second && opt.DialTimeout%time.Second == 0 {
+		q.Set("connect_timeout", strconv.Itoa(int(opt.DialTimeout/time.Second)))
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,98 @@
+package sharding_test
+
+import (
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ClusterConfig", func() {
+	It("parses YAML and constructs the cluster", func() {
+		cfg, err := sharding.ParseClusterConfig([]byte(`
+nshards: 6
+servers:
+  - dsn: postgres://app@db1/app?sslmode=disable
+    weight: 2
+    replicas:
+      - postgres://app@db1-replica/app?sslmode=disable
+  - dsn: postgres://app@db2/app?sslmode=disable
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Servers[0].Replicas).To(HaveLen(1))
+
+		cluster, err := cfg.NewCluster()
+		Expect(err).NotTo(HaveOccurred())
+		defer cluster.Close()
+
+		dbs := cluster.DBs()
+		Expect(dbs).To(HaveLen(3))
+		Expect(dbs[0]).To(BeIdenticalTo(dbs[1]))
+		Expect(dbs[2].Options().Addr).To(Equal("db2:5432"))
+		Expect(cluster.Shards(dbs[0])).To(HaveLen(4))
+		Expect(cluster.Replicas(dbs[0])).To(HaveLen(1))
+		Expect(cluster.Replicas(dbs[2])).To(BeEmpty())
+		Expect(cluster.ReadShard(0).Options().Addr).To(Equal("db1-replica:5432"))
+
+		b, err := cluster.MarshalConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(MatchJSON(`{
+			"nshards": 6,
+			"servers": [
+				{
+					"dsn": "postgres://app@db1/app?sslmode=disable",
+					"weight": 2,
+					"replicas": ["postgres://app@db1-replica/app?sslmode=disable"]
+				},
+				{"dsn": "postgres://app@db2/app?sslmode=disable"}
+			]
+		}`))
+	})
+
+	It("round-trips the shard map and id layout", func() {
+		db1 := pg.Connect(&pg.Options{Addr: "db1:5433", User: "app", Database: "app", Password: "secret"})
+		db2 := pg.Connect(&pg.Options{Addr: "db2:5432", User: "app", Database: "app"})
+		gen := sharding.NewIDGen(40, 10, 14, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+		cluster := sharding.NewClusterWithGen([]*pg.DB{db1, db2}, 4, gen,
+			sharding.WithPlacement(sharding.ShardMap{1, 1, 0, 0}.Placement()))
+		defer cluster.Close()
+
+		b, err := cluster.MarshalConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).NotTo(ContainSubstring("secret"))
+
+		cfg, err := sharding.ParseClusterConfig(b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Servers[0].DSN).To(Equal("postgres://app@db1:5433/app?sslmode=disable"))
+		Expect(cfg.ShardMap).To(Equal(sharding.ShardMap{1, 1, 0, 0}))
+		Expect(cfg.IDGen.ShardBits).To(Equal(uint(10)))
+
+		clone, err := cfg.NewCluster()
+		Expect(err).NotTo(HaveOccurred())
+		defer clone.Close()
+
+		Expect(clone.ShardMap()).To(Equal(cluster.ShardMap()))
+		Expect(clone.Fingerprint()).To(Equal(cluster.Fingerprint()))
+	})
+
+	It("returns errors", func() {
+		_, err := sharding.ParseClusterConfig([]byte("nshards: 4\nunknown: 1\n"))
+		Expect(err).To(MatchError(ContainSubstring("sharding: can't parse cluster config")))
+
+		cfg := &sharding.ClusterConfig{
+			NumShards: 4,
+			Servers:   []sharding.ServerConfig{{DSN: "postgres://db1/app"}},
+			ShardMap:  sharding.ShardMap{0, 0, 0},
+		}
+		_, err = cfg.NewCluster()
+		Expect(err).To(MatchError("sharding: placement assigned 3 shards, expected 4"))
+
+		cfg.Servers[0].DSN = "mysql://db1/app"
+		_, err = cfg.NewCluster()
+		Expect(err).To(MatchError("sharding: server 0: pg: invalid scheme: mysql"))
+	})
+})
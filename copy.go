@@ -0,0 +1,157 @@
+package sharding
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// copyFromCSV copies CSV rows from the r into the table in the shard schema.
+func copyFromCSV(
+	ctx context.Context, shard *pg.DB, table string, columns []string, r io.Reader,
+) (pg.Result, error) {
+	res, err := shard.WithContext(ctx).CopyFrom(r, `COPY ?SHARD.? (?) FROM STDIN WITH (FORMAT csv)`,
+		pg.Ident(table), pg.In(identList(columns)))
+	return res, WrapShardError(shard, err)
+}
+
+// appendCSVRow appends values in the PostgreSQL CSV format. Nil values
+// are written as unquoted empty strings which COPY treats as NULL.
+func appendCSVRow(b []byte, values []interface{}) []byte {
+	for i, v := range values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if v == nil {
+			continue
+		}
+
+		b = append(b, '"')
+		for _, c := range types.Append(nil, v, 0) {
+			if c == '"' {
+				b = append(b, '"')
+			}
+			b = append(b, c)
+		}
+		b = append(b, '"')
+	}
+	return append(b, '\n')
+}
+
+func identList(names []string) []types.Ident {
+	idents := make([]types.Ident, len(names))
+	for i, name := range names {
+		idents[i] = types.Ident(name)
+	}
+	return idents
+}
+
+// CopyAllTo runs the query on every shard one after another and writes
+// results to the w as a single CSV document with one header line.
+// Shards are exported in order of their ids.
+func (cl *Cluster) CopyAllTo(ctx context.Context, w io.Writer, query string, params ...interface{}) error {
+	return cl.CopyAllToN(ctx, 1, w, query, params...)
+}
+
+// CopyAllToN is like CopyAllTo, but exports up to n shards concurrently.
+// Output of every shard is buffered in memory and shards are written
+// in order of completion. The first error cancels running exports and
+// no more shards are started.
+func (cl *Cluster) CopyAllToN(
+	ctx context.Context, n int, w io.Writer, query string, params ...interface{},
+) error {
+	q := "COPY (" + query + ") TO STDOUT WITH (FORMAT csv, HEADER)"
+	shards := cl.Shards(nil)
+
+	if n <= 1 {
+		hw := &headerWriter{w: w}
+		for i, shard := range shards {
+			hw.skip = i > 0
+			if _, err := shard.WithContext(ctx).CopyTo(hw, q, params...); err != nil {
+				return WrapShardError(shard, err)
+			}
+		}
+		return nil
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var written bool
+	var firstErr error
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, n)
+
+	for _, shard := range shards {
+		limit <- struct{}{}
+
+		mu.Lock()
+		stop := firstErr != nil
+		mu.Unlock()
+		if stop || ctx.Err() != nil {
+			<-limit
+			break
+		}
+
+		wg.Add(1)
+		go func(shard *pg.DB) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+
+			var buf bytes.Buffer
+			_, err := shard.WithContext(ctx).CopyTo(&buf, q, params...)
+			err = WrapShardError(shard, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if firstErr != nil {
+				return
+			}
+			if err == nil {
+				_, err = (&headerWriter{w: w, skip: written}).Write(buf.Bytes())
+				written = true
+			}
+			if err != nil {
+				firstErr = err
+				cancel()
+			}
+		}(shard)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return parent.Err()
+}
+
+// headerWriter optionally skips the first line written to it.
+type headerWriter struct {
+	w    io.Writer
+	skip bool
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	if w.skip {
+		i := bytes.IndexByte(b, '\n')
+		if i == -1 {
+			return n, nil
+		}
+		w.skip = false
+		b = b[i+1:]
+	}
+	if _, err := w.w.Write(b); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
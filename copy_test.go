@@ -0,0 +1,64 @@
+package sharding_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pg/sharding/v8/shardingtest"
+)
+
+func TestCopyAllTo(t *testing.T) {
+	cluster := shardingtest.NewCluster(3)
+	defer cluster.Close()
+
+	for i := int64(0); i < 3; i++ {
+		cluster.SetResult(i, "COPY", &shardingtest.Result{
+			CopyData: "id,name\n" + string(rune('0'+i)) + ",user\n",
+		})
+	}
+
+	for _, n := range []int{1, 3} {
+		var buf bytes.Buffer
+		err := cluster.CopyAllToN(context.Background(), n, &buf, "SELECT id, name FROM ?SHARD.users")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := buf.String()
+		if n == 1 {
+			wanted := "id,name\n0,user\n1,user\n2,user\n"
+			if got != wanted {
+				t.Fatalf("got %q, wanted %q", got, wanted)
+			}
+		} else if len(got) != len("id,name\n0,user\n1,user\n2,user\n") || !bytes.HasPrefix(buf.Bytes(), []byte("id,name\n")) {
+			t.Fatalf("got %q", got)
+		}
+	}
+
+	got := cluster.Queries(2)[0]
+	wanted := "COPY (SELECT id, name FROM shard2.users) TO STDOUT WITH (FORMAT csv, HEADER)"
+	if got != wanted {
+		t.Fatalf("got %q, wanted %q", got, wanted)
+	}
+}
+
+func TestCopyAllToNStopsOnError(t *testing.T) {
+	cluster := shardingtest.NewChaosCluster(4, 1)
+	defer cluster.Close()
+
+	cluster.SetError(0, &shardingtest.Error{Message: "permission denied"})
+	cluster.SetChaos(1, &shardingtest.ChaosOptions{Latency: 100 * time.Millisecond})
+
+	var buf bytes.Buffer
+	err := cluster.CopyAllToN(context.Background(), 2, &buf, "SELECT id FROM ?SHARD.users")
+	if err == nil {
+		t.Fatal("got nil error")
+	}
+	for _, shardID := range []int64{2, 3} {
+		if got := cluster.Queries(shardID); len(got) != 0 {
+			t.Fatalf("shard %d: got %q, wanted no queries", shardID, got)
+		}
+	}
+}
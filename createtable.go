@@ -0,0 +1,88 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// CreateTable creates tables for the models in the shard schema, which
+// is created if it does not exist, in a single transaction. Models with
+// unqualified table names, e.g. `pg:"users"`, are created in the shard
+// schema using search_path, so foreign keys to other unqualified tables
+// resolve within the shard too. Temp tables require unqualified names.
+func CreateTable(ctx context.Context, shard *pg.DB, opt *orm.CreateTableOptions, models ...interface{}) error {
+	err := shard.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if opt == nil || !opt.Temp {
+			if _, err := tx.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS ?SHARD"); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "SET LOCAL search_path TO ?SHARD"); err != nil {
+			return err
+		}
+		for _, model := range models {
+			if err := tx.ModelContext(ctx, model).CreateTable(opt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return WrapShardError(shard, err)
+}
+
+// DropTable drops tables of the models in the shard schema in a single
+// transaction.
+func DropTable(ctx context.Context, shard *pg.DB, opt *orm.DropTableOptions, models ...interface{}) error {
+	err := shard.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if _, err := tx.ExecContext(ctx, "SET LOCAL search_path TO ?SHARD"); err != nil {
+			return err
+		}
+		for _, model := range models {
+			if err := tx.ModelContext(ctx, model).DropTable(opt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return WrapShardError(shard, err)
+}
+
+// CreateTablesAll creates tables for the models in every shard using
+// CreateTable.
+func (cl *Cluster) CreateTablesAll(ctx context.Context, opt *orm.CreateTableOptions, models ...interface{}) error {
+	err := cl.ForEachShard(func(shard *pg.DB) error {
+		return CreateTable(ctx, shard, opt, models...)
+	})
+
+	auditErr := cl.audit(ctx, "create_tables", modelParams(models), err)
+	if err != nil {
+		return err
+	}
+	return auditErr
+}
+
+// DropTablesAll drops tables of the models in every shard using DropTable.
+func (cl *Cluster) DropTablesAll(ctx context.Context, opt *orm.DropTableOptions, models ...interface{}) error {
+	err := cl.ForEachShard(func(shard *pg.DB) error {
+		return DropTable(ctx, shard, opt, models...)
+	})
+
+	auditErr := cl.audit(ctx, "drop_tables", modelParams(models), err)
+	if err != nil {
+		return err
+	}
+	return auditErr
+}
+
+func modelParams(models []interface{}) map[string]interface{} {
+	names := make([]string, len(models))
+	for i, model := range models {
+		names[i] = fmt.Sprintf("%T", model)
+	}
+	return map[string]interface{}{
+		"models": names,
+	}
+}
@@ -0,0 +1,82 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type Account struct {
+	tableName struct{} `pg:"accounts"`
+
+	ID   int64
+	Name string
+}
+
+type Visit struct {
+	tableName struct{} `pg:"?SHARD.visits"`
+
+	ID        int64
+	AccountID int64
+}
+
+var _ = Describe("CreateTablesAll", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("creates tables in every shard schema", func() {
+		err := cluster.CreateTablesAll(ctx, &orm.CreateTableOptions{IfNotExists: true},
+			(*Account)(nil), (*Visit)(nil))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"BEGIN",
+			"CREATE SCHEMA IF NOT EXISTS shard1",
+			"SET LOCAL search_path TO shard1",
+			`CREATE TABLE IF NOT EXISTS "accounts" ("id" bigserial, "name" text, PRIMARY KEY ("id"))`,
+			`CREATE TABLE IF NOT EXISTS shard1.visits ("id" bigserial, "account_id" bigint, PRIMARY KEY ("id"))`,
+			"COMMIT",
+		}))
+	})
+
+	It("creates temp tables without schema", func() {
+		err := cluster.CreateTablesAll(ctx, &orm.CreateTableOptions{Temp: true}, (*Account)(nil))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(cluster.Queries(0)).To(Equal([]string{
+			"BEGIN",
+			"SET LOCAL search_path TO shard0",
+			`CREATE TEMP TABLE "accounts" ("id" bigserial, "name" text, PRIMARY KEY ("id"))`,
+			"COMMIT",
+		}))
+	})
+
+	It("drops tables and rolls back on errors", func() {
+		cluster.SetQueryError(1, "DROP TABLE", &shardingtest.Error{Message: "fake error"})
+		err := cluster.DropTablesAll(ctx, &orm.DropTableOptions{IfExists: true}, (*Account)(nil))
+		Expect(err).To(MatchError("sharding: shard 1 (shardingtest1): ERROR #XX000 fake error"))
+
+		Expect(cluster.Queries(0)).To(Equal([]string{
+			"BEGIN",
+			"SET LOCAL search_path TO shard0",
+			`DROP TABLE IF EXISTS "accounts"`,
+			"COMMIT",
+		}))
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"BEGIN",
+			"SET LOCAL search_path TO shard1",
+			`DROP TABLE IF EXISTS "accounts"`,
+			"ROLLBACK",
+		}))
+	})
+})
@@ -0,0 +1,115 @@
+package sharding
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrInvalidCursor is returned by ParseCursor when the token is malformed.
+var ErrInvalidCursor = errors.New("sharding: invalid cursor")
+
+const cursorVersion = 1
+
+// Cursor is the position of keyset pagination over rows of all shards
+// ordered by shard id and then by row id.
+type Cursor struct {
+	ShardID int64
+	// LastID is the id of the last returned row of the shard.
+	LastID int64
+}
+
+// Token returns the cursor encoded as an opaque URL-safe token.
+func (c Cursor) Token() string {
+	b := make([]byte, 1, 1+2*binary.MaxVarintLen64)
+	b[0] = cursorVersion
+	b = appendUvarint(b, uint64(c.ShardID))
+	b = appendVarint(b, c.LastID)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor decodes the token returned by Cursor.Token.
+func ParseCursor(token string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) == 0 || b[0] != cursorVersion {
+		return Cursor{}, ErrInvalidCursor
+	}
+	b = b[1:]
+
+	shardID, n := binary.Uvarint(b)
+	if n <= 0 || shardID > math.MaxInt64 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	b = b[n:]
+
+	lastID, n := binary.Varint(b)
+	if n <= 0 || n != len(b) {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{
+		ShardID: int64(shardID),
+		LastID:  lastID,
+	}, nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// PageFunc fetches up to limit rows of the shard with ids greater than
+// the afterID ordered by id and returns the number of fetched rows and
+// the id of the last one, e.g. using
+//
+//	SELECT * FROM ?SHARD.users WHERE id > ? ORDER BY id LIMIT ?
+type PageFunc func(ctx context.Context, shard *pg.DB, afterID int64, limit int) (n int, lastID int64, err error)
+
+// Paginate fetches the page of up to limit rows that follows the cursor
+// using the fn, moving to the next shard when a shard is exhausted. Pass
+// nil cursor to fetch the first page. It returns the cursor of the next
+// page or nil after the last shard.
+func (cl *Cluster) Paginate(ctx context.Context, cursor *Cursor, limit int, fn PageFunc) (*Cursor, error) {
+	next := Cursor{LastID: math.MinInt64}
+	if cursor != nil {
+		if cursor.ShardID < 0 || cursor.ShardID >= int64(cl.nshards) {
+			return nil, fmt.Errorf("sharding: shard id %d is out of range", cursor.ShardID)
+		}
+		next = *cursor
+	}
+
+	for limit > 0 {
+		shard := cl.shardByID(next.ShardID)
+		n, lastID, err := fn(ctx, shard, next.LastID, limit)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			next.LastID = lastID
+		}
+		if n >= limit {
+			break
+		}
+
+		limit -= n
+		if next.ShardID+1 >= int64(cl.nshards) {
+			return nil, nil
+		}
+		next = Cursor{
+			ShardID: next.ShardID + 1,
+			LastID:  math.MinInt64,
+		}
+	}
+	return &next, nil
+}
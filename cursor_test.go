@@ -0,0 +1,94 @@
+package sharding_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCursorToken(t *testing.T) {
+	for _, c := range []sharding.Cursor{
+		{},
+		{ShardID: 2047, LastID: math.MaxInt64},
+		{ShardID: 3, LastID: math.MinInt64},
+	} {
+		got, err := sharding.ParseCursor(c.Token())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c {
+			t.Errorf("got %v, wanted %v", got, c)
+		}
+	}
+
+	for _, token := range []string{"", "!", "AA", "AQ", "AQEC_w"} {
+		if _, err := sharding.ParseCursor(token); err != sharding.ErrInvalidCursor {
+			t.Errorf("token %q: got %v, wanted ErrInvalidCursor", token, err)
+		}
+	}
+}
+
+var _ = Describe("Paginate", func() {
+	var cluster *sharding.Cluster
+	// ids of rows in every shard
+	rows := map[int64][]int64{
+		0: {10, 20, 30},
+		1: {},
+		2: {5, 15},
+	}
+
+	fetch := func(page *[]int64) sharding.PageFunc {
+		return func(_ context.Context, shard *pg.DB, afterID int64, limit int) (int, int64, error) {
+			var n int
+			var lastID int64
+			for _, id := range rows[shardID(shard)] {
+				if id > afterID && n < limit {
+					*page = append(*page, id)
+					lastID = id
+					n++
+				}
+			}
+			return n, lastID, nil
+		}
+	}
+
+	BeforeEach(func() {
+		db := pg.Connect(&pg.Options{Addr: "db1"})
+		cluster = sharding.NewCluster([]*pg.DB{db}, 3)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("pages over rows of all shards", func() {
+		var pages [][]int64
+		var cursor *sharding.Cursor
+		for {
+			var page []int64
+			next, err := cluster.Paginate(ctx, cursor, 2, fetch(&page))
+			Expect(err).NotTo(HaveOccurred())
+			pages = append(pages, page)
+			if next == nil {
+				break
+			}
+
+			c, err := sharding.ParseCursor(next.Token())
+			Expect(err).NotTo(HaveOccurred())
+			cursor = &c
+		}
+		Expect(pages).To(Equal([][]int64{{10, 20}, {30, 5}, {15}}))
+	})
+
+	It("rejects cursors of other clusters", func() {
+		_, err := cluster.Paginate(ctx, &sharding.Cursor{ShardID: 3}, 2, fetch(new([]int64)))
+		Expect(err).To(MatchError("sharding: shard id 3 is out of range"))
+	})
+})
@@ -0,0 +1,255 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// ErrShardNotOnDB is returned by ShardTx methods when the shard runs on
+// a different database than the transaction.
+var ErrShardNotOnDB = errors.New("sharding: shard is not on the transaction database")
+
+// DBTx is a transaction on a database server that spans all shards
+// running on the server, so multi-shard writes of co-located shards are
+// atomic.
+type DBTx struct {
+	cl *Cluster
+	db *pg.DB
+	tx *pg.Tx
+}
+
+// BeginForDB starts a transaction on the database. Use DBTx.Shard to
+// run queries on the shards of the database in the transaction.
+func (cl *Cluster) BeginForDB(ctx context.Context, db *pg.DB) (*DBTx, error) {
+	if !cl.hasServer(db) {
+		return nil, fmt.Errorf("sharding: %s is not a cluster db", db.Options().Addr)
+	}
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &DBTx{
+		cl: cl,
+		db: db,
+		tx: tx,
+	}, nil
+}
+
+// RunInDBTransaction runs the fn in a transaction started with BeginForDB.
+// The transaction is rolled back if the fn returns an error and committed
+// otherwise.
+func (cl *Cluster) RunInDBTransaction(ctx context.Context, db *pg.DB, fn func(tx *DBTx) error) error {
+	tx, err := cl.BeginForDB(ctx, db)
+	if err != nil {
+		return err
+	}
+	return tx.tx.RunInTransaction(ctx, func(*pg.Tx) error {
+		return fn(tx)
+	})
+}
+
+func (cl *Cluster) hasServer(db *pg.DB) bool {
+	for _, server := range cl.topology().servers {
+		if server == db {
+			return true
+		}
+	}
+	return false
+}
+
+// Tx returns the underlying transaction. Shard params like ?SHARD are not
+// substituted in its queries.
+func (tx *DBTx) Tx() *pg.Tx {
+	return tx.tx
+}
+
+// Shard returns a view of the transaction for the shard the number maps
+// to. Queries of the view substitute the shard params like Cluster.Shard
+// and fail with ErrShardNotOnDB if the shard runs on another database.
+func (tx *DBTx) Shard(number int64) *ShardTx {
+	shardID := tx.cl.shardID(number)
+	t := tx.cl.topology()
+	info := &t.shards[shardID]
+	st := &ShardTx{
+		tx:    tx.tx,
+		shard: info.shard,
+		hook: &shardHook{
+			cl:      tx.cl,
+			shardID: shardID,
+			schema:  shardSchema(info.shard),
+			addr:    info.shard.Options().Addr,
+		},
+		ctx: context.WithValue(tx.tx.Context(), shardIDKey{}, shardID),
+	}
+	if t.dbs[info.dbInd] != tx.db {
+		st.err = fmt.Errorf("%w: shard %d runs on %s", ErrShardNotOnDB, shardID, info.shard.Options().Addr)
+	}
+	return st
+}
+
+// Commit commits the transaction.
+func (tx *DBTx) Commit(ctx context.Context) error {
+	return tx.tx.CommitContext(ctx)
+}
+
+// Rollback aborts the transaction.
+func (tx *DBTx) Rollback(ctx context.Context) error {
+	return tx.tx.RollbackContext(ctx)
+}
+
+// ShardTx is a view of a DBTx for a shard. It implements orm.DB so models
+// can be used with it, e.g. tx.Shard(id).Model(user).Insert(). Queries
+// are checked like queries of the shard, i.e. by the table check, quotas,
+// and query guards, but they are not shed and middleware is not called.
+type ShardTx struct {
+	tx    *pg.Tx
+	shard *pg.DB
+	hook  *shardHook
+	ctx   context.Context
+	err   error
+}
+
+var _ orm.DB = (*ShardTx)(nil)
+
+// format substitutes the shard params and the params in the query and
+// checks the result with the shard checks. The transaction database has
+// no params so the result is sent as is.
+func (st *ShardTx) format(c context.Context, query interface{}, params []interface{}) (string, error) {
+	q, err := st.formatQuery(query, params)
+	if err != nil {
+		return "", err
+	}
+	if err := st.hook.checkTxQuery(c, query, q); err != nil {
+		return "", err
+	}
+	return q, nil
+}
+
+func (st *ShardTx) formatQuery(query interface{}, params []interface{}) (string, error) {
+	if st.err != nil {
+		return "", st.err
+	}
+	fmter := st.shard.Formatter()
+	switch query := query.(type) {
+	case string:
+		return string(fmter.FormatQuery(nil, query, params...)), nil
+	case orm.QueryAppender:
+		if f, ok := fmter.(*orm.Formatter); ok {
+			fmter = f.WithModel(query)
+		}
+		b, err := query.AppendQuery(fmter, nil)
+		return string(b), err
+	default:
+		return "", fmt.Errorf("sharding: can't append %T", query)
+	}
+}
+
+// consume charges the rows of the result to the tenant quota.
+func (st *ShardTx) consume(c context.Context, res pg.Result, err error) {
+	if err == nil && st.hook.cl.quotas != nil {
+		st.hook.cl.quotas.consume(c, res)
+	}
+}
+
+func (st *ShardTx) Model(model ...interface{}) *orm.Query {
+	return orm.NewQueryContext(st.ctx, st, model...)
+}
+
+func (st *ShardTx) ModelContext(c context.Context, model ...interface{}) *orm.Query {
+	return orm.NewQueryContext(c, st, model...)
+}
+
+func (st *ShardTx) Exec(query interface{}, params ...interface{}) (pg.Result, error) {
+	return st.ExecContext(st.ctx, query, params...)
+}
+
+func (st *ShardTx) ExecContext(c context.Context, query interface{}, params ...interface{}) (pg.Result, error) {
+	q, err := st.format(c, query, params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := st.tx.ExecContext(c, q)
+	st.consume(c, res, err)
+	return res, err
+}
+
+func (st *ShardTx) ExecOne(query interface{}, params ...interface{}) (pg.Result, error) {
+	return st.ExecOneContext(st.ctx, query, params...)
+}
+
+func (st *ShardTx) ExecOneContext(c context.Context, query interface{}, params ...interface{}) (pg.Result, error) {
+	q, err := st.format(c, query, params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := st.tx.ExecOneContext(c, q)
+	st.consume(c, res, err)
+	return res, err
+}
+
+func (st *ShardTx) Query(model, query interface{}, params ...interface{}) (pg.Result, error) {
+	return st.QueryContext(st.ctx, model, query, params...)
+}
+
+func (st *ShardTx) QueryContext(
+	c context.Context, model, query interface{}, params ...interface{},
+) (pg.Result, error) {
+	q, err := st.format(c, query, params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := st.tx.QueryContext(c, model, q)
+	st.consume(c, res, err)
+	return res, err
+}
+
+func (st *ShardTx) QueryOne(model, query interface{}, params ...interface{}) (pg.Result, error) {
+	return st.QueryOneContext(st.ctx, model, query, params...)
+}
+
+func (st *ShardTx) QueryOneContext(
+	c context.Context, model, query interface{}, params ...interface{},
+) (pg.Result, error) {
+	q, err := st.format(c, query, params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := st.tx.QueryOneContext(c, model, q)
+	st.consume(c, res, err)
+	return res, err
+}
+
+func (st *ShardTx) CopyFrom(r io.Reader, query interface{}, params ...interface{}) (pg.Result, error) {
+	q, err := st.format(st.ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := st.tx.CopyFrom(r, q)
+	st.consume(st.ctx, res, err)
+	return res, err
+}
+
+func (st *ShardTx) CopyTo(w io.Writer, query interface{}, params ...interface{}) (pg.Result, error) {
+	q, err := st.format(st.ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := st.tx.CopyTo(w, q)
+	st.consume(st.ctx, res, err)
+	return res, err
+}
+
+// Context returns the context of the transaction.
+func (st *ShardTx) Context() context.Context {
+	return st.ctx
+}
+
+// Formatter returns the formatter of the shard.
+func (st *ShardTx) Formatter() orm.QueryFormatter {
+	return st.shard.Formatter()
+}
@@ -0,0 +1,92 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BeginForDB", func() {
+	var fake1, fake2 *shardingtest.Cluster
+	var cluster *sharding.Cluster
+	var db1 *pg.DB
+
+	BeforeEach(func() {
+		fake1 = shardingtest.NewCluster(1)
+		fake2 = shardingtest.NewCluster(1)
+		db1 = fake1.DBs()[0]
+		cluster = sharding.NewCluster([]*pg.DB{db1, fake2.DBs()[0]}, 4)
+	})
+
+	AfterEach(func() {
+		Expect(fake1.Close()).NotTo(HaveOccurred())
+		Expect(fake2.Close()).NotTo(HaveOccurred())
+	})
+
+	It("runs queries of co-located shards in one transaction", func() {
+		err := cluster.RunInDBTransaction(ctx, db1, func(tx *sharding.DBTx) error {
+			if _, err := tx.Shard(0).Exec("UPDATE ?SHARD.users SET n = n - ? WHERE id = ?", 10, 1); err != nil {
+				return err
+			}
+			_, err := tx.Shard(2).Model(&ShardedEvent{Name: "x"}).Insert()
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fake1.Queries(0)).To(Equal([]string{
+			"BEGIN",
+			"UPDATE shard0.users SET n = n - 10 WHERE id = 1",
+			`INSERT INTO shard2.events ("name", "shard_id") VALUES ('x', 2)`,
+			"COMMIT",
+		}))
+		Expect(fake2.Queries(0)).To(BeEmpty())
+	})
+
+	It("rejects shards on other databases", func() {
+		tx, err := cluster.BeginForDB(ctx, db1)
+		Expect(err).NotTo(HaveOccurred())
+		defer tx.Rollback(ctx)
+
+		_, err = tx.Shard(1).Exec("SELECT 1")
+		Expect(errors.Is(err, sharding.ErrShardNotOnDB)).To(BeTrue())
+	})
+	It("checks queries with guards and the table check", func() {
+		var guarded []*sharding.GuardedQuery
+		cluster = sharding.NewCluster([]*pg.DB{db1, fake2.DBs()[0]}, 4,
+			sharding.WithTableCheck(sharding.TableCheckError),
+			sharding.WithQueryGuard(func(_ context.Context, q *sharding.GuardedQuery) error {
+				guarded = append(guarded, q)
+				if strings.HasPrefix(q.Query, "DELETE") {
+					return errors.New("deletes are not allowed")
+				}
+				return nil
+			}))
+
+		tx, err := cluster.BeginForDB(ctx, db1)
+		Expect(err).NotTo(HaveOccurred())
+		defer tx.Rollback(ctx)
+
+		_, err = tx.Shard(0).Exec("DELETE FROM ?SHARD.users")
+		Expect(err).To(MatchError("deletes are not allowed"))
+		_, err = tx.Shard(0).Exec("SELECT * FROM users")
+		var tableErr *sharding.UnqualifiedTableError
+		Expect(errors.As(err, &tableErr)).To(BeTrue())
+
+		Expect(guarded).To(Equal([]*sharding.GuardedQuery{{
+			ShardID: 0,
+			Schema:  "shard0",
+			DBAddr:  db1.Options().Addr,
+			Query:   "DELETE FROM shard0.users",
+			InTx:    true,
+		}}))
+		Expect(fake1.Queries(0)).To(Equal([]string{"BEGIN"}))
+	})
+})
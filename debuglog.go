@@ -0,0 +1,43 @@
+package sharding
+
+import (
+	"github.com/go-pg/pg/v10"
+)
+
+// debugQueryPrefix is the max length of the query logged by the debug logger.
+const debugQueryPrefix = 120
+
+// Logger is the interface used by WithDebugLogger. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithDebugLogger logs every routing decision of Shard, SplitShard,
+// ShardByUUID, and ShardKey with the input key, the chosen shard id, and
+// the db address, and every query executed on a shard with the prefix
+// of the query after ?SHARD substitution. It is slow and should only be
+// enabled for debugging.
+func WithDebugLogger(l Logger) Option {
+	return func(cl *Cluster) {
+		cl.debugLog = l
+	}
+}
+
+func (cl *Cluster) logRoute(key interface{}, shard *pg.DB) {
+	cl.debugLog.Printf("sharding: route key=%v shard=%d db=%s",
+		key, shard.Param("SHARD_ID"), shard.Options().Addr)
+}
+
+func (h *shardHook) logQuery(evt *pg.QueryEvent) {
+	query, err := evt.FormattedQuery()
+	if err != nil {
+		h.cl.debugLog.Printf("sharding: query shard=%d db=%s err=%q",
+			h.shardID, h.addr, err)
+		return
+	}
+	if len(query) > debugQueryPrefix {
+		query = append(query[:debugQueryPrefix:debugQueryPrefix], "..."...)
+	}
+	h.cl.debugLog.Printf("sharding: query shard=%d db=%s query=%q",
+		h.shardID, h.addr, query)
+}
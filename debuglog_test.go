@@ -0,0 +1,61 @@
+package sharding_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+	l.mu.Unlock()
+}
+
+var _ = Describe("WithDebugLogger", func() {
+	var cluster *shardingtest.Cluster
+	var logger *testLogger
+
+	BeforeEach(func() {
+		logger = new(testLogger)
+		cluster = shardingtest.NewCluster(4, sharding.WithDebugLogger(logger))
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("logs routing decisions and queries", func() {
+		shard := cluster.Shard(6)
+		_, err := shard.ExecContext(ctx, "SELECT * FROM ?SHARD.users WHERE id = ?", 6)
+		Expect(err).NotTo(HaveOccurred())
+
+		cluster.ShardKey("acme")
+
+		Expect(logger.lines).To(HaveLen(3))
+		Expect(logger.lines[0]).To(Equal("sharding: route key=6 shard=2 db=shardingtest2"))
+		Expect(logger.lines[1]).To(Equal(
+			`sharding: query shard=2 db=shardingtest2 query="SELECT * FROM shard2.users WHERE id = 6"`))
+		Expect(logger.lines[2]).To(HavePrefix("sharding: route key=[acme] shard="))
+	})
+
+	It("truncates long queries", func() {
+		query := "SELECT '" + strings.Repeat("x", 200) + "'"
+		_, err := cluster.Shard(0).ExecContext(ctx, query)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(logger.lines[1]).To(HaveSuffix(`x..."`))
+		Expect(len(logger.lines[1])).To(BeNumerically("<", 200))
+	})
+})
@@ -0,0 +1,56 @@
+package sharding
+
+import "math/bits"
+
+// divisor computes remainders of the division by a constant without
+// the slow 64-bit division: using a mask when the divisor is a power of
+// two and a precomputed reciprocal otherwise, see Lemire et al.,
+// "Faster Remainder by Direct Computation".
+type divisor struct {
+	d    uint64
+	mask uint64 // d-1 when d is a power of two
+	pow2 bool
+	// m is ceil(2^128/d) as a 128-bit fixed-point fraction.
+	mhi, mlo uint64
+}
+
+func newDivisor(d int) divisor {
+	v := divisor{d: uint64(d)}
+	if d <= 0 {
+		return v
+	}
+	if d&(d-1) == 0 {
+		v.pow2 = true
+		v.mask = uint64(d - 1)
+		return v
+	}
+
+	// floor((2^128-1)/d) + 1 equals ceil(2^128/d) for d that is not
+	// a power of two.
+	hi := ^uint64(0) / v.d
+	rem := ^uint64(0) % v.d
+	lo, _ := bits.Div64(rem, ^uint64(0), v.d)
+	lo++
+	if lo == 0 {
+		hi++
+	}
+	v.mhi, v.mlo = hi, lo
+	return v
+}
+
+// mod returns n % d.
+func (v *divisor) mod(n uint64) uint64 {
+	if v.pow2 {
+		return n & v.mask
+	}
+
+	// The fractional part of n/d is m*n mod 2^128 and the remainder is
+	// the integer part of the fraction multiplied by d.
+	hi, lo := bits.Mul64(v.mlo, n)
+	hi += v.mhi * n
+
+	h1, _ := bits.Mul64(lo, v.d)
+	h2, l2 := bits.Mul64(hi, v.d)
+	_, carry := bits.Add64(l2, h1, 0)
+	return h2 + carry
+}
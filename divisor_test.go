@@ -0,0 +1,32 @@
+package sharding_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestMod(t *testing.T) {
+	divisors := []int{math.MaxInt32, 1<<32 + 1, math.MaxInt64, 1 << 62}
+	for d := 1; d <= 4100; d++ {
+		divisors = append(divisors, d)
+	}
+
+	rnd := rand.New(rand.NewSource(0))
+	numbers := []uint64{0, 1, 2, math.MaxInt64, math.MaxInt64 + 1, math.MaxUint64, math.MaxUint64 - 1}
+	for i := 0; i < 50; i++ {
+		numbers = append(numbers, rnd.Uint64())
+	}
+
+	for _, d := range divisors {
+		for _, n := range numbers {
+			for _, n := range []uint64{n, n + uint64(d), n - uint64(d)} {
+				if got, wanted := sharding.Mod(n, d), n%uint64(d); got != wanted {
+					t.Fatalf("%d %% %d: got %d, wanted %d", n, d, got, wanted)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// DualWriteMismatch describes a write that had a different outcome
+// on the shadow database than on the primary.
+type DualWriteMismatch struct {
+	ShardID int64
+	Query   string
+	// PrimaryAffected and ShadowAffected are the numbers of rows affected
+	// by the query. ShadowAffected is -1 when the query failed.
+	PrimaryAffected int
+	ShadowAffected  int
+	// Err is the error returned by the shadow database.
+	Err error
+}
+
+func (m *DualWriteMismatch) String() string {
+	if m.Err != nil {
+		return fmt.Sprintf("sharding: dual write to shard %d failed on shadow: %s", m.ShardID, m.Err)
+	}
+	return fmt.Sprintf("sharding: dual write to shard %d affected %d rows on primary and %d on shadow",
+		m.ShardID, m.PrimaryAffected, m.ShadowAffected)
+}
+
+type dualWrite struct {
+	shadow     *pg.DB
+	onMismatch func(*DualWriteMismatch)
+}
+
+// dualWrites holds the dual written shards shared by the cluster
+// and its copies.
+type dualWrites struct {
+	mu sync.Mutex
+	m  atomic.Value // map[int64]*dualWrite
+}
+
+func (dw *dualWrites) get(shardID int64) *dualWrite {
+	m, _ := dw.m.Load().(map[int64]*dualWrite)
+	return m[shardID]
+}
+
+// StartDualWrite starts mirroring writes to the shards with the ids to
+// the shadow database, e.g. while the shards are moved to the shadow.
+// Reads are served by the primary. Successful INSERT, UPDATE, DELETE,
+// and DDL queries executed on the shards outside of transactions are
+// replayed on the shadow after they finish on the primary and the
+// onMismatch, if not nil, is called when the shadow fails or affects
+// a different number of rows. Mismatches are also written to the debug
+// logger. Writes in transactions are not mirrored.
+//
+// The shadow must have the shard schemas with the same data, e.g.
+// restored from a Backup, so the results match. Queries are replayed
+// already formatted, so the shadow must not have params set with
+// pg.DB.WithParam.
+func (cl *Cluster) StartDualWrite(
+	ctx context.Context, shadow *pg.DB, shardIDs []int64, onMismatch func(*DualWriteMismatch),
+) error {
+	err := cl.startDualWrite(shadow, shardIDs, onMismatch)
+	auditErr := cl.audit(ctx, "start_dual_write", map[string]interface{}{
+		"shadow": shadow.Options().Addr,
+		"shards": shardIDs,
+	}, err)
+	if err != nil {
+		return err
+	}
+	return auditErr
+}
+
+func (cl *Cluster) startDualWrite(shadow *pg.DB, shardIDs []int64, onMismatch func(*DualWriteMismatch)) error {
+	cl.dualWrites.mu.Lock()
+	defer cl.dualWrites.mu.Unlock()
+
+	old, _ := cl.dualWrites.m.Load().(map[int64]*dualWrite)
+	t := cl.topology()
+	for _, id := range shardIDs {
+		if id < 0 || id >= int64(cl.nshards) {
+			return fmt.Errorf("sharding: shard %d is out of range [0, %d)", id, cl.nshards)
+		}
+		if _, ok := old[id]; ok {
+			return fmt.Errorf("sharding: shard %d is already dual written", id)
+		}
+		if t.shards[id].shard.Options() == shadow.Options() {
+			return fmt.Errorf("sharding: shard %d already runs on the shadow", id)
+		}
+	}
+
+	m := make(map[int64]*dualWrite, len(old)+len(shardIDs))
+	for id, w := range old {
+		m[id] = w
+	}
+	for _, id := range shardIDs {
+		m[id] = &dualWrite{
+			shadow:     shadow,
+			onMismatch: onMismatch,
+		}
+	}
+	cl.dualWrites.m.Store(m)
+	return nil
+}
+
+// StopDualWrite stops mirroring writes to the shards with the ids.
+func (cl *Cluster) StopDualWrite(ctx context.Context, shardIDs ...int64) error {
+	cl.dualWrites.mu.Lock()
+	old, _ := cl.dualWrites.m.Load().(map[int64]*dualWrite)
+	m := make(map[int64]*dualWrite, len(old))
+	for id, w := range old {
+		m[id] = w
+	}
+	for _, id := range shardIDs {
+		delete(m, id)
+	}
+	cl.dualWrites.m.Store(m)
+	cl.dualWrites.mu.Unlock()
+
+	return cl.audit(ctx, "stop_dual_write", map[string]interface{}{
+		"shards": shardIDs,
+	}, nil)
+}
+
+// DualWriteShards returns the sorted ids of the dual written shards.
+func (cl *Cluster) DualWriteShards() []int64 {
+	m, _ := cl.dualWrites.m.Load().(map[int64]*dualWrite)
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// mirror replays the write on the shadow and reports mismatches.
+func (h *shardHook) mirror(ctx context.Context, evt *pg.QueryEvent, w *dualWrite) {
+	if _, ok := evt.DB.(*pg.DB); !ok {
+		return
+	}
+	if evt.Err != nil || isRejected(evt) {
+		return
+	}
+	if _, ok := evt.Query.(*orm.SelectQuery); ok {
+		return
+	}
+
+	b, err := evt.FormattedQuery()
+	if err != nil {
+		return
+	}
+	query := string(b)
+	if !isWriteQuery(query) {
+		return
+	}
+
+	m := &DualWriteMismatch{
+		ShardID:         h.shardID,
+		Query:           query,
+		PrimaryAffected: evt.Result.RowsAffected(),
+		ShadowAffected:  -1,
+	}
+	// The shadow has no params so formatting the query again keeps it
+	// as is.
+	res, err := w.shadow.ExecContext(ctx, query)
+	if err != nil {
+		m.Err = err
+	} else {
+		m.ShadowAffected = res.RowsAffected()
+		if m.ShadowAffected == m.PrimaryAffected {
+			return
+		}
+	}
+
+	if w.onMismatch != nil {
+		w.onMismatch(m)
+	}
+	if h.cl.debugLog != nil {
+		h.cl.debugLog.Printf("%s", m)
+	}
+}
+
+// isWriteQuery reports whether the query modifies data or schema.
+// SELECT queries, including SELECT ... FOR UPDATE, are reads.
+func isWriteQuery(query string) bool {
+	toks := tokenizeSQL(query)
+	for i, tok := range toks {
+		if i == 0 && tok.is("SELECT") {
+			return false
+		}
+		for _, kw := range writeKeywords {
+			if tok.is(kw) && !(i > 0 && toks[i-1].is("FOR")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var writeKeywords = []string{
+	"INSERT", "UPDATE", "DELETE", "TRUNCATE", "CREATE", "ALTER", "DROP",
+}
@@ -0,0 +1,75 @@
+package sharding_test
+
+import (
+	"sync"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dual write", func() {
+	var cluster, shadow *shardingtest.Cluster
+	var mu sync.Mutex
+	var mismatches []*sharding.DualWriteMismatch
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		shadow = shardingtest.NewCluster(1)
+		mismatches = nil
+		err := cluster.StartDualWrite(ctx, shadow.DBs()[0], []int64{1}, func(m *sharding.DualWriteMismatch) {
+			mu.Lock()
+			mismatches = append(mismatches, m)
+			mu.Unlock()
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+		Expect(shadow.Close()).NotTo(HaveOccurred())
+	})
+
+	It("mirrors writes to the shadow", func() {
+		Expect(cluster.DualWriteShards()).To(Equal([]int64{1}))
+
+		_, err := cluster.Shard(1).Exec("UPDATE ?SHARD.users SET name = ? WHERE id = ?", "bob", 1)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cluster.Shard(1).Exec("SELECT * FROM ?SHARD.users FOR UPDATE")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cluster.Shard(0).Exec("DELETE FROM ?SHARD.users")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(shadow.Queries(0)).To(Equal([]string{
+			"UPDATE shard1.users SET name = 'bob' WHERE id = 1",
+		}))
+		Expect(mismatches).To(BeEmpty())
+	})
+
+	It("reports mismatches", func() {
+		shadow.SetResult(0, "DELETE", &shardingtest.Result{Tag: "DELETE", RowsAffected: 2})
+		cluster.SetResult(1, "DELETE", &shardingtest.Result{Tag: "DELETE", RowsAffected: 3})
+
+		_, err := cluster.Shard(1).Exec("DELETE FROM ?SHARD.users")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mismatches).To(HaveLen(1))
+		Expect(mismatches[0].String()).To(Equal(
+			"sharding: dual write to shard 1 affected 3 rows on primary and 2 on shadow"))
+	})
+
+	It("stops mirroring", func() {
+		Expect(cluster.StopDualWrite(ctx, 1)).NotTo(HaveOccurred())
+		Expect(cluster.DualWriteShards()).To(BeEmpty())
+
+		_, err := cluster.Shard(1).Exec("DELETE FROM ?SHARD.users")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shadow.Queries(0)).To(BeEmpty())
+	})
+
+	It("rejects shards that are already dual written", func() {
+		err := cluster.StartDualWrite(ctx, shadow.DBs()[0], []int64{1}, nil)
+		Expect(err).To(MatchError("sharding: shard 1 is already dual written"))
+	})
+})
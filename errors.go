@@ -0,0 +1,65 @@
+package sharding
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ShardError is returned by cluster operations that fail on a shard.
+// Use errors.As to get the failed shard and errors.Is or errors.As
+// to inspect the underlying error, e.g. pg.Error.
+type ShardError struct {
+	ShardID int64
+	// DBAddr is the address of the shard's database server.
+	DBAddr string
+	Err    error
+}
+
+func (e *ShardError) Error() string {
+	return fmt.Sprintf("sharding: shard %d (%s): %s", e.ShardID, e.DBAddr, e.Err)
+}
+
+func (e *ShardError) Unwrap() error {
+	return e.Err
+}
+
+// WrapShardError wraps the err returned by the shard in a ShardError.
+// It returns nil if the err is nil and the err as is if it already
+// is a ShardError.
+func WrapShardError(shard *pg.DB, err error) error {
+	if err == nil {
+		return nil
+	}
+	var shardErr *ShardError
+	if errors.As(err, &shardErr) {
+		return err
+	}
+
+	e := &ShardError{
+		DBAddr: shard.Options().Addr,
+		Err:    err,
+	}
+	e.ShardID, _ = shard.Param("SHARD_ID").(int64)
+	return e
+}
+
+// MultiError is returned by ForEachShardContext with ErrorPolicy.CollectAll
+// when the fn fails on several shards. Errors are ShardErrors in the order
+// they occurred.
+type MultiError struct {
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e.Errors[0], len(e.Errors)-1)
+}
+
+// Unwrap returns the first error.
+func (e *MultiError) Unwrap() error {
+	return e.Errors[0]
+}
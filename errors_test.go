@@ -0,0 +1,58 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+)
+
+func TestShardError(t *testing.T) {
+	cluster := shardingtest.NewCluster(4)
+	defer cluster.Close()
+
+	cluster.SetError(2, &shardingtest.Error{Code: "42P01", Message: "relation does not exist"})
+
+	_, err := cluster.ExistsOnShard(context.Background(), 6, "SELECT 1 FROM ?SHARD.users")
+	var shardErr *sharding.ShardError
+	if !errors.As(err, &shardErr) {
+		t.Fatalf("got %T, wanted *ShardError", err)
+	}
+	if shardErr.ShardID != 2 || shardErr.DBAddr != "shardingtest2" {
+		t.Fatalf("got shard %d on %q", shardErr.ShardID, shardErr.DBAddr)
+	}
+
+	var pgErr pg.Error
+	if !errors.As(err, &pgErr) || pgErr.Field('C') != "42P01" {
+		t.Fatalf("got %v, wanted pg.Error", err)
+	}
+
+	if sharding.WrapShardError(cluster.Shard(1), err) != err {
+		t.Fatal("ShardError is wrapped twice")
+	}
+	if sharding.WrapShardError(cluster.Shard(1), nil) != nil {
+		t.Fatal("nil error is wrapped")
+	}
+
+	err = sharding.WrapShardError(cluster.Shard(1), context.Canceled)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, wanted context.Canceled", err)
+	}
+}
+
+func TestMultiError(t *testing.T) {
+	err1 := errors.New("shard 1 failed")
+	err2 := errors.New("shard 2 failed")
+
+	if got := (&sharding.MultiError{Errors: []error{err1}}).Error(); got != "shard 1 failed" {
+		t.Fatalf("got %q", got)
+	}
+	got := (&sharding.MultiError{Errors: []error{err1, err2}}).Error()
+	if wanted := "shard 1 failed (and 1 more errors)"; got != wanted {
+		t.Fatalf("got %q, wanted %q", got, wanted)
+	}
+}
@@ -0,0 +1,76 @@
+package sharding
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ExistsOnShard picks shard by the key and reports whether the query
+// returns at least one row in the shard. The query is wrapped
+// in SELECT EXISTS so only a single boolean is sent over the wire.
+func (cl *Cluster) ExistsOnShard(
+	ctx context.Context, key int64, query string, params ...interface{},
+) (bool, error) {
+	return exists(ctx, cl.Shard(key), query, params...)
+}
+
+// ExistsAnywhere reports whether the query returns at least one row
+// in any shard of the cluster. Shards are queried concurrently and
+// remaining queries are cancelled as soon as the first row is found.
+func (cl *Cluster) ExistsAnywhere(
+	ctx context.Context, query string, params ...interface{},
+) (bool, error) {
+	return existsAnywhere(ctx, cl.ForEachShard, query, params...)
+}
+
+// ExistsAnywhere reports whether the query returns at least one row
+// in any shard of the subcluster. See Cluster.ExistsAnywhere.
+func (cl *SubCluster) ExistsAnywhere(
+	ctx context.Context, query string, params ...interface{},
+) (bool, error) {
+	return existsAnywhere(ctx, cl.ForEachShard, query, params...)
+}
+
+func existsAnywhere(
+	ctx context.Context,
+	forEach func(fn func(shard *pg.DB) error) error,
+	query string,
+	params ...interface{},
+) (bool, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var found int32
+	err := forEach(func(shard *pg.DB) error {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		ok, err := exists(ctx, shard, query, params...)
+		if err != nil {
+			return err
+		}
+		if ok {
+			atomic.StoreInt32(&found, 1)
+			cancel()
+		}
+		return nil
+	})
+
+	if atomic.LoadInt32(&found) == 1 {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return false, parent.Err()
+}
+
+func exists(ctx context.Context, shard *pg.DB, query string, params ...interface{}) (bool, error) {
+	var ok bool
+	_, err := shard.QueryOneContext(ctx, pg.Scan(&ok), "SELECT EXISTS ("+query+")", params...)
+	return ok, WrapShardError(shard, err)
+}
@@ -0,0 +1,159 @@
+package sharding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// PlanNode is a node of the query plan returned by EXPLAIN (FORMAT JSON).
+type PlanNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name,omitempty"`
+	IndexName    string     `json:"Index Name,omitempty"`
+	StartupCost  float64    `json:"Startup Cost"`
+	TotalCost    float64    `json:"Total Cost"`
+	PlanRows     float64    `json:"Plan Rows"`
+	Plans        []PlanNode `json:"Plans,omitempty"`
+}
+
+// ShardPlan is the plan of the query on a shard.
+type ShardPlan struct {
+	ShardID int64
+	Plan    *PlanNode
+	// Shape lists the scans of the plan in order, e.g.
+	// "Index Scan on users using users_pkey; Seq Scan on posts".
+	// Shards with the same shape access tables the same way.
+	Shape string
+	Err   error
+}
+
+// PlanShape is a plan shape shared by shards.
+type PlanShape struct {
+	Shape    string
+	ShardIDs []int64
+}
+
+// ExplainReport is the outcome of ExplainAll.
+type ExplainReport struct {
+	Query string
+	// Shards are ordered by shard id.
+	Shards []ShardPlan
+	// Shapes group shards that were explained without errors by the plan
+	// shape, from the most to the least common.
+	Shapes []PlanShape
+}
+
+// Differs reports whether shards use plans of different shapes.
+func (r *ExplainReport) Differs() bool {
+	return len(r.Shapes) > 1
+}
+
+// Outliers returns ids of the shards whose plan shape differs from
+// the most common one, e.g. shards that use a sequential scan where other
+// shards use an index scan because of a missing index.
+func (r *ExplainReport) Outliers() []int64 {
+	var ids []int64
+	for i := 1; i < len(r.Shapes); i++ {
+		ids = append(ids, r.Shapes[i].ShardIDs...)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// ExplainAll concurrently runs EXPLAIN (FORMAT JSON) for the query on
+// every shard and groups shards by the shape of their plans. Shards that
+// fail to explain the query are reported with the error; the first error
+// is also returned.
+func (cl *Cluster) ExplainAll(
+	ctx context.Context, query string, params ...interface{},
+) (*ExplainReport, error) {
+	report := &ExplainReport{
+		Query:  query,
+		Shards: make([]ShardPlan, cl.nshards),
+	}
+
+	err := cl.ForEachShardContext(ctx, &ForEachOptions{
+		ContinueOnError: true,
+	}, func(ctx context.Context, shard *pg.DB) error {
+		shardID := shard.Param("SHARD_ID").(int64)
+		p := &report.Shards[shardID]
+		p.ShardID = shardID
+
+		plan, err := explain(ctx, shard, query, params...)
+		if err != nil {
+			p.Err = WrapShardError(shard, err)
+			return p.Err
+		}
+		p.Plan = plan
+		p.Shape = planShape(plan)
+		return nil
+	})
+
+	byShape := make(map[string]int)
+	for i := range report.Shards {
+		p := &report.Shards[i]
+		if p.Err != nil {
+			continue
+		}
+		ind, ok := byShape[p.Shape]
+		if !ok {
+			ind = len(report.Shapes)
+			byShape[p.Shape] = ind
+			report.Shapes = append(report.Shapes, PlanShape{Shape: p.Shape})
+		}
+		report.Shapes[ind].ShardIDs = append(report.Shapes[ind].ShardIDs, p.ShardID)
+	}
+	sort.SliceStable(report.Shapes, func(i, j int) bool {
+		return len(report.Shapes[i].ShardIDs) > len(report.Shapes[j].ShardIDs)
+	})
+
+	return report, err
+}
+
+func explain(ctx context.Context, shard *pg.DB, query string, params ...interface{}) (*PlanNode, error) {
+	var s string
+	_, err := shard.QueryOneContext(ctx, pg.Scan(&s), "EXPLAIN (FORMAT JSON) "+query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []struct {
+		Plan PlanNode `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(s), &plans); err != nil {
+		return nil, fmt.Errorf("sharding: can't parse plan: %w", err)
+	}
+	if len(plans) == 0 {
+		return nil, errors.New("sharding: EXPLAIN returned no plans")
+	}
+	return &plans[0].Plan, nil
+}
+
+// planShape returns the scans of the plan in depth-first order.
+func planShape(plan *PlanNode) string {
+	var scans []string
+	var walk func(node *PlanNode)
+	walk = func(node *PlanNode) {
+		if strings.HasSuffix(node.NodeType, "Scan") {
+			scan := node.NodeType
+			if node.RelationName != "" {
+				scan += " on " + node.RelationName
+			}
+			if node.IndexName != "" {
+				scan += " using " + node.IndexName
+			}
+			scans = append(scans, scan)
+		}
+		for i := range node.Plans {
+			walk(&node.Plans[i])
+		}
+	}
+	walk(plan)
+	return strings.Join(scans, "; ")
+}
@@ -0,0 +1,67 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	indexScanPlan = `[{"Plan": {"Node Type": "Index Scan", "Relation Name": "users",
+		"Index Name": "users_email_idx", "Total Cost": 8.3, "Plan Rows": 1}}]`
+	seqScanPlan = `[{"Plan": {"Node Type": "Limit", "Total Cost": 25.5, "Plan Rows": 1,
+		"Plans": [{"Node Type": "Seq Scan", "Relation Name": "users", "Total Cost": 25.5, "Plan Rows": 1}]}}]`
+)
+
+var _ = Describe("ExplainAll", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(3)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("groups shards by plan shape", func() {
+		cluster.SetResult(shardingtest.AllShards, "EXPLAIN", &shardingtest.Result{
+			Columns: []string{"QUERY PLAN"},
+			Rows:    [][]interface{}{{indexScanPlan}},
+		})
+		cluster.SetResult(2, "EXPLAIN", &shardingtest.Result{
+			Columns: []string{"QUERY PLAN"},
+			Rows:    [][]interface{}{{seqScanPlan}},
+		})
+
+		report, err := cluster.ExplainAll(ctx, "SELECT * FROM ?SHARD.users WHERE email = ?", "a@b.c")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Queries(0)).To(ContainElement(
+			"EXPLAIN (FORMAT JSON) SELECT * FROM shard0.users WHERE email = 'a@b.c'"))
+
+		Expect(report.Shards[0].Plan.IndexName).To(Equal("users_email_idx"))
+		Expect(report.Shards[2].Shape).To(Equal("Seq Scan on users"))
+		Expect(report.Differs()).To(BeTrue())
+		Expect(report.Shapes[0].Shape).To(Equal("Index Scan on users using users_email_idx"))
+		Expect(report.Shapes[0].ShardIDs).To(Equal([]int64{0, 1}))
+		Expect(report.Outliers()).To(Equal([]int64{2}))
+	})
+
+	It("reports shards that fail", func() {
+		cluster.SetResult(shardingtest.AllShards, "EXPLAIN", &shardingtest.Result{
+			Columns: []string{"QUERY PLAN"},
+			Rows:    [][]interface{}{{indexScanPlan}},
+		})
+		cluster.SetQueryError(1, "EXPLAIN", &shardingtest.Error{
+			Code:    "42P01",
+			Message: `relation "shard1.users" does not exist`,
+		})
+
+		report, err := cluster.ExplainAll(ctx, "SELECT * FROM ?SHARD.users")
+		Expect(err).To(HaveOccurred())
+		Expect(report.Shards[1].Err).To(Equal(err))
+		Expect(report.Differs()).To(BeFalse())
+		Expect(report.Shapes[0].ShardIDs).To(Equal([]int64{0, 2}))
+	})
+})
@@ -1,7 +1,44 @@
 package sharding
 
-import "math/rand"
+import (
+	"math/rand"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
 
 func SetUUIDRand(r *rand.Rand) {
 	uuidRand = r
 }
+
+func (d *HotShardDetector) SetNow(now func() time.Time) {
+	d.start = now()
+	d.now = now
+}
+
+func (d *HotShardDetector) Observe(shardID int64, latency time.Duration, err error) {
+	d.observe(shardID, latency, err)
+}
+
+func Mod(n uint64, d int) uint64 {
+	v := newDivisor(d)
+	return v.mod(n)
+}
+
+func SetQuotaNow(cl *Cluster, now func() time.Time) {
+	cl.quotas.now = now
+}
+
+func SetShedNow(cl *Cluster, now func() time.Time) {
+	cl.shedNow = now
+}
+
+func ObserveReplicaLatency(cl *Cluster, replica *pg.DB, latency time.Duration) {
+	cl.topology().latency[replica].observe(latency, time.Now())
+}
+
+func TenantCacheLen(r *TenantRouter) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.cache)
+}
@@ -0,0 +1,184 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// FailoverOptions configures a FailoverController.
+type FailoverOptions struct {
+	// Standbys maps primary databases to the standbys that take over
+	// their shards when the primary is marked unhealthy.
+	Standbys map[*pg.DB]*pg.DB
+	// Promote, if not nil, is called before the shards are redirected
+	// to the standby, e.g. to run SELECT pg_promote() on it. The failover
+	// is aborted when it returns an error.
+	Promote func(ctx context.Context, primary, standby *pg.DB) error
+	// OnFailover, if not nil, is called with the result of every
+	// automatic failover.
+	OnFailover func(primary, standby *pg.DB, err error)
+
+	// MaxRetries is the number of times Run retries the fn that failed
+	// with a network error. Default is 0 which disables retries.
+	MaxRetries int
+	// RetryBackoff is the delay before a retry. Default is 100ms.
+	RetryBackoff time.Duration
+}
+
+// FailoverController redirects shards of a primary database marked
+// unhealthy with SetHealthy, e.g. by MonitorHealth, to its standby using
+// ReplaceDB, which fires DBReplaced and ShardMapChanged events. It is an
+// application-level failover: the standby must be promoted by Promote or
+// by external tooling.
+type FailoverController struct {
+	cl  *Cluster
+	opt *FailoverOptions
+
+	mu         sync.Mutex
+	closed     bool
+	standbys   map[*pg.DB]*pg.DB
+	running    map[*pg.DB]struct{} // primaries being failed over
+	wg         sync.WaitGroup
+	unregister func()
+}
+
+// NewFailoverController returns a controller that fails over primaries
+// of the cluster to the standbys from the options.
+func (cl *Cluster) NewFailoverController(opt *FailoverOptions) *FailoverController {
+	cp := *opt
+	opt = &cp
+	if opt.RetryBackoff <= 0 {
+		opt.RetryBackoff = 100 * time.Millisecond
+	}
+	c := &FailoverController{
+		cl:       cl,
+		opt:      opt,
+		standbys: make(map[*pg.DB]*pg.DB, len(opt.Standbys)),
+		running:  make(map[*pg.DB]struct{}),
+	}
+	for primary, standby := range opt.Standbys {
+		c.standbys[primary] = standby
+	}
+	c.unregister = cl.OnTopologyChange(c.onTopologyChange)
+	return c
+}
+
+func (c *FailoverController) onTopologyChange(ev TopologyEvent) {
+	if ev.Type != DBHealthChanged || ev.Healthy {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	if _, ok := c.standbys[ev.DB]; !ok {
+		return
+	}
+
+	// Listeners must not block so the failover runs in a goroutine.
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		standby, err := c.failover(context.Background(), ev.DB)
+		if c.opt.OnFailover != nil {
+			c.opt.OnFailover(ev.DB, standby, err)
+		}
+	}()
+}
+
+// Failover redirects shards of the primary to its standby. A standby is
+// used only once: it is removed from the controller after the shards are
+// redirected, so a failover that failed, e.g. because Promote failed,
+// can be retried.
+func (c *FailoverController) Failover(ctx context.Context, primary *pg.DB) error {
+	_, err := c.failover(ctx, primary)
+	return err
+}
+
+func (c *FailoverController) failover(ctx context.Context, primary *pg.DB) (*pg.DB, error) {
+	c.mu.Lock()
+	standby, ok := c.standbys[primary]
+	if !ok {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("sharding: %s has no standby", primary)
+	}
+	if _, ok := c.running[primary]; ok {
+		c.mu.Unlock()
+		return standby, fmt.Errorf("sharding: failover of %s is in progress", primary.Options().Addr)
+	}
+	c.running[primary] = struct{}{}
+	c.mu.Unlock()
+
+	var err error
+	if c.opt.Promote != nil {
+		if err = c.opt.Promote(ctx, primary, standby); err != nil {
+			err = fmt.Errorf("sharding: can't promote %s: %w", standby.Options().Addr, err)
+		}
+	}
+	if err == nil {
+		err = c.cl.ReplaceDB(ctx, primary, standby)
+		var auditErr *AuditError
+		if errors.As(err, &auditErr) {
+			// The shards are redirected; only the audit failed.
+			err = nil
+		}
+	}
+
+	c.mu.Lock()
+	delete(c.running, primary)
+	if err == nil {
+		delete(c.standbys, primary)
+	}
+	c.mu.Unlock()
+
+	auditErr := c.cl.audit(ctx, "failover", map[string]interface{}{
+		"primary": primary.Options().Addr,
+		"standby": standby.Options().Addr,
+	}, err)
+	if err != nil {
+		return standby, err
+	}
+	return standby, auditErr
+}
+
+// Run calls the fn with the shard the number maps to. When the fn fails
+// with a network error, it is retried up to MaxRetries times with the
+// shard the number maps to at the time of the retry, so queries that
+// were running when a primary failed are retried on the standby.
+// The fn must be safe to retry.
+func (c *FailoverController) Run(
+	ctx context.Context, number int64, fn func(ctx context.Context, shard *pg.DB) error,
+) error {
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx, c.cl.Shard(number))
+		if err == nil || attempt >= c.opt.MaxRetries || !isNetworkError(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(c.opt.RetryBackoff):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Close stops automatic failovers and waits for running ones to finish.
+func (c *FailoverController) Close() error {
+	c.unregister()
+
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	return nil
+}
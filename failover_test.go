@@ -0,0 +1,150 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FailoverController", func() {
+	var db1, db2, standby *pg.DB
+	var cluster *sharding.Cluster
+
+	var mu sync.Mutex
+	var events []sharding.TopologyEvent
+
+	BeforeEach(func() {
+		db1 = pg.Connect(&pg.Options{Addr: "db1"})
+		db2 = pg.Connect(&pg.Options{Addr: "db2"})
+		standby = pg.Connect(&pg.Options{Addr: "standby1"})
+		cluster = sharding.NewCluster([]*pg.DB{db1, db2}, 4)
+
+		events = nil
+		cluster.OnTopologyChange(func(ev sharding.TopologyEvent) {
+			mu.Lock()
+			events = append(events, ev)
+			mu.Unlock()
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+		// One of them is not in the cluster and is still open.
+		_ = db1.Close()
+		_ = standby.Close()
+	})
+
+	It("redirects shards of an unhealthy primary to the standby", func() {
+		done := make(chan error, 1)
+		c := cluster.NewFailoverController(&sharding.FailoverOptions{
+			Standbys: map[*pg.DB]*pg.DB{db1: standby},
+			OnFailover: func(primary, _ *pg.DB, err error) {
+				done <- err
+			},
+		})
+		defer c.Close()
+
+		cluster.SetHealthy(db2, false)
+		cluster.SetHealthy(db1, false)
+		Eventually(done).Should(Receive(BeNil()))
+
+		for i, shard := range cluster.Shards(nil) {
+			if i%2 == 0 {
+				Expect(shard.Options().Addr).To(Equal("standby1"))
+			} else {
+				Expect(shard.Options().Addr).To(Equal("db2"))
+			}
+		}
+		Expect(cluster.Healthy(standby)).To(BeTrue())
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(events).To(ContainElement(sharding.TopologyEvent{
+			Type:  sharding.DBReplaced,
+			DB:    standby,
+			OldDB: db1,
+		}))
+
+		Expect(c.Failover(ctx, db1)).To(MatchError(ContainSubstring("has no standby")))
+	})
+
+	It("aborts when the standby can't be promoted", func() {
+		c := cluster.NewFailoverController(&sharding.FailoverOptions{
+			Standbys: map[*pg.DB]*pg.DB{db1: standby},
+			Promote: func(context.Context, *pg.DB, *pg.DB) error {
+				return errors.New("replication lag")
+			},
+		})
+		defer c.Close()
+
+		err := c.Failover(ctx, db1)
+		Expect(err).To(MatchError("sharding: can't promote standby1: replication lag"))
+		Expect(cluster.Shard(0).Options().Addr).To(Equal("db1"))
+	})
+
+	It("keeps the standby when the promotion fails", func() {
+		var calls int
+		c := cluster.NewFailoverController(&sharding.FailoverOptions{
+			Standbys: map[*pg.DB]*pg.DB{db1: standby},
+			Promote: func(context.Context, *pg.DB, *pg.DB) error {
+				calls++
+				if calls == 1 {
+					return io.ErrUnexpectedEOF
+				}
+				return nil
+			},
+		})
+		defer c.Close()
+
+		Expect(c.Failover(ctx, db1)).To(MatchError("sharding: can't promote standby1: unexpected EOF"))
+		Expect(cluster.Shard(0).Options().Addr).To(Equal("db1"))
+
+		Expect(c.Failover(ctx, db1)).NotTo(HaveOccurred())
+		Expect(cluster.Shard(0).Options().Addr).To(Equal("standby1"))
+		Expect(c.Failover(ctx, db1)).To(MatchError(ContainSubstring("has no standby")))
+	})
+
+	It("retries queries failed with network errors", func() {
+		c := cluster.NewFailoverController(&sharding.FailoverOptions{
+			MaxRetries:   2,
+			RetryBackoff: time.Millisecond,
+		})
+		defer c.Close()
+
+		var calls int
+		err := c.Run(ctx, 0, func(_ context.Context, shard *pg.DB) error {
+			calls++
+			if calls == 1 {
+				return io.EOF
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls).To(Equal(2))
+
+		calls = 0
+		err = c.Run(ctx, 0, func(context.Context, *pg.DB) error {
+			calls++
+			return io.ErrUnexpectedEOF
+		})
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		Expect(calls).To(Equal(3))
+	})
+	It("does not modify the options", func() {
+		opt := &sharding.FailoverOptions{
+			Standbys: map[*pg.DB]*pg.DB{db1: standby},
+		}
+		c := cluster.NewFailoverController(opt)
+		Expect(c.Close()).NotTo(HaveOccurred())
+		Expect(opt.RetryBackoff).To(BeZero())
+	})
+})
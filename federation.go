@@ -0,0 +1,206 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrClusterNotFound is returned by Federation when there is no cluster
+// with the name.
+var ErrClusterNotFound = errors.New("sharding: cluster not found")
+
+// Federation routes keys to several independent named clusters,
+// e.g. one cluster per region.
+type Federation struct {
+	mu       sync.RWMutex
+	clusters map[string]*Cluster
+}
+
+// NewFederation returns a federation of the clusters indexed by name.
+func NewFederation(clusters map[string]*Cluster) *Federation {
+	f := &Federation{
+		clusters: make(map[string]*Cluster, len(clusters)),
+	}
+	for name, cl := range clusters {
+		f.clusters[name] = cl
+	}
+	return f
+}
+
+// Add adds the cluster with the name replacing the cluster with
+// the same name.
+func (f *Federation) Add(name string, cl *Cluster) {
+	f.mu.Lock()
+	f.clusters[name] = cl
+	f.mu.Unlock()
+}
+
+// Remove removes the cluster with the name. The cluster is not closed.
+func (f *Federation) Remove(name string) {
+	f.mu.Lock()
+	delete(f.clusters, name)
+	f.mu.Unlock()
+}
+
+// Names returns sorted names of the clusters.
+func (f *Federation) Names() []string {
+	f.mu.RLock()
+	names := make([]string, 0, len(f.clusters))
+	for name := range f.clusters {
+		names = append(names, name)
+	}
+	f.mu.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// Cluster returns the cluster with the name.
+func (f *Federation) Cluster(name string) (*Cluster, error) {
+	f.mu.RLock()
+	cl, ok := f.clusters[name]
+	f.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrClusterNotFound, name)
+	}
+	return cl, nil
+}
+
+// Shard maps the number to the corresponding shard in the cluster
+// with the name.
+func (f *Federation) Shard(name string, number int64) (*pg.DB, error) {
+	cl, err := f.Cluster(name)
+	if err != nil {
+		return nil, err
+	}
+	return cl.Shard(number), nil
+}
+
+// SplitShard is like Cluster.SplitShard, but for the cluster with the name.
+func (f *Federation) SplitShard(name string, id int64) (*pg.DB, error) {
+	cl, err := f.Cluster(name)
+	if err != nil {
+		return nil, err
+	}
+	return cl.SplitShard(id), nil
+}
+
+// ForEachCluster concurrently calls the fn on each cluster and returns
+// the first error prefixed with the cluster name.
+func (f *Federation) ForEachCluster(fn func(name string, cl *Cluster) error) error {
+	names := f.Names()
+
+	errCh := make(chan error, 1)
+	var wg sync.WaitGroup
+	for _, name := range names {
+		cl, err := f.Cluster(name)
+		if err != nil {
+			continue // removed concurrently
+		}
+
+		wg.Add(1)
+		go func(name string, cl *Cluster) {
+			defer wg.Done()
+			if err := fn(name, cl); err != nil {
+				select {
+				case errCh <- fmt.Errorf("sharding: cluster %s: %w", name, err):
+				default:
+				}
+			}
+		}(name, cl)
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+		return nil
+	}
+}
+
+// ClusterHealth is the number of healthy database servers in a cluster.
+type ClusterHealth struct {
+	Servers int
+	Healthy int
+}
+
+// FederationHealth is the health of all clusters in a federation.
+type FederationHealth struct {
+	// Servers and Healthy are totals over all clusters.
+	Servers  int
+	Healthy  int
+	Clusters map[string]ClusterHealth
+}
+
+// Health returns the number of servers marked healthy with SetHealthy
+// in every cluster.
+func (f *Federation) Health() FederationHealth {
+	health := FederationHealth{
+		Clusters: make(map[string]ClusterHealth),
+	}
+	for _, name := range f.Names() {
+		cl, err := f.Cluster(name)
+		if err != nil {
+			continue
+		}
+
+		var ch ClusterHealth
+		for _, db := range cl.topology().servers {
+			ch.Servers++
+			if cl.Healthy(db) {
+				ch.Healthy++
+			}
+		}
+
+		health.Servers += ch.Servers
+		health.Healthy += ch.Healthy
+		health.Clusters[name] = ch
+	}
+	return health
+}
+
+// PingAll concurrently pings database servers of every cluster.
+func (f *Federation) PingAll(ctx context.Context) map[string][]ServerPing {
+	var mu sync.Mutex
+	pings := make(map[string][]ServerPing)
+	_ = f.ForEachCluster(func(name string, cl *Cluster) error {
+		p := cl.PingAll(ctx)
+		mu.Lock()
+		pings[name] = p
+		mu.Unlock()
+		return nil
+	})
+	return pings
+}
+
+// ShedStats returns load shedding decisions of every cluster.
+func (f *Federation) ShedStats() map[string]ShedStats {
+	stats := make(map[string]ShedStats)
+	for _, name := range f.Names() {
+		if cl, err := f.Cluster(name); err == nil {
+			stats[name] = cl.ShedStats()
+		}
+	}
+	return stats
+}
+
+// Close closes every cluster.
+func (f *Federation) Close() error {
+	var firstErr error
+	for _, name := range f.Names() {
+		cl, err := f.Cluster(name)
+		if err != nil {
+			continue
+		}
+		if err := cl.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
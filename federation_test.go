@@ -0,0 +1,70 @@
+package sharding_test
+
+import (
+	"errors"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Federation", func() {
+	var us, eu *shardingtest.Cluster
+	var fed *sharding.Federation
+
+	BeforeEach(func() {
+		us = shardingtest.NewCluster(2)
+		eu = shardingtest.NewCluster(4)
+		fed = sharding.NewFederation(map[string]*sharding.Cluster{
+			"us": us.Cluster,
+			"eu": eu.Cluster,
+		})
+	})
+
+	AfterEach(func() {
+		Expect(fed.Close()).NotTo(HaveOccurred())
+	})
+
+	It("routes by cluster name and key", func() {
+		Expect(fed.Names()).To(Equal([]string{"eu", "us"}))
+
+		shard, err := fed.Shard("eu", 7)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = shard.ExecContext(ctx, "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(eu.RoutedShards()).To(Equal([]int64{3}))
+		Expect(us.RoutedShards()).To(BeEmpty())
+
+		_, err = fed.Shard("asia", 7)
+		Expect(errors.Is(err, sharding.ErrClusterNotFound)).To(BeTrue())
+	})
+
+	It("calls the fn on each cluster", func() {
+		err := fed.ForEachCluster(func(name string, cl *sharding.Cluster) error {
+			_, err := cl.Shard(0).ExecContext(ctx, "SELECT ?", name)
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(us.Queries(0)).To(Equal([]string{"SELECT 'us'"}))
+		Expect(eu.Queries(0)).To(Equal([]string{"SELECT 'eu'"}))
+
+		us.SetError(0, &shardingtest.Error{Message: "fake error"})
+		err = fed.ForEachCluster(func(name string, cl *sharding.Cluster) error {
+			_, err := cl.Shard(0).ExecContext(ctx, "SELECT 1")
+			return err
+		})
+		Expect(err).To(MatchError("sharding: cluster us: ERROR #XX000 fake error"))
+	})
+
+	It("aggregates health", func() {
+		_, db := eu.DB(1)
+		eu.SetHealthy(db, false)
+
+		health := fed.Health()
+		Expect(health.Servers).To(Equal(6))
+		Expect(health.Healthy).To(Equal(5))
+		Expect(health.Clusters["eu"]).To(Equal(sharding.ClusterHealth{Servers: 4, Healthy: 3}))
+	})
+})
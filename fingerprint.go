@@ -0,0 +1,143 @@
+package sharding
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// ErrFingerprintMismatch is returned when an id or a UUID was minted by
+// a cluster with a different routing configuration, e.g. a different
+// number of shards or id bit layout.
+var ErrFingerprintMismatch = errors.New("sharding: id fingerprint does not match cluster configuration")
+
+// uuidFingerprintByte is the UUID byte that holds the fingerprint instead
+// of random bits.
+const uuidFingerprintByte = 10
+
+// WithFingerprint embeds the fingerprint of the routing configuration
+// (number of shards, routing function, epoch, and id bit layout) into
+// ids and UUIDs minted by the cluster with NewShardIDGen, NewUUID, and
+// NewUUIDGen. Ids use the `bits` high bits of the sequence, which reduces
+// the number of ids per millisecond. UUIDs use 8 random bits.
+//
+// CheckID and CheckUUID use the fingerprint to detect ids decoded using
+// a wrong configuration. Ids generated by the next_id() SQL function are
+// not fingerprinted.
+func WithFingerprint(bits uint) Option {
+	return func(cl *Cluster) {
+		if bits >= cl.gen.seqBits {
+			cl.optErr = errors.New("sharding: fingerprint must be shorter than the sequence")
+			return
+		}
+		cl.fpBits = bits
+	}
+}
+
+// Fingerprint returns a hash of the cluster routing configuration.
+func (cl *Cluster) Fingerprint() uint32 {
+	var b [8]byte
+	h := fnv.New32a()
+	for _, n := range []int64{
+		int64(cl.nshards),
+		cl.gen.epoch,
+		int64(cl.gen.shardBits),
+		int64(cl.gen.seqBits),
+	} {
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		_, _ = h.Write(b[:])
+	}
+	if cl.gen.unsigned {
+		_, _ = h.Write([]byte("unsigned"))
+	}
+	if cl.gen.tick != 1 {
+		binary.BigEndian.PutUint64(b[:], uint64(cl.gen.tick))
+		_, _ = h.Write([]byte("precision"))
+		_, _ = h.Write(b[:])
+	}
+	if cl.scramble {
+		_, _ = h.Write([]byte("splitmix64"))
+	}
+	// Shards are selected using the number modulo nshards.
+	_, _ = h.Write([]byte("mod"))
+	return h.Sum32()
+}
+
+// idFingerprint returns the high bits of the fingerprint which are
+// better mixed by FNV than the low ones.
+func (cl *Cluster) idFingerprint() int64 {
+	return int64(cl.Fingerprint() >> (32 - cl.fpBits))
+}
+
+func (cl *Cluster) uuidFingerprint() byte {
+	return byte(cl.Fingerprint() >> 24)
+}
+
+// NewShardIDGen returns a new id generator for the shard with the number
+// that embeds the fingerprint when WithFingerprint is used. Generators
+// have independent sequences so ids of different generators for the
+// same shard collide within a millisecond.
+func (cl *Cluster) NewShardIDGen(number int64) *ShardIDGen {
+	return cl.shardIDGenByID(cl.shardID(number))
+}
+
+// shardIDGenByID is like NewShardIDGen, but takes the shard id instead
+// of the number so the id is not scrambled.
+func (cl *Cluster) shardIDGenByID(shardID int64) *ShardIDGen {
+	g := NewShardIDGen(cl.wrapShardID(shardID), cl.gen)
+	if cl.fpBits > 0 {
+		g.fpBits = cl.fpBits
+		g.fp = cl.idFingerprint()
+	}
+	return g
+}
+
+// NewUUID returns a UUID for the shard with the number that embeds
+// the fingerprint when WithFingerprint is used.
+func (cl *Cluster) NewUUID(number int64, tm time.Time) UUID {
+	u := NewUUID(cl.shardID(number), tm)
+	if cl.fpBits > 0 {
+		u[uuidFingerprintByte] = cl.uuidFingerprint()
+	}
+	return u
+}
+
+// NewUUIDGen returns a new UUID generator for the shard with the number
+// that embeds the fingerprint when WithFingerprint is used.
+func (cl *Cluster) NewUUIDGen(number int64) *UUIDGen {
+	g := NewUUIDGen(cl.shardID(number))
+	if cl.fpBits > 0 {
+		g.fp = cl.uuidFingerprint()
+		g.hasFP = true
+	}
+	return g
+}
+
+// CheckID returns an error wrapping ErrFingerprintMismatch when the id
+// has a fingerprint different from the cluster one. It always succeeds
+// without WithFingerprint.
+func (cl *Cluster) CheckID(id int64) error {
+	if cl.fpBits == 0 {
+		return nil
+	}
+	_, _, seq := cl.gen.SplitID(id)
+	got := seq >> (cl.gen.seqBits - cl.fpBits)
+	if want := cl.idFingerprint(); got != want {
+		return fmt.Errorf("%w: id %d has fingerprint %d, wanted %d", ErrFingerprintMismatch, id, got, want)
+	}
+	return nil
+}
+
+// CheckUUID is like CheckID, but for UUIDs minted with NewUUID.
+func (cl *Cluster) CheckUUID(u UUID) error {
+	if cl.fpBits == 0 {
+		return nil
+	}
+	got := u[uuidFingerprintByte]
+	if want := cl.uuidFingerprint(); got != want {
+		return fmt.Errorf("%w: uuid %s has fingerprint %d, wanted %d", ErrFingerprintMismatch, u, got, want)
+	}
+	return nil
+}
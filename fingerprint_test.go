@@ -0,0 +1,70 @@
+package sharding_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestFingerprint(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	defer db.Close()
+
+	cl := sharding.NewCluster([]*pg.DB{db}, 8, sharding.WithFingerprint(3))
+	other := sharding.NewCluster([]*pg.DB{db}, 16, sharding.WithFingerprint(3))
+	if cl.Fingerprint() == other.Fingerprint() {
+		t.Fatal("expected different fingerprints")
+	}
+	if cl.Fingerprint()>>29 == other.Fingerprint()>>29 {
+		t.Fatal("test clusters must have different 3-bit fingerprints")
+	}
+
+	tm := time.Now()
+	gen := cl.NewShardIDGen(3)
+	for i := 0; i < 1000; i++ {
+		id := gen.NextID(tm)
+		if err := cl.CheckID(id); err != nil {
+			t.Fatal(err)
+		}
+		if err := other.CheckID(id); !errors.Is(err, sharding.ErrFingerprintMismatch) {
+			t.Fatalf("got %v, wanted ErrFingerprintMismatch", err)
+		}
+		if _, shardID, _ := cl.IDGen().SplitID(id); shardID != 3 {
+			t.Fatalf("got shard %d, wanted 3", shardID)
+		}
+	}
+
+	first, last, err := gen.AllocateBlock(tm, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last-first != 511 {
+		t.Fatalf("got block [%d, %d], wanted 512 ids", first, last)
+	}
+	if err := cl.CheckID(last); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := gen.AllocateBlock(tm, 513); err == nil {
+		t.Fatal("expected an error for too large block")
+	}
+
+	u := cl.NewUUID(11, tm)
+	if u.ShardID() != 3 {
+		t.Fatalf("got shard %d, wanted 3", u.ShardID())
+	}
+	if err := cl.CheckUUID(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.CheckUUID(u); !errors.Is(err, sharding.ErrFingerprintMismatch) {
+		t.Fatalf("got %v, wanted ErrFingerprintMismatch", err)
+	}
+
+	plain := sharding.NewCluster([]*pg.DB{db}, 8)
+	if err := plain.CheckID(gen.NextID(tm)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,228 @@
+package sharding
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ForEachOptions configures ForEachShardContext.
+type ForEachOptions struct {
+	// Concurrency is the number of shards processed concurrently on every
+	// database server. Default is AutoConcurrency. WithSequentialFanOut
+	// limits it to 1.
+	Concurrency int
+	// Adaptive tunes AutoConcurrency.
+	Adaptive *AdaptiveOptions
+	// ContinueOnError keeps starting the fn on remaining shards after
+	// it fails. By default no new shards are started after the first
+	// error and the ctx passed to running fns is cancelled.
+	ContinueOnError bool
+	// ErrorPolicy, if not nil, overrides ContinueOnError.
+	ErrorPolicy *ErrorPolicy
+	// Progress, if not nil, is called after the fn returns on a shard with
+	// the number of processed shards, the total number of shards, the
+	// shard id and the fn error. Calls are serialized so it can render
+	// a progress bar without locking.
+	Progress func(done, total int, shardID int64, err error)
+}
+
+// ErrorPolicy controls how ForEachShardContext handles errors.
+type ErrorPolicy struct {
+	// FailFast stops starting the fn on new shards and cancels the ctx
+	// passed to running fns after the first error. It is the same
+	// as MaxErrors: 1.
+	FailFast bool
+	// MaxErrors stops like FailFast after the number of errors. Zero
+	// means best-effort: the fn is called on every shard.
+	MaxErrors int
+	// CollectAll returns a *MultiError with the errors of all failed
+	// shards when the fn fails on several shards. By default only
+	// the first error is returned.
+	CollectAll bool
+}
+
+// maxErrors returns the number of errors after which no new shards are
+// started or 0.
+func (opt *ForEachOptions) maxErrors() int {
+	if p := opt.ErrorPolicy; p != nil {
+		if p.FailFast {
+			return 1
+		}
+		return p.MaxErrors
+	}
+	if opt.ContinueOnError {
+		return 0
+	}
+	return 1
+}
+
+// ForEachShardContext concurrently calls the fn on every shard in the
+// cluster and returns the first error. It stops starting the fn on new
+// shards and returns after the running fns exit when the ctx is cancelled.
+func (cl *Cluster) ForEachShardContext(
+	ctx context.Context, opt *ForEachOptions, fn func(ctx context.Context, shard *pg.DB) error,
+) error {
+	return cl.topology().forEachShard(ctx, nil, opt, fn)
+}
+
+// ForEachShardContext is like Cluster.ForEachShardContext, but for the
+// shards in the subcluster.
+func (cl *SubCluster) ForEachShardContext(
+	ctx context.Context, opt *ForEachOptions, fn func(ctx context.Context, shard *pg.DB) error,
+) error {
+	return cl.cl.topology().forEachShard(ctx, cl.ids, opt, fn)
+}
+
+// shardLimiter limits the number of shards processed concurrently
+// on a database server.
+type shardLimiter interface {
+	// acquire waits for a free slot and returns false if the stop
+	// channel was closed first.
+	acquire(stop <-chan struct{}) bool
+	release(latency time.Duration, err error)
+	wake()
+}
+
+type fixedLimiter chan struct{}
+
+func (l fixedLimiter) acquire(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return false
+	default:
+	}
+	select {
+	case l <- struct{}{}:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+func (l fixedLimiter) release(time.Duration, error) {
+	<-l
+}
+
+func (l fixedLimiter) wake() {}
+
+// forEachShard calls the fn on the shards with the ids, or on every shard
+// when ids is nil, processing database servers concurrently.
+func (t *topology) forEachShard(
+	ctx context.Context, ids []int, opt *ForEachOptions, fn func(ctx context.Context, shard *pg.DB) error,
+) error {
+	if opt == nil {
+		opt = new(ForEachOptions)
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	maxErrors := opt.maxErrors()
+	collectAll := opt.ErrorPolicy != nil && opt.ErrorPolicy.CollectAll
+	var errsMu sync.Mutex
+	var errs []error
+	var nerrs int
+	fail := func(shard *pg.DB, err error) {
+		errsMu.Lock()
+		defer errsMu.Unlock()
+
+		nerrs++
+		if maxErrors > 0 && nerrs == maxErrors {
+			cancel()
+		}
+		if collectAll {
+			errs = append(errs, WrapShardError(shard, err))
+		} else if len(errs) == 0 {
+			errs = append(errs, err)
+		}
+	}
+
+	total := len(ids)
+	if ids == nil {
+		total = len(t.shards)
+	}
+	var progressMu sync.Mutex
+	var ndone int
+	progress := func(shard *pg.DB, err error) {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		ndone++
+		opt.Progress(ndone, total, shard.Param("SHARD_ID").(int64), err)
+	}
+
+	_ = t.forEachDB(func(db *pg.DB) error {
+		var limiter shardLimiter
+		if t.sequential {
+			limiter = make(fixedLimiter, 1)
+		} else if opt.Concurrency <= AutoConcurrency {
+			limiter = newAIMDLimiter(db, opt.Adaptive)
+		} else {
+			limiter = make(fixedLimiter, opt.Concurrency)
+		}
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				limiter.wake()
+			case <-done:
+			}
+		}()
+
+		var wg sync.WaitGroup
+		run := func(shard *pg.DB) bool {
+			if shard.Options() != db.Options() {
+				return true
+			}
+			if !limiter.acquire(ctx.Done()) {
+				return false
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				start := time.Now()
+				err := fn(ctx, shard)
+				// Fail before releasing the slot so no new shard is started.
+				if err != nil {
+					fail(shard, err)
+				}
+				if opt.Progress != nil {
+					progress(shard, err)
+				}
+				limiter.release(time.Since(start), err)
+			}()
+			return true
+		}
+
+		if ids == nil {
+			for i := range t.shards {
+				if !run(t.shards[i].shard) {
+					break
+				}
+			}
+		} else {
+			for _, id := range ids {
+				if !run(t.shards[id].shard) {
+					break
+				}
+			}
+		}
+
+		wg.Wait()
+		return nil
+	})
+
+	switch {
+	case len(errs) > 1:
+		return &MultiError{Errors: errs}
+	case len(errs) == 1:
+		return errs[0]
+	}
+	return parent.Err()
+}
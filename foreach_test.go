@@ -0,0 +1,158 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ForEachShardContext", func() {
+	var cluster *sharding.Cluster
+	var mu sync.Mutex
+	var called []int64
+
+	record := func(shard *pg.DB) {
+		mu.Lock()
+		called = append(called, shardID(shard))
+		mu.Unlock()
+	}
+
+	BeforeEach(func() {
+		called = nil
+		db := pg.Connect(&pg.Options{Addr: "db1"})
+		cluster = sharding.NewCluster([]*pg.DB{db}, 4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("stops after the first error", func() {
+		opt := &sharding.ForEachOptions{Concurrency: 1}
+		err := cluster.ForEachShardContext(ctx, opt, func(_ context.Context, shard *pg.DB) error {
+			record(shard)
+			if shardID(shard) == 1 {
+				return errors.New("fake error")
+			}
+			return nil
+		})
+		Expect(err).To(MatchError("fake error"))
+		Expect(called).To(Equal([]int64{0, 1}))
+	})
+
+	It("continues on error when configured", func() {
+		opt := &sharding.ForEachOptions{Concurrency: 1, ContinueOnError: true}
+		err := cluster.ForEachShardContext(ctx, opt, func(_ context.Context, shard *pg.DB) error {
+			record(shard)
+			if shardID(shard) == 1 {
+				return errors.New("fake error")
+			}
+			return nil
+		})
+		Expect(err).To(MatchError("fake error"))
+		Expect(called).To(Equal([]int64{0, 1, 2, 3}))
+	})
+
+	It("returns when the ctx is cancelled", func() {
+		c, cancel := context.WithCancel(ctx)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+
+		opt := &sharding.ForEachOptions{Concurrency: 2}
+		err := cluster.ForEachShardContext(c, opt, func(c context.Context, shard *pg.DB) error {
+			record(shard)
+			<-c.Done()
+			return nil
+		})
+		Expect(err).To(Equal(context.Canceled))
+		Expect(called).To(HaveLen(2))
+	})
+
+	It("supports subclusters and auto concurrency", func() {
+		err := cluster.SubCluster(1, 2).ForEachShardContext(ctx, nil, func(_ context.Context, shard *pg.DB) error {
+			record(shard)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(called).To(ConsistOf(int64(2), int64(3)))
+	})
+
+	It("reports progress", func() {
+		type event struct {
+			done, total int
+			shardID     int64
+			failed      bool
+		}
+		var events []event
+		opt := &sharding.ForEachOptions{
+			Concurrency:     1,
+			ContinueOnError: true,
+			Progress: func(done, total int, shardID int64, err error) {
+				events = append(events, event{done, total, shardID, err != nil})
+			},
+		}
+		err := cluster.ForEachShardContext(ctx, opt, func(_ context.Context, shard *pg.DB) error {
+			if shardID(shard) == 2 {
+				return errors.New("fake error")
+			}
+			return nil
+		})
+		Expect(err).To(MatchError("fake error"))
+		Expect(events).To(Equal([]event{
+			{1, 4, 0, false},
+			{2, 4, 1, false},
+			{3, 4, 2, true},
+			{4, 4, 3, false},
+		}))
+	})
+
+	It("stops after max errors", func() {
+		opt := &sharding.ForEachOptions{
+			Concurrency: 1,
+			ErrorPolicy: &sharding.ErrorPolicy{MaxErrors: 2},
+		}
+		err := cluster.ForEachShardContext(ctx, opt, func(_ context.Context, shard *pg.DB) error {
+			record(shard)
+			if shardID(shard) > 0 {
+				return errors.New("fake error")
+			}
+			return nil
+		})
+		Expect(err).To(MatchError("fake error"))
+		Expect(called).To(Equal([]int64{0, 1, 2}))
+	})
+
+	It("collects all errors", func() {
+		opt := &sharding.ForEachOptions{
+			Concurrency: 1,
+			ErrorPolicy: &sharding.ErrorPolicy{CollectAll: true},
+		}
+		err := cluster.ForEachShardContext(ctx, opt, func(_ context.Context, shard *pg.DB) error {
+			record(shard)
+			if shardID(shard)%2 == 1 {
+				return errors.New("fake error")
+			}
+			return nil
+		})
+		Expect(called).To(Equal([]int64{0, 1, 2, 3}))
+
+		var multiErr *sharding.MultiError
+		Expect(errors.As(err, &multiErr)).To(BeTrue())
+		Expect(multiErr.Errors).To(HaveLen(2))
+		Expect(err).To(MatchError("sharding: shard 1 (db1): fake error (and 1 more errors)"))
+
+		var shardErr *sharding.ShardError
+		Expect(errors.As(multiErr.Errors[1], &shardErr)).To(BeTrue())
+		Expect(shardErr.ShardID).To(Equal(int64(3)))
+	})
+})
@@ -6,4 +6,5 @@ require (
 	github.com/go-pg/pg/v10 v10.3.0
 	github.com/onsi/ginkgo v1.14.1
 	github.com/onsi/gomega v1.10.2
+	gopkg.in/yaml.v2 v2.3.0
 )
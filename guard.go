@@ -0,0 +1,62 @@
+package sharding
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// GuardedQuery is a query that is about to be executed on a shard.
+type GuardedQuery struct {
+	ShardID int64
+	// Schema is the shard schema substituted for ?SHARD.
+	Schema string
+	// DBAddr is the address of the database server.
+	DBAddr string
+	// Query is the SQL sent to the server with all params substituted.
+	Query string
+	// InTx reports whether the query is executed in a transaction.
+	InTx bool
+}
+
+// QueryGuard inspects the query before it is executed on a shard, e.g. to
+// write an audit trail or to enforce a query firewall. A non-nil error
+// rejects the query, which fails with the error without being sent
+// to the server.
+type QueryGuard func(ctx context.Context, q *GuardedQuery) error
+
+// WithQueryGuard adds the guard that is called for every query executed
+// on a shard, including queries of ShardTx, after load shedding and
+// quotas, so guards only see queries that are sent to the server unless
+// another guard rejects them. Guards are called in the order they are
+// added.
+func WithQueryGuard(guard QueryGuard) Option {
+	return func(cl *Cluster) {
+		cl.guards = append(cl.guards, guard)
+	}
+}
+
+func (h *shardHook) guard(ctx context.Context, evt *pg.QueryEvent) error {
+	query, err := evt.FormattedQuery()
+	if err != nil {
+		return err
+	}
+	_, inTx := evt.DB.(*pg.Tx)
+	return h.runGuards(ctx, string(query), inTx)
+}
+
+func (h *shardHook) runGuards(ctx context.Context, query string, inTx bool) error {
+	q := &GuardedQuery{
+		ShardID: h.shardID,
+		Schema:  h.schema,
+		DBAddr:  h.addr,
+		Query:   query,
+		InTx:    inTx,
+	}
+	for _, guard := range h.cl.guards {
+		if err := guard(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query guards", func() {
+	errForbidden := errors.New("DROP is forbidden")
+
+	var cluster *shardingtest.Cluster
+	var mu sync.Mutex
+	var guarded []sharding.GuardedQuery
+
+	BeforeEach(func() {
+		guarded = nil
+		cluster = shardingtest.NewCluster(2,
+			sharding.WithQueryGuard(func(ctx context.Context, q *sharding.GuardedQuery) error {
+				mu.Lock()
+				guarded = append(guarded, *q)
+				mu.Unlock()
+				return nil
+			}),
+			sharding.WithQueryGuard(func(ctx context.Context, q *sharding.GuardedQuery) error {
+				if strings.HasPrefix(q.Query, "DROP") {
+					return errForbidden
+				}
+				return nil
+			}),
+		)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("receives formatted queries", func() {
+		_, err := cluster.Shard(1).Exec("SELECT * FROM ?SHARD.users WHERE id = ?", 42)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(guarded).To(HaveLen(1))
+		Expect(guarded[0].ShardID).To(Equal(int64(1)))
+		Expect(guarded[0].Schema).To(Equal("shard1"))
+		Expect(guarded[0].Query).To(Equal("SELECT * FROM shard1.users WHERE id = 42"))
+		Expect(guarded[0].InTx).To(BeFalse())
+	})
+
+	It("marks queries in transactions", func() {
+		err := cluster.Shard(0).RunInTransaction(ctx, func(tx *pg.Tx) error {
+			_, err := tx.Exec("SELECT 1")
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var inTx []string
+		for _, q := range guarded {
+			if q.InTx {
+				inTx = append(inTx, q.Query)
+			}
+		}
+		Expect(inTx).To(ContainElement("SELECT 1"))
+	})
+
+	It("rejects queries", func() {
+		_, err := cluster.Shard(0).Exec("DROP TABLE ?SHARD.users")
+		Expect(err).To(Equal(errForbidden))
+		Expect(cluster.Queries(0)).To(BeEmpty())
+	})
+})
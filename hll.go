@@ -0,0 +1,159 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/bits"
+	"strconv"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// HLL is a HyperLogLog sketch that estimates the number of distinct
+// values. Sketches built on different shards can be merged.
+type HLL struct {
+	p    uint8
+	regs []uint8
+}
+
+// NewHLL returns a sketch with 2^precision registers. Precision must be
+// between 4 and 18; the standard error is about 1.04 / sqrt(2^precision).
+func NewHLL(precision uint8) *HLL {
+	if precision < 4 || precision > 18 {
+		panic("sharding: HLL precision must be between 4 and 18")
+	}
+	return &HLL{
+		p:    precision,
+		regs: make([]uint8, 1<<precision),
+	}
+}
+
+// Add adds the value to the sketch.
+func (h *HLL) Add(value []byte) {
+	x := hash64(value)
+	idx := x >> (64 - h.p)
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rank > h.regs[idx] {
+		h.regs[idx] = rank
+	}
+}
+
+func (h *HLL) setMax(idx int, rank uint8) {
+	if idx >= 0 && idx < len(h.regs) && rank > h.regs[idx] {
+		h.regs[idx] = rank
+	}
+}
+
+// Merge merges the other sketch into h.
+func (h *HLL) Merge(other *HLL) error {
+	if h.p != other.p {
+		return errors.New("sharding: can't merge HLL sketches with different precision")
+	}
+	for i, r := range other.regs {
+		if r > h.regs[i] {
+			h.regs[i] = r
+		}
+	}
+	return nil
+}
+
+// Count returns the estimated number of distinct values.
+func (h *HLL) Count() uint64 {
+	m := float64(len(h.regs))
+
+	var sum float64
+	var zeros int
+	for _, r := range h.regs {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// hash64 is FNV-1a followed by the splitmix64 finalizer to spread
+// the bits for HyperLogLog.
+func hash64(b []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// hllRegister is a HyperLogLog register computed by a shard.
+type hllRegister struct {
+	Idx  int
+	Rank uint8
+}
+
+// hllRegistersQuery computes non-empty registers of a sketch with
+// the precision over the first column of the query. Values are hashed
+// with md5 of their text representation, so registers computed by
+// different shards can be merged.
+func hllRegistersQuery(query string, precision uint8) string {
+	p := strconv.Itoa(int(precision))
+	maxRank := strconv.Itoa(64 - int(precision) + 1)
+	return `
+		SELECT idx, max(rank) AS rank FROM (
+			SELECT
+				substring(h FROM 1 FOR ` + p + `)::bit(` + p + `)::int AS idx,
+				coalesce(nullif(position(B'1' IN substring(h FROM ` + p + ` + 1)), 0), ` + maxRank + `) AS rank
+			FROM (
+				SELECT ('x' || substr(md5(q.?::text), 1, 16))::bit(64) AS h
+				FROM (` + query + `) AS q
+			) AS hashed
+			WHERE h IS NOT NULL
+		) AS regs
+		GROUP BY idx`
+}
+
+// ApproxCountDistinct estimates the number of distinct non-null values of
+// the column returned by the query across all shards. Every shard builds
+// a HyperLogLog sketch server-side and returns only its non-empty
+// registers, at most 16384 small rows, which are merged client-side.
+// The shards still scan every row of the query.
+func (cl *Cluster) ApproxCountDistinct(
+	ctx context.Context, query, column string, params ...interface{},
+) (uint64, error) {
+	const precision = 14
+
+	q := hllRegistersQuery(query, precision)
+	params = append([]interface{}{pg.Ident(column)}, params...)
+
+	var mu sync.Mutex
+	total := NewHLL(precision)
+
+	err := cl.ForEachShard(func(shard *pg.DB) error {
+		var regs []hllRegister
+		if _, err := shard.QueryContext(ctx, &regs, q, params...); err != nil {
+			return WrapShardError(shard, err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, reg := range regs {
+			total.setMax(reg.Idx, reg.Rank)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total.Count(), nil
+}
@@ -0,0 +1,82 @@
+package sharding_test
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+)
+
+func TestHLLCount(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		h := sharding.NewHLL(14)
+		for i := 0; i < n; i++ {
+			h.Add([]byte(strconv.Itoa(i)))
+			h.Add([]byte(strconv.Itoa(i))) // duplicates are ignored
+		}
+
+		got := float64(h.Count())
+		if diff := math.Abs(got-float64(n)) / float64(n); diff > 0.03 {
+			t.Errorf("n=%d: got %.0f (error %.3f)", n, got, diff)
+		}
+	}
+}
+
+func TestHLLMerge(t *testing.T) {
+	h1 := sharding.NewHLL(14)
+	h2 := sharding.NewHLL(14)
+	for i := 0; i < 20000; i++ {
+		h1.Add([]byte(strconv.Itoa(i)))
+		h2.Add([]byte(strconv.Itoa(i + 10000)))
+	}
+
+	if err := h1.Merge(h2); err != nil {
+		t.Fatal(err)
+	}
+	got := float64(h1.Count())
+	if diff := math.Abs(got-30000) / 30000; diff > 0.03 {
+		t.Errorf("got %.0f (error %.3f)", got, diff)
+	}
+
+	if err := h1.Merge(sharding.NewHLL(10)); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestApproxCountDistinct(t *testing.T) {
+	cluster := shardingtest.NewCluster(2)
+	defer cluster.Close()
+
+	cluster.SetResult(0, "md5", &shardingtest.Result{
+		Columns: []string{"idx", "rank"},
+		Rows:    [][]interface{}{{0, 1}, {5, 3}},
+	})
+	cluster.SetResult(1, "md5", &shardingtest.Result{
+		Columns: []string{"idx", "rank"},
+		Rows:    [][]interface{}{{5, 2}, {7, 1}},
+	})
+
+	n, err := cluster.ApproxCountDistinct(context.Background(),
+		"SELECT * FROM ?SHARD.users WHERE age > ?", "email", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("got %d, wanted 3", n)
+	}
+
+	got := cluster.Queries(1)[0]
+	for _, wanted := range []string{
+		`md5(q."email"::text)`,
+		`FROM (SELECT * FROM shard1.users WHERE age > 18) AS q`,
+		`GROUP BY idx`,
+	} {
+		if !strings.Contains(got, wanted) {
+			t.Fatalf("query %q does not contain %q", got, wanted)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package sharding
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// shardHook is installed on every shard to track queries running
+// on the shard's server and to enforce cluster query checks.
+type shardHook struct {
+	cl       *Cluster
+	shardID  int64
+	schema   string
+	addr     string
+	inflight *int64
+	latency  *serverLatency // nil for primaries
+}
+
+var _ pg.QueryHook = (*shardHook)(nil)
+
+func (h *shardHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	// AfterQuery is called even when BeforeQuery fails.
+	inflight := atomic.AddInt64(h.inflight, 1)
+
+	if h.cl.debugLog != nil {
+		h.logQuery(evt)
+	}
+
+	if h.cl.tableCheck == TableCheckError {
+		if query, err := evt.FormattedQuery(); err == nil {
+			if err := h.checkTables(string(query)); err != nil {
+				return ctx, h.reject(evt, err)
+			}
+		}
+	}
+	if err := h.checkShardColumn(evt.Query); err != nil {
+		return ctx, h.reject(evt, err)
+	}
+	if h.cl.quotas != nil {
+		if err := h.cl.quotas.acquire(ctx, h.shardID); err != nil {
+			return ctx, h.reject(evt, err)
+		}
+	}
+	if h.cl.shedPolicy != nil && h.cl.shed(ctx, h.shardID, inflight) {
+		return ctx, h.reject(evt, ErrLoadShed)
+	}
+	if len(h.cl.guards) > 0 {
+		if err := h.guard(ctx, evt); err != nil {
+			return ctx, h.reject(evt, err)
+		}
+	}
+	if mws := h.cl.middleware.load(); len(mws) > 0 {
+		if h.cl.keys != nil {
+			ctx = h.cl.keyContext(ctx, h.shardID)
+		}
+		ctx, err := h.startMiddleware(ctx, evt, mws)
+		if err != nil {
+			return ctx, h.reject(evt, err)
+		}
+		return ctx, nil
+	}
+	return ctx, nil
+}
+
+func (h *shardHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	atomic.AddInt64(h.inflight, -1)
+
+	if !isRejected(evt) {
+		latency := time.Since(evt.StartTime)
+		h.cl.observe(h.shardID, latency, evt.Err)
+		if h.latency != nil && evt.Err == nil {
+			h.latency.observe(latency, time.Now())
+		}
+		if h.cl.quotas != nil {
+			h.cl.quotas.consume(ctx, evt.Result)
+		}
+	}
+	if w := h.cl.dualWrites.get(h.shardID); w != nil {
+		h.mirror(ctx, evt, w)
+	}
+	return finishMiddleware(evt)
+}
+
+// checkTxQuery runs the checks of BeforeQuery for a query of ShardTx,
+// which is sent on the server transaction bypassing the shard hooks.
+// Queries in a transaction are not shed.
+func (h *shardHook) checkTxQuery(ctx context.Context, query interface{}, formatted string) error {
+	if h.cl.tableCheck == TableCheckError {
+		if err := h.checkTables(formatted); err != nil {
+			return err
+		}
+	}
+	if err := h.checkShardColumn(query); err != nil {
+		return err
+	}
+	if h.cl.quotas != nil {
+		if err := h.cl.quotas.acquire(ctx, h.shardID); err != nil {
+			return err
+		}
+	}
+	if len(h.cl.guards) > 0 {
+		return h.runGuards(ctx, formatted, true)
+	}
+	return nil
+}
+
+type rejectedKey struct{}
+
+// reject marks the query as rejected by the hook so AfterQuery,
+// which go-pg calls anyway, does not count it as executed.
+func (h *shardHook) reject(evt *pg.QueryEvent, err error) error {
+	if evt.Stash == nil {
+		evt.Stash = make(map[interface{}]interface{})
+	}
+	evt.Stash[rejectedKey{}] = true
+	return err
+}
+
+func isRejected(evt *pg.QueryEvent) bool {
+	_, ok := evt.Stash[rejectedKey{}]
+	return ok
+}
+
+func (h *shardHook) checkTables(query string) error {
+	refs := unqualifiedTables(query)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	tables := make([]string, len(refs))
+	for i, ref := range refs {
+		tables[i] = ref.name
+	}
+	return &UnqualifiedTableError{
+		ShardID: h.shardID,
+		Tables:  tables,
+	}
+}
@@ -0,0 +1,236 @@
+package sharding
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HotShardOptions configures a HotShardDetector.
+type HotShardOptions struct {
+	// Window is the sliding window the activity is measured over.
+	// Default is 1 minute.
+	Window time.Duration
+	// Buckets is the number of buckets the window is split into. More
+	// buckets make the window slide more smoothly. Default is 6.
+	Buckets int
+
+	// MaxQPS is the queries per second threshold. Zero disables it.
+	MaxQPS float64
+	// MaxLatency is the average query latency threshold. Zero disables it.
+	MaxLatency time.Duration
+	// Alert is called when a shard exceeds a threshold. It is not called
+	// again for the shard until the shard drops below the thresholds.
+	// Alert is called from the goroutine executing the query so it
+	// should not block.
+	Alert func(activity *ShardActivity)
+}
+
+// ShardActivity is the activity of a shard within the detector window.
+type ShardActivity struct {
+	ShardID int64
+	Queries int64
+	QPS     float64
+	// Latency is the average query latency.
+	Latency   time.Duration
+	ErrorRate float64
+}
+
+// HotShardDetector tracks per-shard query rate and latency of queries
+// executed through the cluster in a sliding window and reports shards
+// that are candidates to be split or moved.
+type HotShardDetector struct {
+	cl         *Cluster
+	opt        HotShardOptions
+	bucketSize int64 // in nanoseconds
+	start      time.Time
+	now        func() time.Time
+
+	shards []hotShard
+}
+
+type hotShard struct {
+	mu      sync.Mutex
+	buckets []hotBucket
+	hot     bool
+}
+
+type hotBucket struct {
+	n       int64 // bucket number since the Unix epoch
+	queries int64
+	latency int64 // in nanoseconds
+	errors  int64
+}
+
+// NewHotShardDetector returns a detector that observes queries executed
+// on the cluster shards until it is closed.
+func (cl *Cluster) NewHotShardDetector(opt *HotShardOptions) *HotShardDetector {
+	d := &HotShardDetector{
+		cl:     cl,
+		start:  time.Now(),
+		now:    time.Now,
+		shards: make([]hotShard, cl.nshards),
+	}
+	if opt != nil {
+		d.opt = *opt
+	}
+	if d.opt.Window <= 0 {
+		d.opt.Window = time.Minute
+	}
+	if d.opt.Buckets <= 0 {
+		d.opt.Buckets = 6
+	}
+	d.bucketSize = int64(d.opt.Window) / int64(d.opt.Buckets)
+	if d.bucketSize < 1 {
+		d.bucketSize = 1
+	}
+	for i := range d.shards {
+		d.shards[i].buckets = make([]hotBucket, d.opt.Buckets)
+	}
+
+	cl.detectors.add(d)
+	return d
+}
+
+// Close stops observing queries.
+func (d *HotShardDetector) Close() error {
+	d.cl.detectors.remove(d)
+	return nil
+}
+
+func (d *HotShardDetector) observe(shardID int64, latency time.Duration, err error) {
+	now := d.now()
+	n := now.UnixNano() / d.bucketSize
+
+	s := &d.shards[shardID]
+	s.mu.Lock()
+
+	b := &s.buckets[n%int64(len(s.buckets))]
+	if b.n != n {
+		*b = hotBucket{n: n}
+	}
+	b.queries++
+	b.latency += int64(latency)
+	if err != nil {
+		b.errors++
+	}
+
+	if d.opt.MaxQPS == 0 && d.opt.MaxLatency == 0 {
+		s.mu.Unlock()
+		return
+	}
+
+	activity := d.activity(shardID, now)
+	hot := (d.opt.MaxQPS > 0 && activity.QPS > d.opt.MaxQPS) ||
+		(d.opt.MaxLatency > 0 && activity.Latency > d.opt.MaxLatency)
+	alert := hot && !s.hot
+	s.hot = hot
+	s.mu.Unlock()
+
+	if alert && d.opt.Alert != nil {
+		d.opt.Alert(&activity)
+	}
+}
+
+// activity returns the activity of the shard. The shard must be locked.
+func (d *HotShardDetector) activity(shardID int64, now time.Time) ShardActivity {
+	s := &d.shards[shardID]
+	n := now.UnixNano() / d.bucketSize
+	minN := n - int64(len(s.buckets)) + 1
+
+	var queries, latency, errors int64
+	for i := range s.buckets {
+		b := &s.buckets[i]
+		if b.n < minN || b.n > n {
+			continue
+		}
+		queries += b.queries
+		latency += b.latency
+		errors += b.errors
+	}
+
+	// Don't underestimate the rate before the first window is complete,
+	// but don't overestimate it using a very short interval either.
+	elapsed := now.Sub(d.start)
+	if elapsed > d.opt.Window {
+		elapsed = d.opt.Window
+	}
+	if elapsed < time.Duration(d.bucketSize) {
+		elapsed = time.Duration(d.bucketSize)
+	}
+
+	activity := ShardActivity{
+		ShardID: shardID,
+		Queries: queries,
+		QPS:     float64(queries) / elapsed.Seconds(),
+	}
+	if queries > 0 {
+		activity.Latency = time.Duration(latency / queries)
+		activity.ErrorRate = float64(errors) / float64(queries)
+	}
+	return activity
+}
+
+// Activity returns the activity of every shard ordered by shard id.
+func (d *HotShardDetector) Activity() []ShardActivity {
+	now := d.now()
+	activity := make([]ShardActivity, len(d.shards))
+	for i := range d.shards {
+		s := &d.shards[i]
+		s.mu.Lock()
+		activity[i] = d.activity(int64(i), now)
+		s.mu.Unlock()
+	}
+	return activity
+}
+
+// TopShards returns up to n shards with the highest query rate.
+func (d *HotShardDetector) TopShards(n int) []ShardActivity {
+	activity := d.Activity()
+	sort.SliceStable(activity, func(i, j int) bool {
+		return activity[i].QPS > activity[j].QPS
+	})
+	if n < len(activity) {
+		activity = activity[:n]
+	}
+	return activity
+}
+
+//------------------------------------------------------------------------------
+
+// hotShardDetectors is a copy-on-write list of detectors observing
+// cluster queries.
+type hotShardDetectors struct {
+	mu sync.Mutex
+	ds atomic.Value // []*HotShardDetector
+}
+
+func (l *hotShardDetectors) load() []*HotShardDetector {
+	ds, _ := l.ds.Load().([]*HotShardDetector)
+	return ds
+}
+
+func (l *hotShardDetectors) add(d *HotShardDetector) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prev := l.load()
+	ds := make([]*HotShardDetector, 0, len(prev)+1)
+	ds = append(ds, prev...)
+	l.ds.Store(append(ds, d))
+}
+
+func (l *hotShardDetectors) remove(d *HotShardDetector) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prev := l.load()
+	ds := make([]*HotShardDetector, 0, len(prev))
+	for _, other := range prev {
+		if other != d {
+			ds = append(ds, other)
+		}
+	}
+	l.ds.Store(ds)
+}
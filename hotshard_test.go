@@ -0,0 +1,100 @@
+package sharding_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HotShardDetector", func() {
+	var cluster *shardingtest.Cluster
+	var detector *sharding.HotShardDetector
+	var alerts []sharding.ShardActivity
+	var now time.Time
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+		alerts = nil
+		now = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+		detector = cluster.NewHotShardDetector(&sharding.HotShardOptions{
+			Window:     10 * time.Second,
+			Buckets:    10,
+			MaxQPS:     1,
+			MaxLatency: 100 * time.Millisecond,
+			Alert: func(activity *sharding.ShardActivity) {
+				alerts = append(alerts, *activity)
+			},
+		})
+		detector.SetNow(func() time.Time { return now })
+	})
+
+	AfterEach(func() {
+		Expect(detector.Close()).NotTo(HaveOccurred())
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("observes queries executed on shards", func() {
+		_, err := cluster.Shard(2).ExecContext(ctx, "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+
+		top := detector.TopShards(1)
+		Expect(top).To(HaveLen(1))
+		Expect(top[0].ShardID).To(Equal(int64(2)))
+		Expect(top[0].Queries).To(Equal(int64(1)))
+
+		Expect(detector.Close()).NotTo(HaveOccurred())
+		_, err = cluster.Shard(2).ExecContext(ctx, "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(detector.Activity()[2].Queries).To(Equal(int64(1)))
+	})
+
+	It("tracks activity in a sliding window", func() {
+		for i := 0; i < 5; i++ {
+			detector.Observe(1, 10*time.Millisecond, nil)
+			now = now.Add(time.Second)
+		}
+		detector.Observe(3, 30*time.Millisecond, errors.New("fake error"))
+		detector.Observe(3, 10*time.Millisecond, nil)
+
+		top := detector.TopShards(2)
+		Expect(top).To(Equal([]sharding.ShardActivity{
+			{ShardID: 1, Queries: 5, QPS: 1, Latency: 10 * time.Millisecond},
+			{ShardID: 3, Queries: 2, QPS: 0.4, Latency: 20 * time.Millisecond, ErrorRate: 0.5},
+		}))
+
+		now = now.Add(6 * time.Second)
+		activity := detector.Activity()
+		Expect(activity[1].Queries).To(Equal(int64(3)))
+		Expect(activity[3].Queries).To(Equal(int64(2)))
+
+		now = now.Add(10 * time.Second)
+		Expect(detector.TopShards(10)[0].Queries).To(BeZero())
+	})
+
+	It("alerts once when a shard becomes hot", func() {
+		now = now.Add(10 * time.Second)
+		for i := 0; i < 12; i++ {
+			detector.Observe(0, time.Millisecond, nil)
+		}
+		Expect(alerts).To(HaveLen(1))
+		Expect(alerts[0].ShardID).To(Equal(int64(0)))
+		Expect(alerts[0].Queries).To(Equal(int64(11)))
+
+		detector.Observe(1, time.Second, nil)
+		Expect(alerts).To(HaveLen(2))
+		Expect(alerts[1].Latency).To(Equal(time.Second))
+
+		now = now.Add(20 * time.Second)
+		detector.Observe(0, time.Millisecond, nil)
+		for i := 0; i < 11; i++ {
+			detector.Observe(0, time.Millisecond, nil)
+		}
+		Expect(alerts).To(HaveLen(3))
+	})
+})
@@ -0,0 +1,38 @@
+package sharding
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// AllocateIDBlock is a server-side equivalent of ShardIDGen.AllocateBlock.
+// It reserves n contiguous ids for the time on the shard with the number
+// by advancing the shard's id_seq sequence that is used by next_id(),
+// see README. The block is reserved in a single round trip: ALTER SEQUENCE
+// blocks concurrent nextval calls until the statements are committed.
+// It requires PostgreSQL 10 or later.
+func (cl *Cluster) AllocateIDBlock(
+	ctx context.Context, number int64, tm time.Time, n int64,
+) (first, last int64, err error) {
+	if err := checkBlockSize(n, cl.gen.seqMask+1); err != nil {
+		return 0, 0, err
+	}
+
+	shard := cl.Shard(number)
+	var start int64
+	_, err = shard.QueryOneContext(ctx, pg.Scan(&start), `
+		ALTER SEQUENCE ?SHARD.id_seq INCREMENT BY 1;
+		SELECT setval('?SHARD.id_seq', s + ?0 - 1) - ?0 + 1 FROM (
+			SELECT CASE WHEN v % ?1 + ?0 > ?1 THEN v + ?1 - v % ?1 ELSE v END AS s
+			FROM (SELECT nextval('?SHARD.id_seq') AS v) AS seq
+		) AS block
+	`, n, cl.gen.seqMask+1)
+	if err != nil {
+		return 0, 0, WrapShardError(shard, err)
+	}
+
+	shardID := cl.shardID(number)
+	return cl.gen.MakeID(tm, shardID, start), cl.gen.MakeID(tm, shardID, start+n-1), nil
+}
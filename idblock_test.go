@@ -0,0 +1,48 @@
+package sharding_test
+
+import (
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AllocateIDBlock", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		cluster.SetResult(1, "setval", &shardingtest.Result{
+			Columns: []string{"start"},
+			Rows:    [][]interface{}{{int64(4096)}},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("reserves the block using the shard sequence", func() {
+		tm := time.Now()
+		first, last, err := cluster.AllocateIDBlock(ctx, 3, tm, 10)
+		Expect(err).NotTo(HaveOccurred())
+
+		gen := sharding.NewShardIDGen(1, nil)
+		Expect(first).To(Equal(gen.MinID(tm)))
+		Expect(last).To(Equal(gen.MinID(tm) + 9))
+
+		queries := cluster.Queries(1)
+		Expect(queries).To(HaveLen(1))
+		Expect(queries[0]).To(ContainSubstring("ALTER SEQUENCE shard1.id_seq INCREMENT BY 1;"))
+		Expect(queries[0]).To(ContainSubstring("setval('shard1.id_seq', s + 10 - 1) - 10 + 1"))
+		Expect(queries[0]).To(ContainSubstring("WHEN v % 4096 + 10 > 4096"))
+	})
+
+	It("checks the block size", func() {
+		_, _, err := cluster.AllocateIDBlock(ctx, 1, time.Now(), 0)
+		Expect(err).To(MatchError("sharding: block size must be between 1 and 4096, got 0"))
+	})
+})
@@ -1,7 +1,10 @@
 package sharding
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -11,13 +14,24 @@ var (
 	DefaultIDGen = NewIDGen(41, 11, 12, _epoch)
 )
 
+// ErrTimeOutOfRange is returned by MakeIDE and MakeUint64 when the time
+// can't be represented by the id layout.
+var ErrTimeOutOfRange = errors.New("sharding: time is out of the id range")
+
 type IDGen struct {
+	timeBits  uint
 	shardBits uint
 	seqBits   uint
 	epoch     int64 // in milliseconds
+	tick      int64 // time precision in milliseconds
 	minTime   time.Time
+	maxTime   time.Time
 	shardMask int64
 	seqMask   int64
+
+	// unsigned is true when time is stored as an unsigned number
+	// of milliseconds since the epoch.
+	unsigned bool
 }
 
 func NewIDGen(timeBits, shardBits, seqBits uint, epoch time.Time) *IDGen {
@@ -25,15 +39,74 @@ func NewIDGen(timeBits, shardBits, seqBits uint, epoch time.Time) *IDGen {
 		panic("timeBits + shardBits + seqBits != 64")
 	}
 
-	dur := time.Duration(1) << (timeBits - 1) * time.Millisecond
-	return &IDGen{
+	g := &IDGen{
+		timeBits:  timeBits,
 		shardBits: shardBits,
 		seqBits:   seqBits,
 		epoch:     epoch.UnixNano() / int64(time.Millisecond),
-		minTime:   epoch.Add(-dur),
+		tick:      1,
 		shardMask: int64(1)<<shardBits - 1,
 		seqMask:   int64(1)<<seqBits - 1,
 	}
+	g.setTimeRange()
+	return g
+}
+
+// NewUint64IDGen is like NewIDGen, but ids use the unsigned 64-bit layout
+// where time is the number of milliseconds since the epoch. It doubles
+// the time range after the epoch at the cost of times before it.
+//
+// Unsigned ids are returned by MakeID and accepted by SplitID converted
+// with Uint64ToBigint so they keep their order in Postgres bigint columns.
+// Use MakeUint64 to get the raw unsigned id.
+func NewUint64IDGen(timeBits, shardBits, seqBits uint, epoch time.Time) *IDGen {
+	g := NewIDGen(timeBits, shardBits, seqBits, epoch)
+	g.unsigned = true
+	g.setTimeRange()
+	return g
+}
+
+// WithPrecision returns a copy of the generator that stores time with
+// the precision instead of milliseconds, e.g. 41 time bits with
+// the second precision cover ~35 thousand years instead of ~70 years.
+// The sequence then counts ids per precision interval, so the layout
+// usually moves bits from time to sequence. Precision must be
+// a positive multiple of a millisecond.
+func (g *IDGen) WithPrecision(precision time.Duration) *IDGen {
+	if precision < time.Millisecond || precision%time.Millisecond != 0 {
+		panic("sharding: id precision must be a positive multiple of a millisecond")
+	}
+	clone := *g
+	clone.tick = int64(precision / time.Millisecond)
+	clone.setTimeRange()
+	return &clone
+}
+
+// Precision returns the precision of time stored in ids.
+func (g *IDGen) Precision() time.Duration {
+	return time.Duration(g.tick) * time.Millisecond
+}
+
+func (g *IDGen) setTimeRange() {
+	if g.unsigned {
+		n := int64(uint64(1) << g.timeBits)
+		g.minTime = msTime(g.epoch)
+		g.maxTime = msTime(g.epoch + n*g.tick - 1)
+		return
+	}
+	n := int64(1) << (g.timeBits - 1)
+	g.minTime = msTime(g.epoch - n*g.tick)
+	g.maxTime = msTime(g.epoch + n*g.tick - 1)
+}
+
+// Unsigned reports whether the generator uses the unsigned 64-bit layout.
+func (g *IDGen) Unsigned() bool {
+	return g.unsigned
+}
+
+// TimeRange returns the min and the max time supported by the generator.
+func (g *IDGen) TimeRange() (min, max time.Time) {
+	return g.minTime, g.maxTime
 }
 
 func (g *IDGen) NumShards() int {
@@ -41,19 +114,91 @@ func (g *IDGen) NumShards() int {
 }
 
 // MakeId returns an id for the time. Note that you can only
-// generate 4096 unique numbers per millisecond.
+// generate 4096 unique numbers per millisecond. Times before the min
+// supported time return math.MinInt64; use MakeIDE to detect them.
 func (g *IDGen) MakeID(tm time.Time, shard, seq int64) int64 {
 	if tm.Before(g.minTime) {
 		return int64(math.MinInt64)
 	}
+	return g.bigint(g.makeUint64(tm, shard, seq))
+}
+
+// MakeIDE is like MakeID, but returns ErrTimeOutOfRange when the time
+// is outside of the range supported by the generator.
+func (g *IDGen) MakeIDE(tm time.Time, shard, seq int64) (int64, error) {
+	if err := g.checkTime(tm); err != nil {
+		return 0, err
+	}
+	return g.bigint(g.makeUint64(tm, shard, seq)), nil
+}
+
+// MakeUint64 returns the id for the time as an unsigned number that
+// uses the full 64-bit space. For the signed layout it is the MakeIDE id
+// converted with BigintToUint64.
+func (g *IDGen) MakeUint64(tm time.Time, shard, seq int64) (uint64, error) {
+	if err := g.checkTime(tm); err != nil {
+		return 0, err
+	}
+	id := g.makeUint64(tm, shard, seq)
+	if !g.unsigned {
+		id = BigintToUint64(int64(id))
+	}
+	return id, nil
+}
 
-	id := tm.UnixNano()/int64(time.Millisecond) - g.epoch
+func (g *IDGen) checkTime(tm time.Time) error {
+	if tm.Before(g.minTime) || tm.After(g.maxTime) {
+		return fmt.Errorf("%w: %s is not between %s and %s",
+			ErrTimeOutOfRange, tm.UTC(), g.minTime.UTC(), g.maxTime.UTC())
+	}
+	return nil
+}
+
+// makeUint64 returns the id bits in the generator layout.
+func (g *IDGen) makeUint64(tm time.Time, shard, seq int64) uint64 {
+	id := uint64(g.ticks(tm))
 	id <<= g.shardBits + g.seqBits
-	id |= shard << g.seqBits
-	id |= seq % (g.seqMask + 1)
+	id |= uint64(shard) << g.seqBits
+	id |= uint64(seq % (g.seqMask + 1))
 	return id
 }
 
+// ticks returns the number of precision intervals between the epoch
+// and the time rounded down.
+func (g *IDGen) ticks(tm time.Time) int64 {
+	d := tm.UnixNano()/int64(time.Millisecond) - g.epoch
+	n := d / g.tick
+	if d%g.tick < 0 {
+		n--
+	}
+	return n
+}
+
+// bigint converts the id bits to the id stored in the database.
+func (g *IDGen) bigint(id uint64) int64 {
+	if g.unsigned {
+		return Uint64ToBigint(id)
+	}
+	return int64(id)
+}
+
+// Uint64ToBigint converts an unsigned id to a Postgres bigint by flipping
+// the sign bit, which preserves the order of ids.
+func Uint64ToBigint(id uint64) int64 {
+	return int64(id ^ 1<<63)
+}
+
+// BigintToUint64 converts a bigint returned by Uint64ToBigint back
+// to the unsigned id.
+func BigintToUint64(id int64) uint64 {
+	return uint64(id) ^ 1<<63
+}
+
+func msTime(ms int64) time.Time {
+	sec := ms / 1000
+	return time.Unix(sec, (ms-sec*1000)*int64(time.Millisecond))
+}
+
 // MinID returns min id for the time.
 func (g *IDGen) MinID(tm time.Time) int64 {
 	return g.MakeID(tm, 0, 0)
@@ -66,9 +211,13 @@ func (g *IDGen) MaxID(tm time.Time) int64 {
 
 // SplitID splits id into time, shard id, and sequence id.
 func (g *IDGen) SplitID(id int64) (tm time.Time, shardID int64, seqID int64) {
-	ms := id>>(g.shardBits+g.seqBits) + g.epoch
-	sec := ms / 1000
-	tm = time.Unix(sec, (ms-sec*1000)*int64(time.Millisecond))
+	var ticks int64
+	if g.unsigned {
+		ticks = int64(BigintToUint64(id) >> (g.shardBits + g.seqBits))
+	} else {
+		ticks = id >> (g.shardBits + g.seqBits)
+	}
+	tm = msTime(ticks*g.tick + g.epoch)
 	shardID = (id >> g.seqBits) & g.shardMask
 	seqID = id & g.seqMask
 	return
@@ -87,6 +236,10 @@ type ShardIDGen struct {
 	shard int64
 	seq   int64
 	gen   *IDGen
+
+	// fpBits high bits of the sequence are set to the fingerprint fp.
+	fpBits uint
+	fp     int64
 }
 
 // NewShardIDGen returns id generator for the shard.
@@ -104,7 +257,60 @@ func NewShardIDGen(shard int64, gen *IDGen) *ShardIDGen {
 // generate 4096 unique numbers per millisecond.
 func (g *ShardIDGen) NextID(tm time.Time) int64 {
 	seq := atomic.AddInt64(&g.seq, 1) - 1
-	return g.gen.MakeID(tm, g.shard, seq)
+	return g.gen.MakeID(tm, g.shard, g.fingerprint(seq))
+}
+
+// fingerprint replaces the high bits of the seq with the fingerprint.
+func (g *ShardIDGen) fingerprint(seq int64) int64 {
+	if g.fpBits == 0 {
+		return seq
+	}
+	lowBits := g.gen.seqBits - g.fpBits
+	return g.fp<<lowBits | seq&(int64(1)<<lowBits-1)
+}
+
+// seqSize returns the number of sequence numbers per millisecond.
+func (g *ShardIDGen) seqSize() int64 {
+	return int64(1) << (g.gen.seqBits - g.fpBits)
+}
+
+// AllocateBlock reserves n contiguous ids for the time and returns the first
+// and the last id of the block. Ids in the block are not returned by NextID
+// or other blocks as long as fewer than 4096 ids per millisecond are
+// generated. n can't exceed the number of ids per millisecond.
+func (g *ShardIDGen) AllocateBlock(tm time.Time, n int64) (first, last int64, err error) {
+	size := g.seqSize()
+	if err := checkBlockSize(n, size); err != nil {
+		return 0, 0, err
+	}
+
+	var start int64
+	for {
+		seq := atomic.LoadInt64(&g.seq)
+		start = alignBlock(seq, n, size)
+		if atomic.CompareAndSwapInt64(&g.seq, seq, start+n) {
+			break
+		}
+	}
+	first = g.gen.MakeID(tm, g.shard, g.fingerprint(start))
+	last = g.gen.MakeID(tm, g.shard, g.fingerprint(start+n-1))
+	return first, last, nil
+}
+
+func checkBlockSize(n, size int64) error {
+	if n <= 0 || n > size {
+		return fmt.Errorf("sharding: block size must be between 1 and %d, got %d", size, n)
+	}
+	return nil
+}
+
+// alignBlock returns the first sequence number starting from the seq
+// that is followed by n numbers without wrapping around the size.
+func alignBlock(seq, n, size int64) int64 {
+	if seq%size+n > size {
+		return seq + size - seq%size
+	}
+	return seq
 }
 
 // MinId returns min id for the time.
@@ -121,3 +327,22 @@ func (g *ShardIDGen) MaxID(tm time.Time) int64 {
 func (g *ShardIDGen) SplitID(id int64) (tm time.Time, shardID int64, seqID int64) {
 	return g.gen.SplitID(id)
 }
+
+// idGens holds id generators shared by the cluster and its subclusters.
+type idGens struct {
+	mu sync.Mutex
+	m  map[int64]*ShardIDGen
+}
+
+// shardIDGen returns the shared id generator for the shard id.
+func (cl *Cluster) shardIDGen(shardID int64) *ShardIDGen {
+	cl.idGens.mu.Lock()
+	defer cl.idGens.mu.Unlock()
+
+	g, ok := cl.idGens.m[shardID]
+	if !ok {
+		g = cl.shardIDGenByID(shardID)
+		cl.idGens.m[shardID] = g
+	}
+	return g
+}
@@ -1,6 +1,7 @@
 package sharding_test
 
 import (
+	"errors"
 	"math"
 	"testing"
 	"time"
@@ -140,3 +141,157 @@ func TestCollision(t *testing.T) {
 		m[id] = struct{}{}
 	}
 }
+
+func TestAllocateBlock(t *testing.T) {
+	gen := sharding.NewShardIDGen(0, nil)
+	tm := time.Now()
+
+	seen := make(map[int64]struct{})
+	add := func(id int64) {
+		if _, ok := seen[id]; ok {
+			t.Fatalf("collision for %d", id)
+		}
+		seen[id] = struct{}{}
+	}
+
+	for i := 0; i < 10; i++ {
+		add(gen.NextID(tm))
+	}
+
+	first, last, err := gen.AllocateBlock(tm, 4000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last-first != 3999 {
+		t.Fatalf("got block [%d, %d], wanted 4000 ids", first, last)
+	}
+	for id := first; id <= last; id++ {
+		add(id)
+	}
+
+	// The next block does not fit into the rest of the sequence.
+	first, last, err = gen.AllocateBlock(tm, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, seq := gen.SplitID(first); seq != 0 {
+		t.Errorf("got seq %d, wanted 0", seq)
+	}
+	if last-first != 99 {
+		t.Fatalf("got block [%d, %d], wanted 100 ids", first, last)
+	}
+	if _, _, seq := gen.SplitID(gen.NextID(tm)); seq != 100 {
+		t.Errorf("got seq %d, wanted 100", seq)
+	}
+
+	if _, _, err := gen.AllocateBlock(tm, 4097); err == nil {
+		t.Error("expected an error for too large block")
+	}
+}
+
+func TestMakeIDE(t *testing.T) {
+	gen := sharding.DefaultIDGen
+	min, max := gen.TimeRange()
+
+	if _, err := gen.MakeIDE(min.Add(-time.Millisecond), 0, 0); !errors.Is(err, sharding.ErrTimeOutOfRange) {
+		t.Errorf("got %v, wanted ErrTimeOutOfRange", err)
+	}
+	if _, err := gen.MakeIDE(max.Add(time.Millisecond), 0, 0); !errors.Is(err, sharding.ErrTimeOutOfRange) {
+		t.Errorf("got %v, wanted ErrTimeOutOfRange", err)
+	}
+
+	for _, tm := range []time.Time{min, max} {
+		id, err := gen.MakeIDE(tm, 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := gen.MakeID(tm, 1, 2); id != want {
+			t.Errorf("got %d, wanted %d", id, want)
+		}
+	}
+}
+
+func TestUint64IDGen(t *testing.T) {
+	epoch := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	gen := sharding.NewUint64IDGen(41, 11, 12, epoch)
+
+	min, max := gen.TimeRange()
+	if !min.Equal(epoch) {
+		t.Errorf("got min %s, wanted %s", min, epoch)
+	}
+	if wanted := time.Date(2089, time.September, 6, 15, 47, 35, 551000000, time.UTC); !max.Equal(wanted) {
+		t.Errorf("got max %s, wanted %s", max, wanted)
+	}
+
+	if _, err := gen.MakeUint64(epoch.Add(-time.Millisecond), 0, 0); !errors.Is(err, sharding.ErrTimeOutOfRange) {
+		t.Errorf("got %v, wanted ErrTimeOutOfRange", err)
+	}
+
+	u, err := gen.MakeUint64(epoch, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != 0 {
+		t.Errorf("got %d, wanted 0", u)
+	}
+	if id := gen.MakeID(epoch, 0, 0); id != math.MinInt64 {
+		t.Errorf("got %d, wanted %d", id, int64(math.MinInt64))
+	}
+
+	// Ids keep their order across the sign bit of bigint.
+	prev := int64(math.MinInt64)
+	for year := 2021; year <= 2089; year++ {
+		tm := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		id, err := gen.MakeIDE(tm, 5, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= prev {
+			t.Errorf("%s: id=%d, prev=%d", tm, id, prev)
+		}
+		prev = id
+
+		gotTm, gotShard, gotSeq := gen.SplitID(id)
+		if !gotTm.Equal(tm) || gotShard != 5 || gotSeq != 7 {
+			t.Errorf("got (%s, %d, %d), wanted (%s, 5, 7)", gotTm, gotShard, gotSeq, tm)
+		}
+
+		u, err := gen.MakeUint64(tm, 5, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sharding.BigintToUint64(id) != u || sharding.Uint64ToBigint(u) != id {
+			t.Errorf("bigint %d does not match uint64 %d", id, u)
+		}
+	}
+}
+
+func TestIDGenPrecision(t *testing.T) {
+	epoch := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	gen := sharding.NewIDGen(41, 11, 12, epoch).WithPrecision(time.Second)
+
+	if got := gen.Precision(); got != time.Second {
+		t.Errorf("got precision %s, wanted 1s", got)
+	}
+	_, max := gen.TimeRange()
+	if max.Year() < 30000 {
+		t.Errorf("got max %s, wanted thousands of years", max)
+	}
+
+	tm := time.Date(2100, time.March, 1, 12, 30, 15, 999000000, time.UTC)
+	id := gen.MakeID(tm, 5, 7)
+	gotTm, gotShard, gotSeq := gen.SplitID(id)
+	if wanted := tm.Truncate(time.Second); !gotTm.Equal(wanted) || gotShard != 5 || gotSeq != 7 {
+		t.Errorf("got (%s, %d, %d), wanted (%s, 5, 7)", gotTm, gotShard, gotSeq, wanted)
+	}
+
+	// Times before the epoch are rounded down too.
+	before := epoch.Add(-1500 * time.Millisecond)
+	if gotTm, _, _ := gen.SplitID(gen.MakeID(before, 0, 0)); !gotTm.Equal(epoch.Add(-2 * time.Second)) {
+		t.Errorf("got %s, wanted %s", gotTm, epoch.Add(-2*time.Second))
+	}
+
+	if next := gen.MakeID(tm.Add(time.Second), 0, 0); next <= id {
+		t.Errorf("id %d is not greater than %d", next, id)
+	}
+}
@@ -0,0 +1,86 @@
+package sharding
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// SQL returns SQL that creates the make_id(tm, seq_id) and next_id()
+// functions and the id_seq sequence in the schema generating ids with
+// the same epoch and bit layout as the generator, e.g. gen.SQL("?SHARD").
+// The shard id is taken from the ?SHARD_ID param so the SQL must be
+// executed on a shard. Ids of the unsigned layout are converted with
+// Uint64ToBigint and time is rounded down to the generator precision.
+func (g *IDGen) SQL(schemaParam string) string {
+	var signFlip string
+	if g.unsigned {
+		signFlip = " # (1::bigint << 63)"
+	}
+	epoch := strconv.FormatInt(g.epoch, 10)
+	ticks := "(floor(extract(epoch FROM tm) * 1000)::bigint - " + epoch + ")"
+	if g.tick != 1 {
+		ticks = "floor((extract(epoch FROM tm) * 1000 - " + epoch + ") / " +
+			strconv.FormatInt(g.tick, 10) + ")::bigint"
+	}
+	r := strings.NewReplacer(
+		"{ticks}", ticks,
+		"{schema}", schemaParam,
+		"{time_shift}", strconv.FormatUint(uint64(g.shardBits+g.seqBits), 10),
+		"{seq_bits}", strconv.FormatUint(uint64(g.seqBits), 10),
+		"{max_shard_id}", strconv.FormatInt(g.shardMask+1, 10),
+		"{max_seq_id}", strconv.FormatInt(g.seqMask+1, 10),
+		"{sign_flip}", signFlip,
+	)
+	return r.Replace(`
+CREATE OR REPLACE FUNCTION {schema}.make_id(tm timestamptz, seq_id bigint)
+RETURNS bigint AS $$
+  SELECT (({ticks} << {time_shift})
+    | ((?SHARD_ID::bigint % {max_shard_id}) << {seq_bits})
+    | (seq_id % {max_seq_id})){sign_flip}
+$$
+LANGUAGE sql IMMUTABLE;
+
+CREATE SEQUENCE IF NOT EXISTS {schema}.id_seq;
+
+CREATE OR REPLACE FUNCTION {schema}.next_id()
+RETURNS bigint AS $$
+  SELECT {schema}.make_id(clock_timestamp(), nextval('{schema}.id_seq'))
+$$
+LANGUAGE sql VOLATILE;
+`)
+}
+
+// params returns the shard params derived from the generator layout
+// (SHARD_BITS, SEQ_BITS, and MAX_SHARDS) and their lowercase aliases, so
+// SQL id functions can be templated together with ?EPOCH, e.g.
+//
+//	(floor(extract(epoch FROM tm) * 1000)::bigint - ?EPOCH) << (?SHARD_BITS + ?SEQ_BITS)
+func (g *IDGen) params() map[string]interface{} {
+	return map[string]interface{}{
+		"shard_bits": int64(g.shardBits),
+		"seq_bits":   int64(g.seqBits),
+		"max_shards": g.shardMask + 1,
+		"SHARD_BITS": int64(g.shardBits),
+		"SEQ_BITS":   int64(g.seqBits),
+		"MAX_SHARDS": g.shardMask + 1,
+	}
+}
+
+// InstallIDFunctions creates or replaces the id functions returned by
+// IDGen.SQL in the schema of every shard.
+func (cl *Cluster) InstallIDFunctions(ctx context.Context) error {
+	query := cl.gen.SQL("?SHARD")
+	err := cl.ForEachShard(func(shard *pg.DB) error {
+		_, err := shard.ExecContext(ctx, query)
+		return WrapShardError(shard, err)
+	})
+
+	auditErr := cl.audit(ctx, "install_id_functions", nil, err)
+	if err != nil {
+		return err
+	}
+	return auditErr
+}
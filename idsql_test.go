@@ -0,0 +1,76 @@
+package sharding_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InstallIDFunctions", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("creates functions in every shard", func() {
+		Expect(cluster.InstallIDFunctions(ctx)).NotTo(HaveOccurred())
+
+		queries := cluster.Queries(1)
+		Expect(queries).To(HaveLen(1))
+		Expect(queries[0]).To(ContainSubstring("CREATE OR REPLACE FUNCTION shard1.make_id(tm timestamptz, seq_id bigint)"))
+		Expect(queries[0]).To(ContainSubstring("::bigint - 1262304000000) << 23)"))
+		Expect(queries[0]).To(ContainSubstring("| ((1::bigint % 2048) << 12)"))
+		Expect(queries[0]).To(ContainSubstring("SELECT shard1.make_id(clock_timestamp(), nextval('shard1.id_seq'))"))
+	})
+
+	It("returns shard errors", func() {
+		cluster.SetError(0, &shardingtest.Error{Message: "fake error"})
+		err := cluster.InstallIDFunctions(ctx)
+		Expect(err).To(MatchError("sharding: shard 0 (shardingtest0): ERROR #XX000 fake error"))
+	})
+})
+
+func TestIDGenSQL(t *testing.T) {
+	gen := sharding.NewIDGen(40, 10, 14, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	sql := gen.SQL("myschema")
+
+	for _, substr := range []string{
+		"CREATE OR REPLACE FUNCTION myschema.make_id(tm timestamptz, seq_id bigint)",
+		"::bigint - 1577836800000) << 24)",
+		"| ((?SHARD_ID::bigint % 1024) << 14)",
+		"| (seq_id % 16384)",
+		"CREATE SEQUENCE IF NOT EXISTS myschema.id_seq;",
+		"SELECT myschema.make_id(clock_timestamp(), nextval('myschema.id_seq'))",
+	} {
+		if !strings.Contains(sql, substr) {
+			t.Errorf("SQL does not contain %q:\n%s", substr, sql)
+		}
+	}
+}
+
+func TestUint64IDGenSQL(t *testing.T) {
+	gen := sharding.NewUint64IDGen(41, 11, 12, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	sql := gen.SQL("myschema")
+	if substr := "| (seq_id % 4096)) # (1::bigint << 63)"; !strings.Contains(sql, substr) {
+		t.Errorf("SQL does not contain %q:\n%s", substr, sql)
+	}
+}
+
+func TestIDGenPrecisionSQL(t *testing.T) {
+	gen := sharding.NewIDGen(41, 11, 12, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	sql := gen.WithPrecision(10 * time.Millisecond).SQL("myschema")
+	if substr := "SELECT ((floor((extract(epoch FROM tm) * 1000 - 1577836800000) / 10)::bigint << 23)"; !strings.Contains(sql, substr) {
+		t.Errorf("SQL does not contain %q:\n%s", substr, sql)
+	}
+}
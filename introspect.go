@@ -0,0 +1,191 @@
+package sharding
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// TableSize is the disk usage of a table in a shard.
+type TableSize struct {
+	ShardID int64
+	Table   string
+	// TableBytes includes TOAST, but not indexes.
+	TableBytes int64
+	IndexBytes int64
+	TotalBytes int64
+}
+
+// TableSizes returns sizes of the tables in every shard schema ordered
+// by shard id and table name. Use TotalTableSizes to sum them per table.
+func (cl *Cluster) TableSizes(ctx context.Context) ([]TableSize, error) {
+	var mu sync.Mutex
+	var sizes []TableSize
+	err := cl.ForEachShard(func(shard *pg.DB) error {
+		var shardSizes []TableSize
+		_, err := shard.QueryContext(ctx, &shardSizes, `
+			SELECT ?SHARD_ID AS shard_id, c.relname AS table,
+				pg_table_size(c.oid) AS table_bytes,
+				pg_indexes_size(c.oid) AS index_bytes,
+				pg_total_relation_size(c.oid) AS total_bytes
+			FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = '?SHARD' AND c.relkind IN ('r', 'p', 'm')
+		`)
+		if err != nil {
+			return WrapShardError(shard, err)
+		}
+
+		mu.Lock()
+		sizes = append(sizes, shardSizes...)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].ShardID != sizes[j].ShardID {
+			return sizes[i].ShardID < sizes[j].ShardID
+		}
+		return sizes[i].Table < sizes[j].Table
+	})
+	return sizes, nil
+}
+
+// TotalTableSizes sums the sizes returned by TableSizes per table.
+// ShardID of the totals is -1.
+func TotalTableSizes(sizes []TableSize) map[string]TableSize {
+	totals := make(map[string]TableSize)
+	for _, s := range sizes {
+		t := totals[s.Table]
+		t.ShardID = -1
+		t.Table = s.Table
+		t.TableBytes += s.TableBytes
+		t.IndexBytes += s.IndexBytes
+		t.TotalBytes += s.TotalBytes
+		totals[s.Table] = t
+	}
+	return totals
+}
+
+// IndexBloat is the estimated bloat of a btree index in a shard.
+type IndexBloat struct {
+	ShardID int64
+	Table   string
+	Index   string
+	// Bytes is the size of the index.
+	Bytes int64
+	// ExpectedBytes is the estimated size of a freshly built index.
+	ExpectedBytes int64
+	// BloatBytes is Bytes - ExpectedBytes or 0.
+	BloatBytes int64
+	// BloatRatio is BloatBytes / Bytes.
+	BloatRatio float64
+}
+
+// IndexBloat returns the estimated bloat of btree indexes in every shard
+// schema ordered by shard id, table, and index. Estimates are based on
+// the planner statistics so tables must be analyzed; they are good enough
+// to find indexes worth rebuilding with REINDEX, but not precise.
+func (cl *Cluster) IndexBloat(ctx context.Context) ([]IndexBloat, error) {
+	var mu sync.Mutex
+	var bloat []IndexBloat
+	err := cl.ForEachShard(func(shard *pg.DB) error {
+		var rows []IndexBloat
+		// Every index tuple has a 12 bytes header and item pointer and
+		// pages are 90% full by default.
+		_, err := shard.QueryContext(ctx, &rows, `
+			SELECT ?SHARD_ID AS shard_id, tc.relname AS table, ic.relname AS index,
+				pg_relation_size(ic.oid) AS bytes,
+				ceil(greatest(ic.reltuples, 0) * (12 + coalesce(w.width, 8)) / 0.9)::bigint AS expected_bytes
+			FROM pg_index x
+			JOIN pg_class ic ON ic.oid = x.indexrelid
+			JOIN pg_class tc ON tc.oid = x.indrelid
+			JOIN pg_namespace n ON n.oid = ic.relnamespace
+			JOIN pg_am am ON am.oid = ic.relam
+			LEFT JOIN LATERAL (
+				SELECT sum(s.avg_width) AS width
+				FROM pg_attribute a
+				JOIN pg_stats s
+					ON s.schemaname = n.nspname AND s.tablename = tc.relname AND s.attname = a.attname
+				WHERE a.attrelid = tc.oid AND a.attnum = ANY (x.indkey)
+			) w ON true
+			WHERE n.nspname = '?SHARD' AND am.amname = 'btree'
+		`)
+		if err != nil {
+			return WrapShardError(shard, err)
+		}
+
+		for i := range rows {
+			r := &rows[i]
+			if r.Bytes > r.ExpectedBytes {
+				r.BloatBytes = r.Bytes - r.ExpectedBytes
+				r.BloatRatio = math.Round(float64(r.BloatBytes)/float64(r.Bytes)*1000) / 1000
+			}
+		}
+
+		mu.Lock()
+		bloat = append(bloat, rows...)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(bloat, func(i, j int) bool {
+		a, b := &bloat[i], &bloat[j]
+		if a.ShardID != b.ShardID {
+			return a.ShardID < b.ShardID
+		}
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Index < b.Index
+	})
+	return bloat, nil
+}
+
+// RowCount is the number of rows of a table in a shard.
+type RowCount struct {
+	ShardID int64
+	// Rows is the exact number of rows.
+	Rows int64
+	// Estimated is the planner estimate which is -1 when the table
+	// was never analyzed.
+	Estimated int64
+}
+
+// RowCounts returns the number of rows of the table in every shard
+// indexed by shard id. Rows are counted with count(*) which reads
+// the whole table.
+func (cl *Cluster) RowCounts(ctx context.Context, table string) ([]RowCount, error) {
+	counts := make([]RowCount, cl.nshards)
+	err := cl.ForEachShard(func(shard *pg.DB) error {
+		c := &counts[shard.Param("SHARD_ID").(int64)]
+		c.ShardID = shard.Param("SHARD_ID").(int64)
+		_, err := shard.QueryOneContext(ctx, pg.Scan(&c.Rows, &c.Estimated), `
+			SELECT (SELECT count(*) FROM ?SHARD.?),
+				(SELECT reltuples::bigint FROM pg_class WHERE oid = '?SHARD.?'::regclass)
+		`, pg.Ident(table), pg.Ident(table))
+		return WrapShardError(shard, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// TotalRows returns the sum of the exact row counts.
+func TotalRows(counts []RowCount) int64 {
+	var n int64
+	for _, c := range counts {
+		n += c.Rows
+	}
+	return n
+}
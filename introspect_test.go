@@ -0,0 +1,83 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Introspection", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("returns table sizes", func() {
+		for shardID := int64(0); shardID < 2; shardID++ {
+			cluster.SetResult(shardID, "pg_total_relation_size", &shardingtest.Result{
+				Columns: []string{"shard_id", "table", "table_bytes", "index_bytes", "total_bytes"},
+				Rows: [][]interface{}{
+					{shardID, "users", 100, 20, 120},
+					{shardID, "posts", 10, 2, 12},
+				},
+			})
+		}
+
+		sizes, err := cluster.TableSizes(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sizes).To(HaveLen(4))
+		Expect(sizes[0]).To(Equal(sharding.TableSize{
+			ShardID: 0, Table: "posts", TableBytes: 10, IndexBytes: 2, TotalBytes: 12,
+		}))
+		Expect(sharding.TotalTableSizes(sizes)["users"]).To(Equal(sharding.TableSize{
+			ShardID: -1, Table: "users", TableBytes: 200, IndexBytes: 40, TotalBytes: 240,
+		}))
+	})
+
+	It("estimates index bloat", func() {
+		cluster.SetResult(shardingtest.AllShards, "pg_index", &shardingtest.Result{
+			Columns: []string{"shard_id", "table", "index", "bytes", "expected_bytes"},
+			Rows:    [][]interface{}{{1, "users", "users_pkey", 1000, 400}},
+		})
+
+		bloat, err := cluster.IndexBloat(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bloat).To(HaveLen(2))
+		Expect(bloat[0]).To(Equal(sharding.IndexBloat{
+			ShardID:       1,
+			Table:         "users",
+			Index:         "users_pkey",
+			Bytes:         1000,
+			ExpectedBytes: 400,
+			BloatBytes:    600,
+			BloatRatio:    0.6,
+		}))
+	})
+
+	It("counts rows", func() {
+		cluster.SetResult(1, "count(*)", &shardingtest.Result{
+			Columns: []string{"count", "reltuples"},
+			Rows:    [][]interface{}{{42, 40}},
+		})
+		cluster.SetResult(0, "count(*)", &shardingtest.Result{
+			Columns: []string{"count", "reltuples"},
+			Rows:    [][]interface{}{{8, -1}},
+		})
+
+		counts, err := cluster.RowCounts(ctx, "users")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counts).To(Equal([]sharding.RowCount{
+			{ShardID: 0, Rows: 8, Estimated: -1},
+			{ShardID: 1, Rows: 42, Estimated: 40},
+		}))
+		Expect(sharding.TotalRows(counts)).To(Equal(int64(50)))
+		Expect(cluster.Queries(1)[0]).To(ContainSubstring(`FROM shard1."users"`))
+	})
+})
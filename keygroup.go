@@ -0,0 +1,49 @@
+package sharding
+
+import (
+	"sort"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// GroupByShard buckets the keys by the id of the shard they map to with
+// Shard. Keys keep their order within a group.
+func (cl *Cluster) GroupByShard(keys []int64) map[int64][]int64 {
+	groups := make(map[int64][]int64)
+	for _, key := range keys {
+		shardID := cl.shardID(key)
+		groups[shardID] = append(groups[shardID], key)
+	}
+	return groups
+}
+
+// GroupUUIDsByShard buckets the UUIDs by the id of the shard they map to
+// with ShardByUUID.
+func (cl *Cluster) GroupUUIDsByShard(uuids []UUID) map[int64][]UUID {
+	groups := make(map[int64][]UUID)
+	for _, u := range uuids {
+		shardID := cl.wrapShardID(u.ShardID())
+		groups[shardID] = append(groups[shardID], u)
+	}
+	return groups
+}
+
+// ForEachKeyGroup groups the keys with GroupByShard and concurrently calls
+// the fn once per shard with the keys of the shard like ForShards, so
+// a batch of keys is read with one query per shard, e.g.
+//
+//	SELECT * FROM ?SHARD.users WHERE id IN (?)
+func (cl *Cluster) ForEachKeyGroup(keys []int64, fn func(shard *pg.DB, keys []int64) error) error {
+	groups := cl.GroupByShard(keys)
+	ids := make([]int64, 0, len(groups))
+	for shardID := range groups {
+		ids = append(ids, shardID)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return cl.ForShards(ids, func(shard *pg.DB) error {
+		return fn(shard, groups[shard.Param("SHARD_ID").(int64)])
+	})
+}
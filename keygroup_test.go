@@ -0,0 +1,59 @@
+package sharding_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Key groups", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("groups keys by shard", func() {
+		Expect(cluster.GroupByShard([]int64{1, 5, 2, 9, 4})).To(Equal(map[int64][]int64{
+			0: {4},
+			1: {1, 5, 9},
+			2: {2},
+		}))
+
+		tm := time.Now()
+		u1 := sharding.NewUUID(1, tm)
+		u2 := sharding.NewUUID(6, tm)
+		u3 := sharding.NewUUID(5, tm)
+		Expect(cluster.GroupUUIDsByShard([]sharding.UUID{u1, u2, u3})).To(Equal(map[int64][]sharding.UUID{
+			1: {u1, u3},
+			2: {u2},
+		}))
+	})
+
+	It("queries every shard once", func() {
+		var mu sync.Mutex
+		groups := make(map[int64][]int64)
+		err := cluster.ForEachKeyGroup([]int64{1, 5, 2, 9}, func(shard *pg.DB, keys []int64) error {
+			mu.Lock()
+			groups[shardID(shard)] = keys
+			mu.Unlock()
+			_, err := shard.Exec("SELECT * FROM ?SHARD.users WHERE id IN (?)", pg.In(keys))
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(groups).To(Equal(map[int64][]int64{1: {1, 5, 9}, 2: {2}}))
+		Expect(cluster.Queries(1)).To(Equal([]string{"SELECT * FROM shard1.users WHERE id IN (1,5,9)"}))
+		Expect(cluster.Queries(0)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,95 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoKeyProvider is returned by EncryptionKey when the ctx does not
+// belong to a shard of a cluster created with WithKeyProvider.
+var ErrNoKeyProvider = errors.New("sharding: context has no key provider")
+
+// KeyRequest identifies the encryption key resolved by KeyProvider.
+type KeyRequest struct {
+	ShardID ShardID
+	// Tenant is the tenant set with WithTenant if HasTenant is true.
+	Tenant    int64
+	HasTenant bool
+}
+
+// KeyProvider resolves encryption keys of shards or tenants, e.g. keys
+// stored in a KMS. It is called on every lookup, so providers backed by
+// remote services should cache keys.
+type KeyProvider interface {
+	EncryptionKey(ctx context.Context, req KeyRequest) ([]byte, error)
+}
+
+// KeyProviderFunc is an adapter to use a func as KeyProvider.
+type KeyProviderFunc func(ctx context.Context, req KeyRequest) ([]byte, error)
+
+func (fn KeyProviderFunc) EncryptionKey(ctx context.Context, req KeyRequest) ([]byte, error) {
+	return fn(ctx, req)
+}
+
+type keyProviderKey struct{}
+
+// WithKeyProvider sets the provider of encryption keys returned by
+// EncryptionKey. The provider is available to model hooks of queries
+// built with shard.Model and to shard middleware, so they can encrypt and
+// decrypt columns with the key of the shard the query is routed to.
+func WithKeyProvider(p KeyProvider) Option {
+	return func(cl *Cluster) {
+		cl.keys = p
+	}
+}
+
+// EncryptionKey resolves the key of the shard and the tenant of the ctx,
+// i.e. of the ctx passed to model hooks and shard middleware or created
+// with WithShard. It returns an error wrapping ErrNoKeyProvider when
+// the ctx does not belong to a shard of a cluster with a key provider.
+func EncryptionKey(ctx context.Context) ([]byte, error) {
+	p, ok := ctx.Value(keyProviderKey{}).(KeyProvider)
+	if !ok {
+		return nil, ErrNoKeyProvider
+	}
+	id, ok := ShardFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("%w: context has no shard", ErrNoKeyProvider)
+	}
+	return resolveKey(ctx, p, id)
+}
+
+// EncryptionKey resolves the key of the shard with the id and the tenant
+// of the ctx.
+func (cl *Cluster) EncryptionKey(ctx context.Context, id ShardID) ([]byte, error) {
+	if cl.keys == nil {
+		return nil, ErrNoKeyProvider
+	}
+	if err := cl.checkShardIDRange(id); err != nil {
+		return nil, err
+	}
+	return resolveKey(ctx, cl.keys, id)
+}
+
+func resolveKey(ctx context.Context, p KeyProvider, id ShardID) ([]byte, error) {
+	req := KeyRequest{ShardID: id}
+	req.Tenant, req.HasTenant = TenantFromContext(ctx)
+	key, err := p.EncryptionKey(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("sharding: can't resolve encryption key of shard %d: %w", id, err)
+	}
+	return key, nil
+}
+
+// keyContext returns the ctx carrying the key provider and the shard id
+// for shard middleware.
+func (cl *Cluster) keyContext(ctx context.Context, shardID int64) context.Context {
+	if ctx.Value(keyProviderKey{}) == nil {
+		ctx = context.WithValue(ctx, keyProviderKey{}, cl.keys)
+	}
+	if id, ok := contextShardID(ctx); !ok || id != shardID {
+		ctx = context.WithValue(ctx, shardIDKey{}, shardID)
+	}
+	return ctx
+}
@@ -0,0 +1,106 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type EncryptedEvent struct {
+	tableName struct{} `pg:"?SHARD.events"`
+
+	Name string
+	Key  string `pg:"-"`
+}
+
+func (e *EncryptedEvent) BeforeInsert(ctx context.Context) (context.Context, error) {
+	key, err := sharding.EncryptionKey(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	e.Key = string(key)
+	return ctx, nil
+}
+
+var _ = Describe("KeyProvider", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		provider := sharding.KeyProviderFunc(func(ctx context.Context, req sharding.KeyRequest) ([]byte, error) {
+			if req.ShardID == 0 {
+				return nil, errors.New("key is revoked")
+			}
+			if req.HasTenant {
+				return []byte(fmt.Sprintf("tenant%d", req.Tenant)), nil
+			}
+			return []byte(fmt.Sprintf("shard%d", req.ShardID)), nil
+		})
+		cluster = shardingtest.NewCluster(4, sharding.WithKeyProvider(provider))
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("resolves keys in model hooks", func() {
+		event := &EncryptedEvent{Name: "signup"}
+		_, err := cluster.Shard(3).Model(event).Insert()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.Key).To(Equal("shard3"))
+
+		shard := cluster.Shard(2)
+		ctx := sharding.WithShard(sharding.WithTenant(ctx, 42), shard)
+		_, err = shard.ModelContext(ctx, event).Insert()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.Key).To(Equal("tenant42"))
+
+		_, err = cluster.Shard(0).Model(event).Insert()
+		Expect(err).To(MatchError("sharding: can't resolve encryption key of shard 0: key is revoked"))
+		Expect(cluster.Queries(0)).To(BeEmpty())
+	})
+
+	It("resolves keys in shard middleware", func() {
+		var keys []string
+		cluster.Use(func(next sharding.ShardQueryFunc) sharding.ShardQueryFunc {
+			return func(ctx context.Context, q *sharding.ShardQuery) error {
+				key, err := sharding.EncryptionKey(ctx)
+				if err != nil {
+					return err
+				}
+				keys = append(keys, string(key))
+				return next(ctx, q)
+			}
+		})
+
+		_, err := cluster.Shard(1).ExecContext(context.Background(), "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cluster.Shard(1).ExecContext(sharding.WithTenant(ctx, 7), "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(Equal([]string{"shard1", "tenant7"}))
+	})
+
+	It("resolves keys by shard id", func() {
+		key, err := cluster.EncryptionKey(ctx, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(key)).To(Equal("shard2"))
+
+		_, err = cluster.EncryptionKey(ctx, 4)
+		Expect(errors.Is(err, sharding.ErrShardIDOutOfRange)).To(BeTrue())
+	})
+
+	It("requires a key provider", func() {
+		_, err := sharding.EncryptionKey(context.Background())
+		Expect(err).To(Equal(sharding.ErrNoKeyProvider))
+
+		other := shardingtest.NewCluster(2)
+		defer other.Close()
+		_, err = other.EncryptionKey(ctx, 1)
+		Expect(err).To(Equal(sharding.ErrNoKeyProvider))
+	})
+})
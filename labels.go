@@ -0,0 +1,86 @@
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// WithShardLabel tags the shards with the ids with the label, e.g.
+// "region=eu" or "tier=premium", so batch jobs can target the group with
+// ShardsByLabel and ForEachShardWithLabel. A shard can have many labels.
+func WithShardLabel(label string, ids ...int64) Option {
+	return func(cl *Cluster) {
+		if cl.labels == nil {
+			cl.labels = make(map[string][]int64)
+		}
+		cl.labels[label] = append(cl.labels[label], ids...)
+	}
+}
+
+// checkShardLabels validates the labels and sorts the label shard ids.
+func (cl *Cluster) checkShardLabels() error {
+	for label, ids := range cl.labels {
+		if label == "" {
+			return errors.New("sharding: shard label is empty")
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+		uniq := ids[:0]
+		for i, id := range ids {
+			if id < 0 || id >= int64(cl.nshards) {
+				return fmt.Errorf("sharding: label %q: shard id %d is out of range", label, id)
+			}
+			if i > 0 && id == ids[i-1] {
+				continue
+			}
+			uniq = append(uniq, id)
+		}
+		cl.labels[label] = uniq
+	}
+	return nil
+}
+
+// ShardsByLabel returns the shards with the label ordered by shard id.
+func (cl *Cluster) ShardsByLabel(label string) []*pg.DB {
+	ids := cl.labels[label]
+	if len(ids) == 0 {
+		return nil
+	}
+
+	t := cl.topology()
+	shards := make([]*pg.DB, len(ids))
+	for i, id := range ids {
+		shards[i] = t.shards[id].shard
+	}
+	return shards
+}
+
+// ForEachShardWithLabel concurrently calls the fn on the shards with
+// the label like ForShards. It returns an error if no shards have
+// the label, which usually is a typo.
+func (cl *Cluster) ForEachShardWithLabel(label string, fn func(shard *pg.DB) error) error {
+	ids, ok := cl.labels[label]
+	if !ok {
+		return fmt.Errorf("sharding: unknown shard label %q", label)
+	}
+	return cl.ForShards(ids, fn)
+}
+
+// ShardLabels returns the sorted labels of the shard with the id.
+func (cl *Cluster) ShardLabels(shardID int64) []string {
+	var labels []string
+	for label, ids := range cl.labels {
+		i := sort.Search(len(ids), func(i int) bool {
+			return ids[i] >= shardID
+		})
+		if i < len(ids) && ids[i] == shardID {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
@@ -0,0 +1,72 @@
+package sharding_test
+
+import (
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Shard labels", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4,
+			sharding.WithShardLabel("region=eu", 2, 0, 2),
+			sharding.WithShardLabel("region=us", 1, 3),
+			sharding.WithShardLabel("tier=premium", 3))
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("returns shards by label", func() {
+		var ids []int64
+		for _, shard := range cluster.ShardsByLabel("region=eu") {
+			ids = append(ids, shardID(shard))
+		}
+		Expect(ids).To(Equal([]int64{0, 2}))
+		Expect(cluster.ShardsByLabel("region=asia")).To(BeEmpty())
+
+		Expect(cluster.ShardLabels(3)).To(Equal([]string{"region=us", "tier=premium"}))
+		Expect(cluster.ShardInfos()[0].Labels).To(Equal([]string{"region=eu"}))
+	})
+
+	It("iterates shards with the label", func() {
+		var mu sync.Mutex
+		var ids []int64
+		err := cluster.ForEachShardWithLabel("region=us", func(shard *pg.DB) error {
+			mu.Lock()
+			ids = append(ids, shardID(shard))
+			mu.Unlock()
+			_, err := shard.Exec("SELECT 1")
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids).To(ConsistOf(int64(1), int64(3)))
+		Expect(cluster.RoutedShards()).To(Equal([]int64{1, 3}))
+
+		err = cluster.ForEachShardWithLabel("region=asia", func(*pg.DB) error {
+			return nil
+		})
+		Expect(err).To(MatchError(`sharding: unknown shard label "region=asia"`))
+	})
+
+	It("validates shard ids", func() {
+		db := pg.Connect(&pg.Options{Addr: "db1"})
+		defer db.Close()
+
+		_, err := sharding.NewClusterE(&sharding.ClusterOptions{
+			DBs:       []*pg.DB{db},
+			NumShards: 4,
+			Options:   []sharding.Option{sharding.WithShardLabel("region=eu", 4)},
+		})
+		Expect(err).To(MatchError(`sharding: label "region=eu": shard id 4 is out of range`))
+	})
+})
@@ -0,0 +1,151 @@
+package sharding
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ShardNotification is a notification received from a shard.
+type ShardNotification struct {
+	ShardID int64
+	// Channel is the channel name without the shard prefix.
+	Channel string
+	Payload string
+}
+
+// ShardChannel returns the name of the channel scoped to the shard,
+// e.g. shard3.events, for clusters with default shard names.
+// Notifications can be sent to it from SQL with
+// SELECT pg_notify('?SHARD.events', 'payload').
+func ShardChannel(shardID int64, channel string) string {
+	return shardName(shardID) + "." + channel
+}
+
+// ShardListener listens for notifications on shard-scoped channels
+// of several shards.
+type ShardListener struct {
+	lns    []*pg.Listener
+	ch     chan ShardNotification
+	closed func()
+	// exit is closed by Close to stop goroutines blocked on sending
+	// to the ch that nobody reads.
+	exit chan struct{}
+
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Listen listens for notifications sent to the channels of the shard
+// with the number.
+func (cl *Cluster) Listen(ctx context.Context, number int64, channels ...string) *ShardListener {
+	shard := cl.Shard(number)
+	return cl.newShardListener(ctx, map[*pg.DB][]*pg.DB{
+		shard: {shard},
+	}, channels)
+}
+
+// ListenAll listens for notifications sent to the channels of every shard
+// in the cluster using one connection per database server.
+func (cl *Cluster) ListenAll(ctx context.Context, channels ...string) *ShardListener {
+	t := cl.topology()
+	m := make(map[*pg.DB][]*pg.DB, len(t.servers))
+	for i := range t.shards {
+		db := t.dbs[t.shards[i].dbInd]
+		m[db] = append(m[db], t.shards[i].shard)
+	}
+	return cl.newShardListener(ctx, m, channels)
+}
+
+func (cl *Cluster) newShardListener(
+	ctx context.Context, m map[*pg.DB][]*pg.DB, channels []string,
+) *ShardListener {
+	atomic.AddInt64(&cl.listens, 1)
+	ln := &ShardListener{
+		ch:   make(chan ShardNotification, 100),
+		exit: make(chan struct{}),
+		closed: func() {
+			atomic.AddInt64(&cl.listens, -1)
+		},
+	}
+
+	for db, shards := range m {
+		ids := make(map[string]int64, len(shards))
+		var qualified []string
+		for _, shard := range shards {
+			name := shardSchema(shard)
+			ids[name] = shard.Param("SHARD_ID").(int64)
+			for _, channel := range channels {
+				qualified = append(qualified, name+"."+channel)
+			}
+		}
+
+		pgln := db.Listen(ctx, qualified...)
+		ln.lns = append(ln.lns, pgln)
+
+		ln.wg.Add(1)
+		go func(pgch <-chan pg.Notification) {
+			defer ln.wg.Done()
+			for n := range pgch {
+				ind := strings.IndexByte(n.Channel, '.')
+				if ind == -1 {
+					continue
+				}
+				id, ok := ids[n.Channel[:ind]]
+				if !ok {
+					continue
+				}
+				select {
+				case ln.ch <- ShardNotification{
+					ShardID: id,
+					Channel: n.Channel[ind+1:],
+					Payload: n.Payload,
+				}:
+				case <-ln.exit:
+					return
+				}
+			}
+		}(pgln.Channel())
+	}
+
+	go func() {
+		ln.wg.Wait()
+		close(ln.ch)
+	}()
+
+	return ln
+}
+
+// Channel returns a channel for receiving notifications from all shards.
+// The channel is closed when the listener is closed.
+func (ln *ShardListener) Channel() <-chan ShardNotification {
+	return ln.ch
+}
+
+// Close closes the listener. Notifications that were not received
+// from the Channel are discarded.
+func (ln *ShardListener) Close() error {
+	var firstErr error
+	ln.closeOnce.Do(func() {
+		ln.closed()
+		close(ln.exit)
+		for _, pgln := range ln.lns {
+			if err := pgln.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	})
+	return firstErr
+}
+
+// Notify sends the notification to the shard-scoped channel of the shard
+// with the number.
+func (cl *Cluster) Notify(ctx context.Context, number int64, channel, payload string) error {
+	shard := cl.Shard(number)
+	_, err := shard.ExecContext(ctx, "SELECT pg_notify(?, ?)",
+		shardSchema(shard)+"."+channel, payload)
+	return WrapShardError(shard, err)
+}
@@ -0,0 +1,99 @@
+package sharding
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache is an LRU cache with optional expiration of entries used by
+// StaleCache and LRUQueryCacheStore. It is safe for concurrent use.
+type lruCache struct {
+	maxEntries int // zero means no limit
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+	// time is when the value was set.
+	time time.Time
+	// expiresAt is zero for entries that don't expire.
+	expiresAt time.Time
+}
+
+func newLRUCache(maxEntries int) *lruCache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the entry and marks it as recently used. Expired entries
+// are removed.
+func (c *lruCache) get(key string, now time.Time) (*lruEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+		c.ll.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry, true
+}
+
+// set stores the value evicting the least recently used entry when
+// the cache is full. A zero ttl means the value does not expire.
+func (c *lruCache) set(key string, value interface{}, now time.Time, ttl time.Duration) {
+	entry := &lruEntry{
+		key:   key,
+		value: value,
+		time:  now,
+	}
+	if ttl > 0 {
+		entry.expiresAt = now.Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value = entry
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(entry)
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.entries, el.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.ll.Remove(el)
+		delete(c.entries, key)
+	}
+}
+
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,178 @@
+package sharding
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// Schedule returns the next time a maintenance task runs after the time.
+type Schedule interface {
+	Next(tm time.Time) time.Time
+}
+
+// ScheduleFunc is an adapter to use a func as a Schedule.
+type ScheduleFunc func(tm time.Time) time.Time
+
+// Next calls fn(tm).
+func (fn ScheduleFunc) Next(tm time.Time) time.Time {
+	return fn(tm)
+}
+
+// Every returns a schedule that runs at multiples of the interval like
+// the */N cron syntax, e.g. Every(time.Hour) runs at the start of every
+// hour. Intervals are aligned to UTC.
+func Every(interval time.Duration) Schedule {
+	return ScheduleFunc(func(tm time.Time) time.Time {
+		return tm.Truncate(interval).Add(interval)
+	})
+}
+
+// Daily returns a schedule that runs every day at the hour and the minute
+// in the time location.
+func Daily(hour, min int, loc *time.Location) Schedule {
+	return ScheduleFunc(func(tm time.Time) time.Time {
+		tm = tm.In(loc)
+		next := time.Date(tm.Year(), tm.Month(), tm.Day(), hour, min, 0, 0, loc)
+		if !next.After(tm) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	})
+}
+
+// MaintenanceTask is maintenance SQL executed on every shard, e.g.
+//
+//	sharding.MaintenanceTask{
+//		Name:     "analyze users",
+//		Query:    "ANALYZE ?SHARD.users",
+//		Schedule: sharding.Daily(3, 0, time.UTC),
+//	}
+type MaintenanceTask struct {
+	Name string
+	// Query is executed outside of a transaction so it can be VACUUM.
+	Query    string
+	Schedule Schedule
+}
+
+// MaintenanceOptions configures RunMaintenance and ScheduleMaintenance.
+type MaintenanceOptions struct {
+	// ConcurrencyPerDB limits the number of shards processed concurrently
+	// on every database server. Default is 1.
+	ConcurrencyPerDB int
+	// Jitter is the max random delay added to scheduled runs so tasks
+	// of many clusters don't start at the same time.
+	Jitter time.Duration
+	// OnResult, if not nil, is called after the query finishes on a shard.
+	OnResult func(MaintenanceResult)
+}
+
+// MaintenanceResult is the result of a maintenance task on a shard.
+type MaintenanceResult struct {
+	Task     string
+	ShardID  int64
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// RunMaintenance executes the task query on every shard, processing
+// different database servers concurrently, and returns results sorted
+// by shard id. Errors on a shard don't stop the task on other shards.
+func (cl *Cluster) RunMaintenance(
+	ctx context.Context, task MaintenanceTask, opt *MaintenanceOptions,
+) []MaintenanceResult {
+	if opt == nil {
+		opt = new(MaintenanceOptions)
+	}
+	concurrency := opt.ConcurrencyPerDB
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	results := make([]MaintenanceResult, 0, cl.nshards)
+	_ = cl.ForEachShardContext(ctx, &ForEachOptions{
+		Concurrency:     concurrency,
+		ContinueOnError: true,
+	}, func(ctx context.Context, shard *pg.DB) error {
+		res := MaintenanceResult{
+			Task:    task.Name,
+			ShardID: shard.Param("SHARD_ID").(int64),
+			Start:   time.Now(),
+		}
+		_, err := shard.ExecContext(ctx, task.Query)
+		res.Duration = time.Since(res.Start)
+		res.Err = WrapShardError(shard, err)
+
+		if opt.OnResult != nil {
+			opt.OnResult(res)
+		}
+		mu.Lock()
+		results = append(results, res)
+		mu.Unlock()
+		return res.Err
+	})
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ShardID < results[j].ShardID
+	})
+	return results
+}
+
+// ScheduleMaintenance runs every task with RunMaintenance according to its
+// schedule. Tasks run independently of each other. ScheduleMaintenance
+// blocks until the ctx is done.
+func (cl *Cluster) ScheduleMaintenance(ctx context.Context, tasks []MaintenanceTask, opt *MaintenanceOptions) {
+	if opt == nil {
+		opt = new(MaintenanceOptions)
+	}
+
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task MaintenanceTask) {
+			defer wg.Done()
+			cl.scheduleMaintenance(ctx, task, opt)
+		}(task)
+	}
+	wg.Wait()
+}
+
+func (cl *Cluster) scheduleMaintenance(ctx context.Context, task MaintenanceTask, opt *MaintenanceOptions) {
+	for {
+		now := time.Now()
+		wait := task.Schedule.Next(now).Sub(now)
+		if opt.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(opt.Jitter)))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		results := cl.RunMaintenance(ctx, task, opt)
+		_ = cl.audit(ctx, "maintenance", map[string]interface{}{
+			"task":   task.Name,
+			"failed": countFailed(results),
+		}, nil)
+	}
+}
+
+func countFailed(results []MaintenanceResult) int {
+	var n int
+	for i := range results {
+		if results[i].Err != nil {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,83 @@
+package sharding_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Maintenance", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("runs the task on every shard", func() {
+		cluster.SetError(2, &shardingtest.Error{Message: "fake error"})
+
+		results := cluster.RunMaintenance(ctx, sharding.MaintenanceTask{
+			Name:  "vacuum",
+			Query: "VACUUM ANALYZE ?SHARD.users",
+		}, &sharding.MaintenanceOptions{ConcurrencyPerDB: 2})
+		Expect(results).To(HaveLen(4))
+		for i, res := range results {
+			Expect(res.ShardID).To(Equal(int64(i)))
+			Expect(res.Task).To(Equal("vacuum"))
+			Expect(res.Duration).To(BeNumerically(">", 0))
+		}
+		Expect(results[1].Err).NotTo(HaveOccurred())
+		Expect(results[2].Err).To(MatchError("sharding: shard 2 (shardingtest2): ERROR #XX000 fake error"))
+		Expect(cluster.Queries(3)).To(Equal([]string{"VACUUM ANALYZE shard3.users"}))
+	})
+
+	It("runs tasks on schedule", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var mu sync.Mutex
+		var results []sharding.MaintenanceResult
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cluster.ScheduleMaintenance(ctx, []sharding.MaintenanceTask{{
+				Name:     "analyze",
+				Query:    "ANALYZE ?SHARD.users",
+				Schedule: sharding.Every(10 * time.Millisecond),
+			}}, &sharding.MaintenanceOptions{
+				Jitter: time.Millisecond,
+				OnResult: func(res sharding.MaintenanceResult) {
+					mu.Lock()
+					results = append(results, res)
+					mu.Unlock()
+				},
+			})
+		}()
+
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(results)
+		}).Should(BeNumerically(">=", 8))
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("computes daily runs", func() {
+		sched := sharding.Daily(3, 30, time.UTC)
+		tm := time.Date(2020, time.March, 1, 4, 0, 0, 0, time.UTC)
+		Expect(sched.Next(tm)).To(Equal(time.Date(2020, time.March, 2, 3, 30, 0, 0, time.UTC)))
+		tm = time.Date(2020, time.March, 1, 1, 0, 0, 0, time.UTC)
+		Expect(sched.Next(tm)).To(Equal(time.Date(2020, time.March, 1, 3, 30, 0, 0, time.UTC)))
+	})
+})
@@ -0,0 +1,125 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ShardQuery is a query executed on a shard. After next returns
+// the embedded QueryEvent also holds the query Result and Err.
+type ShardQuery struct {
+	ShardID int64
+	*pg.QueryEvent
+}
+
+// ShardQueryFunc executes the query on the shard and returns the
+// query error.
+type ShardQueryFunc func(ctx context.Context, q *ShardQuery) error
+
+// ShardMiddleware wraps execution of shard queries.
+type ShardMiddleware func(next ShardQueryFunc) ShardQueryFunc
+
+var errMiddlewareSkipped = errors.New("sharding: middleware did not call next")
+
+type middlewareChain struct {
+	mu  sync.Mutex
+	mws atomic.Value // []ShardMiddleware
+}
+
+func (c *middlewareChain) load() []ShardMiddleware {
+	mws, _ := c.mws.Load().([]ShardMiddleware)
+	return mws
+}
+
+// Use appends middlewares that wrap every query executed through any
+// shard of the cluster. The first middleware is the outermost one.
+//
+// go-pg executes the query after query hooks return, so the middleware
+// chain runs in a separate goroutine while the query is executed:
+//   - next must be called at most once and before the middleware returns;
+//   - the query fails with the middleware error when next is not called,
+//     or with an error if the middleware returns nil;
+//   - a non-nil middleware error replaces the query error, but a query
+//     error can't be hidden by returning nil.
+func (cl *Cluster) Use(mws ...ShardMiddleware) {
+	cl.middleware.mu.Lock()
+	defer cl.middleware.mu.Unlock()
+
+	prev := cl.middleware.load()
+	all := make([]ShardMiddleware, 0, len(prev)+len(mws))
+	all = append(all, prev...)
+	all = append(all, mws...)
+	cl.middleware.mws.Store(all)
+}
+
+// middlewareCall synchronizes the middleware chain with the query.
+type middlewareCall struct {
+	proceed chan context.Context // the chain called next
+	result  chan error           // the query finished
+	done    chan error           // the chain returned
+}
+
+type middlewareCallKey struct{}
+
+// startMiddleware runs the middleware chain until it calls next
+// and returns the ctx passed to next. It returns an error if the
+// chain returns without calling next.
+func (h *shardHook) startMiddleware(
+	ctx context.Context, evt *pg.QueryEvent, mws []ShardMiddleware,
+) (context.Context, error) {
+	call := &middlewareCall{
+		proceed: make(chan context.Context, 1),
+		result:  make(chan error, 1),
+		done:    make(chan error, 1),
+	}
+
+	var called bool
+	fn := ShardQueryFunc(func(ctx context.Context, _ *ShardQuery) error {
+		if called {
+			return errors.New("sharding: middleware called next more than once")
+		}
+		called = true
+		call.proceed <- ctx
+		return <-call.result
+	})
+	for i := len(mws) - 1; i >= 0; i-- {
+		fn = mws[i](fn)
+	}
+
+	q := &ShardQuery{
+		ShardID:    h.shardID,
+		QueryEvent: evt,
+	}
+	go func() {
+		call.done <- fn(ctx, q)
+	}()
+
+	select {
+	case ctx = <-call.proceed:
+		if evt.Stash == nil {
+			evt.Stash = make(map[interface{}]interface{})
+		}
+		evt.Stash[middlewareCallKey{}] = call
+		return ctx, nil
+	case err := <-call.done:
+		if err == nil {
+			err = errMiddlewareSkipped
+		}
+		return ctx, err
+	}
+}
+
+// finishMiddleware passes the query result to the middleware chain
+// and waits for it to return.
+func finishMiddleware(evt *pg.QueryEvent) error {
+	call, ok := evt.Stash[middlewareCallKey{}].(*middlewareCall)
+	if !ok {
+		return nil
+	}
+	call.result <- evt.Err
+	return <-call.done
+}
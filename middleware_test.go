@@ -0,0 +1,107 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type tenantKey struct{}
+
+var _ = Describe("Use", func() {
+	var cluster *shardingtest.Cluster
+	var mu sync.Mutex
+	var log []string
+
+	record := func(s string) {
+		mu.Lock()
+		log = append(log, s)
+		mu.Unlock()
+	}
+
+	named := func(name string) sharding.ShardMiddleware {
+		return func(next sharding.ShardQueryFunc) sharding.ShardQueryFunc {
+			return func(ctx context.Context, q *sharding.ShardQuery) error {
+				record(name + " before")
+				err := next(ctx, q)
+				record(name + " after")
+				return err
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		log = nil
+		cluster = shardingtest.NewCluster(2)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("wraps queries in the order of middlewares", func() {
+		cluster.Use(named("a"), named("b"))
+		cluster.Use(func(next sharding.ShardQueryFunc) sharding.ShardQueryFunc {
+			return func(ctx context.Context, q *sharding.ShardQuery) error {
+				query, err := q.FormattedQuery()
+				Expect(err).NotTo(HaveOccurred())
+				record(string(query))
+
+				err = next(ctx, q)
+				Expect(q.Result.RowsAffected()).To(Equal(0))
+				return err
+			}
+		})
+
+		_, err := cluster.Shard(1).ExecContext(ctx, "SELECT ?SHARD_ID")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(log).To(Equal([]string{"a before", "b before", "SELECT 1", "b after", "a after"}))
+	})
+
+	It("receives query errors and can replace them", func() {
+		cluster.SetError(0, &shardingtest.Error{Message: "fake error"})
+		var queryErr error
+		cluster.Use(func(next sharding.ShardQueryFunc) sharding.ShardQueryFunc {
+			return func(ctx context.Context, q *sharding.ShardQuery) error {
+				queryErr = next(ctx, q)
+				return errors.New("middleware error")
+			}
+		})
+
+		_, err := cluster.Shard(0).ExecContext(ctx, "SELECT 1")
+		Expect(err).To(MatchError("middleware error"))
+		Expect(queryErr).To(MatchError("ERROR #XX000 fake error"))
+	})
+
+	It("rejects queries when next is not called", func() {
+		cluster.Use(func(next sharding.ShardQueryFunc) sharding.ShardQueryFunc {
+			return func(ctx context.Context, q *sharding.ShardQuery) error {
+				if q.ShardID == 1 {
+					return errors.New("shard is read only")
+				}
+				if ctx.Value(tenantKey{}) == nil {
+					return nil
+				}
+				return next(ctx, q)
+			}
+		})
+
+		_, err := cluster.Shard(1).ExecContext(ctx, "SELECT 1")
+		Expect(err).To(MatchError("shard is read only"))
+		Expect(cluster.Queries(1)).To(BeEmpty())
+
+		_, err = cluster.Shard(0).ExecContext(ctx, "SELECT 1")
+		Expect(err).To(MatchError("sharding: middleware did not call next"))
+
+		tenantCtx := context.WithValue(ctx, tenantKey{}, 42)
+		_, err = cluster.Shard(0).ExecContext(tenantCtx, "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Queries(0)).To(Equal([]string{"SELECT 1"}))
+	})
+})
@@ -0,0 +1,93 @@
+package sharding
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+
+	"github.com/go-pg/pg/v10/types"
+)
+
+// NullUUID is a UUID that can be NULL, e.g. a value of a nullable uuid
+// column. Unlike UUID, the zero UUID is a valid value and not NULL.
+type NullUUID struct {
+	UUID  UUID
+	Valid bool // Valid is true if UUID is not NULL
+}
+
+// NewNullUUID returns a valid NullUUID.
+func NewNullUUID(u UUID) NullUUID {
+	return NullUUID{UUID: u, Valid: true}
+}
+
+func (u NullUUID) String() string {
+	if !u.Valid {
+		return "NULL"
+	}
+	return u.UUID.String()
+}
+
+var _ types.ValueAppender = (*NullUUID)(nil)
+
+func (u NullUUID) AppendValue(b []byte, quote int) ([]byte, error) {
+	if !u.Valid {
+		return types.AppendNull(b, quote), nil
+	}
+	return appendUUID(b, u.UUID, quote), nil
+}
+
+var _ driver.Valuer = (*NullUUID)(nil)
+
+func (u NullUUID) Value() (driver.Value, error) {
+	if !u.Valid {
+		return nil, nil
+	}
+	return u.UUID.String(), nil
+}
+
+var _ sql.Scanner = (*NullUUID)(nil)
+
+func (u *NullUUID) Scan(src interface{}) error {
+	if src == nil {
+		*u = NullUUID{}
+		return nil
+	}
+	if err := u.UUID.Scan(src); err != nil {
+		u.Valid = false
+		return err
+	}
+	u.Valid = true
+	return nil
+}
+
+var _ json.Marshaler = (*NullUUID)(nil)
+
+func (u NullUUID) MarshalJSON() ([]byte, error) {
+	if !u.Valid {
+		return []byte("null"), nil
+	}
+
+	b := make([]byte, 0, uuidHexLen+2)
+	b = append(b, '"')
+	b = appendHex(b, u.UUID[:])
+	b = append(b, '"')
+	return b, nil
+}
+
+var _ json.Unmarshaler = (*NullUUID)(nil)
+
+func (u *NullUUID) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*u = NullUUID{}
+		return nil
+	}
+	if len(b) >= 2 {
+		b = b[1 : len(b)-1]
+	}
+	if err := u.UUID.UnmarshalText(b); err != nil {
+		u.Valid = false
+		return err
+	}
+	u.Valid = true
+	return nil
+}
@@ -0,0 +1,202 @@
+package sharding
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ShardWorkload is the size and the query load of a shard.
+type ShardWorkload struct {
+	ShardID int64
+	// Bytes is the total size of the shard tables including indexes.
+	Bytes int64
+	// Queries is the number of queries executed on the shard through
+	// the cluster since it was created.
+	Queries uint64
+	// QueryTime is the total time spent in those queries, which
+	// approximates the shard share of the server CPU.
+	QueryTime time.Duration
+}
+
+// Workload returns the workload of every shard ordered by shard id.
+func (cl *Cluster) Workload(ctx context.Context) ([]ShardWorkload, error) {
+	shards := cl.Shards(nil)
+	workload := make([]ShardWorkload, len(shards))
+	for i := range workload {
+		stats := &cl.stats[i]
+		workload[i] = ShardWorkload{
+			ShardID:   int64(i),
+			Queries:   atomic.LoadUint64(&stats.queries),
+			QueryTime: time.Duration(atomic.LoadInt64(&stats.queryTime)),
+		}
+	}
+
+	err := cl.ForEachShard(func(shard *pg.DB) error {
+		shardID := shard.Param("SHARD_ID").(int64)
+		_, err := shard.QueryOneContext(ctx, pg.Scan(&workload[shardID].Bytes), `
+			SELECT coalesce(sum(pg_total_relation_size(c.oid)), 0)::bigint
+			FROM pg_class AS c
+			JOIN pg_namespace AS n ON n.oid = c.relnamespace
+			WHERE n.nspname = '?SHARD' AND c.relkind IN ('r', 'm')
+		`)
+		return WrapShardError(shard, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workload, nil
+}
+
+// OptimizerOptions configures OptimizePlacement.
+type OptimizerOptions struct {
+	// Load returns the load of the shard. Default is the QueryTime or
+	// Bytes when no queries were timed.
+	Load func(w *ShardWorkload) float64
+	// MaxMoves limits the number of moved shards. Zero means no limit.
+	MaxMoves int
+	// MaxBytes limits the total size of moved shards. Zero means no limit.
+	MaxBytes int64
+}
+
+// ShardMove describes a shard that should be moved to another server.
+type ShardMove struct {
+	ShardID int64
+	From    *pg.DB
+	To      *pg.DB
+	Bytes   int64
+}
+
+// PlacementPlan is a shard assignment proposed by OptimizePlacement.
+type PlacementPlan struct {
+	Moves []ShardMove
+	// Bytes is the estimated amount of data to move.
+	Bytes int64
+	// MaxLoad is the load of the most loaded server before and after
+	// the moves.
+	MaxLoadBefore float64
+	MaxLoadAfter  float64
+
+	dbs  []*pg.DB
+	inds []int // index in dbs for every shard
+}
+
+// Placement returns a Placement that assigns shards according to the plan.
+// Use it with WithPlacement once the data is moved. It falls back to
+// StickyPlacement when the cluster databases change.
+func (p *PlacementPlan) Placement() Placement {
+	return PlacementFunc(func(nshards, ndbs int, prev []int) []int {
+		if nshards != len(p.inds) || ndbs != len(p.dbs) {
+			return StickyPlacement.Place(nshards, ndbs, prev)
+		}
+		return append([]int(nil), p.inds...)
+	})
+}
+
+// OptimizePlacement proposes moves of shards between database servers
+// that minimize the load of the most loaded server within the movement
+// budget using Planner.
+func (cl *Cluster) OptimizePlacement(workload []ShardWorkload, opt *OptimizerOptions) *PlacementPlan {
+	if opt == nil {
+		opt = new(OptimizerOptions)
+	}
+
+	t := cl.topology()
+
+	// Optimize servers rather than dbs which can be listed several times.
+	servers := make(map[*pg.DB]int, len(t.servers))
+	firstInd := make([]int, len(t.servers))
+	for i, db := range t.servers {
+		servers[db] = i
+	}
+	for i := len(t.dbs) - 1; i >= 0; i-- {
+		firstInd[servers[t.dbs[i]]] = i
+	}
+
+	current := make(ShardMap, len(t.shards))
+	for i := range t.shards {
+		current[i] = servers[t.dbs[t.shards[i].dbInd]]
+	}
+
+	planner := &Planner{
+		Load:     opt.Load,
+		MaxMoves: opt.MaxMoves,
+		MaxBytes: opt.MaxBytes,
+	}
+	rebalance := planner.Plan(current, len(t.servers), workload)
+
+	plan := &PlacementPlan{
+		Bytes:         rebalance.Bytes,
+		MaxLoadBefore: rebalance.MaxLoadBefore,
+		MaxLoadAfter:  rebalance.MaxLoadAfter,
+		dbs:           t.dbs,
+		inds:          make([]int, len(t.shards)),
+	}
+	for i := range t.shards {
+		plan.inds[i] = t.shards[i].dbInd
+	}
+	for _, m := range rebalance.Migrations {
+		plan.inds[m.ShardID] = firstInd[m.To]
+		plan.Moves = append(plan.Moves, ShardMove{
+			ShardID: m.ShardID,
+			From:    t.servers[m.From],
+			To:      t.servers[m.To],
+			Bytes:   m.Bytes,
+		})
+	}
+
+	sort.Slice(plan.Moves, func(i, j int) bool {
+		return plan.Moves[i].ShardID < plan.Moves[j].ShardID
+	})
+	return plan
+}
+
+func defaultShardLoad(workload []ShardWorkload) func(w *ShardWorkload) float64 {
+	for i := range workload {
+		if workload[i].QueryTime > 0 {
+			return func(w *ShardWorkload) float64 {
+				return float64(w.QueryTime)
+			}
+		}
+	}
+	return func(w *ShardWorkload) float64 {
+		return float64(w.Bytes)
+	}
+}
+
+func argMax(s []float64) int {
+	ind := 0
+	for i, v := range s {
+		if v > s[ind] {
+			ind = i
+		}
+	}
+	return ind
+}
+
+func argMin(s []float64) int {
+	ind := 0
+	for i, v := range s {
+		if v < s[ind] {
+			ind = i
+		}
+	}
+	return ind
+}
+
+func maxFloat(s []float64) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+	return s[argMax(s)]
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
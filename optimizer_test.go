@@ -0,0 +1,88 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OptimizePlacement", func() {
+	var db1, db2 *pg.DB
+	var cluster *sharding.Cluster
+	var workload []sharding.ShardWorkload
+
+	BeforeEach(func() {
+		db1 = pg.Connect(&pg.Options{Addr: "db1"})
+		db2 = pg.Connect(&pg.Options{Addr: "db2"})
+		cluster = sharding.NewCluster([]*pg.DB{db1, db2}, 4)
+		workload = []sharding.ShardWorkload{
+			{ShardID: 0, Bytes: 100},
+			{ShardID: 1, Bytes: 10},
+			{ShardID: 2, Bytes: 100},
+			{ShardID: 3, Bytes: 10},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("minimizes max server load", func() {
+		plan := cluster.OptimizePlacement(workload, nil)
+		Expect(plan.Moves).To(Equal([]sharding.ShardMove{
+			{ShardID: 0, From: db1, To: db2, Bytes: 100},
+			{ShardID: 1, From: db2, To: db1, Bytes: 10},
+		}))
+		Expect(plan.Bytes).To(Equal(int64(110)))
+		Expect(plan.MaxLoadBefore).To(Equal(200.0))
+		Expect(plan.MaxLoadAfter).To(Equal(110.0))
+
+		moved := sharding.NewCluster([]*pg.DB{db1, db2}, 4, sharding.WithPlacement(plan.Placement()))
+		Expect(moved.Shards(db1)).To(HaveLen(2))
+		Expect(shardID(moved.Shards(db1)[0])).To(Equal(int64(1)))
+		Expect(shardID(moved.Shards(db2)[0])).To(Equal(int64(0)))
+	})
+
+	It("respects the movement budget", func() {
+		plan := cluster.OptimizePlacement(workload, &sharding.OptimizerOptions{MaxMoves: 1})
+		Expect(plan.Moves).To(HaveLen(1))
+		Expect(plan.MaxLoadAfter).To(Equal(120.0))
+
+		plan = cluster.OptimizePlacement(workload, &sharding.OptimizerOptions{MaxBytes: 50})
+		Expect(plan.Moves).To(BeEmpty())
+		Expect(plan.MaxLoadAfter).To(Equal(200.0))
+	})
+})
+
+var _ = Describe("Workload", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		cluster.SetResult(shardingtest.AllShards, "pg_total_relation_size", &shardingtest.Result{
+			Columns: []string{"size"},
+			Rows:    [][]interface{}{{int64(8192)}},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("returns shard sizes and query stats", func() {
+		_, err := cluster.Shard(1).ExecContext(ctx, "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+
+		workload, err := cluster.Workload(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workload).To(HaveLen(2))
+		Expect(workload[1].Bytes).To(Equal(int64(8192)))
+		Expect(workload[1].Queries).To(Equal(uint64(1)))
+		Expect(workload[1].QueryTime).To(BeNumerically(">", 0))
+		Expect(workload[0].Queries).To(BeZero())
+	})
+})
@@ -0,0 +1,106 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// shardParamNames are the names of the params set on every shard.
+var shardParamNames = []string{
+	"shard_id", "shard", "epoch", "shard_bits", "seq_bits", "max_shards",
+	"SHARD_ID", "SHARD", "EPOCH", "SHARD_BITS", "SEQ_BITS", "MAX_SHARDS",
+}
+
+// customParam is a param added with WithShardParam.
+type customParam struct {
+	name  string
+	value func(shardID int64) interface{}
+}
+
+type customParamsKey struct{}
+
+// WithShardParam sets the param with the name on every shard to the value
+// returned by the fn for the shard id, e.g.
+//
+//	sharding.WithShardParam("TABLESPACE", func(shardID int64) interface{} {
+//		return pg.Ident(fmt.Sprintf("ts%d", shardID%4))
+//	})
+//
+// The param is substituted in queries, templates, and FormatString like
+// ?SHARD. Names of the builtin shard params can't be used.
+func WithShardParam(name string, fn func(shardID int64) interface{}) Option {
+	return func(cl *Cluster) {
+		if err := cl.checkCustomParam(name); err != nil {
+			cl.optErr = err
+			return
+		}
+		cl.params = append(cl.params, customParam{name: name, value: fn})
+	}
+}
+
+func (cl *Cluster) checkCustomParam(name string) error {
+	if name == "" {
+		return errors.New("sharding: shard param name is empty")
+	}
+	for i := 0; i < len(name); i++ {
+		if !isParamChar(name[i]) {
+			return fmt.Errorf("sharding: invalid shard param name %q", name)
+		}
+	}
+	if _, ok := shardParams[name]; ok {
+		return fmt.Errorf("sharding: shard param %s is builtin", name)
+	}
+	if cl.hasCustomParam(name) {
+		return fmt.Errorf("sharding: shard param %s is set twice", name)
+	}
+	return nil
+}
+
+func (cl *Cluster) hasCustomParam(name string) bool {
+	for i := range cl.params {
+		if cl.params[i].name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withCustomParams sets the params added with WithShardParam on the shard.
+func (cl *Cluster) withCustomParams(shard *pg.DB, id int64) *pg.DB {
+	if len(cl.params) == 0 {
+		return shard
+	}
+	names := make([]string, len(cl.params))
+	for i, p := range cl.params {
+		shard = shard.WithParam(p.name, p.value(id))
+		names[i] = p.name
+	}
+	return shard.WithContext(context.WithValue(shard.Context(), customParamsKey{}, names))
+}
+
+// ShardParams returns the params the shard substitutes in queries, e.g.
+// SHARD, SHARD_ID, EPOCH, and other IDGen params, their lowercase aliases,
+// and the params added with WithShardParam. The SHARD value is pg.Safe so it is not quoted.
+func ShardParams(shard *pg.DB) map[string]interface{} {
+	custom, _ := shard.Context().Value(customParamsKey{}).([]string)
+	params := make(map[string]interface{}, len(shardParamNames)+len(custom))
+	for _, names := range [][]string{shardParamNames, custom} {
+		for _, name := range names {
+			if value := shard.Param(name); value != nil {
+				params[name] = value
+			}
+		}
+	}
+	return params
+}
+
+// FormatString substitutes the shard params like ?SHARD in the query,
+// e.g. the SQL rendered by an external query builder, so it can be
+// executed or logged as is. Positional placeholders like ? and $1 and
+// unknown params are left intact.
+func FormatString(shard *pg.DB, query string) string {
+	return string(shard.Formatter().FormatQuery(nil, query))
+}
@@ -0,0 +1,81 @@
+package sharding_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestShardParams(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	defer db.Close()
+
+	cl := sharding.NewCluster([]*pg.DB{db}, 4)
+	shard := cl.Shard(2)
+
+	params := sharding.ShardParams(shard)
+	if got := params["SHARD"]; got != pg.Safe("shard2") {
+		t.Errorf("got SHARD=%v, wanted shard2", got)
+	}
+	if got := params["SHARD_ID"]; got != int64(2) {
+		t.Errorf("got SHARD_ID=%v, wanted 2", got)
+	}
+	if got := params["EPOCH"]; got != int64(1262304000000) {
+		t.Errorf("got EPOCH=%v, wanted 1262304000000", got)
+	}
+	if got := params["SHARD_BITS"]; got != int64(11) {
+		t.Errorf("got SHARD_BITS=%v, wanted 11", got)
+	}
+	if got := params["SEQ_BITS"]; got != int64(12) {
+		t.Errorf("got SEQ_BITS=%v, wanted 12", got)
+	}
+	if got := params["max_shards"]; got != int64(2048) {
+		t.Errorf("got max_shards=%v, wanted 2048", got)
+	}
+
+	got := sharding.FormatString(shard,
+		"SELECT * FROM ?SHARD.users WHERE shard_id = ?SHARD_ID AND id = ? AND name = $1 AND x = ?unknown")
+	wanted := "SELECT * FROM shard2.users WHERE shard_id = 2 AND id = ? AND name = $1 AND x = ?unknown"
+	if got != wanted {
+		t.Errorf("got %q, wanted %q", got, wanted)
+	}
+}
+
+func TestWithShardParam(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	defer db.Close()
+
+	cl := sharding.NewCluster([]*pg.DB{db}, 4, sharding.WithShardParam("TABLESPACE", func(shardID int64) interface{} {
+		return pg.Ident(fmt.Sprintf("ts%d", shardID%2))
+	}))
+	shard := cl.Shard(3)
+
+	if got := sharding.ShardParams(shard)["TABLESPACE"]; got != pg.Ident("ts1") {
+		t.Errorf("got TABLESPACE=%v, wanted ts1", got)
+	}
+
+	query := `CREATE TABLE ?SHARD.users (id bigint) TABLESPACE ?TABLESPACE`
+	wanted := `CREATE TABLE shard3.users (id bigint) TABLESPACE "ts1"`
+	if got := sharding.FormatString(shard, query); got != wanted {
+		t.Errorf("got %q, wanted %q", got, wanted)
+	}
+	if got := cl.Compile(query).String(shard); got != wanted {
+		t.Errorf("got %q, wanted %q", got, wanted)
+	}
+
+	for _, name := range []string{"", "SHARD", "bad name"} {
+		_, err := sharding.NewClusterE(&sharding.ClusterOptions{
+			DBs:       []*pg.DB{db},
+			NumShards: 4,
+			Options: []sharding.Option{sharding.WithShardParam(name, func(int64) interface{} {
+				return nil
+			})},
+		})
+		if err == nil {
+			t.Errorf("expected an error for param %q", name)
+		}
+	}
+}
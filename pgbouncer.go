@@ -0,0 +1,87 @@
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// ErrSessionState is returned by features that rely on session state,
+// e.g. prepared statements, when WithPgBouncer is used.
+var ErrSessionState = errors.New("sharding: feature relies on session state")
+
+// WithPgBouncer makes the cluster compatible with pgbouncer in transaction
+// pooling mode, where consecutive transactions may run on different
+// server sessions. Prepare and PrepareAll fail with ErrSessionState.
+// LISTEN can't fail, so Listen and ListenAll keep working and are
+// reported by CheckPgBouncer with other session-level usages.
+//
+// Queries must reference tables as ?SHARD.table; use
+// WithTableCheck(TableCheckError) to enforce it. CreateTable sets
+// search_path with SET LOCAL which is scoped to the transaction and is
+// compatible with transaction pooling.
+func WithPgBouncer() Option {
+	return func(cl *Cluster) {
+		cl.pgbouncer = true
+	}
+}
+
+// PgBouncerIssue is a usage of the cluster that is incompatible with
+// pgbouncer transaction pooling.
+type PgBouncerIssue struct {
+	// Feature is the incompatible feature, e.g. LISTEN.
+	Feature string
+	Detail  string
+}
+
+func (i PgBouncerIssue) String() string {
+	return i.Feature + ": " + i.Detail
+}
+
+// CheckPgBouncer returns the usages of the cluster that rely on session
+// state and break with pgbouncer transaction pooling. It can be used
+// with or without WithPgBouncer, e.g. in a test before the migration.
+func (cl *Cluster) CheckPgBouncer() []PgBouncerIssue {
+	var issues []PgBouncerIssue
+
+	if n := atomic.LoadInt64(&cl.listens); n > 0 {
+		issues = append(issues, PgBouncerIssue{
+			Feature: "LISTEN",
+			Detail:  fmt.Sprintf("%d open shard listeners", n),
+		})
+	}
+
+	cl.stmts.mu.Lock()
+	names := make([]string, 0, len(cl.stmts.stmts))
+	for key := range cl.stmts.stmts {
+		names = append(names, key)
+	}
+	cl.stmts.mu.Unlock()
+	if len(names) > 0 {
+		sort.Strings(names)
+		issues = append(issues, PgBouncerIssue{
+			Feature: "prepared statements",
+			Detail:  fmt.Sprintf("%d statements are prepared, first is %s", len(names), names[0]),
+		})
+	}
+
+	for _, db := range cl.topology().servers {
+		if db.Options().OnConnect != nil {
+			issues = append(issues, PgBouncerIssue{
+				Feature: "session settings",
+				Detail: fmt.Sprintf("OnConnect of %s is not called for every server session",
+					db.Options().Addr),
+			})
+		}
+	}
+
+	if cl.tableCheck == TableCheckOff {
+		issues = append(issues, PgBouncerIssue{
+			Feature: "search_path",
+			Detail:  "table check is off so unqualified tables may resolve through search_path",
+		})
+	}
+
+	return issues
+}
@@ -0,0 +1,64 @@
+package sharding_test
+
+import (
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithPgBouncer", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2, sharding.WithPgBouncer())
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("rejects prepared statements", func() {
+		_, err := cluster.Prepare(0, "get_user", "SELECT * FROM ?SHARD.users WHERE id = $1")
+		Expect(errors.Is(err, sharding.ErrSessionState)).To(BeTrue())
+
+		err = cluster.PrepareAll("get_user", "SELECT * FROM ?SHARD.users WHERE id = $1")
+		Expect(errors.Is(err, sharding.ErrSessionState)).To(BeTrue())
+	})
+
+	It("reports session state usages", func() {
+		// The fake servers don't support LISTEN.
+		db := pg.Connect(&pg.Options{Addr: "127.0.0.1:1"})
+		defer db.Close()
+		cl := sharding.NewCluster([]*pg.DB{db}, 2, sharding.WithPgBouncer())
+
+		Expect(issueFeatures(cl.CheckPgBouncer())).To(Equal([]string{"search_path"}))
+
+		ln := cl.ListenAll(ctx, "events")
+		Expect(issueFeatures(cl.CheckPgBouncer())).To(Equal([]string{"LISTEN", "search_path"}))
+
+		_ = ln.Close()
+		Expect(issueFeatures(cl.CheckPgBouncer())).To(Equal([]string{"search_path"}))
+	})
+
+	It("passes with the table check", func() {
+		checked := shardingtest.NewCluster(2, sharding.WithPgBouncer(),
+			sharding.WithTableCheck(sharding.TableCheckError))
+		defer checked.Close()
+
+		Expect(checked.CheckPgBouncer()).To(BeEmpty())
+	})
+})
+
+func issueFeatures(issues []sharding.PgBouncerIssue) []string {
+	features := make([]string, len(issues))
+	for i, issue := range issues {
+		features[i] = issue.Feature
+	}
+	return features
+}
@@ -0,0 +1,102 @@
+package sharding
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ServerPing is the result of pinging a database server.
+type ServerPing struct {
+	DB   *pg.DB
+	Addr string
+	// ConnectTime is the time it takes to establish a new connection
+	// including authentication and the first round trip.
+	ConnectTime time.Duration
+	// RTT is the round trip time of a query on a pooled connection.
+	RTT time.Duration
+	// Version is the PostgreSQL server_version.
+	Version string
+	// Err is the first error encountered while pinging the server.
+	Err error
+}
+
+// PingAll concurrently pings every database server in the cluster and
+// returns results in the same order as the servers. Failed pings are
+// reported via ServerPing.Err.
+func (cl *Cluster) PingAll(ctx context.Context) []ServerPing {
+	t := cl.topology()
+	pings := make([]ServerPing, len(t.servers))
+	inds := make(map[*pg.DB]int, len(t.servers))
+	for i, db := range t.servers {
+		inds[db] = i
+	}
+
+	_ = t.forEachDB(func(db *pg.DB) error {
+		pings[inds[db]] = pingServer(ctx, db)
+		return nil
+	})
+	return pings
+}
+
+func pingServer(ctx context.Context, db *pg.DB) ServerPing {
+	ping := ServerPing{
+		DB:   db,
+		Addr: db.Options().Addr,
+	}
+
+	opt := *db.Options()
+	opt.PoolSize = 1
+	opt.MinIdleConns = 0
+	fresh := pg.Connect(&opt)
+	defer fresh.Close()
+
+	start := time.Now()
+	if err := fresh.Ping(ctx); err != nil {
+		ping.Err = err
+		return ping
+	}
+	ping.ConnectTime = time.Since(start)
+
+	start = time.Now()
+	if err := db.Ping(ctx); err != nil {
+		ping.Err = err
+		return ping
+	}
+	ping.RTT = time.Since(start)
+
+	_, err := db.QueryOneContext(ctx, pg.Scan(&ping.Version), "SHOW server_version")
+	if err != nil {
+		ping.Err = err
+	}
+	return ping
+}
+
+// MonitorHealth pings every database server with the interval and marks
+// servers healthy or unhealthy with SetHealthyContext depending on the result.
+// The fn, if not nil, receives results of every round. MonitorHealth
+// blocks until the ctx is done.
+func (cl *Cluster) MonitorHealth(ctx context.Context, interval time.Duration, fn func([]ServerPing)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pings := cl.PingAll(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		for i := range pings {
+			_ = cl.SetHealthyContext(ctx, pings[i].DB, pings[i].Err == nil)
+		}
+		if fn != nil {
+			fn(pings)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package sharding_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PingAll", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		cluster.SetResult(shardingtest.AllShards, "server_version", &shardingtest.Result{
+			Columns: []string{"server_version"},
+			Rows:    [][]interface{}{{"13.0"}},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("pings every server", func() {
+		cluster.SetError(1, &shardingtest.Error{Message: "server is down"})
+
+		pings := cluster.PingAll(ctx)
+		Expect(pings).To(HaveLen(2))
+
+		Expect(pings[0].Err).NotTo(HaveOccurred())
+		Expect(pings[0].Version).To(Equal("13.0"))
+		Expect(pings[0].ConnectTime).To(BeNumerically(">", 0))
+		Expect(pings[0].RTT).To(BeNumerically(">", 0))
+
+		Expect(pings[1].Err).To(MatchError("ERROR #XX000 server is down"))
+	})
+
+	It("marks failed servers unhealthy", func() {
+		cluster.SetError(1, &shardingtest.Error{Message: "server is down"})
+
+		ctx, cancel := context.WithCancel(ctx)
+		cluster.MonitorHealth(ctx, time.Hour, func([]sharding.ServerPing) {
+			cancel()
+		})
+
+		dbs := cluster.DBs()
+		Expect(cluster.Healthy(dbs[0])).To(BeTrue())
+		Expect(cluster.Healthy(dbs[1])).To(BeFalse())
+	})
+})
@@ -0,0 +1,64 @@
+package sharding
+
+// Placement assigns logical shards to the databases of the cluster.
+type Placement interface {
+	// Place returns index in the cluster dbs for each of nshards shards.
+	// The prev holds current index of each shard or -1 if the shard's
+	// database is being removed. It is nil when the cluster is created.
+	Place(nshards, ndbs int, prev []int) []int
+}
+
+// PlacementFunc is an adapter to use ordinary functions as Placement.
+type PlacementFunc func(nshards, ndbs int, prev []int) []int
+
+func (fn PlacementFunc) Place(nshards, ndbs int, prev []int) []int {
+	return fn(nshards, ndbs, prev)
+}
+
+// RoundRobinPlacement assigns shard i to the db i % ndbs ignoring
+// the previous assignment.
+var RoundRobinPlacement Placement = PlacementFunc(func(nshards, ndbs int, _ []int) []int {
+	inds := make([]int, nshards)
+	for i := range inds {
+		inds[i] = i % ndbs
+	}
+	return inds
+})
+
+// StickyPlacement keeps shards on their current databases and moves only
+// as many shards as required to balance the cluster, which minimizes data
+// movement when databases are added or removed.
+var StickyPlacement Placement = PlacementFunc(func(nshards, ndbs int, prev []int) []int {
+	if prev == nil {
+		return RoundRobinPlacement.Place(nshards, ndbs, nil)
+	}
+
+	capacity := make([]int, ndbs)
+	for i := range capacity {
+		capacity[i] = nshards / ndbs
+		if i < nshards%ndbs {
+			capacity[i]++
+		}
+	}
+
+	inds := make([]int, nshards)
+	var moved []int
+	for i, ind := range prev {
+		if ind >= 0 && ind < ndbs && capacity[ind] > 0 {
+			inds[i] = ind
+			capacity[ind]--
+			continue
+		}
+		moved = append(moved, i)
+	}
+
+	dbInd := 0
+	for _, i := range moved {
+		for capacity[dbInd] == 0 {
+			dbInd++
+		}
+		inds[i] = dbInd
+		capacity[dbInd]--
+	}
+	return inds
+})
@@ -0,0 +1,140 @@
+package sharding
+
+// ShardMap is an assignment of shards to servers: the shard with id i
+// is placed on the server with index ShardMap[i].
+type ShardMap []int
+
+// ShardMap returns the current assignment of shards to the cluster
+// dbs, i.e. indexes in DBs().
+func (cl *Cluster) ShardMap() ShardMap {
+	t := cl.topology()
+	m := make(ShardMap, len(t.shards))
+	for i := range t.shards {
+		m[i] = t.shards[i].dbInd
+	}
+	return m
+}
+
+// Placement returns a Placement that assigns shards according to the map
+// where server indexes are indexes in the cluster dbs. It falls back to
+// StickyPlacement when the map does not fit the cluster.
+func (m ShardMap) Placement() Placement {
+	return PlacementFunc(func(nshards, ndbs int, prev []int) []int {
+		if nshards != len(m) {
+			return StickyPlacement.Place(nshards, ndbs, prev)
+		}
+		for _, ind := range m {
+			if ind < 0 || ind >= ndbs {
+				return StickyPlacement.Place(nshards, ndbs, prev)
+			}
+		}
+		return append([]int(nil), m...)
+	})
+}
+
+// Planner plans moves of shards between servers that balance the load.
+type Planner struct {
+	// Load returns the load of the shard. Default is the QueryTime or
+	// Bytes when no queries were timed.
+	Load func(w *ShardWorkload) float64
+	// MaxMoves limits the number of moved shards. Zero means no limit.
+	MaxMoves int
+	// MaxBytes limits the total size of moved shards. Zero means no limit.
+	MaxBytes int64
+}
+
+// Migration moves the shard from the server with index From to the server
+// with index To.
+type Migration struct {
+	ShardID int64
+	From    int
+	To      int
+	Bytes   int64
+}
+
+// RebalancePlan is the result of Planner.Plan.
+type RebalancePlan struct {
+	// Map is the assignment after the migrations.
+	Map ShardMap
+	// Migrations are ordered so that every migration reduces
+	// the max server load as much as possible.
+	Migrations []Migration
+	// Bytes is the estimated amount of data to move.
+	Bytes int64
+	// MaxLoad is the load of the most loaded server before and after
+	// the migrations.
+	MaxLoadBefore float64
+	MaxLoadAfter  float64
+}
+
+// Plan returns migrations that minimize the load of the most loaded of
+// nservers servers within the movement budget. It greedily moves a shard
+// from the most loaded server to the least loaded one while that reduces
+// the max load and moves every shard at most once. Workload of shards
+// missing in the workload is zero.
+func (p *Planner) Plan(current ShardMap, nservers int, workload []ShardWorkload) *RebalancePlan {
+	loadFn := p.Load
+	if loadFn == nil {
+		loadFn = defaultShardLoad(workload)
+	}
+
+	plan := &RebalancePlan{
+		Map: append(ShardMap(nil), current...),
+	}
+
+	shardLoads := make([]float64, len(current))
+	shardBytes := make([]int64, len(current))
+	for i := range workload {
+		w := &workload[i]
+		if w.ShardID < 0 || int(w.ShardID) >= len(current) {
+			continue
+		}
+		shardLoads[w.ShardID] = loadFn(w)
+		shardBytes[w.ShardID] = w.Bytes
+	}
+
+	loads := make([]float64, nservers)
+	for i, load := range shardLoads {
+		loads[current[i]] += load
+	}
+	plan.MaxLoadBefore = maxFloat(loads)
+
+	moved := make([]bool, len(current))
+	for p.MaxMoves == 0 || len(plan.Migrations) < p.MaxMoves {
+		from, to := argMax(loads), argMin(loads)
+		diff := loads[from] - loads[to]
+
+		// The best shard is the one closest to diff/2: moving it makes
+		// both servers as close to each other as possible.
+		best := -1
+		for i := range plan.Map {
+			if moved[i] || plan.Map[i] != from || shardLoads[i] <= 0 || shardLoads[i] >= diff {
+				continue
+			}
+			if p.MaxBytes > 0 && plan.Bytes+shardBytes[i] > p.MaxBytes {
+				continue
+			}
+			if best == -1 || abs(shardLoads[i]-diff/2) < abs(shardLoads[best]-diff/2) {
+				best = i
+			}
+		}
+		if best == -1 {
+			break
+		}
+
+		moved[best] = true
+		loads[from] -= shardLoads[best]
+		loads[to] += shardLoads[best]
+		plan.Map[best] = to
+		plan.Bytes += shardBytes[best]
+		plan.Migrations = append(plan.Migrations, Migration{
+			ShardID: int64(best),
+			From:    from,
+			To:      to,
+			Bytes:   shardBytes[best],
+		})
+	}
+
+	plan.MaxLoadAfter = maxFloat(loads)
+	return plan
+}
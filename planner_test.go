@@ -0,0 +1,67 @@
+package sharding_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestPlanner(t *testing.T) {
+	current := sharding.ShardMap{0, 0, 0, 1, 1, 2}
+	workload := []sharding.ShardWorkload{
+		{ShardID: 0, Bytes: 50},
+		{ShardID: 1, Bytes: 40},
+		{ShardID: 2, Bytes: 30},
+		{ShardID: 3, Bytes: 20},
+		{ShardID: 4, Bytes: 10},
+	}
+
+	plan := (&sharding.Planner{}).Plan(current, 3, workload)
+	if plan.MaxLoadBefore != 120 {
+		t.Errorf("got max load %v, wanted 120", plan.MaxLoadBefore)
+	}
+	if plan.MaxLoadAfter != 50 {
+		t.Errorf("got max load %v, wanted 50", plan.MaxLoadAfter)
+	}
+	wantedMigrations := []sharding.Migration{
+		{ShardID: 0, From: 0, To: 2, Bytes: 50},
+		{ShardID: 2, From: 0, To: 1, Bytes: 30},
+		{ShardID: 4, From: 1, To: 0, Bytes: 10},
+	}
+	if !reflect.DeepEqual(plan.Migrations, wantedMigrations) {
+		t.Errorf("got %v, wanted %v", plan.Migrations, wantedMigrations)
+	}
+	wantedMap := sharding.ShardMap{2, 0, 1, 1, 0, 2}
+	if !reflect.DeepEqual(plan.Map, wantedMap) {
+		t.Errorf("got %v, wanted %v", plan.Map, wantedMap)
+	}
+	if !reflect.DeepEqual(current, sharding.ShardMap{0, 0, 0, 1, 1, 2}) {
+		t.Errorf("current map is modified: %v", current)
+	}
+
+	plan = (&sharding.Planner{MaxMoves: 1}).Plan(current, 3, workload)
+	if len(plan.Migrations) != 1 {
+		t.Errorf("got %d migrations, wanted 1", len(plan.Migrations))
+	}
+}
+
+func TestShardMapPlacement(t *testing.T) {
+	db1 := pg.Connect(&pg.Options{Addr: "db1"})
+	db2 := pg.Connect(&pg.Options{Addr: "db2"})
+	cluster := sharding.NewCluster([]*pg.DB{db1, db2}, 4)
+	defer cluster.Close()
+
+	m := cluster.ShardMap()
+	if !reflect.DeepEqual(m, sharding.ShardMap{0, 1, 0, 1}) {
+		t.Fatalf("got %v", m)
+	}
+
+	m[0] = 1
+	moved := sharding.NewCluster([]*pg.DB{db1, db2}, 4, sharding.WithPlacement(m.Placement()))
+	if got := len(moved.Shards(db2)); got != 3 {
+		t.Errorf("got %d shards on db2, wanted 3", got)
+	}
+}
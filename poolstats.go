@@ -0,0 +1,69 @@
+package sharding
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ServerPoolStats are connection pool stats of a database server and
+// query counts of the shards it runs.
+type ServerPoolStats struct {
+	Addr string
+	// PoolSize is the max number of connections in the pool.
+	PoolSize int
+	pg.PoolStats
+	// Inflight is the number of queries running on the server.
+	Inflight int64
+	// Queries is the number of queries executed on the server shards.
+	Queries uint64
+	Shards  []ShardQueryStats
+}
+
+// ShardQueryStats are query counts of a shard since the cluster was
+// created.
+type ShardQueryStats struct {
+	ShardID   int64
+	Queries   uint64
+	QueryTime time.Duration
+	// Shed is the number of queries rejected by the ShedPolicy.
+	Shed uint64
+}
+
+// PoolStats returns a snapshot of connection pool stats of every unique
+// database server in the order of DBs, e.g. for export with expvar:
+//
+//	expvar.Publish("sharding", expvar.Func(func() interface{} {
+//		return cluster.PoolStats()
+//	}))
+func (cl *Cluster) PoolStats() []ServerPoolStats {
+	t := cl.topology()
+
+	inds := make(map[*pg.DB]int, len(t.servers))
+	servers := make([]ServerPoolStats, len(t.servers))
+	for i, db := range t.servers {
+		inds[db] = i
+		servers[i] = ServerPoolStats{
+			Addr:      db.Options().Addr,
+			PoolSize:  db.Options().PoolSize,
+			PoolStats: *db.PoolStats(),
+			Inflight:  atomic.LoadInt64(t.inflight[db]),
+		}
+	}
+
+	for i := range t.shards {
+		shard := &t.shards[i]
+		stats := &cl.stats[shard.id]
+		s := &servers[inds[t.dbs[shard.dbInd]]]
+		qs := ShardQueryStats{
+			ShardID:   int64(shard.id),
+			Queries:   atomic.LoadUint64(&stats.queries),
+			QueryTime: time.Duration(atomic.LoadInt64(&stats.queryTime)),
+			Shed:      atomic.LoadUint64(&stats.shed),
+		}
+		s.Queries += qs.Queries
+		s.Shards = append(s.Shards, qs)
+	}
+	return servers
+}
@@ -0,0 +1,44 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PoolStats", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("attributes queries to shards and servers", func() {
+		for i := 0; i < 3; i++ {
+			_, err := cluster.Shard(1).ExecContext(ctx, "SELECT 1")
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		stats := cluster.PoolStats()
+		Expect(stats).To(HaveLen(2))
+
+		Expect(stats[0].Addr).To(Equal("shardingtest0"))
+		Expect(stats[0].Queries).To(BeZero())
+		Expect(stats[0].Shards).To(HaveLen(1))
+		Expect(stats[0].Shards[0].ShardID).To(BeZero())
+
+		Expect(stats[1].Addr).To(Equal("shardingtest1"))
+		Expect(stats[1].Queries).To(Equal(uint64(3)))
+		Expect(stats[1].TotalConns).To(Equal(uint32(1)))
+		Expect(stats[1].Inflight).To(BeZero())
+		Expect(stats[1].Shards).To(HaveLen(1))
+		Expect(stats[1].Shards[0].ShardID).To(Equal(int64(1)))
+		Expect(stats[1].Shards[0].Queries).To(Equal(uint64(3)))
+		Expect(stats[1].Shards[0].QueryTime).To(BeNumerically(">", 0))
+	})
+})
@@ -0,0 +1,123 @@
+package sharding
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// stmtCache holds statements prepared on shards by name.
+type stmtCache struct {
+	mu    sync.Mutex
+	stmts map[string]*pg.Stmt // indexed by shard id and name
+}
+
+func stmtKey(shardID int64, name string) string {
+	return strconv.FormatInt(shardID, 10) + ":" + name
+}
+
+// Prepare formats the query params like ?SHARD once, prepares the query
+// on the shard with the number, and caches the statement under the name.
+// Statements with the same name on the same shard are prepared only once.
+// Every statement holds a connection of the server pool until it is
+// closed with ClosePrepared or the cluster is closed.
+func (cl *Cluster) Prepare(number int64, name, query string) (*pg.Stmt, error) {
+	if cl.pgbouncer {
+		return nil, fmt.Errorf("%w: prepared statements are not supported by pgbouncer", ErrSessionState)
+	}
+
+	return cl.prepareByID(cl.shardID(number), name, query)
+}
+
+// prepareByID is like Prepare, but takes the shard id instead of the
+// number so the id is not scrambled.
+func (cl *Cluster) prepareByID(shardID int64, name, query string) (*pg.Stmt, error) {
+	key := stmtKey(shardID, name)
+
+	cl.stmts.mu.Lock()
+	defer cl.stmts.mu.Unlock()
+
+	if stmt, ok := cl.stmts.stmts[key]; ok {
+		return stmt, nil
+	}
+
+	shard := cl.shardByID(shardID)
+	q := shard.Formatter().FormatQuery(nil, query)
+	stmt, err := shard.Prepare(string(q))
+	if err != nil {
+		return nil, WrapShardError(shard, err)
+	}
+
+	if cl.stmts.stmts == nil {
+		cl.stmts.stmts = make(map[string]*pg.Stmt)
+	}
+	cl.stmts.stmts[key] = stmt
+	return stmt, nil
+}
+
+// Prepared returns the statement prepared with Prepare on the shard
+// with the number.
+func (cl *Cluster) Prepared(number int64, name string) (*pg.Stmt, bool) {
+	cl.stmts.mu.Lock()
+	stmt, ok := cl.stmts.stmts[stmtKey(cl.shardID(number), name)]
+	cl.stmts.mu.Unlock()
+	return stmt, ok
+}
+
+// PrepareAll prepares the query on every shard. It fails when database
+// servers don't have enough connections to hold a statement per shard.
+func (cl *Cluster) PrepareAll(name, query string) error {
+	if cl.pgbouncer {
+		return fmt.Errorf("%w: prepared statements are not supported by pgbouncer", ErrSessionState)
+	}
+
+	t := cl.topology()
+	for _, db := range t.servers {
+		nshards := len(cl.Shards(db))
+		if db.Options().PoolSize <= nshards {
+			return fmt.Errorf("sharding: PrepareAll requires PoolSize greater than %d shards of %s",
+				nshards, db.Options().Addr)
+		}
+	}
+
+	return cl.ForEachShard(func(shard *pg.DB) error {
+		_, err := cl.prepareByID(shard.Param("SHARD_ID").(int64), name, query)
+		return err
+	})
+}
+
+// ClosePrepared closes statements prepared with the name on all shards.
+func (cl *Cluster) ClosePrepared(name string) error {
+	cl.stmts.mu.Lock()
+	defer cl.stmts.mu.Unlock()
+
+	var firstErr error
+	for shardID := 0; shardID < cl.nshards; shardID++ {
+		key := stmtKey(int64(shardID), name)
+		stmt, ok := cl.stmts.stmts[key]
+		if !ok {
+			continue
+		}
+		delete(cl.stmts.stmts, key)
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (c *stmtCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for key, stmt := range c.stmts {
+		delete(c.stmts, key)
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,34 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prepare", func() {
+	It("returns shard errors", func() {
+		cluster := shardingtest.NewCluster(2)
+		defer cluster.Close()
+
+		_, err := cluster.Prepare(1, "get_user", "SELECT * FROM ?SHARD.users WHERE id = $1")
+		Expect(err).To(MatchError(
+			"sharding: shard 1 (shardingtest1): ERROR #0A000 shardingtest: extended query protocol is not supported"))
+
+		_, ok := cluster.Prepared(1, "get_user")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("checks pool size before preparing on all shards", func() {
+		db := pg.Connect(&pg.Options{Addr: "db1", PoolSize: 4})
+		cluster := sharding.NewCluster([]*pg.DB{db}, 4)
+		defer cluster.Close()
+
+		err := cluster.PrepareAll("get_user", "SELECT * FROM ?SHARD.users WHERE id = $1")
+		Expect(err).To(MatchError("sharding: PrepareAll requires PoolSize greater than 4 shards of db1"))
+	})
+})
@@ -0,0 +1,173 @@
+package sharding
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ProvisionTemplate describes how to create a shard schema.
+type ProvisionTemplate struct {
+	// Queries are executed in a single transaction, e.g. CREATE SCHEMA ?SHARD.
+	Queries []string
+	// NoTxQueries are executed after the transaction is committed. Use it
+	// for statements that can't run in a transaction, e.g.
+	// CREATE INDEX CONCURRENTLY.
+	NoTxQueries []string
+	// Cleanup is executed when NoTxQueries fail after the transaction
+	// created the shard schema. Shards whose schema existed before
+	// the run are never cleaned up. Default is
+	// DROP SCHEMA IF EXISTS ?SHARD CASCADE.
+	Cleanup []string
+}
+
+// ProvisionResult is the outcome of provisioning a shard.
+type ProvisionResult struct {
+	ShardID  int64
+	Time     time.Time
+	Duration time.Duration
+	Err      error
+	// CleanupErr is the error returned by the cleanup queries.
+	CleanupErr error
+}
+
+// Provisioner creates shard schemas using a template and records
+// the outcome for every shard so failed shards can be retried.
+type Provisioner struct {
+	cl   *Cluster
+	tmpl *ProvisionTemplate
+
+	mu      sync.Mutex
+	results map[int64]*ProvisionResult
+}
+
+// NewProvisioner returns a provisioner for the cluster shards.
+func (cl *Cluster) NewProvisioner(tmpl *ProvisionTemplate) *Provisioner {
+	return &Provisioner{
+		cl:      cl,
+		tmpl:    tmpl,
+		results: make(map[int64]*ProvisionResult),
+	}
+}
+
+// Run provisions every shard in the cluster and returns the first error.
+func (p *Provisioner) Run(ctx context.Context) error {
+	return p.cl.ForEachShard(func(shard *pg.DB) error {
+		return p.provision(ctx, shard)
+	})
+}
+
+// Retry provisions shards that failed during previous runs.
+func (p *Provisioner) Retry(ctx context.Context) error {
+	failed := make(map[int64]struct{})
+	for _, id := range p.Failed() {
+		failed[id] = struct{}{}
+	}
+
+	return p.cl.ForEachShard(func(shard *pg.DB) error {
+		if _, ok := failed[shard.Param("SHARD_ID").(int64)]; !ok {
+			return nil
+		}
+		return p.provision(ctx, shard)
+	})
+}
+
+// Results returns the latest outcome for every provisioned shard
+// ordered by shard id.
+func (p *Provisioner) Results() []ProvisionResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	results := make([]ProvisionResult, 0, len(p.results))
+	for _, res := range p.results {
+		results = append(results, *res)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ShardID < results[j].ShardID
+	})
+	return results
+}
+
+// Failed returns ids of the shards that failed to provision.
+func (p *Provisioner) Failed() []int64 {
+	var ids []int64
+	for _, res := range p.Results() {
+		if res.Err != nil {
+			ids = append(ids, res.ShardID)
+		}
+	}
+	return ids
+}
+
+func (p *Provisioner) provision(ctx context.Context, shard *pg.DB) error {
+	res := &ProvisionResult{
+		ShardID: shard.Param("SHARD_ID").(int64),
+		Time:    time.Now(),
+	}
+
+	created, err := p.run(ctx, shard)
+	res.Err = WrapShardError(shard, err)
+	if res.Err != nil && created {
+		res.CleanupErr = WrapShardError(shard, p.cleanup(ctx, shard))
+	}
+	res.Duration = time.Since(res.Time)
+
+	p.mu.Lock()
+	p.results[res.ShardID] = res
+	p.mu.Unlock()
+
+	auditErr := p.cl.audit(ctx, "provision_shard", map[string]interface{}{
+		"shard_id": res.ShardID,
+	}, res.Err)
+	if res.Err != nil {
+		return res.Err
+	}
+	return auditErr
+}
+
+// run executes the template and reports whether the shard schema was
+// created by this run, i.e. whether it is safe to clean it up.
+func (p *Provisioner) run(ctx context.Context, shard *pg.DB) (bool, error) {
+	var existed bool
+	err := shard.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		_, err := tx.QueryContext(ctx, pg.Scan(&existed),
+			"SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = '?SHARD')")
+		if err != nil {
+			return err
+		}
+
+		for _, q := range p.tmpl.Queries {
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// The transaction is rolled back so there is nothing to clean up.
+		return false, err
+	}
+
+	for _, q := range p.tmpl.NoTxQueries {
+		if _, err := shard.ExecContext(ctx, q); err != nil {
+			return !existed, err
+		}
+	}
+	return !existed, nil
+}
+
+func (p *Provisioner) cleanup(ctx context.Context, shard *pg.DB) error {
+	queries := p.tmpl.Cleanup
+	if len(queries) == 0 {
+		queries = []string{"DROP SCHEMA IF EXISTS ?SHARD CASCADE"}
+	}
+	for _, q := range queries {
+		if _, err := shard.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
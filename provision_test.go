@@ -0,0 +1,100 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Provisioner", func() {
+	var cluster *shardingtest.Cluster
+	var p *sharding.Provisioner
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		p = cluster.NewProvisioner(&sharding.ProvisionTemplate{
+			Queries:     []string{"CREATE SCHEMA ?SHARD"},
+			NoTxQueries: []string{"CREATE INDEX CONCURRENTLY users_idx ON ?SHARD.users (id)"},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("cleans up and retries failed shards", func() {
+		cluster.SetResult(shardingtest.AllShards, "pg_namespace", &shardingtest.Result{
+			Columns: []string{"exists"},
+			Rows:    [][]interface{}{{false}},
+		})
+		cluster.SetQueryError(1, "CREATE INDEX", &shardingtest.Error{Message: "disk is full"})
+
+		err := p.Run(ctx)
+		Expect(err).To(MatchError("sharding: shard 1 (shardingtest1): ERROR #XX000 disk is full"))
+		Expect(p.Failed()).To(Equal([]int64{1}))
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"BEGIN",
+			"SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = 'shard1')",
+			"CREATE SCHEMA shard1",
+			"COMMIT",
+			"CREATE INDEX CONCURRENTLY users_idx ON shard1.users (id)",
+			"DROP SCHEMA IF EXISTS shard1 CASCADE",
+		}))
+
+		cluster.Reset()
+		cluster.SetResult(shardingtest.AllShards, "pg_namespace", &shardingtest.Result{
+			Columns: []string{"exists"},
+			Rows:    [][]interface{}{{false}},
+		})
+		Expect(p.Retry(ctx)).NotTo(HaveOccurred())
+		Expect(p.Failed()).To(BeEmpty())
+		Expect(cluster.RoutedShards()).To(Equal([]int64{1}))
+
+		results := p.Results()
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].ShardID).To(Equal(int64(0)))
+		Expect(results[1].ShardID).To(Equal(int64(1)))
+	})
+
+	It("does not clean up shards that were already provisioned", func() {
+		cluster.SetResult(shardingtest.AllShards, "pg_namespace", &shardingtest.Result{
+			Columns: []string{"exists"},
+			Rows:    [][]interface{}{{true}},
+		})
+		cluster.SetQueryError(shardingtest.AllShards, "CREATE SCHEMA", &shardingtest.Error{
+			Code:    "42P06",
+			Message: `schema "shard1" already exists`,
+		})
+
+		err := p.Run(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"BEGIN",
+			"SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = 'shard1')",
+			"CREATE SCHEMA shard1",
+			"ROLLBACK",
+		}))
+		for _, res := range p.Results() {
+			Expect(res.CleanupErr).NotTo(HaveOccurred())
+		}
+	})
+
+	It("does not clean up existing schemas when NoTxQueries fail", func() {
+		p = cluster.NewProvisioner(&sharding.ProvisionTemplate{
+			Queries:     []string{"CREATE SCHEMA IF NOT EXISTS ?SHARD"},
+			NoTxQueries: []string{"CREATE INDEX CONCURRENTLY users_idx ON ?SHARD.users (id)"},
+		})
+		cluster.SetResult(1, "pg_namespace", &shardingtest.Result{
+			Columns: []string{"exists"},
+			Rows:    [][]interface{}{{true}},
+		})
+		cluster.SetQueryError(1, "CREATE INDEX", &shardingtest.Error{Message: "disk is full"})
+
+		Expect(p.Run(ctx)).To(HaveOccurred())
+		for _, q := range cluster.Queries(1) {
+			Expect(q).NotTo(ContainSubstring("DROP"))
+		}
+	})
+})
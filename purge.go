@@ -0,0 +1,120 @@
+package sharding
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// PurgeTable is a table with rows of a key, e.g. an account, that are
+// purged by PurgeKey.
+type PurgeTable struct {
+	// Table name without the shard schema, e.g. "comments".
+	Table string
+	// Column that references the key, e.g. "account_id".
+	Column string
+	// Anonymize, if not empty, makes PurgeKey update the columns to the
+	// values instead of deleting the rows, e.g. {"email": nil}.
+	Anonymize map[string]interface{}
+}
+
+// PurgeOptions configures PurgeKey.
+type PurgeOptions struct {
+	// DryRun counts the rows that would be purged without changing them.
+	DryRun bool
+}
+
+// PurgeResult is the outcome of PurgeKey.
+type PurgeResult struct {
+	Key     int64
+	ShardID int64
+	DryRun  bool
+	// Rows is the number of rows deleted or anonymized in every table,
+	// or that would be with DryRun.
+	Rows map[string]int
+}
+
+// PurgeKey deletes or anonymizes rows of the key in the tables, in order,
+// in a single transaction on the shard owning the key, e.g. to fulfill
+// a data deletion request.
+func (cl *Cluster) PurgeKey(
+	ctx context.Context, key int64, tables []PurgeTable, opt *PurgeOptions,
+) (*PurgeResult, error) {
+	if opt == nil {
+		opt = new(PurgeOptions)
+	}
+
+	res := &PurgeResult{
+		Key:     key,
+		ShardID: cl.shardID(key),
+		DryRun:  opt.DryRun,
+		Rows:    make(map[string]int, len(tables)),
+	}
+
+	shard := cl.Shard(key)
+	err := shard.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		for i := range tables {
+			n, err := purgeTable(ctx, tx, &tables[i], key, opt.DryRun)
+			if err != nil {
+				return err
+			}
+			res.Rows[tables[i].Table] = n
+		}
+		return nil
+	})
+	err = WrapShardError(shard, err)
+
+	auditErr := cl.audit(ctx, "purge_key", map[string]interface{}{
+		"key":      key,
+		"shard_id": res.ShardID,
+		"dry_run":  opt.DryRun,
+		"rows":     res.Rows,
+	}, err)
+	if err != nil {
+		return nil, err
+	}
+	return res, auditErr
+}
+
+func purgeTable(ctx context.Context, tx *pg.Tx, t *PurgeTable, key int64, dryRun bool) (int, error) {
+	if dryRun {
+		var n int
+		_, err := tx.QueryOneContext(ctx, pg.Scan(&n), "SELECT count(*) FROM ?SHARD.? WHERE ? = ?",
+			pg.Ident(t.Table), pg.Ident(t.Column), key)
+		return n, err
+	}
+
+	if len(t.Anonymize) == 0 {
+		res, err := tx.ExecContext(ctx, "DELETE FROM ?SHARD.? WHERE ? = ?",
+			pg.Ident(t.Table), pg.Ident(t.Column), key)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected(), nil
+	}
+
+	columns := make([]string, 0, len(t.Anonymize))
+	for column := range t.Anonymize {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	query := "UPDATE ?SHARD.? SET "
+	params := []interface{}{pg.Ident(t.Table)}
+	for i, column := range columns {
+		if i > 0 {
+			query += ", "
+		}
+		query += "? = ?"
+		params = append(params, pg.Ident(column), t.Anonymize[column])
+	}
+	query += " WHERE ? = ?"
+	params = append(params, pg.Ident(t.Column), key)
+
+	res, err := tx.ExecContext(ctx, query, params...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,80 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PurgeKey", func() {
+	var cluster *shardingtest.Cluster
+	tables := []sharding.PurgeTable{
+		{Table: "comments", Column: "account_id"},
+		{Table: "accounts", Column: "id", Anonymize: map[string]interface{}{
+			"name":  "deleted",
+			"email": nil,
+		}},
+	}
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("deletes and anonymizes rows on the owning shard", func() {
+		cluster.SetResult(1, "comments", &shardingtest.Result{
+			Tag:          "DELETE",
+			RowsAffected: 3,
+		})
+		cluster.SetResult(1, "accounts", &shardingtest.Result{
+			Tag:          "UPDATE",
+			RowsAffected: 1,
+		})
+
+		res, err := cluster.PurgeKey(ctx, 5, tables, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(&sharding.PurgeResult{
+			Key:     5,
+			ShardID: 1,
+			Rows:    map[string]int{"comments": 3, "accounts": 1},
+		}))
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"BEGIN",
+			`DELETE FROM shard1."comments" WHERE "account_id" = 5`,
+			`UPDATE shard1."accounts" SET "email" = NULL, "name" = 'deleted' WHERE "id" = 5`,
+			"COMMIT",
+		}))
+		Expect(cluster.RoutedShards()).To(Equal([]int64{1}))
+	})
+
+	It("counts rows in dry-run mode", func() {
+		cluster.SetResult(1, "count", &shardingtest.Result{
+			Columns: []string{"count"},
+			Rows:    [][]interface{}{{7}},
+		})
+
+		res, err := cluster.PurgeKey(ctx, 5, tables, &sharding.PurgeOptions{DryRun: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.DryRun).To(BeTrue())
+		Expect(res.Rows).To(Equal(map[string]int{"comments": 7, "accounts": 7}))
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"BEGIN",
+			`SELECT count(*) FROM shard1."comments" WHERE "account_id" = 5`,
+			`SELECT count(*) FROM shard1."accounts" WHERE "id" = 5`,
+			"COMMIT",
+		}))
+	})
+
+	It("rolls back on errors", func() {
+		cluster.SetQueryError(1, "accounts", &shardingtest.Error{Message: "fake error"})
+
+		_, err := cluster.PurgeKey(ctx, 5, tables, nil)
+		Expect(err).To(MatchError("sharding: shard 1 (shardingtest1): ERROR #XX000 fake error"))
+		Expect(cluster.Queries(1)).To(ContainElement("ROLLBACK"))
+	})
+})
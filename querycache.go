@@ -0,0 +1,134 @@
+package sharding
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// QueryCacheStore stores encoded query results for QueryCache.
+type QueryCacheStore interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores the value. Zero ttl means the value does not expire.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// QueryCache is a read-through cache of query results keyed by shard id
+// and formatted query. Results are stored JSON encoded so models must
+// survive a round trip through encoding/json.
+type QueryCache struct {
+	cl    *Cluster
+	store QueryCacheStore
+	ttl   time.Duration
+}
+
+// NewQueryCache returns a cache of query results of the cluster shards
+// that expire after the ttl.
+func (cl *Cluster) NewQueryCache(store QueryCacheStore, ttl time.Duration) *QueryCache {
+	return &QueryCache{
+		cl:    cl,
+		store: store,
+		ttl:   ttl,
+	}
+}
+
+// Key returns the cache key of the query on the shard with the number.
+func (c *QueryCache) Key(number int64, query string, params ...interface{}) string {
+	shard := c.cl.Shard(number)
+	b := strconv.AppendInt(nil, c.cl.shardID(number), 10)
+	b = append(b, ':')
+	b = shard.Formatter().FormatQuery(b, query, params...)
+	return string(b)
+}
+
+// Query returns the cached result of the query on the shard with the
+// number or runs the query and caches the result.
+func (c *QueryCache) Query(
+	ctx context.Context, number int64, model interface{}, query string, params ...interface{},
+) error {
+	return c.query(ctx, number, model, query, params, false)
+}
+
+// QueryOne is like Query, but uses QueryOne. pg.ErrNoRows is not cached.
+func (c *QueryCache) QueryOne(
+	ctx context.Context, number int64, model interface{}, query string, params ...interface{},
+) error {
+	return c.query(ctx, number, model, query, params, true)
+}
+
+func (c *QueryCache) query(
+	ctx context.Context, number int64, model interface{}, query string, params []interface{}, one bool,
+) error {
+	key := c.Key(number, query, params...)
+	b, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return json.Unmarshal(b, model)
+	}
+
+	shard := c.cl.Shard(number)
+	if one {
+		_, err = shard.QueryOneContext(ctx, model, query, params...)
+	} else {
+		_, err = shard.QueryContext(ctx, model, query, params...)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err = json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(ctx, key, b, c.ttl)
+}
+
+// Invalidate removes the cached result of the query on the shard
+// with the number.
+func (c *QueryCache) Invalidate(ctx context.Context, number int64, query string, params ...interface{}) error {
+	return c.store.Delete(ctx, c.Key(number, query, params...))
+}
+
+//------------------------------------------------------------------------------
+
+// LRUQueryCacheStore is an in-memory QueryCacheStore that evicts least
+// recently used values. It is safe for concurrent use.
+type LRUQueryCacheStore struct {
+	lru *lruCache
+}
+
+var _ QueryCacheStore = (*LRUQueryCacheStore)(nil)
+
+// NewLRUQueryCacheStore returns a store that holds up to maxEntries values.
+func NewLRUQueryCacheStore(maxEntries int) *LRUQueryCacheStore {
+	return &LRUQueryCacheStore{
+		lru: newLRUCache(maxEntries),
+	}
+}
+
+func (s *LRUQueryCacheStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	entry, ok := s.lru.get(key, time.Now())
+	if !ok {
+		return nil, false, nil
+	}
+	return entry.value.([]byte), true, nil
+}
+
+func (s *LRUQueryCacheStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.lru.set(key, value, time.Now(), ttl)
+	return nil
+}
+
+func (s *LRUQueryCacheStore) Delete(_ context.Context, key string) error {
+	s.lru.delete(key)
+	return nil
+}
+
+// Len returns the number of values in the store.
+func (s *LRUQueryCacheStore) Len() int {
+	return s.lru.len()
+}
@@ -0,0 +1,73 @@
+package sharding_test
+
+import (
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QueryCache", func() {
+	type Tenant struct {
+		ID   int64
+		Name string
+	}
+
+	var cluster *shardingtest.Cluster
+	var store *sharding.LRUQueryCacheStore
+	var cache *sharding.QueryCache
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		cluster.SetResult(1, "tenants", &shardingtest.Result{
+			Columns: []string{"id", "name"},
+			Rows:    [][]interface{}{{int64(1), "acme"}},
+		})
+		store = sharding.NewLRUQueryCacheStore(10)
+		cache = cluster.NewQueryCache(store, time.Hour)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("caches results by shard and query", func() {
+		for i := 0; i < 2; i++ {
+			var tenant Tenant
+			err := cache.QueryOne(ctx, 3, &tenant, "SELECT * FROM ?SHARD.tenants WHERE id = ?", 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tenant).To(Equal(Tenant{ID: 1, Name: "acme"}))
+		}
+		Expect(cluster.Queries(1)).To(HaveLen(1))
+
+		key := cache.Key(3, "SELECT * FROM ?SHARD.tenants WHERE id = ?", 1)
+		Expect(key).To(Equal("1:SELECT * FROM shard1.tenants WHERE id = 1"))
+
+		var tenants []Tenant
+		Expect(cache.Query(ctx, 1, &tenants, "SELECT * FROM ?SHARD.tenants")).NotTo(HaveOccurred())
+		Expect(tenants).To(HaveLen(1))
+		Expect(store.Len()).To(Equal(2))
+	})
+
+	It("invalidates results", func() {
+		var tenant Tenant
+		query := "SELECT * FROM ?SHARD.tenants WHERE id = ?"
+		Expect(cache.QueryOne(ctx, 1, &tenant, query, 1)).NotTo(HaveOccurred())
+		Expect(cache.Invalidate(ctx, 1, query, 1)).NotTo(HaveOccurred())
+		Expect(cache.QueryOne(ctx, 1, &tenant, query, 1)).NotTo(HaveOccurred())
+		Expect(cluster.Queries(1)).To(HaveLen(2))
+	})
+
+	It("expires results", func() {
+		cache = cluster.NewQueryCache(store, time.Nanosecond)
+		var tenant Tenant
+		query := "SELECT * FROM ?SHARD.tenants"
+		Expect(cache.QueryOne(ctx, 1, &tenant, query)).NotTo(HaveOccurred())
+		time.Sleep(time.Millisecond)
+		Expect(cache.QueryOne(ctx, 1, &tenant, query)).NotTo(HaveOccurred())
+		Expect(cluster.Queries(1)).To(HaveLen(2))
+	})
+})
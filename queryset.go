@@ -0,0 +1,134 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrUnknownQuery is returned by QuerySet methods for names that were
+// not registered.
+var ErrUnknownQuery = errors.New("sharding: unknown query")
+
+// QuerySet is a registry of named queries compiled as templates, so
+// all sharded SQL of an application is registered and reviewed in one
+// place, e.g.
+//
+//	qs := cluster.NewQuerySet()
+//	qs.MustRegister("get_user", "SELECT * FROM ?SHARD.users WHERE id = ?")
+//
+//	_, err := qs.QueryOneContext(ctx, cluster.Shard(id), user, "get_user", id)
+//
+// It is safe for concurrent use.
+type QuerySet struct {
+	cl *Cluster
+
+	mu        sync.RWMutex
+	templates map[string]*Template
+}
+
+// NewQuerySet returns an empty query set for the cluster shards.
+func (cl *Cluster) NewQuerySet() *QuerySet {
+	return &QuerySet{
+		cl:        cl,
+		templates: make(map[string]*Template),
+	}
+}
+
+// Register compiles the query and registers it with the name. Names can't
+// be registered twice.
+func (qs *QuerySet) Register(name, query string) error {
+	if name == "" {
+		return errors.New("sharding: query name is empty")
+	}
+
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	if _, ok := qs.templates[name]; ok {
+		return fmt.Errorf("sharding: query %q is already registered", name)
+	}
+	qs.templates[name] = qs.cl.Compile(query)
+	return nil
+}
+
+// MustRegister is like Register, but panics on error. It simplifies
+// registering queries in package variables and init functions.
+func (qs *QuerySet) MustRegister(name, query string) {
+	if err := qs.Register(name, query); err != nil {
+		panic(err)
+	}
+}
+
+// Names returns the sorted names of the registered queries.
+func (qs *QuerySet) Names() []string {
+	qs.mu.RLock()
+	names := make([]string, 0, len(qs.templates))
+	for name := range qs.templates {
+		names = append(names, name)
+	}
+	qs.mu.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// Template returns the template of the query with the name.
+func (qs *QuerySet) Template(name string) (*Template, error) {
+	qs.mu.RLock()
+	t, ok := qs.templates[name]
+	qs.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQuery, name)
+	}
+	return t, nil
+}
+
+// String returns the query with the name with shard params substituted
+// for the shard, e.g. to review the SQL executed on the shard.
+func (qs *QuerySet) String(shard *pg.DB, name string) (string, error) {
+	t, err := qs.Template(name)
+	if err != nil {
+		return "", err
+	}
+	return t.String(shard), nil
+}
+
+// ExecContext executes the query with the name on the shard.
+func (qs *QuerySet) ExecContext(
+	ctx context.Context, shard *pg.DB, name string, params ...interface{},
+) (pg.Result, error) {
+	t, err := qs.Template(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.ExecContext(ctx, shard, params...)
+}
+
+// QueryContext executes the query with the name on the shard and scans
+// rows into the model.
+func (qs *QuerySet) QueryContext(
+	ctx context.Context, shard *pg.DB, model interface{}, name string, params ...interface{},
+) (pg.Result, error) {
+	t, err := qs.Template(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.QueryContext(ctx, shard, model, params...)
+}
+
+// QueryOneContext executes the query with the name on the shard and scans
+// the single returned row into the model.
+func (qs *QuerySet) QueryOneContext(
+	ctx context.Context, shard *pg.DB, model interface{}, name string, params ...interface{},
+) (pg.Result, error) {
+	t, err := qs.Template(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.QueryOneContext(ctx, shard, model, params...)
+}
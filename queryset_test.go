@@ -0,0 +1,61 @@
+package sharding_test
+
+import (
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QuerySet", func() {
+	var cluster *shardingtest.Cluster
+	var qs *sharding.QuerySet
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		qs = cluster.NewQuerySet()
+		qs.MustRegister("get_user", "SELECT name FROM ?SHARD.users WHERE id = ?")
+		qs.MustRegister("delete_user", "DELETE FROM ?SHARD.users WHERE id = ?")
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("runs named queries", func() {
+		cluster.SetResult(1, "SELECT name", &shardingtest.Result{
+			Columns: []string{"name"},
+			Rows:    [][]interface{}{{"alice"}},
+		})
+
+		var name string
+		_, err := qs.QueryOneContext(ctx, cluster.Shard(1), pg.Scan(&name), "get_user", 42)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("alice"))
+
+		_, err = qs.ExecContext(ctx, cluster.Shard(1), "delete_user", 42)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"SELECT name FROM shard1.users WHERE id = 42",
+			"DELETE FROM shard1.users WHERE id = 42",
+		}))
+	})
+
+	It("lists and renders queries", func() {
+		Expect(qs.Names()).To(Equal([]string{"delete_user", "get_user"}))
+		s, err := qs.String(cluster.Shard(0), "get_user")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s).To(Equal("SELECT name FROM shard0.users WHERE id = ?"))
+	})
+
+	It("rejects unknown and duplicate names", func() {
+		_, err := qs.ExecContext(ctx, cluster.Shard(0), "missing")
+		Expect(errors.Is(err, sharding.ErrUnknownQuery)).To(BeTrue())
+		Expect(qs.Register("get_user", "SELECT 1")).To(MatchError(`sharding: query "get_user" is already registered`))
+	})
+})
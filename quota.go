@@ -0,0 +1,287 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrQuotaExceeded is returned when a query is rejected because the
+// tenant exceeded its quota.
+var ErrQuotaExceeded = errors.New("sharding: tenant quota exceeded")
+
+type tenantKey struct{}
+
+// WithTenant returns a context that makes queries executed with it count
+// against the quota of the tenant, usually the shard key of the tenant,
+// when WithTenantQuotas is used.
+func WithTenant(ctx context.Context, tenant int64) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set with WithTenant.
+func TenantFromContext(ctx context.Context) (int64, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(int64)
+	return tenant, ok
+}
+
+// Quota limits the resources used by a tenant.
+type Quota struct {
+	// QueriesPerSecond is the rate of queries. Zero means no limit.
+	QueriesPerSecond float64
+	// Burst is the number of queries that can be executed at once after
+	// the tenant was idle. Default is QueriesPerSecond, but at least 1.
+	Burst int
+	// RowsPerSecond is the rate of rows returned or affected by queries.
+	// Rows are counted after queries finish, so a query can overdraw the
+	// budget; next queries wait until it recovers. Zero means no limit.
+	RowsPerSecond float64
+	// MaxDelay is how long a query waits for the quota before it is
+	// rejected with ErrQuotaExceeded. Zero rejects without waiting.
+	MaxDelay time.Duration
+}
+
+// QuotaOptions configures WithTenantQuotas.
+type QuotaOptions struct {
+	// Default is the quota of tenants that have no own quota.
+	Default Quota
+	// Quota, if not nil, returns the own quota of the tenant. It is called
+	// once per tenant, so changes are picked up by ResetQuota.
+	Quota func(tenant int64) (quota Quota, ok bool)
+}
+
+// WithTenantQuotas limits queries executed on shards with a context
+// returned by WithTenant, so a tenant exceeding its quota is delayed or
+// rejected with ErrQuotaExceeded instead of slowing down tenants on
+// the same database server. Queries without a tenant are not limited.
+func WithTenantQuotas(opt *QuotaOptions) Option {
+	return func(cl *Cluster) {
+		cl.quotas = &tenantQuotas{
+			opt:     opt,
+			tenants: make(map[int64]*tenantQuota),
+			now:     time.Now,
+		}
+	}
+}
+
+// QuotaStats are quota decisions of the cluster.
+type QuotaStats struct {
+	Delayed  uint64
+	Rejected uint64
+	// RejectedByTenant is the number of rejected queries per tenant.
+	RejectedByTenant map[int64]uint64
+}
+
+// QuotaStats returns quota decisions made since the cluster was created.
+func (cl *Cluster) QuotaStats() QuotaStats {
+	stats := QuotaStats{
+		RejectedByTenant: make(map[int64]uint64),
+	}
+	q := cl.quotas
+	if q == nil {
+		return stats
+	}
+	stats.Delayed = atomic.LoadUint64(&q.delayed)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for tenant, tq := range q.tenants {
+		if tq.rejected > 0 {
+			stats.Rejected += tq.rejected
+			stats.RejectedByTenant[tenant] = tq.rejected
+		}
+	}
+	stats.Rejected += q.prunedRejected
+	return stats
+}
+
+// ResetQuota forgets the usage and the quota of the tenant so
+// QuotaOptions.Quota is called again for the next query of the tenant.
+func (cl *Cluster) ResetQuota(tenant int64) {
+	if q := cl.quotas; q != nil {
+		q.mu.Lock()
+		delete(q.tenants, tenant)
+		q.mu.Unlock()
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// maxTrackedTenants is the number of tracked tenants after which tenants
+// that have not used their quota recently are forgotten.
+const maxTrackedTenants = 10000
+
+type tenantQuotas struct {
+	delayed uint64 // first to be aligned for atomic operations
+	opt     *QuotaOptions
+	now     func() time.Time
+
+	mu             sync.Mutex
+	tenants        map[int64]*tenantQuota
+	prunedRejected uint64
+}
+
+type tenantQuota struct {
+	quota    Quota
+	queries  bucket
+	rows     bucket
+	rejected uint64
+}
+
+// bucket is a token bucket that can be overdrawn.
+type bucket struct {
+	rate     float64 // tokens per second
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// wait returns how long to wait until the bucket has the tokens.
+func (b *bucket) wait(tokens float64) time.Duration {
+	if b.tokens >= tokens {
+		return 0
+	}
+	return time.Duration((tokens - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *bucket) full() bool {
+	return b.tokens >= b.capacity
+}
+
+func (q *tenantQuotas) tenant(tenant int64, now time.Time) *tenantQuota {
+	if tq, ok := q.tenants[tenant]; ok {
+		return tq
+	}
+
+	if len(q.tenants) >= maxTrackedTenants {
+		q.prune(now)
+	}
+
+	quota := q.opt.Default
+	if q.opt.Quota != nil {
+		if own, ok := q.opt.Quota(tenant); ok {
+			quota = own
+		}
+	}
+	burst := float64(quota.Burst)
+	if burst <= 0 {
+		burst = quota.QueriesPerSecond
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	tq := &tenantQuota{
+		quota: quota,
+		queries: bucket{
+			rate:     quota.QueriesPerSecond,
+			capacity: burst,
+			tokens:   burst,
+			last:     now,
+		},
+		rows: bucket{
+			rate:     quota.RowsPerSecond,
+			capacity: quota.RowsPerSecond,
+			tokens:   quota.RowsPerSecond,
+			last:     now,
+		},
+	}
+	q.tenants[tenant] = tq
+	return tq
+}
+
+// prune forgets tenants with full buckets, i.e. tenants that would get
+// the same quota if they were tracked from scratch.
+func (q *tenantQuotas) prune(now time.Time) {
+	for tenant, tq := range q.tenants {
+		tq.queries.refill(now)
+		tq.rows.refill(now)
+		if tq.queries.full() && tq.rows.full() {
+			q.prunedRejected += tq.rejected
+			delete(q.tenants, tenant)
+		}
+	}
+}
+
+// acquire takes a query from the quota of the ctx tenant waiting up to
+// the quota MaxDelay.
+func (q *tenantQuotas) acquire(ctx context.Context, shardID int64) error {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	now := q.now()
+	q.mu.Lock()
+	tq := q.tenant(tenant, now)
+	quota := &tq.quota
+
+	var wait time.Duration
+	if quota.QueriesPerSecond > 0 {
+		tq.queries.refill(now)
+		wait = tq.queries.wait(1)
+	}
+	if quota.RowsPerSecond > 0 {
+		tq.rows.refill(now)
+		// Queries wait until the overdrawn budget is paid back.
+		if d := tq.rows.wait(0); d > wait {
+			wait = d
+		}
+	}
+	if wait > quota.MaxDelay {
+		tq.rejected++
+		q.mu.Unlock()
+		return fmt.Errorf("%w: tenant %d on shard %d", ErrQuotaExceeded, tenant, shardID)
+	}
+	if quota.QueriesPerSecond > 0 {
+		// Reserve the query so concurrent queries wait in line.
+		tq.queries.tokens--
+	}
+	q.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	atomic.AddUint64(&q.delayed, 1)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// consume charges the rows of the finished query to the ctx tenant.
+func (q *tenantQuotas) consume(ctx context.Context, res pg.Result) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok || res == nil {
+		return
+	}
+	rows := res.RowsAffected()
+	if rows <= 0 {
+		return
+	}
+
+	now := q.now()
+	q.mu.Lock()
+	tq := q.tenant(tenant, now)
+	if tq.quota.RowsPerSecond > 0 {
+		tq.rows.refill(now)
+		tq.rows.tokens -= float64(rows)
+	}
+	q.mu.Unlock()
+}
@@ -0,0 +1,85 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tenant quotas", func() {
+	var cluster *shardingtest.Cluster
+	var now time.Time
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2, sharding.WithTenantQuotas(&sharding.QuotaOptions{
+			Default: sharding.Quota{
+				QueriesPerSecond: 1,
+				Burst:            2,
+			},
+			Quota: func(tenant int64) (sharding.Quota, bool) {
+				if tenant != 9 {
+					return sharding.Quota{}, false
+				}
+				return sharding.Quota{
+					RowsPerSecond: 100,
+					MaxDelay:      10 * time.Millisecond,
+				}, true
+			},
+		}))
+		now = time.Now()
+		sharding.SetQuotaNow(cluster.Cluster, func() time.Time { return now })
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	exec := func(ctx context.Context, tenant int64) error {
+		_, err := cluster.Shard(tenant).ExecContext(ctx, "DELETE FROM ?SHARD.events")
+		return err
+	}
+
+	It("limits the rate of queries", func() {
+		tenantCtx := sharding.WithTenant(ctx, 7)
+		Expect(exec(tenantCtx, 7)).NotTo(HaveOccurred())
+		Expect(exec(tenantCtx, 7)).NotTo(HaveOccurred())
+
+		err := exec(tenantCtx, 7)
+		Expect(errors.Is(err, sharding.ErrQuotaExceeded)).To(BeTrue())
+		Expect(cluster.Queries(1)).To(HaveLen(2))
+
+		// Other tenants and queries without a tenant are not affected.
+		Expect(exec(sharding.WithTenant(ctx, 5), 5)).NotTo(HaveOccurred())
+		Expect(exec(ctx, 7)).NotTo(HaveOccurred())
+
+		now = now.Add(time.Second)
+		Expect(exec(tenantCtx, 7)).NotTo(HaveOccurred())
+
+		stats := cluster.QuotaStats()
+		Expect(stats.Rejected).To(Equal(uint64(1)))
+		Expect(stats.RejectedByTenant).To(Equal(map[int64]uint64{7: 1}))
+	})
+
+	It("limits the rate of rows", func() {
+		cluster.SetResult(shardingtest.AllShards, "DELETE", &shardingtest.Result{
+			Tag:          "DELETE",
+			RowsAffected: 150,
+		})
+		tenantCtx := sharding.WithTenant(ctx, 9)
+
+		Expect(exec(tenantCtx, 9)).NotTo(HaveOccurred())
+		err := exec(tenantCtx, 9)
+		Expect(errors.Is(err, sharding.ErrQuotaExceeded)).To(BeTrue())
+
+		// The budget is 1 row short, so the query waits 10ms.
+		now = now.Add(490 * time.Millisecond)
+		Expect(exec(tenantCtx, 9)).NotTo(HaveOccurred())
+		Expect(cluster.QuotaStats().Delayed).To(Equal(uint64(1)))
+	})
+})
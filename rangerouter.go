@@ -0,0 +1,156 @@
+package sharding
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/v10"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrKeyOutOfRange is returned by RangeRouter for keys less than the start
+// of the first range.
+var ErrKeyOutOfRange = errors.New("sharding: key is not in any range")
+
+// ShardRange assigns keys from Start up to the Start of the next range
+// to the shard. The last range has no upper bound.
+type ShardRange struct {
+	Start   int64 `json:"start" yaml:"start"`
+	ShardID int64 `json:"shard_id" yaml:"shard_id"`
+}
+
+// RangeMap is a list of ranges sorted by Start, e.g.
+//
+//	sharding.RangeMap{
+//		{Start: 0, ShardID: 0},         // 0 <= id < 1000000
+//		{Start: 1000000, ShardID: 1},   // 1000000 <= id < 2000000
+//		{Start: 2000000, ShardID: 2},   // 2000000 <= id
+//	}
+type RangeMap []ShardRange
+
+// ParseRangeMap parses the range map in the JSON or YAML format.
+func ParseRangeMap(b []byte) (RangeMap, error) {
+	var m RangeMap
+	var err error
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(b, &m)
+	} else {
+		err = yaml.UnmarshalStrict(b, &m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sharding: can't parse range map: %w", err)
+	}
+	return m, nil
+}
+
+func (m RangeMap) check(nshards int) error {
+	if len(m) == 0 {
+		return errors.New("sharding: range map is empty")
+	}
+	for i, r := range m {
+		if r.ShardID < 0 || r.ShardID >= int64(nshards) {
+			return fmt.Errorf("sharding: range %d is assigned to shard %d out of %d shards",
+				r.Start, r.ShardID, nshards)
+		}
+		if i > 0 && r.Start <= m[i-1].Start {
+			return fmt.Errorf("sharding: range %d is not sorted after range %d", r.Start, m[i-1].Start)
+		}
+	}
+	return nil
+}
+
+// shardID returns the shard id of the range containing the key.
+func (m RangeMap) shardID(key int64) (int64, bool) {
+	i := sort.Search(len(m), func(i int) bool {
+		return m[i].Start > key
+	})
+	if i == 0 {
+		return 0, false
+	}
+	return m[i-1].ShardID, true
+}
+
+// RangeRouter routes keys to shards by key ranges instead of modulo, e.g.
+// so new tenants with increasing ids land on new shards after the last
+// range is split. It is safe for concurrent use.
+type RangeRouter struct {
+	cl *Cluster
+
+	mu sync.Mutex   // serializes splits
+	m  atomic.Value // RangeMap
+}
+
+// NewRangeRouter returns a router for the cluster that uses the ranges
+// of the map.
+func (cl *Cluster) NewRangeRouter(m RangeMap) (*RangeRouter, error) {
+	if err := m.check(cl.nshards); err != nil {
+		return nil, err
+	}
+	r := &RangeRouter{cl: cl}
+	r.m.Store(append(RangeMap(nil), m...))
+	return r, nil
+}
+
+// RangeMap returns a copy of the current ranges.
+func (r *RangeRouter) RangeMap() RangeMap {
+	return append(RangeMap(nil), r.load()...)
+}
+
+func (r *RangeRouter) load() RangeMap {
+	return r.m.Load().(RangeMap)
+}
+
+// ShardID returns the id of the shard that owns the key.
+func (r *RangeRouter) ShardID(key int64) (int64, error) {
+	shardID, ok := r.load().shardID(key)
+	if !ok {
+		return 0, fmt.Errorf("%w: %d", ErrKeyOutOfRange, key)
+	}
+	return shardID, nil
+}
+
+// Shard returns the shard that owns the key.
+func (r *RangeRouter) Shard(key int64) (*pg.DB, error) {
+	shardID, err := r.ShardID(key)
+	if err != nil {
+		return nil, err
+	}
+	return r.cl.route(key, shardID), nil
+}
+
+// Split splits the range containing the key at the key and assigns keys
+// from the key up to the end of the range to the shard. Rows of existing
+// keys must be moved by the caller before keys are split off.
+func (r *RangeRouter) Split(at, shardID int64) error {
+	if shardID < 0 || shardID >= int64(r.cl.nshards) {
+		return fmt.Errorf("sharding: shard %d is out of range [0, %d)", shardID, r.cl.nshards)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.load()
+	i := sort.Search(len(old), func(i int) bool {
+		return old[i].Start > at
+	})
+	if i == 0 {
+		return fmt.Errorf("%w: %d", ErrKeyOutOfRange, at)
+	}
+
+	m := make(RangeMap, 0, len(old)+1)
+	if old[i-1].Start == at {
+		// The range already starts at the key, so it is reassigned.
+		m = append(m, old[:i-1]...)
+	} else {
+		m = append(m, old[:i]...)
+	}
+	m = append(m, ShardRange{Start: at, ShardID: shardID})
+	m = append(m, old[i:]...)
+	r.m.Store(m)
+	return nil
+}
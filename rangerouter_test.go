@@ -0,0 +1,88 @@
+package sharding_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestRangeRouter(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	cl := sharding.NewCluster([]*pg.DB{db}, 4)
+	defer cl.Close()
+
+	m, err := sharding.ParseRangeMap([]byte(`
+- start: 0
+  shard_id: 0
+- start: 1000000
+  shard_id: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := cl.NewRangeRouter(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		key     int64
+		shardID int64
+	}{
+		{0, 0},
+		{999999, 0},
+		{1000000, 1},
+		{5000000, 1},
+	} {
+		shard, err := r.Shard(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := shardID(shard); got != test.shardID {
+			t.Errorf("key %d: got shard %d, wanted %d", test.key, got, test.shardID)
+		}
+	}
+	if _, err := r.ShardID(-1); !errors.Is(err, sharding.ErrKeyOutOfRange) {
+		t.Errorf("got %v, wanted ErrKeyOutOfRange", err)
+	}
+
+	// New keys land on the new shard after the last range is split.
+	if err := r.Split(2000000, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Split(500000, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Split(0, 3); err != nil {
+		t.Fatal(err)
+	}
+	wanted := sharding.RangeMap{
+		{Start: 0, ShardID: 3},
+		{Start: 500000, ShardID: 3},
+		{Start: 1000000, ShardID: 1},
+		{Start: 2000000, ShardID: 2},
+	}
+	got := r.RangeMap()
+	if len(got) != len(wanted) {
+		t.Fatalf("got %v, wanted %v", got, wanted)
+	}
+	for i := range got {
+		if got[i] != wanted[i] {
+			t.Fatalf("got %v, wanted %v", got, wanted)
+		}
+	}
+	if id, _ := r.ShardID(2500000); id != 2 {
+		t.Errorf("got shard %d, wanted 2", id)
+	}
+
+	if _, err := cl.NewRangeRouter(sharding.RangeMap{{Start: 10, ShardID: 0}, {Start: 5, ShardID: 1}}); err == nil {
+		t.Error("expected an error for unsorted ranges")
+	}
+	if _, err := cl.NewRangeRouter(sharding.RangeMap{{Start: 0, ShardID: 4}}); err == nil {
+		t.Error("expected an error for a shard out of range")
+	}
+}
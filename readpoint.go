@@ -0,0 +1,116 @@
+package sharding
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrInvalidReadPoint is returned by ParseReadPoint when the token is
+// malformed or was created for a cluster with a different number of shards.
+var ErrInvalidReadPoint = errors.New("sharding: invalid read point")
+
+const readPointVersion = 1
+
+// ReadPoint is an approximately consistent point in time of the cluster:
+// the max committed id of a table captured on every shard concurrently.
+// Reads constrained to ids less or equal to the read point return the same
+// rows until the rows are updated or deleted, which makes paginated and
+// repeated cross-shard analytical reads stable. Rows committed after the
+// capture with smaller ids, e.g. by long transactions, are not visible.
+type ReadPoint struct {
+	// MaxIDs are the max ids indexed by shard id. Shards without rows
+	// have math.MinInt64.
+	MaxIDs []int64
+}
+
+// ReadPoint captures the max value of the id column of the table on every
+// shard, e.g. cl.ReadPoint(ctx, "events", "id").
+func (cl *Cluster) ReadPoint(ctx context.Context, table, column string) (*ReadPoint, error) {
+	rp := &ReadPoint{
+		MaxIDs: make([]int64, cl.nshards),
+	}
+	err := cl.ForEachShardContext(ctx, nil, func(ctx context.Context, shard *pg.DB) error {
+		shardID := shard.Param("SHARD_ID").(int64)
+		_, err := shard.QueryOneContext(ctx, pg.Scan(&rp.MaxIDs[shardID]),
+			"SELECT coalesce(max(?), ?)::bigint FROM ?SHARD.?",
+			pg.Ident(column), int64(math.MinInt64), pg.Ident(table))
+		return WrapShardError(shard, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
+
+// Shard returns the shard with the ?READ_POINT param set to the max id
+// of the shard, e.g. for SELECT * FROM ?SHARD.events WHERE id <= ?READ_POINT.
+// Shards the read point has no id for, e.g. of a bigger cluster, are
+// returned unchanged so queries using ?READ_POINT fail on the server.
+func (rp *ReadPoint) Shard(shard *pg.DB) *pg.DB {
+	shardID, ok := shard.Param("SHARD_ID").(int64)
+	if !ok || shardID < 0 || shardID >= int64(len(rp.MaxIDs)) {
+		return shard
+	}
+	return shard.WithParam("READ_POINT", rp.MaxIDs[shardID])
+}
+
+// ForEachShardAt is like ForEachShardContext, but passes shards returned
+// by ReadPoint.Shard to the fn.
+func (cl *Cluster) ForEachShardAt(
+	ctx context.Context, rp *ReadPoint, opt *ForEachOptions, fn func(ctx context.Context, shard *pg.DB) error,
+) error {
+	if len(rp.MaxIDs) != cl.nshards {
+		return ErrInvalidReadPoint
+	}
+	return cl.ForEachShardContext(ctx, opt, func(ctx context.Context, shard *pg.DB) error {
+		return fn(ctx, rp.Shard(shard))
+	})
+}
+
+// Token returns the read point encoded as an opaque URL-safe token that
+// can be passed between requests.
+func (rp *ReadPoint) Token() string {
+	b := make([]byte, 1, 1+(len(rp.MaxIDs)+1)*binary.MaxVarintLen64)
+	b[0] = readPointVersion
+	b = appendUvarint(b, uint64(len(rp.MaxIDs)))
+	for _, id := range rp.MaxIDs {
+		b = appendVarint(b, id)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseReadPoint decodes the token returned by ReadPoint.Token.
+func (cl *Cluster) ParseReadPoint(token string) (*ReadPoint, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) == 0 || b[0] != readPointVersion {
+		return nil, ErrInvalidReadPoint
+	}
+	b = b[1:]
+
+	nshards, n := binary.Uvarint(b)
+	if n <= 0 || nshards != uint64(cl.nshards) {
+		return nil, ErrInvalidReadPoint
+	}
+	b = b[n:]
+
+	rp := &ReadPoint{
+		MaxIDs: make([]int64, nshards),
+	}
+	for i := range rp.MaxIDs {
+		id, n := binary.Varint(b)
+		if n <= 0 {
+			return nil, ErrInvalidReadPoint
+		}
+		rp.MaxIDs[i] = id
+		b = b[n:]
+	}
+	if len(b) != 0 {
+		return nil, ErrInvalidReadPoint
+	}
+	return rp, nil
+}
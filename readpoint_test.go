@@ -0,0 +1,74 @@
+package sharding_test
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReadPoint", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		cluster.SetResult(0, "max(", &shardingtest.Result{
+			Columns: []string{"coalesce"},
+			Rows:    [][]interface{}{{100}},
+		})
+		cluster.SetResult(1, "max(", &shardingtest.Result{
+			Columns: []string{"coalesce"},
+			Rows:    [][]interface{}{{200}},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("captures max ids and constrains reads", func() {
+		rp, err := cluster.ReadPoint(ctx, "events", "id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rp.MaxIDs).To(Equal([]int64{100, 200}))
+		Expect(cluster.Queries(0)[0]).To(Equal(
+			`SELECT coalesce(max("id"), -9223372036854775808)::bigint FROM shard0."events"`))
+
+		parsed, err := cluster.ParseReadPoint(rp.Token())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(rp))
+
+		cluster.Reset()
+		err = cluster.ForEachShardAt(ctx, parsed, nil, func(ctx context.Context, shard *pg.DB) error {
+			_, err := shard.ExecContext(ctx, "SELECT * FROM ?SHARD.events WHERE id <= ?READ_POINT")
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Queries(0)).To(Equal([]string{"SELECT * FROM shard0.events WHERE id <= 100"}))
+		Expect(cluster.Queries(1)).To(Equal([]string{"SELECT * FROM shard1.events WHERE id <= 200"}))
+	})
+
+	It("rejects tokens of other clusters", func() {
+		rp := &sharding.ReadPoint{MaxIDs: []int64{1, 2, 3}}
+		_, err := cluster.ParseReadPoint(rp.Token())
+		Expect(err).To(Equal(sharding.ErrInvalidReadPoint))
+
+		_, err = cluster.ParseReadPoint("garbage")
+		Expect(err).To(Equal(sharding.ErrInvalidReadPoint))
+	})
+	It("leaves shards without an id unchanged", func() {
+		rp := &sharding.ReadPoint{MaxIDs: []int64{100}}
+		Expect(rp.Shard(cluster.Shard(0)).Param("READ_POINT")).To(Equal(int64(100)))
+
+		shard := cluster.Shard(1)
+		Expect(rp.Shard(shard)).To(BeIdenticalTo(shard))
+
+		db := pg.Connect(&pg.Options{Addr: "db1"})
+		defer db.Close()
+		Expect(rp.Shard(db)).To(BeIdenticalTo(db))
+	})
+})
@@ -0,0 +1,188 @@
+package sharding
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// WithReplicas adds read replicas of the primary database. Shards of
+// the primary are available on the replicas with ReadShard. Writes always
+// go to the primary; use Session to read own writes.
+func WithReplicas(primary *pg.DB, replicas ...*pg.DB) Option {
+	return func(cl *Cluster) {
+		if cl.replicas == nil {
+			cl.replicas = make(map[*pg.DB][]*pg.DB)
+		}
+		cl.replicas[primary] = append(cl.replicas[primary], replicas...)
+	}
+}
+
+// Replicas returns the read replicas of the primary database.
+func (cl *Cluster) Replicas(primary *pg.DB) []*pg.DB {
+	return cl.replicas[primary]
+}
+
+// replicaShards returns the shard with the id on every replica of the db.
+func (cl *Cluster) replicaShards(t, prev *topology, db *pg.DB, id int) []*pg.DB {
+	replicas := cl.replicas[db]
+	if len(replicas) == 0 {
+		return nil
+	}
+	for _, replica := range replicas {
+		if _, ok := t.inflight[replica]; ok {
+			continue
+		}
+		if prev != nil && prev.inflight[replica] != nil {
+			t.inflight[replica] = prev.inflight[replica]
+			t.latency[replica] = prev.latency[replica]
+		} else {
+			t.inflight[replica] = new(int64)
+			t.latency[replica] = new(serverLatency)
+		}
+	}
+	if prev != nil && prev.dbs[prev.shards[id].dbInd] == db {
+		return prev.shards[id].replicas
+	}
+
+	shards := make([]*pg.DB, len(replicas))
+	for i, replica := range replicas {
+		shards[i] = cl.newShard(replica, int64(id), t.inflight[replica], t.latency[replica])
+	}
+	return shards
+}
+
+// WithLatencyAwareReads makes ReadShard pick the healthy replica with
+// the lowest recent query latency, weighted by the number of queries
+// running on the replica, instead of the next replica in round-robin
+// order. Replicas without recent queries are probed with a single read
+// every second so a replica that recovered from a slowdown gets reads
+// again.
+func WithLatencyAwareReads() Option {
+	return func(cl *Cluster) {
+		cl.fastReads = true
+	}
+}
+
+// ReplicaLatency returns the moving average of query latencies on
+// the replica. It returns false when the replica has not executed
+// queries yet.
+func (cl *Cluster) ReplicaLatency(replica *pg.DB) (time.Duration, bool) {
+	l := cl.topology().latency[replica]
+	if l == nil {
+		return 0, false
+	}
+	v, ok := l.get()
+	return time.Duration(v), ok
+}
+
+// ReadShard returns the shard for the number on one of the healthy
+// replicas of its database picked in round-robin order or, with
+// WithLatencyAwareReads, by latency. The primary shard is returned when
+// the database has no healthy replicas. Reads from replicas can be stale;
+// use Session to read own writes.
+func (cl *Cluster) ReadShard(number int64) *pg.DB {
+	t := cl.topology()
+	info := &t.shards[cl.shardID(number)]
+	if len(info.replicas) == 0 {
+		return cl.route(number, cl.shardID(number))
+	}
+
+	replicas := cl.replicas[t.dbs[info.dbInd]]
+	var ind int
+	if cl.fastReads {
+		ind = cl.fastestReplica(t, replicas)
+	} else {
+		ind = cl.nextReplica(replicas)
+	}
+	if ind == -1 {
+		return cl.route(number, cl.shardID(number))
+	}
+
+	shard := info.replicas[ind]
+	if cl.debugLog != nil {
+		cl.logRoute(number, shard)
+	}
+	return shard
+}
+
+// nextReplica returns the index of the next healthy replica in round-robin
+// order or -1.
+func (cl *Cluster) nextReplica(replicas []*pg.DB) int {
+	n := atomic.AddUint64(&cl.replicaNext, 1)
+	for i := uint64(0); i < uint64(len(replicas)); i++ {
+		ind := int((n + i) % uint64(len(replicas)))
+		if cl.Healthy(replicas[ind]) {
+			return ind
+		}
+	}
+	return -1
+}
+
+// fastestReplica returns the index of the healthy replica with the lowest
+// latency weighted by running queries or -1. Ties are broken in
+// round-robin order.
+func (cl *Cluster) fastestReplica(t *topology, replicas []*pg.DB) int {
+	now := time.Now()
+	n := atomic.AddUint64(&cl.replicaNext, 1)
+
+	best := -1
+	bestScore := math.Inf(1)
+	for i := uint64(0); i < uint64(len(replicas)); i++ {
+		ind := int((n + i) % uint64(len(replicas)))
+		replica := replicas[ind]
+		if !cl.Healthy(replica) {
+			continue
+		}
+
+		l := t.latency[replica]
+		if l.claimProbe(now) {
+			return ind
+		}
+		score := math.Inf(1)
+		if v, ok := l.get(); ok {
+			score = v * float64(atomic.LoadInt64(t.inflight[replica])+1)
+		}
+		if best == -1 || score < bestScore {
+			best = ind
+			bestScore = score
+		}
+	}
+	return best
+}
+
+//------------------------------------------------------------------------------
+
+// replicaProbeInterval is how often a replica without queries is probed.
+const replicaProbeInterval = time.Second
+
+// serverLatency tracks query latencies of a replica.
+type serverLatency struct {
+	last int64 // unix nanoseconds of the last query or probe; first to be aligned
+	ewma ewma
+}
+
+func (l *serverLatency) observe(latency time.Duration, now time.Time) {
+	l.ewma.add(float64(latency))
+	atomic.StoreInt64(&l.last, now.UnixNano())
+}
+
+// get returns the latency in nanoseconds.
+func (l *serverLatency) get() (float64, bool) {
+	l.ewma.mu.Lock()
+	v, ok := l.ewma.value, l.ewma.init
+	l.ewma.mu.Unlock()
+	return v, ok
+}
+
+// claimProbe reports whether the replica has no recent queries and
+// records the probe so concurrent reads don't probe the replica as well.
+func (l *serverLatency) claimProbe(now time.Time) bool {
+	last := atomic.LoadInt64(&l.last)
+	if now.UnixNano()-last < int64(replicaProbeInterval) {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&l.last, last, now.UnixNano())
+}
@@ -0,0 +1,53 @@
+package sharding_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestLatencyAwareReads(t *testing.T) {
+	primary := pg.Connect(&pg.Options{Addr: "primary"})
+	slow := pg.Connect(&pg.Options{Addr: "slow"})
+	fast := pg.Connect(&pg.Options{Addr: "fast"})
+	cl := sharding.NewCluster([]*pg.DB{primary}, 4,
+		sharding.WithReplicas(primary, slow, fast),
+		sharding.WithLatencyAwareReads())
+	defer cl.Close()
+
+	if _, ok := cl.ReplicaLatency(fast); ok {
+		t.Errorf("got latency of the replica without queries")
+	}
+
+	// Replicas without queries are probed once.
+	probed := map[string]bool{
+		cl.ReadShard(1).Options().Addr: true,
+		cl.ReadShard(1).Options().Addr: true,
+	}
+	if !probed["slow"] || !probed["fast"] {
+		t.Errorf("got probed %v, wanted both replicas", probed)
+	}
+
+	sharding.ObserveReplicaLatency(cl, slow, 10*time.Millisecond)
+	sharding.ObserveReplicaLatency(cl, fast, time.Millisecond)
+	if got, _ := cl.ReplicaLatency(fast); got != time.Millisecond {
+		t.Errorf("got %s, wanted 1ms", got)
+	}
+	for i := 0; i < 10; i++ {
+		if got := cl.ReadShard(int64(i)).Options().Addr; got != "fast" {
+			t.Fatalf("got %s, wanted fast", got)
+		}
+	}
+
+	cl.SetHealthy(fast, false)
+	if got := cl.ReadShard(1).Options().Addr; got != "slow" {
+		t.Errorf("got %s, wanted slow when the fast replica is down", got)
+	}
+	cl.SetHealthy(slow, false)
+	if got := cl.ReadShard(1).Options().Addr; got != "primary" {
+		t.Errorf("got %s, wanted primary when replicas are down", got)
+	}
+}
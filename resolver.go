@@ -0,0 +1,154 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrShardNotResolved is returned by ShardResolver when none of the
+// legacy resolvers knows the id.
+var ErrShardNotResolved = errors.New("sharding: can't resolve shard for legacy id")
+
+// LegacyResolver resolves shard id for ids that don't embed a shard,
+// e.g. ids generated before the data was sharded.
+type LegacyResolver interface {
+	ResolveShard(ctx context.Context, id int64) (shardID int64, ok bool, err error)
+}
+
+// LegacyResolverFunc is an adapter to use a func as a LegacyResolver.
+type LegacyResolverFunc func(ctx context.Context, id int64) (int64, bool, error)
+
+func (fn LegacyResolverFunc) ResolveShard(ctx context.Context, id int64) (int64, bool, error) {
+	return fn(ctx, id)
+}
+
+// LegacyTableResolver returns a resolver that looks up shard id in the
+// table with id and shard_id columns. The table name is not escaped.
+func LegacyTableResolver(db *pg.DB, table string) LegacyResolver {
+	return LegacyResolverFunc(func(ctx context.Context, id int64) (int64, bool, error) {
+		var shardID int64
+		_, err := db.QueryOneContext(ctx, pg.Scan(&shardID),
+			"SELECT shard_id FROM "+table+" WHERE id = ?", id)
+		if err == pg.ErrNoRows {
+			return 0, false, nil
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		return shardID, true, nil
+	})
+}
+
+// ShardResolverOptions configures a ShardResolver.
+type ShardResolverOptions struct {
+	// MinTime is the time the cluster started to generate ids. Ids that
+	// decode to an earlier time are resolved with Resolvers. It is
+	// required: small legacy ids, e.g. serial ids, decode to times just
+	// after the IDGen epoch so the epoch can't tell them apart.
+	MinTime time.Time
+	// MaxClockSkew is how far in the future an id can be before it is
+	// resolved with Resolvers. Default is 1 hour.
+	MaxClockSkew time.Duration
+	// Resolvers are consulted in order for legacy ids.
+	Resolvers []LegacyResolver
+	// CacheSize is the max number of cached legacy ids. Default is 100000.
+	CacheSize int
+}
+
+// ShardResolver routes ids that embed a shard with SplitShard and falls
+// back to a chain of resolvers for legacy ids that don't, so datasets with
+// both kinds of ids can be routed through a single API.
+type ShardResolver struct {
+	cl  *Cluster
+	opt ShardResolverOptions
+
+	mu    sync.RWMutex
+	cache map[int64]int64
+}
+
+// NewShardResolver returns a resolver for the cluster.
+func (cl *Cluster) NewShardResolver(opt *ShardResolverOptions) (*ShardResolver, error) {
+	if opt.MinTime.IsZero() {
+		return nil, errors.New("sharding: ShardResolverOptions.MinTime is required")
+	}
+
+	r := &ShardResolver{
+		cl:    cl,
+		opt:   *opt,
+		cache: make(map[int64]int64),
+	}
+	if r.opt.MaxClockSkew == 0 {
+		r.opt.MaxClockSkew = time.Hour
+	}
+	if r.opt.CacheSize == 0 {
+		r.opt.CacheSize = 100000
+	}
+	return r, nil
+}
+
+// IsLegacy reports whether the id does not embed a shard, i.e. the
+// time encoded in the id is implausible.
+func (r *ShardResolver) IsLegacy(id int64) bool {
+	tm, _, _ := r.cl.gen.SplitID(id)
+	return tm.Before(r.opt.MinTime) || tm.After(time.Now().Add(r.opt.MaxClockSkew))
+}
+
+// ShardID returns shard id for the id. Shard ids decoded from ids out of
+// the cluster range wrap around unless WithStrictShardIDs is used. Shard
+// ids returned by legacy resolvers out of the cluster range are rejected
+// with an error wrapping ErrShardIDOutOfRange and are not cached.
+func (r *ShardResolver) ShardID(ctx context.Context, id int64) (int64, error) {
+	if !r.IsLegacy(id) {
+		_, shardID, _ := r.cl.gen.SplitID(id)
+		r.cl.strictShardID("id", id, shardID)
+		return r.cl.wrapShardID(shardID), nil
+	}
+
+	r.mu.RLock()
+	shardID, ok := r.cache[id]
+	r.mu.RUnlock()
+	if ok {
+		return shardID, nil
+	}
+
+	for _, resolver := range r.opt.Resolvers {
+		shardID, ok, err := resolver.ResolveShard(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			if err := r.cl.checkShardID("legacy id", id, shardID); err != nil {
+				return 0, err
+			}
+			r.store(id, shardID)
+			return shardID, nil
+		}
+	}
+	return 0, ErrShardNotResolved
+}
+
+func (r *ShardResolver) store(id, shardID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.cache) >= r.opt.CacheSize {
+		for k := range r.cache {
+			delete(r.cache, k)
+			break
+		}
+	}
+	r.cache[id] = shardID
+}
+
+// Shard returns the shard for the id.
+func (r *ShardResolver) Shard(ctx context.Context, id int64) (*pg.DB, error) {
+	shardID, err := r.ShardID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return r.cl.shardByID(shardID), nil
+}
@@ -0,0 +1,127 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestShardResolver(t *testing.T) {
+	cluster := sharding.NewCluster([]*pg.DB{pg.Connect(&pg.Options{})}, 8)
+	defer cluster.Close()
+
+	var calls int
+	legacy := map[int64]int64{12345: 5}
+	r, err := cluster.NewShardResolver(&sharding.ShardResolverOptions{
+		MinTime: time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Resolvers: []sharding.LegacyResolver{
+			sharding.LegacyResolverFunc(func(_ context.Context, id int64) (int64, bool, error) {
+				calls++
+				shardID, ok := legacy[id]
+				return shardID, ok, nil
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	id := sharding.DefaultIDGen.MakeID(time.Now(), 3, 0)
+	if shardID, err := r.ShardID(ctx, id); err != nil || shardID != 3 {
+		t.Fatalf("got %d, %v, wanted 3", shardID, err)
+	}
+	if calls != 0 {
+		t.Fatalf("got %d calls, wanted 0", calls)
+	}
+
+	for i := 0; i < 2; i++ {
+		shardID, err := r.ShardID(ctx, 12345)
+		if err != nil || shardID != 5 {
+			t.Fatalf("got %d, %v, wanted 5", shardID, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("got %d calls, wanted 1", calls)
+	}
+
+	future := sharding.DefaultIDGen.MakeID(time.Now().Add(24*time.Hour), 3, 0)
+	for _, id := range []int64{-1, future} {
+		if !r.IsLegacy(id) {
+			t.Fatalf("id %d is not legacy", id)
+		}
+		if _, err := r.ShardID(ctx, id); err != sharding.ErrShardNotResolved {
+			t.Fatalf("got %v, wanted ErrShardNotResolved", err)
+		}
+	}
+}
+
+func TestShardResolverDefaultOptions(t *testing.T) {
+	cluster := sharding.NewCluster([]*pg.DB{pg.Connect(&pg.Options{})}, 8)
+	defer cluster.Close()
+
+	// Without MinTime the serial id 12345 would decode to a time just
+	// after the epoch and be routed by garbage shard bits.
+	_, err := cluster.NewShardResolver(&sharding.ShardResolverOptions{})
+	if err == nil || err.Error() != "sharding: ShardResolverOptions.MinTime is required" {
+		t.Fatalf("got %v, wanted MinTime is required", err)
+	}
+}
+
+func TestShardResolverStrictShardIDs(t *testing.T) {
+	var errs []error
+	cluster := sharding.NewCluster([]*pg.DB{pg.Connect(&pg.Options{})}, 8,
+		sharding.WithStrictShardIDs(func(err error) {
+			errs = append(errs, err)
+		}))
+	defer cluster.Close()
+
+	r, err := cluster.NewShardResolver(&sharding.ShardResolverOptions{
+		MinTime: time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := sharding.DefaultIDGen.MakeID(time.Now(), 11, 0)
+	if shardID, err := r.ShardID(context.Background(), id); err != nil || shardID != 3 {
+		t.Fatalf("got %d, %v, wanted 3", shardID, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], sharding.ErrShardIDOutOfRange) {
+		t.Fatalf("got %v, wanted ErrShardIDOutOfRange", errs)
+	}
+}
+
+func TestShardResolverRejectsResolvedShardIDs(t *testing.T) {
+	cluster := sharding.NewCluster([]*pg.DB{pg.Connect(&pg.Options{})}, 8)
+	defer cluster.Close()
+
+	var calls int
+	r, err := cluster.NewShardResolver(&sharding.ShardResolverOptions{
+		MinTime: time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Resolvers: []sharding.LegacyResolver{
+			sharding.LegacyResolverFunc(func(context.Context, int64) (int64, bool, error) {
+				calls++
+				return 9, true, nil
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := r.ShardID(context.Background(), 12345)
+		if !errors.Is(err, sharding.ErrShardIDOutOfRange) {
+			t.Fatalf("got %v, wanted ErrShardIDOutOfRange", err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("got %d calls, wanted 2", calls)
+	}
+}
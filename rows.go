@@ -0,0 +1,68 @@
+package sharding
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// ForEachRow runs the query on every shard and streams the result rows
+// without loading them into memory. The newRow is called once per shard
+// and returns the scanner that every row of the shard is scanned into,
+// e.g. pg.Scan(&id, &name) or a struct model created with orm.NewModel.
+// The fn is called with the scanner after every row is scanned. Shards
+// are processed using ForEachShardContext with the opt.
+//
+// Rows are read as they arrive, so a slow fn holds the connection and
+// the query snapshot open.
+func (cl *Cluster) ForEachRow(
+	ctx context.Context,
+	opt *ForEachOptions,
+	newRow func(shardID int64) orm.ColumnScanner,
+	fn func(shardID int64, row orm.ColumnScanner) error,
+	query string, params ...interface{},
+) error {
+	return cl.ForEachShardContext(ctx, opt, func(ctx context.Context, shard *pg.DB) error {
+		shardID := shard.Param("SHARD_ID").(int64)
+		m := &rowModel{
+			shardID: shardID,
+			row:     newRow(shardID),
+			fn:      fn,
+		}
+		_, err := shard.QueryContext(ctx, m, query, params...)
+		if m.err != nil {
+			// The fn error is returned as is.
+			return m.err
+		}
+		return WrapShardError(shard, err)
+	})
+}
+
+// rowModel is a go-pg model that passes every scanned row to the fn.
+type rowModel struct {
+	shardID int64
+	row     orm.ColumnScanner
+	fn      func(shardID int64, row orm.ColumnScanner) error
+	err     error
+}
+
+var _ orm.HooklessModel = (*rowModel)(nil)
+
+func (m *rowModel) Init() error {
+	return nil
+}
+
+func (m *rowModel) NextColumnScanner() orm.ColumnScanner {
+	return m.row
+}
+
+func (m *rowModel) AddColumnScanner(orm.ColumnScanner) error {
+	// go-pg reads remaining rows after an error, so the fn is not called
+	// for them.
+	if m.err != nil {
+		return m.err
+	}
+	m.err = m.fn(m.shardID, m.row)
+	return m.err
+}
@@ -0,0 +1,94 @@
+package sharding_test
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ForEachRow", func() {
+	var cluster *shardingtest.Cluster
+
+	type row struct {
+		id   int64
+		name string
+	}
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		cluster.SetResult(shardingtest.AllShards, "users", &shardingtest.Result{
+			Columns: []string{"id", "name"},
+			Rows:    [][]interface{}{{1, "alice"}, {2, "bob"}, {3, nil}},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("streams rows of every shard", func() {
+		var mu sync.Mutex
+		rows := make(map[int64][]row)
+		values := make(map[int64]*row)
+
+		err := cluster.ForEachRow(ctx, nil,
+			func(shardID int64) orm.ColumnScanner {
+				r := new(row)
+				mu.Lock()
+				values[shardID] = r
+				mu.Unlock()
+				return pg.Scan(&r.id, &r.name)
+			},
+			func(shardID int64, _ orm.ColumnScanner) error {
+				mu.Lock()
+				rows[shardID] = append(rows[shardID], *values[shardID])
+				mu.Unlock()
+				return nil
+			},
+			"SELECT id, name FROM ?SHARD.users")
+		Expect(err).NotTo(HaveOccurred())
+
+		wanted := []row{{1, "alice"}, {2, "bob"}, {3, ""}}
+		Expect(rows).To(Equal(map[int64][]row{0: wanted, 1: wanted}))
+		Expect(cluster.Queries(1)).To(Equal([]string{"SELECT id, name FROM shard1.users"}))
+	})
+
+	It("stops calling the fn after an error", func() {
+		cluster.SetResult(1, "users", &shardingtest.Result{
+			Columns: []string{"id", "name"},
+		})
+
+		var calls int
+		var id int64
+		err := cluster.ForEachRow(ctx, nil,
+			func(int64) orm.ColumnScanner {
+				return pg.Scan(&id, new(string))
+			},
+			func(int64, orm.ColumnScanner) error {
+				calls++
+				if id == 2 {
+					return errors.New("fake error")
+				}
+				return nil
+			},
+			"SELECT id, name FROM ?SHARD.users")
+		Expect(err).To(MatchError("fake error"))
+		Expect(calls).To(Equal(2))
+	})
+
+	It("returns shard errors", func() {
+		cluster.SetError(1, &shardingtest.Error{Message: "fake error"})
+		err := cluster.ForEachRow(ctx, nil,
+			func(int64) orm.ColumnScanner { return pg.Scan(new(int64), new(string)) },
+			func(int64, orm.ColumnScanner) error { return nil },
+			"SELECT id, name FROM ?SHARD.users")
+		Expect(err).To(MatchError("sharding: shard 1 (shardingtest1): ERROR #XX000 fake error"))
+	})
+})
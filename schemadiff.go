@@ -0,0 +1,265 @@
+package sharding
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// SchemaDifference is a table, column, constraint, or index of a shard
+// schema that differs from the reference shard.
+type SchemaDifference struct {
+	ShardID int64
+	// Kind is one of "table", "column", "constraint", and "index".
+	Kind  string
+	Table string
+	// Name is the name of the column, constraint, or index.
+	Name string
+	// Want is the definition in the reference shard or empty when
+	// the object does not exist there, e.g. "text NOT NULL" for a column
+	// or the list of columns for a table. Schema names are replaced with
+	// the reference shard schema.
+	Want string
+	// Got is the definition in the shard or empty when the object is
+	// missing.
+	Got string
+}
+
+// SchemaDiff is the outcome of DiffSchemas.
+type SchemaDiff struct {
+	ReferenceShardID int64
+	// Differences are ordered by shard id, table, kind, and name.
+	// Columns, constraints, and indexes of a table that is missing
+	// in a shard or in the reference shard are not listed.
+	Differences []SchemaDifference
+}
+
+// Drifted returns ids of the shards whose schema differs from
+// the reference shard.
+func (d *SchemaDiff) Drifted() []int64 {
+	var ids []int64
+	for i := range d.Differences {
+		id := d.Differences[i].ShardID
+		if len(ids) == 0 || ids[len(ids)-1] != id {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// DiffSchemas introspects tables, columns, constraints, and indexes of
+// every shard schema and reports differences from the schema of the shard
+// with the reference id, e.g. a migration that was not applied to some
+// shards. Shards that fail to be introspected are skipped and the first
+// error is returned with the diff.
+func (cl *Cluster) DiffSchemas(ctx context.Context, referenceShardID int64) (*SchemaDiff, error) {
+	if err := cl.checkShardIDRange(ShardID(referenceShardID)); err != nil {
+		return nil, err
+	}
+
+	refShard := cl.shardByID(referenceShardID)
+	ref, err := introspectSchema(ctx, refShard, shardSchema(refShard))
+	if err != nil {
+		return nil, WrapShardError(refShard, err)
+	}
+
+	diffs := make([][]SchemaDifference, cl.nshards)
+	err = cl.ForEachShardContext(ctx, &ForEachOptions{
+		ContinueOnError: true,
+	}, func(ctx context.Context, shard *pg.DB) error {
+		shardID := shard.Param("SHARD_ID").(int64)
+		if shardID == referenceShardID {
+			return nil
+		}
+
+		schema, err := introspectSchema(ctx, shard, shardSchema(refShard))
+		if err != nil {
+			return WrapShardError(shard, err)
+		}
+		diffs[shardID] = diffSchema(shardID, ref, schema)
+		return nil
+	})
+
+	diff := &SchemaDiff{
+		ReferenceShardID: referenceShardID,
+	}
+	for _, d := range diffs {
+		diff.Differences = append(diff.Differences, d...)
+	}
+	return diff, err
+}
+
+// schemaObject is a column, constraint, or index of a table.
+type schemaObject struct {
+	kind  string
+	table string
+	name  string
+}
+
+// shardSchemaDef is the introspected schema of a shard.
+type shardSchemaDef struct {
+	tables  map[string]string // column list indexed by table name
+	objects map[schemaObject]string
+}
+
+type schemaColumn struct {
+	Table   string
+	Name    string
+	Type    string
+	NotNull bool
+	Default string
+}
+
+type schemaTableObject struct {
+	Table string
+	Name  string
+	Def   string
+}
+
+// introspectSchema reads the schema of the shard replacing the shard
+// schema name with the refSchema in definitions.
+func introspectSchema(ctx context.Context, shard *pg.DB, refSchema string) (*shardSchemaDef, error) {
+	var columns []schemaColumn
+	_, err := shard.QueryContext(ctx, &columns, `
+		SELECT c.relname AS table, a.attname AS name,
+			format_type(a.atttypid, a.atttypmod) AS type, a.attnotnull AS not_null,
+			coalesce(pg_get_expr(d.adbin, d.adrelid), '') AS default
+		FROM pg_attribute AS a
+		JOIN pg_class AS c ON c.oid = a.attrelid
+		JOIN pg_namespace AS n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attrdef AS d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = '?SHARD' AND c.relkind IN ('r', 'p')
+		AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY c.relname, a.attnum
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	var constraints []schemaTableObject
+	_, err = shard.QueryContext(ctx, &constraints, `
+		SELECT c.relname AS table, con.conname AS name, pg_get_constraintdef(con.oid) AS def
+		FROM pg_constraint AS con
+		JOIN pg_class AS c ON c.oid = con.conrelid
+		JOIN pg_namespace AS n ON n.oid = c.relnamespace
+		WHERE n.nspname = '?SHARD'
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []schemaTableObject
+	_, err = shard.QueryContext(ctx, &indexes, `
+		SELECT c.relname AS table, ic.relname AS name, pg_get_indexdef(i.indexrelid) AS def
+		FROM pg_index AS i
+		JOIN pg_class AS c ON c.oid = i.indrelid
+		JOIN pg_class AS ic ON ic.oid = i.indexrelid
+		JOIN pg_namespace AS n ON n.oid = c.relnamespace
+		WHERE n.nspname = '?SHARD'
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	rewrite := schemaRewriter(shardSchema(shard), refSchema)
+	def := &shardSchemaDef{
+		tables:  make(map[string]string),
+		objects: make(map[schemaObject]string),
+	}
+	for _, c := range columns {
+		col := c.Type
+		if c.NotNull {
+			col += " NOT NULL"
+		}
+		if c.Default != "" {
+			col += " DEFAULT " + rewrite(c.Default)
+		}
+		def.objects[schemaObject{"column", c.Table, c.Name}] = col
+
+		if cols := def.tables[c.Table]; cols != "" {
+			def.tables[c.Table] = cols + ", " + c.Name
+		} else {
+			def.tables[c.Table] = c.Name
+		}
+	}
+	for _, c := range constraints {
+		def.objects[schemaObject{"constraint", c.Table, c.Name}] = rewrite(c.Def)
+	}
+	for _, index := range indexes {
+		def.objects[schemaObject{"index", index.Table, index.Name}] = rewrite(index.Def)
+	}
+	return def, nil
+}
+
+func diffSchema(shardID int64, ref, got *shardSchemaDef) []SchemaDifference {
+	var diffs []SchemaDifference
+	for table, want := range ref.tables {
+		if _, ok := got.tables[table]; !ok {
+			diffs = append(diffs, SchemaDifference{
+				ShardID: shardID,
+				Kind:    "table",
+				Table:   table,
+				Want:    want,
+			})
+		}
+	}
+	for table, cols := range got.tables {
+		if _, ok := ref.tables[table]; !ok {
+			diffs = append(diffs, SchemaDifference{
+				ShardID: shardID,
+				Kind:    "table",
+				Table:   table,
+				Got:     cols,
+			})
+		}
+	}
+
+	bothHave := func(table string) bool {
+		_, inRef := ref.tables[table]
+		_, inGot := got.tables[table]
+		return inRef && inGot
+	}
+	for obj, want := range ref.objects {
+		if have := got.objects[obj]; have != want && bothHave(obj.table) {
+			diffs = append(diffs, SchemaDifference{
+				ShardID: shardID,
+				Kind:    obj.kind,
+				Table:   obj.table,
+				Name:    obj.name,
+				Want:    want,
+				Got:     have,
+			})
+		}
+	}
+	for obj, have := range got.objects {
+		if _, ok := ref.objects[obj]; !ok && bothHave(obj.table) {
+			diffs = append(diffs, SchemaDifference{
+				ShardID: shardID,
+				Kind:    obj.kind,
+				Table:   obj.table,
+				Name:    obj.name,
+				Got:     have,
+			})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		a, b := &diffs[i], &diffs[j]
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		if a.Kind != b.Kind {
+			return schemaKindOrder[a.Kind] < schemaKindOrder[b.Kind]
+		}
+		return a.Name < b.Name
+	})
+	return diffs
+}
+
+var schemaKindOrder = map[string]int{
+	"table":      0,
+	"column":     1,
+	"constraint": 2,
+	"index":      3,
+}
@@ -0,0 +1,108 @@
+package sharding_test
+
+import (
+	"errors"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiffSchemas", func() {
+	var cluster *shardingtest.Cluster
+
+	columns := func(rows ...[]interface{}) *shardingtest.Result {
+		return &shardingtest.Result{
+			Columns: []string{"table", "name", "type", "not_null", "default"},
+			Rows:    rows,
+		}
+	}
+	objects := func(rows ...[]interface{}) *shardingtest.Result {
+		return &shardingtest.Result{
+			Columns: []string{"table", "name", "def"},
+			Rows:    rows,
+		}
+	}
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+
+		for shardID := int64(0); shardID < 4; shardID++ {
+			schema := "shard" + string(rune('0'+shardID))
+			cluster.SetResult(shardID, "format_type", columns(
+				[]interface{}{"users", "id", "bigint", true, "nextval('" + schema + ".users_id_seq'::regclass)"},
+				[]interface{}{"users", "email", "text", true, ""},
+			))
+			cluster.SetResult(shardID, "pg_get_constraintdef", objects(
+				[]interface{}{"users", "users_pkey", "PRIMARY KEY (id)"},
+			))
+			cluster.SetResult(shardID, "pg_get_indexdef", objects(
+				[]interface{}{"users", "users_pkey",
+					"CREATE UNIQUE INDEX users_pkey ON " + schema + ".users USING btree (id)"},
+				[]interface{}{"users", "users_email_idx",
+					"CREATE INDEX users_email_idx ON " + schema + ".users USING btree (email)"},
+			))
+		}
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("reports no differences for identical shards", func() {
+		diff, err := cluster.DiffSchemas(ctx, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff.Differences).To(BeEmpty())
+		Expect(diff.Drifted()).To(BeEmpty())
+		Expect(cluster.Queries(1)).To(ContainElement(ContainSubstring("n.nspname = 'shard1'")))
+	})
+
+	It("reports differences from the reference shard", func() {
+		cluster.SetResult(1, "format_type", columns(
+			[]interface{}{"users", "id", "bigint", true, "nextval('shard1.users_id_seq'::regclass)"},
+			[]interface{}{"users", "email", "character varying(255)", false, ""},
+			[]interface{}{"posts", "id", "bigint", true, ""},
+		))
+		cluster.SetResult(3, "pg_get_indexdef", objects(
+			[]interface{}{"users", "users_pkey", "CREATE UNIQUE INDEX users_pkey ON shard3.users USING btree (id)"},
+		))
+
+		diff, err := cluster.DiffSchemas(ctx, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff.Drifted()).To(Equal([]int64{1, 3}))
+		Expect(diff.Differences).To(Equal([]sharding.SchemaDifference{{
+			ShardID: 1,
+			Kind:    "table",
+			Table:   "posts",
+			Got:     "id",
+		}, {
+			ShardID: 1,
+			Kind:    "column",
+			Table:   "users",
+			Name:    "email",
+			Want:    "text NOT NULL",
+			Got:     "character varying(255)",
+		}, {
+			ShardID: 3,
+			Kind:    "index",
+			Table:   "users",
+			Name:    "users_email_idx",
+			Want:    "CREATE INDEX users_email_idx ON shard0.users USING btree (email)",
+		}}))
+	})
+
+	It("returns the diff of shards that were introspected", func() {
+		cluster.SetQueryError(2, "pg_get_constraintdef", &shardingtest.Error{Message: "permission denied"})
+
+		diff, err := cluster.DiffSchemas(ctx, 0)
+		Expect(err).To(MatchError(ContainSubstring("permission denied")))
+		Expect(diff.Differences).To(BeEmpty())
+	})
+
+	It("rejects reference ids out of range", func() {
+		_, err := cluster.DiffSchemas(ctx, 4)
+		Expect(errors.Is(err, sharding.ErrShardIDOutOfRange)).To(BeTrue())
+	})
+})
@@ -0,0 +1,64 @@
+package sharding
+
+import "sort"
+
+// WithKeyScrambling makes Shard and other methods that map numbers to
+// shards scramble the number using ScrambleKey before taking it modulo
+// the number of shards, so sequential keys, e.g. account ids, are spread
+// across shards and servers instead of mapping to adjacent shards. Shard
+// ids decoded from ids and UUIDs are not scrambled.
+//
+// Enabling it on an existing cluster moves most keys to other shards.
+// Use KeyMoves to find the keys that have to be migrated.
+func WithKeyScrambling() Option {
+	return func(cl *Cluster) {
+		cl.scramble = true
+	}
+}
+
+// KeyScrambling reports whether WithKeyScrambling is used.
+func (cl *Cluster) KeyScrambling() bool {
+	return cl.scramble
+}
+
+// ScrambleKey returns the key mixed using the splitmix64 finalizer.
+// It is a bijection so distinct keys stay distinct. The algorithm is part
+// of the public API and never changes.
+func ScrambleKey(key int64) int64 {
+	z := uint64(key) + 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// KeyMove is a key that maps to different shards with and without
+// key scrambling.
+type KeyMove struct {
+	Key int64
+	// OldShardID is the shard of the key without scrambling.
+	OldShardID int64
+	// NewShardID is the shard of the key with scrambling.
+	NewShardID int64
+}
+
+// KeyMoves returns the keys that map to different shards with and without
+// WithKeyScrambling ordered by key, i.e. the keys that have to be moved
+// when scrambling is enabled (or disabled) for the cluster.
+func (cl *Cluster) KeyMoves(keys []int64) []KeyMove {
+	var moves []KeyMove
+	for _, key := range keys {
+		oldID := cl.wrapShardID(key)
+		newID := cl.wrapShardID(ScrambleKey(key))
+		if oldID != newID {
+			moves = append(moves, KeyMove{
+				Key:        key,
+				OldShardID: oldID,
+				NewShardID: newID,
+			})
+		}
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		return moves[i].Key < moves[j].Key
+	})
+	return moves
+}
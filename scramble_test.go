@@ -0,0 +1,71 @@
+package sharding_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestScrambleKey(t *testing.T) {
+	// The first output of splitmix64 seeded with 0.
+	if got := uint64(sharding.ScrambleKey(0)); got != 0xe220a8397b1dcdaf {
+		t.Errorf("got %#x, wanted 0xe220a8397b1dcdaf", got)
+	}
+}
+
+func TestWithKeyScrambling(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	defer db.Close()
+
+	plain := sharding.NewCluster([]*pg.DB{db}, 8)
+	cl := sharding.NewCluster([]*pg.DB{db}, 8, sharding.WithKeyScrambling())
+	if !cl.KeyScrambling() || plain.KeyScrambling() {
+		t.Fatal("got wrong KeyScrambling")
+	}
+
+	// Sequential keys must not map to sequential shards.
+	sequential := true
+	for key := int64(0); key < 8; key++ {
+		want := sharding.ScrambleKey(key) & 7
+		if got := shardID(cl.Shard(key)); got != want {
+			t.Errorf("key %d: got shard %d, wanted %d", key, got, want)
+		}
+		if shardID(cl.Shard(key)) != key {
+			sequential = false
+		}
+	}
+	if sequential {
+		t.Error("keys are not scrambled")
+	}
+
+	// Shard ids encoded in ids are not scrambled.
+	id := cl.IDGen().MakeID(time.Now(), 3, 0)
+	if got := shardID(cl.SplitShard(id)); got != 3 {
+		t.Errorf("got shard %d, wanted 3", got)
+	}
+
+	if cl.Fingerprint() == plain.Fingerprint() {
+		t.Error("scrambling does not change the fingerprint")
+	}
+	if !cl.Config().ScrambleKeys {
+		t.Error("ScrambleKeys is not exported to the config")
+	}
+
+	keys := []int64{5, 1, 2, 3, 4}
+	moves := cl.KeyMoves(keys)
+	if len(moves) == 0 {
+		t.Fatal("got no moves")
+	}
+	for i, m := range moves {
+		if i > 0 && moves[i-1].Key >= m.Key {
+			t.Errorf("moves are not ordered: %v", moves)
+		}
+		if m.OldShardID != shardID(plain.Shard(m.Key)) ||
+			m.NewShardID != shardID(cl.Shard(m.Key)) || m.OldShardID == m.NewShardID {
+			t.Errorf("got wrong move %+v", m)
+		}
+	}
+}
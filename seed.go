@@ -0,0 +1,121 @@
+package sharding
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// SeedRow describes a synthetic row being generated.
+type SeedRow struct {
+	ShardID int64
+	// N is the row number in the shard starting from 0.
+	N int
+	// ID is minted with the cluster IDGen using Time, ShardID, and N.
+	ID   int64
+	Time time.Time
+}
+
+// SeedTable describes synthetic data for a table in every shard.
+type SeedTable struct {
+	// Table name without the shard schema, e.g. "users".
+	Table string
+	// Columns in COPY order. The first column receives the generated id.
+	Columns []string
+	// RowsPerShard is the number of rows generated in each shard.
+	RowsPerShard int
+	// Values returns values for the rest of the columns. The rnd is seeded
+	// deterministically for each shard and table.
+	Values func(rnd *rand.Rand, row *SeedRow) []interface{}
+}
+
+// Seeder generates deterministic synthetic data for shards. The same
+// Seed, time range, and tables always produce the same rows.
+type Seeder struct {
+	Seed int64
+	// Row timestamps are spread evenly over [From, To).
+	From, To time.Time
+	Tables   []SeedTable
+}
+
+// Generate calls fn with every row generated for the table in the shard.
+// Note that ids are unique only when no more than 4096 rows (with the
+// default IDGen) fall into the same millisecond.
+func (s *Seeder) Generate(
+	gen *IDGen, shardID int64, table *SeedTable, fn func(values []interface{}) error,
+) error {
+	if gen == nil {
+		gen = DefaultIDGen
+	}
+	rnd := rand.New(rand.NewSource(s.seed(shardID, table.Table)))
+
+	span := s.To.Sub(s.From)
+	for i := 0; i < table.RowsPerShard; i++ {
+		tm := s.From.Add(time.Duration(float64(span) * float64(i) / float64(table.RowsPerShard)))
+		row := &SeedRow{
+			ShardID: shardID,
+			N:       i,
+			ID:      gen.MakeID(tm, shardID, int64(i)),
+			Time:    tm,
+		}
+
+		values := []interface{}{row.ID}
+		if table.Values != nil {
+			values = append(values, table.Values(rnd, row)...)
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Seeder) seed(shardID int64, table string) int64 {
+	h := uint64(s.Seed) ^ uint64(shardID)*0x9e3779b97f4a7c15
+	for i := 0; i < len(table); i++ {
+		h ^= uint64(table[i])
+		h *= 0x100000001b3
+	}
+	return int64(h)
+}
+
+// Seed generates synthetic data with the seeder and loads it into every
+// shard of the cluster using COPY.
+func (cl *Cluster) Seed(ctx context.Context, s *Seeder) error {
+	return cl.ForEachShard(func(shard *pg.DB) error {
+		shardID := shard.Param("SHARD_ID").(int64)
+		for i := range s.Tables {
+			if err := cl.seedTable(ctx, shard, shardID, s, &s.Tables[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (cl *Cluster) seedTable(
+	ctx context.Context, shard *pg.DB, shardID int64, s *Seeder, table *SeedTable,
+) error {
+	pr, pw := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(pw)
+		var b []byte
+		err := s.Generate(cl.gen, shardID, table, func(values []interface{}) error {
+			b = appendCSVRow(b[:0], values)
+			_, err := w.Write(b)
+			return err
+		})
+		if err == nil {
+			err = w.Flush()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	_, err := copyFromCSV(ctx, shard, table.Table, table.Columns, pr)
+	_ = pr.CloseWithError(err)
+	return err
+}
@@ -0,0 +1,66 @@
+package sharding_test
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestSeederGenerate(t *testing.T) {
+	from := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	seeder := &sharding.Seeder{
+		Seed: 42,
+		From: from,
+		To:   from.Add(time.Hour),
+	}
+	table := &sharding.SeedTable{
+		Table:        "users",
+		Columns:      []string{"id", "name"},
+		RowsPerShard: 100,
+		Values: func(rnd *rand.Rand, row *sharding.SeedRow) []interface{} {
+			return []interface{}{rnd.Int63()}
+		},
+	}
+
+	generate := func(shardID int64) [][]interface{} {
+		var rows [][]interface{}
+		err := seeder.Generate(nil, shardID, table, func(values []interface{}) error {
+			rows = append(rows, values)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	rows := generate(7)
+	if len(rows) != 100 {
+		t.Fatalf("got %d rows, wanted 100", len(rows))
+	}
+	if !reflect.DeepEqual(rows, generate(7)) {
+		t.Fatalf("rows are not deterministic")
+	}
+	if reflect.DeepEqual(rows, generate(8)) {
+		t.Fatalf("shards have identical rows")
+	}
+
+	var prev int64
+	for i, row := range rows {
+		id := row[0].(int64)
+		tm, shardID, _ := sharding.DefaultIDGen.SplitID(id)
+		if shardID != 7 {
+			t.Fatalf("row %d: got shard %d, wanted 7", i, shardID)
+		}
+		if tm.Before(seeder.From) || !tm.Before(seeder.To) {
+			t.Fatalf("row %d: time %s is out of range", i, tm)
+		}
+		if id <= prev {
+			t.Fatalf("row %d: id=%d prev=%d", i, id, prev)
+		}
+		prev = id
+	}
+}
@@ -0,0 +1,89 @@
+package sharding
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// Session routes reads of shards written in the session to the primary
+// so a user reads own writes while other reads go to replicas, e.g.
+//
+//	sess := cluster.Session()
+//	_, err := sess.Shard(userID).Model(user).Insert()
+//	// Reads from the primary because the shard was written to.
+//	err = sess.ReadShard(userID).Model(user).WherePK().Select()
+//
+// Sessions are cheap and are usually created per request or stored
+// in the user session. It is safe for concurrent use.
+type Session struct {
+	cl *Cluster
+
+	mu      sync.Mutex
+	written map[int64]struct{} // shard ids
+}
+
+// Session returns a new session without written shards.
+func (cl *Cluster) Session() *Session {
+	return &Session{
+		cl:      cl,
+		written: make(map[int64]struct{}),
+	}
+}
+
+// Shard returns the primary shard for the number and marks the shard
+// as written so following reads in the session use the primary.
+func (s *Session) Shard(number int64) *pg.DB {
+	s.MarkWritten(number)
+	return s.cl.Shard(number)
+}
+
+// ReadShard returns the primary shard for the number if the session
+// wrote to the shard and a shard on a replica like Cluster.ReadShard
+// otherwise.
+func (s *Session) ReadShard(number int64) *pg.DB {
+	s.mu.Lock()
+	_, written := s.written[s.cl.shardID(number)]
+	s.mu.Unlock()
+
+	if written {
+		return s.cl.Shard(number)
+	}
+	return s.cl.ReadShard(number)
+}
+
+// MarkWritten marks the shard for the number as written, e.g. after
+// writing to a shard returned by Cluster.Shard.
+func (s *Session) MarkWritten(number int64) {
+	s.markWrittenID(s.cl.shardID(number))
+}
+
+func (s *Session) markWrittenID(shardID int64) {
+	s.mu.Lock()
+	s.written[shardID] = struct{}{}
+	s.mu.Unlock()
+}
+
+// Written returns the sorted ids of the shards written in the session,
+// e.g. to restore the session with Restore in the next request.
+func (s *Session) Written() []int64 {
+	s.mu.Lock()
+	ids := make([]int64, 0, len(s.written))
+	for id := range s.written {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// Restore marks the shards with the ids returned by Written as written.
+func (s *Session) Restore(shardIDs []int64) {
+	for _, id := range shardIDs {
+		s.markWrittenID(s.cl.wrapShardID(id))
+	}
+}
@@ -0,0 +1,65 @@
+package sharding_test
+
+import (
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestSession(t *testing.T) {
+	primary := pg.Connect(&pg.Options{Addr: "primary"})
+	replica := pg.Connect(&pg.Options{Addr: "replica"})
+	cl := sharding.NewCluster([]*pg.DB{primary}, 4, sharding.WithReplicas(primary, replica))
+	defer cl.Close()
+
+	if got := cl.ReadShard(1).Options().Addr; got != "replica" {
+		t.Errorf("got %s, wanted replica", got)
+	}
+	if got := cl.ReadShard(1).Param("SHARD_ID"); got != int64(1) {
+		t.Errorf("got SHARD_ID=%v, wanted 1", got)
+	}
+
+	sess := cl.Session()
+	if got := sess.Shard(5).Options().Addr; got != "primary" {
+		t.Errorf("got %s, wanted primary", got)
+	}
+	if got := sess.ReadShard(1).Options().Addr; got != "primary" {
+		t.Errorf("got %s, wanted primary for the written shard", got)
+	}
+	if got := sess.ReadShard(2).Options().Addr; got != "replica" {
+		t.Errorf("got %s, wanted replica", got)
+	}
+
+	restored := cl.Session()
+	restored.Restore(sess.Written())
+	if got := restored.ReadShard(1).Options().Addr; got != "primary" {
+		t.Errorf("got %s, wanted primary for the restored shard", got)
+	}
+
+	cl.SetHealthy(replica, false)
+	if got := cl.ReadShard(2).Options().Addr; got != "primary" {
+		t.Errorf("got %s, wanted primary when the replica is down", got)
+	}
+}
+
+func TestSessionRestoreKeyScrambling(t *testing.T) {
+	primary := pg.Connect(&pg.Options{Addr: "primary"})
+	replica := pg.Connect(&pg.Options{Addr: "replica"})
+	cl := sharding.NewCluster([]*pg.DB{primary}, 4,
+		sharding.WithReplicas(primary, replica), sharding.WithKeyScrambling())
+	defer cl.Close()
+
+	sess := cl.Session()
+	sess.MarkWritten(0)
+
+	restored := cl.Session()
+	restored.Restore(sess.Written())
+	if got, wanted := restored.Written(), sess.Written(); len(got) != 1 || got[0] != wanted[0] {
+		t.Errorf("got %v, wanted %v", got, wanted)
+	}
+	if got := restored.ReadShard(0).Options().Addr; got != "primary" {
+		t.Errorf("got %s, wanted primary for the restored shard", got)
+	}
+}
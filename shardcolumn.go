@@ -0,0 +1,145 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+type shardIDKey struct{}
+
+// contextShardID returns the id of the shard the ctx was created for.
+// Queries built with shard.Model use the shard context unless another
+// one is passed with ModelContext.
+func contextShardID(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(shardIDKey{}).(int64)
+	return id, ok
+}
+
+// ShardFromContext returns the id of the shard the ctx belongs to, e.g.
+// in model hooks like BeforeInsert of queries built with shard.Model or
+// DBTx.Shard(number).Model. Contexts passed explicitly, e.g. to
+// ModelContext or RunInTransaction, carry the shard id only when created
+// with WithShard.
+func ShardFromContext(ctx context.Context) (ShardID, bool) {
+	id, ok := contextShardID(ctx)
+	return ShardID(id), ok
+}
+
+// WithShard returns a copy of the ctx that carries the id and the key
+// provider of the shard returned by the cluster, so model hooks of queries
+// executed with the ctx see the shard, e.g.
+//
+//	shard.ModelContext(sharding.WithShard(ctx, shard), user).Insert()
+//
+// The ctx is returned as is for other dbs.
+func WithShard(ctx context.Context, shard *pg.DB) context.Context {
+	id, ok := ShardIDOf(shard)
+	if !ok {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, shardIDKey{}, int64(id))
+	if p := shard.Context().Value(keyProviderKey{}); p != nil {
+		ctx = context.WithValue(ctx, keyProviderKey{}, p)
+	}
+	return ctx
+}
+
+// ShardColumn can be embedded into models stored in shards to keep the
+// id of the shard the row is stored in, e.g. for exports and consistency
+// checks:
+//
+//	type User struct {
+//		tableName struct{} `pg:"?SHARD.users"`
+//
+//		ID int64
+//		sharding.ShardColumn
+//	}
+//
+// The shard_id column is populated by the BeforeInsert hook from the shard
+// executing shard.Model(...).Insert(). Models that define their own
+// BeforeInsert must call ShardColumn.BeforeInsert. Inserts of rows with
+// a shard_id different from the shard, e.g. queries built with
+// ModelContext and a ctx not created with WithShard, fail with
+// *ShardColumnError.
+type ShardColumn struct {
+	ShardID int64 `pg:"shard_id,use_zero"`
+}
+
+var _ orm.BeforeInsertHook = (*ShardColumn)(nil)
+
+func (c *ShardColumn) BeforeInsert(ctx context.Context) (context.Context, error) {
+	if id, ok := contextShardID(ctx); ok {
+		c.ShardID = id
+	}
+	return ctx, nil
+}
+
+func (c *ShardColumn) shardColumn() *ShardColumn {
+	return c
+}
+
+type shardColumner interface {
+	shardColumn() *ShardColumn
+}
+
+var shardColumnerType = reflect.TypeOf((*shardColumner)(nil)).Elem()
+
+// ShardColumnError is returned when a row with ShardColumn is inserted
+// into a shard other than the one in its shard_id.
+type ShardColumnError struct {
+	ShardID    int64
+	RowShardID int64
+}
+
+func (e *ShardColumnError) Error() string {
+	return fmt.Sprintf("sharding: row with shard_id %d is inserted into shard %d",
+		e.RowShardID, e.ShardID)
+}
+
+// checkShardColumn returns an error if the insert query model has
+// a ShardColumn that does not match the shard.
+func (h *shardHook) checkShardColumn(query interface{}) error {
+	q, ok := query.(*orm.InsertQuery)
+	if !ok {
+		return nil
+	}
+	model := q.Query().TableModel()
+	if model == nil || model.IsNil() ||
+		!reflect.PtrTo(model.Table().Type).Implements(shardColumnerType) {
+		return nil
+	}
+
+	v := model.Value()
+	switch v.Kind() {
+	case reflect.Struct:
+		return h.checkShardColumnValue(v)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := h.checkShardColumnValue(reflect.Indirect(v.Index(i))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (h *shardHook) checkShardColumnValue(v reflect.Value) error {
+	if !v.CanAddr() {
+		return nil
+	}
+	c, ok := v.Addr().Interface().(shardColumner)
+	if !ok {
+		return nil
+	}
+	if id := c.shardColumn().ShardID; id != h.shardID {
+		return &ShardColumnError{
+			ShardID:    h.shardID,
+			RowShardID: id,
+		}
+	}
+	return nil
+}
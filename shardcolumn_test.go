@@ -0,0 +1,102 @@
+package sharding_test
+
+import (
+	"context"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type ShardAwareEvent struct {
+	tableName struct{} `pg:"?SHARD.events"`
+
+	Name    string
+	ShardID sharding.ShardID `pg:"-"`
+}
+
+func (e *ShardAwareEvent) BeforeInsert(ctx context.Context) (context.Context, error) {
+	e.ShardID, _ = sharding.ShardFromContext(ctx)
+	return ctx, nil
+}
+
+type ShardedEvent struct {
+	tableName struct{} `pg:"?SHARD.events"`
+
+	Name string
+	sharding.ShardColumn
+}
+
+var _ = Describe("ShardColumn", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("is populated from the shard on insert", func() {
+		event := &ShardedEvent{Name: "signup"}
+		_, err := cluster.Shard(3).Model(event).Insert()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.ShardID).To(Equal(int64(3)))
+
+		events := []ShardedEvent{{Name: "a"}, {Name: "b"}}
+		_, err = cluster.Shard(2).Model(&events).Insert()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events[0].ShardID).To(Equal(int64(2)))
+		Expect(events[1].ShardID).To(Equal(int64(2)))
+
+		queries := cluster.Queries(2)
+		Expect(queries).To(HaveLen(1))
+		Expect(queries[0]).To(Equal(
+			`INSERT INTO shard2.events ("name", "shard_id") VALUES ('a', 2), ('b', 2)`))
+	})
+
+	It("rejects rows inserted into another shard", func() {
+		event := &ShardedEvent{Name: "signup"}
+		_, err := cluster.Shard(3).ModelContext(context.Background(), event).Insert()
+		Expect(err).To(MatchError("sharding: row with shard_id 0 is inserted into shard 3"))
+		Expect(cluster.Queries(3)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("ShardFromContext", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("returns the shard in model hooks", func() {
+		event := &ShardAwareEvent{Name: "signup"}
+		_, err := cluster.Shard(3).Model(event).Insert()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.ShardID).To(Equal(sharding.ShardID(3)))
+	})
+
+	It("is propagated by WithShard", func() {
+		_, ok := sharding.ShardFromContext(context.Background())
+		Expect(ok).To(BeFalse())
+
+		shard := cluster.Shard(2)
+		event := &ShardAwareEvent{Name: "signup"}
+		_, err := shard.ModelContext(sharding.WithShard(context.Background(), shard), event).Insert()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.ShardID).To(Equal(sharding.ShardID(2)))
+
+		sharded := &ShardedEvent{Name: "signup"}
+		_, err = shard.ModelContext(sharding.WithShard(context.Background(), shard), sharded).Insert()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sharded.ShardID).To(Equal(int64(2)))
+	})
+})
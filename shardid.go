@@ -0,0 +1,65 @@
+package sharding
+
+import (
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ShardID is the id of a logical shard in the range [0, number of shards).
+// Methods that take a number, e.g. Shard, map any key to a shard using
+// modulo, so passing a user id where a shard id was expected goes
+// unnoticed. Methods that take a ShardID, e.g. ShardByID, make the intent
+// explicit and can reject ids out of the cluster range.
+type ShardID int64
+
+// Int64 returns the id as int64 for the methods that predate ShardID.
+func (id ShardID) Int64() int64 {
+	return int64(id)
+}
+
+// ShardIDOf returns the id of the shard returned by the cluster, e.g.
+// to the fn of ForEachShard. It returns false for other dbs.
+func ShardIDOf(shard *pg.DB) (ShardID, bool) {
+	id, ok := shard.Param("SHARD_ID").(int64)
+	return ShardID(id), ok
+}
+
+// ShardID returns the id of the shard the number maps to, i.e. of the shard
+// returned by Shard(number).
+func (cl *Cluster) ShardID(number int64) ShardID {
+	return ShardID(cl.shardID(number))
+}
+
+// SplitShardID returns the id of the shard embedded in the id, i.e. of the
+// shard returned by SplitShard(id).
+func (cl *Cluster) SplitShardID(id int64) ShardID {
+	_, shardID, _ := cl.gen.SplitID(id)
+	return ShardID(cl.wrapShardID(shardID))
+}
+
+// ShardByID returns the shard with the id. Ids out of the cluster range
+// wrap around unless WithStrictShardIDs is used.
+func (cl *Cluster) ShardByID(id ShardID) *pg.DB {
+	if cl.strictIDs {
+		cl.reportShardIDError(cl.checkShardIDRange(id))
+	}
+	return cl.shardByID(int64(id))
+}
+
+// ShardByIDE is like ShardByID, but returns an error wrapping
+// ErrShardIDOutOfRange when the id is out of the cluster range.
+func (cl *Cluster) ShardByIDE(id ShardID) (*pg.DB, error) {
+	if err := cl.checkShardIDRange(id); err != nil {
+		return nil, err
+	}
+	return cl.shardByID(int64(id)), nil
+}
+
+func (cl *Cluster) checkShardIDRange(id ShardID) error {
+	if id >= 0 && id < ShardID(cl.nshards) {
+		return nil
+	}
+	return fmt.Errorf("%w: got shard id %d, but the cluster has %d shards",
+		ErrShardIDOutOfRange, id, cl.nshards)
+}
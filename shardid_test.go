@@ -0,0 +1,50 @@
+package sharding_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestShardID(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	defer db.Close()
+
+	var reported []error
+	cl := sharding.NewCluster([]*pg.DB{db}, 4, sharding.WithStrictShardIDs(func(err error) {
+		reported = append(reported, err)
+	}))
+
+	if got := cl.ShardID(6); got != 2 {
+		t.Errorf("got shard id %d, wanted 2", got)
+	}
+	if got := cl.SplitShardID(sharding.DefaultIDGen.MakeID(time.Now(), 7, 0)); got != 3 {
+		t.Errorf("got shard id %d, wanted 3", got)
+	}
+
+	shard := cl.ShardByID(1)
+	if id, ok := sharding.ShardIDOf(shard); !ok || id != 1 {
+		t.Errorf("got (%d, %v), wanted shard id 1", id, ok)
+	}
+	if _, ok := sharding.ShardIDOf(db); ok {
+		t.Error("got shard id of a db")
+	}
+	if len(reported) != 0 {
+		t.Fatalf("got %v, wanted no errors", reported)
+	}
+
+	if _, err := cl.ShardByIDE(4); !errors.Is(err, sharding.ErrShardIDOutOfRange) {
+		t.Errorf("got %v, wanted ErrShardIDOutOfRange", err)
+	}
+	// The shard is still returned after the error is reported.
+	if got := shardID(cl.ShardByID(5)); got != 1 {
+		t.Errorf("got shard %d, wanted 1", got)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], sharding.ErrShardIDOutOfRange) {
+		t.Errorf("got %v, wanted ErrShardIDOutOfRange", reported)
+	}
+}
@@ -0,0 +1,137 @@
+package shardingtest
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+// ChaosOptions configures faults injected into queries on a shard.
+type ChaosOptions struct {
+	// ErrorRate is the probability in [0, 1] that a query fails with Error.
+	ErrorRate float64
+	// Error is the injected error. Default is 57P01 (admin_shutdown),
+	// which PostgreSQL sends when a server restarts.
+	Error *Error
+	// DropRate is the probability in [0, 1] that the connection is closed
+	// instead of responding to a query, like on a crash or a network
+	// failure. The query fails with an I/O error.
+	DropRate float64
+	// Latency is added to every query.
+	Latency time.Duration
+	// Jitter is the maximum random latency added on top of Latency.
+	Jitter time.Duration
+}
+
+// ChaosStats are faults injected into queries on a shard.
+type ChaosStats struct {
+	Errors  int
+	Drops   int
+	Delayed int
+}
+
+// ChaosCluster is a fake Cluster that injects faults configured with
+// SetChaos into queries, e.g. to test retries of the application against
+// failing shards. Queries that are not failed by the chaos get canned
+// results and simulated errors of the Cluster.
+type ChaosCluster struct {
+	*Cluster
+	chaos *chaos
+}
+
+// NewChaosCluster returns a fake cluster with nshards shards. Faults are
+// picked using a random source with the seed, so a test running queries
+// from a single goroutine gets the same faults on every run.
+func NewChaosCluster(nshards int, seed int64, opts ...sharding.Option) *ChaosCluster {
+	c := NewCluster(nshards, opts...)
+	c.chaos = &chaos{
+		rand:  rand.New(rand.NewSource(seed)),
+		opts:  make(map[int64]*ChaosOptions),
+		stats: make(map[int64]*ChaosStats),
+	}
+	return &ChaosCluster{
+		Cluster: c,
+		chaos:   c.chaos,
+	}
+}
+
+// SetChaos sets faults injected into queries on the shard or on every
+// shard with AllShards. Options of the shard take precedence over options
+// of AllShards. A nil opt stops injecting faults.
+func (c *ChaosCluster) SetChaos(shardID int64, opt *ChaosOptions) {
+	c.chaos.mu.Lock()
+	defer c.chaos.mu.Unlock()
+
+	if opt == nil {
+		delete(c.chaos.opts, shardID)
+	} else {
+		c.chaos.opts[shardID] = opt
+	}
+}
+
+// ChaosStats returns faults injected into queries on the shard.
+func (c *ChaosCluster) ChaosStats(shardID int64) ChaosStats {
+	c.chaos.mu.Lock()
+	defer c.chaos.mu.Unlock()
+
+	if stats, ok := c.chaos.stats[shardID]; ok {
+		return *stats
+	}
+	return ChaosStats{}
+}
+
+//------------------------------------------------------------------------------
+
+type chaos struct {
+	mu    sync.Mutex
+	rand  *rand.Rand
+	opts  map[int64]*ChaosOptions
+	stats map[int64]*ChaosStats
+}
+
+// inject returns the fault for the query on the shard.
+func (ch *chaos) inject(shardID int64) response {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	opt, ok := ch.opts[shardID]
+	if !ok {
+		opt, ok = ch.opts[AllShards]
+	}
+	if !ok {
+		return response{}
+	}
+
+	stats, ok := ch.stats[shardID]
+	if !ok {
+		stats = new(ChaosStats)
+		ch.stats[shardID] = stats
+	}
+
+	var resp response
+	resp.delay = opt.Latency
+	if opt.Jitter > 0 {
+		resp.delay += time.Duration(ch.rand.Int63n(int64(opt.Jitter)))
+	}
+	if resp.delay > 0 {
+		stats.Delayed++
+	}
+
+	switch p := ch.rand.Float64(); {
+	case p < opt.DropRate:
+		stats.Drops++
+		resp.drop = true
+	case p < opt.DropRate+opt.ErrorRate:
+		stats.Errors++
+		resp.err = opt.Error
+		if resp.err == nil {
+			resp.err = &Error{
+				Code:    "57P01",
+				Message: "shardingtest: terminating connection due to administrator command",
+			}
+		}
+	}
+	return resp
+}
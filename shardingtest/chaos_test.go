@@ -0,0 +1,103 @@
+package shardingtest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestChaosErrors(t *testing.T) {
+	cluster := shardingtest.NewChaosCluster(4, 1)
+	defer cluster.Close()
+
+	cluster.SetChaos(2, &shardingtest.ChaosOptions{ErrorRate: 1})
+
+	err := cluster.ForEachShard(func(shard *pg.DB) error {
+		_, err := shard.Exec(`SELECT 1`)
+		return err
+	})
+	pgErr, ok := err.(pg.Error)
+	if !ok {
+		t.Fatalf("got %T, wanted pg.Error", err)
+	}
+	if pgErr.Field('C') != "57P01" {
+		t.Fatalf("got code %q", pgErr.Field('C'))
+	}
+	if got := cluster.ChaosStats(2); got != (shardingtest.ChaosStats{Errors: 1}) {
+		t.Fatalf("got %+v", got)
+	}
+	if got := cluster.ChaosStats(1); got != (shardingtest.ChaosStats{}) {
+		t.Fatalf("got %+v, wanted no faults", got)
+	}
+}
+
+func TestChaosDrops(t *testing.T) {
+	cluster := shardingtest.NewChaosCluster(4, 1)
+	defer cluster.Close()
+
+	cluster.SetChaos(shardingtest.AllShards, &shardingtest.ChaosOptions{DropRate: 1})
+	_, err := cluster.Shard(1).Exec(`SELECT 1`)
+	if err == nil {
+		t.Fatal("got nil error for the dropped connection")
+	}
+	if _, ok := err.(pg.Error); ok {
+		t.Fatalf("got pg.Error %s, wanted an I/O error", err)
+	}
+	if got := cluster.ChaosStats(1).Drops; got != 1 {
+		t.Fatalf("got %d drops, wanted 1", got)
+	}
+
+	cluster.SetChaos(shardingtest.AllShards, nil)
+	if _, err := cluster.Shard(1).Exec(`SELECT 1`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	cluster := shardingtest.NewChaosCluster(4, 1)
+	defer cluster.Close()
+
+	cluster.SetChaos(0, &shardingtest.ChaosOptions{Latency: 20 * time.Millisecond})
+	start := time.Now()
+	if _, err := cluster.Shard(0).Exec(`SELECT 1`); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("got %s, wanted at least 20ms", d)
+	}
+	if got := cluster.ChaosStats(0).Delayed; got != 1 {
+		t.Fatalf("got %d delayed queries, wanted 1", got)
+	}
+}
+
+func TestChaosSeed(t *testing.T) {
+	failures := func() []bool {
+		cluster := shardingtest.NewChaosCluster(1, 42)
+		defer cluster.Close()
+
+		cluster.SetChaos(0, &shardingtest.ChaosOptions{ErrorRate: 0.5})
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			_, err := cluster.Shard(0).Exec(`SELECT 1`)
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first, second := failures(), failures()
+	var nfailed int
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("got different faults for the same seed: %v and %v", first, second)
+		}
+		if first[i] {
+			nfailed++
+		}
+	}
+	if nfailed == 0 || nfailed == len(first) {
+		t.Fatalf("got %d failed queries out of %d", nfailed, len(first))
+	}
+}
@@ -0,0 +1,222 @@
+// Package shardingtest provides a fake sharding.Cluster for unit tests that
+// need to assert routing decisions without a running PostgreSQL.
+package shardingtest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// AllShards can be used instead of a shard id to configure every shard.
+const AllShards = -1
+
+// Result is a canned query result returned by the fake cluster.
+type Result struct {
+	Columns []string
+	Rows    [][]interface{}
+	// Tag is the command tag, e.g. INSERT 0. Default is SELECT.
+	Tag string
+	// RowsAffected defaults to the number of rows.
+	RowsAffected int
+	// CopyData is sent to the client in response to COPY ... TO STDOUT.
+	CopyData string
+}
+
+// Error is a simulated PostgreSQL error. Queries fail with pg.Error
+// carrying the same SQLSTATE code and message.
+type Error struct {
+	// Code is the SQLSTATE code. Default is XX000 (internal_error).
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type cannedResult struct {
+	shardID int64
+	substr  string
+	res     *Result
+	err     *Error
+}
+
+// Cluster is a sharding.Cluster backed by in-memory fake PostgreSQL servers,
+// one server per shard. It records queries routed to each shard and returns
+// canned results or simulated errors.
+type Cluster struct {
+	*sharding.Cluster
+
+	mu      sync.Mutex
+	queries map[int64][]string
+	copied  map[int64][]byte
+	errors  map[int64]*Error
+	results []cannedResult
+	chaos   *chaos // set by NewChaosCluster
+}
+
+// NewCluster returns a fake cluster with nshards shards.
+func NewCluster(nshards int, opts ...sharding.Option) *Cluster {
+	c := &Cluster{
+		queries: make(map[int64][]string),
+		copied:  make(map[int64][]byte),
+		errors:  make(map[int64]*Error),
+	}
+
+	dbs := make([]*pg.DB, nshards)
+	srvs := make(map[*pg.DB]*server, nshards)
+	for i := range dbs {
+		srv := new(server)
+		dbs[i] = pg.Connect(&pg.Options{
+			Addr: fmt.Sprintf("shardingtest%d", i),
+			Dialer: func(context.Context, string, string) (net.Conn, error) {
+				return srv.dial(), nil
+			},
+			MaxRetries: 0,
+		})
+		srvs[dbs[i]] = srv
+	}
+
+	c.Cluster = sharding.NewCluster(dbs, nshards, opts...)
+	for db, srv := range srvs {
+		shardID := c.Cluster.Shards(db)[0].Param("SHARD_ID").(int64)
+		srv.handle = func(query string) response {
+			return c.handle(shardID, query)
+		}
+		srv.copied = func(data []byte) {
+			c.mu.Lock()
+			c.copied[shardID] = append(c.copied[shardID], data...)
+			c.mu.Unlock()
+		}
+	}
+
+	return c
+}
+
+func (c *Cluster) handle(shardID int64, query string) response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.queries[shardID] = append(c.queries[shardID], query)
+
+	var delay time.Duration
+	if c.chaos != nil {
+		fault := c.chaos.inject(shardID)
+		if fault.err != nil || fault.drop {
+			return fault
+		}
+		delay = fault.delay
+	}
+
+	resp := c.respond(shardID, query)
+	resp.delay = delay
+	return resp
+}
+
+// respond returns the simulated error or the canned result for the query.
+func (c *Cluster) respond(shardID int64, query string) response {
+	if err, ok := c.errors[shardID]; ok {
+		return response{err: err}
+	}
+	if err, ok := c.errors[AllShards]; ok {
+		return response{err: err}
+	}
+
+	for i := len(c.results) - 1; i >= 0; i-- {
+		r := &c.results[i]
+		if r.shardID != AllShards && r.shardID != shardID {
+			continue
+		}
+		if strings.Contains(query, r.substr) {
+			return response{res: r.res, err: r.err}
+		}
+	}
+	return response{}
+}
+
+// Queries returns formatted queries that were routed to the shard.
+func (c *Cluster) Queries(shardID int64) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.queries[shardID]...)
+}
+
+// Copied returns data received by the shard with COPY ... FROM STDIN.
+func (c *Cluster) Copied(shardID int64) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return string(c.copied[shardID])
+}
+
+// RoutedShards returns ids of the shards that received at least one query.
+func (c *Cluster) RoutedShards() []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ids []int64
+	for _, shard := range c.Cluster.Shards(nil) {
+		id := shard.Param("SHARD_ID").(int64)
+		if len(c.queries[id]) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// SetError makes queries on the shard fail with the err. A nil err
+// removes the simulated error.
+func (c *Cluster) SetError(shardID int64, err *Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		delete(c.errors, shardID)
+	} else {
+		c.errors[shardID] = err
+	}
+}
+
+// SetResult makes queries on the shard that contain the substr return
+// the res. Results and errors registered later take precedence.
+func (c *Cluster) SetResult(shardID int64, substr string, res *Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.results = append(c.results, cannedResult{
+		shardID: shardID,
+		substr:  substr,
+		res:     res,
+	})
+}
+
+// SetQueryError makes queries on the shard that contain the substr fail
+// with the err. Errors and results registered later take precedence.
+func (c *Cluster) SetQueryError(shardID int64, substr string, err *Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.results = append(c.results, cannedResult{
+		shardID: shardID,
+		substr:  substr,
+		err:     err,
+	})
+}
+
+// Reset forgets recorded queries and copied data, simulated errors, and canned results.
+func (c *Cluster) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.queries = make(map[int64][]string)
+	c.copied = make(map[int64][]byte)
+	c.errors = make(map[int64]*Error)
+	c.results = nil
+}
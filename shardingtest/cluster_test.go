@@ -0,0 +1,82 @@
+package shardingtest_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestClusterRecordsQueries(t *testing.T) {
+	cluster := shardingtest.NewCluster(4)
+	defer cluster.Close()
+
+	_, err := cluster.Shard(6).Exec(`DELETE FROM ?SHARD.users WHERE id = ?`, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := cluster.Queries(2)
+	wanted := []string{`DELETE FROM shard2.users WHERE id = 6`}
+	if !reflect.DeepEqual(got, wanted) {
+		t.Fatalf("got %q, wanted %q", got, wanted)
+	}
+	if ids := cluster.RoutedShards(); !reflect.DeepEqual(ids, []int64{2}) {
+		t.Fatalf("got %v, wanted [2]", ids)
+	}
+}
+
+func TestClusterCannedResults(t *testing.T) {
+	cluster := shardingtest.NewCluster(4)
+	defer cluster.Close()
+
+	cluster.SetResult(1, "users", &shardingtest.Result{
+		Columns: []string{"id", "name"},
+		Rows: [][]interface{}{
+			{int64(1), "alice"},
+			{int64(5), nil},
+		},
+	})
+
+	var users []struct {
+		ID   int64
+		Name string
+	}
+	res, err := cluster.Shard(1).Query(&users, `SELECT id, name FROM ?SHARD.users`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RowsReturned() != 2 {
+		t.Fatalf("got %d rows, wanted 2", res.RowsReturned())
+	}
+	if users[0].ID != 1 || users[0].Name != "alice" || users[1].ID != 5 || users[1].Name != "" {
+		t.Fatalf("got %+v", users)
+	}
+}
+
+func TestClusterErrors(t *testing.T) {
+	cluster := shardingtest.NewCluster(4)
+	defer cluster.Close()
+
+	cluster.SetError(3, &shardingtest.Error{
+		Code:    "57P01",
+		Message: "terminating connection",
+	})
+
+	err := cluster.ForEachShard(func(shard *pg.DB) error {
+		_, err := shard.Exec(`SELECT 1`)
+		return err
+	})
+	pgErr, ok := err.(pg.Error)
+	if !ok {
+		t.Fatalf("got %T, wanted pg.Error", err)
+	}
+	if pgErr.Field('C') != "57P01" {
+		t.Fatalf("got code %q", pgErr.Field('C'))
+	}
+	if len(cluster.Queries(0)) != 1 || len(cluster.Queries(3)) != 1 {
+		t.Fatalf("every shard must receive the query")
+	}
+}
@@ -0,0 +1,299 @@
+package shardingtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10/types"
+)
+
+const (
+	protocolVersion   = 196608
+	cancelRequestCode = 80877102
+	sslRequestCode    = 80877103
+)
+
+// response is what the fake server sends back for a query.
+type response struct {
+	err   *Error
+	res   *Result
+	delay time.Duration // before the response is sent
+	drop  bool          // close the connection instead of responding
+}
+
+// server is a minimal in-memory PostgreSQL server that speaks enough of the
+// simple query protocol for go-pg to run queries against it.
+type server struct {
+	handle func(query string) response
+	copied func(data []byte)
+}
+
+func (s *server) dial() net.Conn {
+	client, srv := net.Pipe()
+	go s.serve(srv)
+	return client
+}
+
+func (s *server) serve(cn net.Conn) {
+	defer cn.Close()
+
+	rd := bufio.NewReader(cn)
+	wr := bufio.NewWriter(cn)
+
+	if !s.startup(rd, wr) {
+		return
+	}
+
+	for {
+		typ, msg, err := readMessage(rd)
+		if err != nil {
+			return
+		}
+
+		switch typ {
+		case 'Q':
+			query := strings.TrimSuffix(string(msg), "\x00")
+			resp := s.handle(query)
+			if resp.delay > 0 {
+				time.Sleep(resp.delay)
+			}
+			if resp.drop {
+				return
+			}
+			switch {
+			case resp.err != nil:
+				s.writeError(wr, resp.err)
+			case isCopyFrom(query):
+				if !s.copyFrom(rd, wr) {
+					return
+				}
+			case isCopyTo(query):
+				s.copyTo(wr, resp.res)
+			default:
+				s.writeResponse(wr, resp)
+			}
+			writeMessage(wr, 'Z', []byte{'I'})
+		case 'S': // sync after extended query protocol messages
+			s.writeError(wr, &Error{
+				Code:    "0A000",
+				Message: "shardingtest: extended query protocol is not supported",
+			})
+			writeMessage(wr, 'Z', []byte{'I'})
+		case 'X':
+			return
+		default:
+			continue
+		}
+
+		if err := wr.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *server) startup(rd *bufio.Reader, wr *bufio.Writer) bool {
+	for {
+		msg, err := readStartupMessage(rd)
+		if err != nil || len(msg) < 4 {
+			return false
+		}
+
+		switch binary.BigEndian.Uint32(msg) {
+		case sslRequestCode:
+			if _, err := wr.Write([]byte{'N'}); err != nil {
+				return false
+			}
+			if err := wr.Flush(); err != nil {
+				return false
+			}
+		case protocolVersion:
+			writeMessage(wr, 'R', appendInt32(nil, 0))
+			writeMessage(wr, 'K', appendInt32(appendInt32(nil, 1), 1))
+			writeMessage(wr, 'Z', []byte{'I'})
+			return wr.Flush() == nil
+		default: // cancel request or unknown protocol
+			return false
+		}
+	}
+}
+
+func (s *server) copyFrom(rd *bufio.Reader, wr *bufio.Writer) bool {
+	writeMessage(wr, 'G', []byte{0, 0, 0})
+	if err := wr.Flush(); err != nil {
+		return false
+	}
+
+	var data []byte
+	for {
+		typ, msg, err := readMessage(rd)
+		if err != nil {
+			return false
+		}
+
+		switch typ {
+		case 'd':
+			data = append(data, msg...)
+		case 'c':
+			s.copied(data)
+			tag := "COPY " + strconv.Itoa(bytes.Count(data, []byte{'\n'}))
+			writeMessage(wr, 'C', append([]byte(tag), 0))
+			return true
+		case 'f':
+			s.writeError(wr, &Error{Code: "57014", Message: string(msg)})
+			return true
+		}
+	}
+}
+
+func (s *server) copyTo(wr *bufio.Writer, res *Result) {
+	var data string
+	if res != nil {
+		data = res.CopyData
+	}
+
+	writeMessage(wr, 'H', []byte{0, 0, 0})
+	if data != "" {
+		writeMessage(wr, 'd', []byte(data))
+	}
+	writeMessage(wr, 'c', nil)
+	tag := "COPY " + strconv.Itoa(strings.Count(data, "\n"))
+	writeMessage(wr, 'C', append([]byte(tag), 0))
+}
+
+func isCopyFrom(query string) bool {
+	query = strings.ToUpper(query)
+	return strings.HasPrefix(query, "COPY ") && strings.Contains(query, "FROM STDIN")
+}
+
+func isCopyTo(query string) bool {
+	query = strings.ToUpper(query)
+	return strings.HasPrefix(query, "COPY ") && strings.Contains(query, "TO STDOUT")
+}
+
+func (s *server) writeResponse(wr *bufio.Writer, resp response) {
+	if resp.err != nil {
+		s.writeError(wr, resp.err)
+		return
+	}
+
+	res := resp.res
+	if res == nil {
+		res = new(Result)
+	}
+
+	if len(res.Columns) > 0 {
+		b := appendInt16(nil, int16(len(res.Columns)))
+		for _, col := range res.Columns {
+			b = append(b, col...)
+			b = append(b, 0)
+			b = appendInt32(b, 0)  // table oid
+			b = appendInt16(b, 0)  // column attribute number
+			b = appendInt32(b, 25) // text type oid
+			b = appendInt16(b, -1) // type size
+			b = appendInt32(b, -1) // type modifier
+			b = appendInt16(b, 0)  // text format
+		}
+		writeMessage(wr, 'T', b)
+	}
+
+	for _, row := range res.Rows {
+		b := appendInt16(nil, int16(len(row)))
+		for _, v := range row {
+			if v == nil {
+				b = appendInt32(b, -1)
+				continue
+			}
+			value := appendValue(nil, v)
+			b = appendInt32(b, int32(len(value)))
+			b = append(b, value...)
+		}
+		writeMessage(wr, 'D', b)
+	}
+
+	tag := res.Tag
+	if tag == "" {
+		tag = "SELECT"
+	}
+	n := res.RowsAffected
+	if n == 0 {
+		n = len(res.Rows)
+	}
+	tag += " " + strconv.Itoa(n)
+	writeMessage(wr, 'C', append([]byte(tag), 0))
+}
+
+func (s *server) writeError(wr *bufio.Writer, e *Error) {
+	code := e.Code
+	if code == "" {
+		code = "XX000"
+	}
+
+	var b []byte
+	b = appendField(b, 'S', "ERROR")
+	b = appendField(b, 'C', code)
+	b = appendField(b, 'M', e.Message)
+	b = append(b, 0)
+	writeMessage(wr, 'E', b)
+}
+
+// appendValue appends v in the PostgreSQL text format.
+func appendValue(b []byte, v interface{}) []byte {
+	if v, ok := v.(bool); ok {
+		if v {
+			return append(b, 't')
+		}
+		return append(b, 'f')
+	}
+	return types.Append(b, v, 0)
+}
+
+func readStartupMessage(rd *bufio.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+		return nil, err
+	}
+	// The length includes itself.
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n < 4 {
+		return nil, fmt.Errorf("shardingtest: invalid message length %d", n)
+	}
+	msg := make([]byte, n-4)
+	_, err := io.ReadFull(rd, msg)
+	return msg, err
+}
+
+func readMessage(rd *bufio.Reader) (byte, []byte, error) {
+	typ, err := rd.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	msg, err := readStartupMessage(rd)
+	return typ, msg, err
+}
+
+func writeMessage(wr *bufio.Writer, typ byte, msg []byte) {
+	_ = wr.WriteByte(typ)
+	_, _ = wr.Write(appendInt32(nil, int32(len(msg)+4)))
+	_, _ = wr.Write(msg)
+}
+
+func appendField(b []byte, typ byte, s string) []byte {
+	b = append(b, typ)
+	b = append(b, s...)
+	return append(b, 0)
+}
+
+func appendInt16(b []byte, n int16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+func appendInt32(b []byte, n int32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
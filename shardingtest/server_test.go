@@ -0,0 +1,24 @@
+package shardingtest
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestReadStartupMessageInvalidLength(t *testing.T) {
+	for _, hdr := range [][]byte{
+		{0, 0, 0, 0},
+		{0, 0, 0, 3},
+	} {
+		_, err := readStartupMessage(bufio.NewReader(bytes.NewReader(hdr)))
+		if err == nil {
+			t.Fatalf("%v: got nil error", hdr)
+		}
+	}
+
+	msg, err := readStartupMessage(bufio.NewReader(bytes.NewReader([]byte{0, 0, 0, 5, 'x'})))
+	if err != nil || string(msg) != "x" {
+		t.Fatalf("got %q, %v", msg, err)
+	}
+}
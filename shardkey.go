@@ -0,0 +1,88 @@
+package sharding
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// KeyHash returns a stable hash of the composite key. The algorithm is
+// part of the public API and never changes: every part is encoded as
+//
+//   - integers of any size: 'i' followed by the value as big-endian int64,
+//   - strings, []byte, and UUIDs: 's' followed by the big-endian uint32
+//     length and the bytes,
+//   - booleans: 'b' followed by 0 or 1,
+//
+// and the concatenation of encoded parts is hashed using 64-bit FNV-1a.
+// It panics on parts of other types.
+func KeyHash(parts ...interface{}) uint64 {
+	h := fnv.New64a()
+	var b []byte
+	for _, part := range parts {
+		b = appendKeyPart(b[:0], part)
+		_, _ = h.Write(b)
+	}
+	return h.Sum64()
+}
+
+func appendKeyPart(b []byte, part interface{}) []byte {
+	switch v := part.(type) {
+	case int:
+		return appendKeyInt(b, int64(v))
+	case int8:
+		return appendKeyInt(b, int64(v))
+	case int16:
+		return appendKeyInt(b, int64(v))
+	case int32:
+		return appendKeyInt(b, int64(v))
+	case int64:
+		return appendKeyInt(b, v)
+	case uint:
+		return appendKeyInt(b, int64(v))
+	case uint8:
+		return appendKeyInt(b, int64(v))
+	case uint16:
+		return appendKeyInt(b, int64(v))
+	case uint32:
+		return appendKeyInt(b, int64(v))
+	case uint64:
+		return appendKeyInt(b, int64(v))
+	case string:
+		return appendKeyBytes(b, []byte(v))
+	case []byte:
+		return appendKeyBytes(b, v)
+	case UUID:
+		return appendKeyBytes(b, v[:])
+	case bool:
+		if v {
+			return append(b, 'b', 1)
+		}
+		return append(b, 'b', 0)
+	default:
+		panic(fmt.Sprintf("sharding: unsupported shard key part type %T", part))
+	}
+}
+
+func appendKeyInt(b []byte, n int64) []byte {
+	b = append(b, 'i')
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	return append(b, buf[:]...)
+}
+
+func appendKeyBytes(b, s []byte) []byte {
+	b = append(b, 's')
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(len(s)))
+	b = append(b, buf[:]...)
+	return append(b, s...)
+}
+
+// ShardKey maps the composite key, e.g. a tenant id and a region, to the
+// corresponding shard in the cluster using KeyHash.
+func (cl *Cluster) ShardKey(parts ...interface{}) *pg.DB {
+	return cl.route(parts, int64(KeyHash(parts...)))
+}
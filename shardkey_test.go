@@ -0,0 +1,44 @@
+package sharding_test
+
+import (
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestKeyHash(t *testing.T) {
+	// The hash is stable and must never change.
+	if got := sharding.KeyHash(int64(42), "eu"); got != sharding.KeyHash(42, []byte("eu")) {
+		t.Errorf("integer and string types must not change the hash")
+	}
+	if got, wanted := sharding.KeyHash(), uint64(0xcbf29ce484222325); got != wanted {
+		t.Errorf("got %x, wanted %x", got, wanted)
+	}
+	if sharding.KeyHash("ab", "c") == sharding.KeyHash("a", "bc") {
+		t.Errorf("parts must be length prefixed")
+	}
+	if sharding.KeyHash(1, true) == sharding.KeyHash(1, false) {
+		t.Errorf("booleans must change the hash")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for an unsupported type")
+		}
+	}()
+	sharding.KeyHash(1.5)
+}
+
+func TestShardKey(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	cluster := sharding.NewCluster([]*pg.DB{db}, 16)
+	defer cluster.Close()
+
+	shard := cluster.ShardKey(int64(42), "eu")
+	wanted := int64(sharding.KeyHash(int64(42), "eu") % 16)
+	if got := shard.Param("SHARD_ID").(int64); got != wanted {
+		t.Errorf("got shard %d, wanted %d", got, wanted)
+	}
+}
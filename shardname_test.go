@@ -0,0 +1,88 @@
+package sharding_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithShardNameFunc", func() {
+	var cluster *shardingtest.Cluster
+
+	nameFunc := func(id int64) string {
+		return fmt.Sprintf("app1_shard_%04d", id)
+	}
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2, sharding.WithShardNameFunc(nameFunc))
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("substitutes ?SHARD with the custom name", func() {
+		_, err := cluster.Shard(1).ExecContext(ctx, "SELECT * FROM ?SHARD.users")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Queries(1)).To(Equal([]string{"SELECT * FROM app1_shard_0001.users"}))
+
+		infos := cluster.ShardInfos()
+		Expect(infos[0].Schema).To(Equal("app1_shard_0000"))
+		Expect(infos[1].Schema).To(Equal("app1_shard_0001"))
+	})
+
+	It("names snapshots after the custom name", func() {
+		snap, err := cluster.Snapshot(ctx, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snap.Schema).To(HavePrefix("app1_shard_0001_snapshot_"))
+	})
+
+	It("notifies channels scoped to the custom name", func() {
+		Expect(cluster.Notify(ctx, 1, "events", "hello")).NotTo(HaveOccurred())
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"SELECT pg_notify('app1_shard_0001.events', 'hello')",
+		}))
+	})
+
+	It("names backup files after the custom name", func() {
+		dir, err := ioutil.TempDir("", "sharding-backup")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		manifest, err := cluster.Backup(ctx, &sharding.BackupOptions{
+			Tables: []string{"users"},
+			Create: cluster.BackupDir(dir),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, shard := range manifest.Shards {
+			name := filepath.Join(shard.Schema, "users.csv")
+			Expect(shard.Artifacts[0].Name).To(Equal(name))
+			Expect(filepath.Join(dir, name)).To(BeAnExistingFile())
+		}
+		Expect(manifest.Shards[1].Schema).To(Equal("app1_shard_0001"))
+	})
+
+	It("rejects duplicate names", func() {
+		db := pg.Connect(&pg.Options{Addr: "db1"})
+		defer db.Close()
+
+		_, err := sharding.NewClusterE(&sharding.ClusterOptions{
+			DBs:       []*pg.DB{db},
+			NumShards: 4,
+			Options: []sharding.Option{sharding.WithShardNameFunc(func(id int64) string {
+				return fmt.Sprintf("shard%d", id%2)
+			})},
+		})
+		Expect(err).To(MatchError(`sharding: shard name "shard0" is used by shards 0 and 2`))
+	})
+})
@@ -0,0 +1,85 @@
+package sharding
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ShardOptions are session settings applied to connections used by
+// shards, e.g. stricter limits for a maintenance job.
+type ShardOptions struct {
+	// StatementTimeout sets statement_timeout.
+	StatementTimeout time.Duration
+	// LockTimeout sets lock_timeout.
+	LockTimeout time.Duration
+	// IdleInTransactionTimeout sets idle_in_transaction_session_timeout.
+	IdleInTransactionTimeout time.Duration
+	// Params are custom settings, e.g. {"work_mem": "64MB"}.
+	Params map[string]string
+	// PoolSize is the size of the connection pool for every database
+	// server. Default is the pool size of the cluster dbs.
+	PoolSize int
+}
+
+// WithShardOptions returns a cluster with the same shards that uses
+// separate connection pools with the options applied to every connection.
+// Use Shard on the returned cluster to apply options to individual shards.
+// The returned cluster must be closed when it is no longer needed;
+// closing it does not affect the original cluster.
+func (cl *Cluster) WithShardOptions(opt *ShardOptions) *Cluster {
+	return cl.withDBs(func(db *pg.DB) *pg.DB {
+		dbOpt := *db.Options()
+		if opt.PoolSize > 0 {
+			dbOpt.PoolSize = opt.PoolSize
+		}
+
+		onConnect := dbOpt.OnConnect
+		dbOpt.OnConnect = func(ctx context.Context, cn *pg.Conn) error {
+			if onConnect != nil {
+				if err := onConnect(ctx, cn); err != nil {
+					return err
+				}
+			}
+			return opt.apply(ctx, cn)
+		}
+
+		return pg.Connect(&dbOpt)
+	})
+}
+
+func (opt *ShardOptions) apply(ctx context.Context, cn *pg.Conn) error {
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"statement_timeout", opt.StatementTimeout},
+		{"lock_timeout", opt.LockTimeout},
+		{"idle_in_transaction_session_timeout", opt.IdleInTransactionTimeout},
+	}
+	for _, t := range timeouts {
+		if t.value <= 0 {
+			continue
+		}
+		_, err := cn.ExecContext(ctx, "SET ? = ?",
+			pg.Ident(t.name), t.value.Milliseconds())
+		if err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(opt.Params))
+	for name := range opt.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, err := cn.ExecContext(ctx, "SET ? = ?", pg.Ident(name), opt.Params[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
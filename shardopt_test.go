@@ -0,0 +1,66 @@
+package sharding_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+)
+
+func TestWithShardOptions(t *testing.T) {
+	cluster := shardingtest.NewCluster(2)
+	defer cluster.Close()
+
+	maint := cluster.WithShardOptions(&sharding.ShardOptions{
+		StatementTimeout: 5 * time.Second,
+		Params:           map[string]string{"work_mem": "64MB"},
+	})
+
+	if _, err := maint.Shard(1).Exec("DELETE FROM ?SHARD.users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cluster.Shard(1).Exec("DELETE FROM ?SHARD.users"); err != nil {
+		t.Fatal(err)
+	}
+	if err := maint.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	wanted := []string{
+		`SET "statement_timeout" = 5000`,
+		`SET "work_mem" = '64MB'`,
+		"DELETE FROM shard1.users",
+		"DELETE FROM shard1.users",
+	}
+	if got := cluster.Queries(1); !reflect.DeepEqual(got, wanted) {
+		t.Fatalf("got %q, wanted %q", got, wanted)
+	}
+	if got := cluster.Queries(0); len(got) != 0 {
+		t.Fatalf("got %q, wanted no queries", got)
+	}
+}
+
+func TestWithShardOptionsKeepsRegistrations(t *testing.T) {
+	cluster := shardingtest.NewCluster(2)
+	defer cluster.Close()
+
+	cluster.SetCascade("account", &sharding.Cascade{
+		Tables: []sharding.CascadeTable{{Table: "accounts", Column: "id"}},
+	})
+	db := cluster.DBs()[0]
+	cluster.SetHealthy(db, false)
+
+	maint := cluster.WithShardOptions(&sharding.ShardOptions{
+		StatementTimeout: 5 * time.Second,
+	})
+	defer maint.Close()
+
+	if _, err := maint.CascadeDelete(ctx, "account", 1); err != nil {
+		t.Fatal(err)
+	}
+	if maint.Healthy(maint.DBs()[0]) {
+		t.Fatal("the db is healthy, wanted the health state to be carried over")
+	}
+}
@@ -0,0 +1,231 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLoadShed is returned when a query is rejected by the cluster
+// ShedPolicy to protect an overloaded shard.
+var ErrLoadShed = errors.New("sharding: query is shed due to overload")
+
+// Priority is the priority of queries used by ShedPolicy.
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context that makes queries executed with it
+// use the priority. Queries have PriorityNormal by default.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFromContext returns the priority set with WithPriority.
+func PriorityFromContext(ctx context.Context) Priority {
+	priority, _ := ctx.Value(priorityKey{}).(Priority)
+	return priority
+}
+
+// ShardLoad describes the load of a shard and the query that is
+// about to be executed on it.
+type ShardLoad struct {
+	ShardID  int64
+	Priority Priority
+	// Inflight is the number of queries running on the shard's server.
+	Inflight int64
+	// Latency is the moving average of query latency on the shard.
+	Latency time.Duration
+	// ErrorRate is the moving average of the fraction of failed queries.
+	ErrorRate float64
+	// ClusterLatency is the moving average of query latency on all shards.
+	ClusterLatency time.Duration
+}
+
+// ShedPolicy decides whether a query should be rejected with ErrLoadShed
+// before it is executed on the shard.
+type ShedPolicy interface {
+	Shed(load *ShardLoad) bool
+}
+
+// ShedPolicyFunc is an adapter to use ordinary functions as ShedPolicy.
+type ShedPolicyFunc func(load *ShardLoad) bool
+
+func (fn ShedPolicyFunc) Shed(load *ShardLoad) bool {
+	return fn(load)
+}
+
+// WithShedPolicy enables client-side load shedding using the policy.
+// The policy is consulted before every query executed on a shard. Shed
+// shards let a probe query through every second so their latency and
+// error rate keep being updated and shedding stops when they recover.
+func WithShedPolicy(policy ShedPolicy) Option {
+	return func(cl *Cluster) {
+		cl.shedPolicy = policy
+	}
+}
+
+// HotShardPolicy is a ShedPolicy that rejects low priority queries on the
+// hottest shards when the cluster latency or shard error rate exceeds
+// the SLO.
+type HotShardPolicy struct {
+	// LatencySLO is the max acceptable cluster latency.
+	LatencySLO time.Duration
+	// ErrorRateSLO is the max acceptable error rate of a shard.
+	// Zero disables the check.
+	ErrorRateSLO float64
+	// HotFactor is how much slower than the cluster a shard must be to be
+	// considered hot. Default is 1, i.e. shards slower than average.
+	HotFactor float64
+	// ShedBelow is the priority below which queries are shed.
+	// Default is PriorityNormal, i.e. only PriorityLow queries are shed.
+	ShedBelow Priority
+}
+
+var _ ShedPolicy = (*HotShardPolicy)(nil)
+
+func (p *HotShardPolicy) Shed(load *ShardLoad) bool {
+	if load.Priority >= p.ShedBelow {
+		return false
+	}
+
+	if p.ErrorRateSLO > 0 && load.ErrorRate > p.ErrorRateSLO {
+		return true
+	}
+
+	if p.LatencySLO <= 0 || load.ClusterLatency <= p.LatencySLO {
+		return false
+	}
+	hotFactor := p.HotFactor
+	if hotFactor == 0 {
+		hotFactor = 1
+	}
+	return float64(load.Latency) >= hotFactor*float64(load.ClusterLatency)
+}
+
+// ShedStats are load shedding decisions of the cluster.
+type ShedStats struct {
+	Allowed uint64
+	Shed    uint64
+	// ShedByShard is the number of shed queries per shard id.
+	ShedByShard map[int64]uint64
+}
+
+// ShedStats returns load shedding decisions made since the cluster
+// was created.
+func (cl *Cluster) ShedStats() ShedStats {
+	stats := ShedStats{
+		Allowed:     atomic.LoadUint64(&cl.shedAllowed),
+		ShedByShard: make(map[int64]uint64),
+	}
+	for i := range cl.stats {
+		if n := atomic.LoadUint64(&cl.stats[i].shed); n > 0 {
+			stats.Shed += n
+			stats.ShedByShard[int64(i)] = n
+		}
+	}
+	return stats
+}
+
+//------------------------------------------------------------------------------
+
+// statsDecay is the weight of a new observation in moving averages.
+const statsDecay = 0.1
+
+type ewma struct {
+	mu    sync.Mutex
+	value float64
+	init  bool
+}
+
+func (e *ewma) add(v float64) {
+	e.mu.Lock()
+	if e.init {
+		e.value += statsDecay * (v - e.value)
+	} else {
+		e.value = v
+		e.init = true
+	}
+	e.mu.Unlock()
+}
+
+func (e *ewma) get() float64 {
+	e.mu.Lock()
+	v := e.value
+	e.mu.Unlock()
+	return v
+}
+
+// shedProbeInterval is how often a shed shard lets a query through.
+const shedProbeInterval = time.Second
+
+// shardStats are query statistics of a shard.
+type shardStats struct {
+	// 64-bit counters go first to be aligned for atomic operations.
+	shed      uint64
+	queries   uint64
+	queryTime int64 // in nanoseconds
+	last      int64 // unix nanoseconds of the last query or probe
+
+	// Moving averages are only tracked with a ShedPolicy.
+	latency   ewma // in nanoseconds
+	errorRate ewma
+}
+
+func (cl *Cluster) observe(shardID int64, latency time.Duration, err error) {
+	stats := &cl.stats[shardID]
+	atomic.AddUint64(&stats.queries, 1)
+	atomic.AddInt64(&stats.queryTime, int64(latency))
+	for _, d := range cl.detectors.load() {
+		d.observe(shardID, latency, err)
+	}
+	if cl.shedPolicy == nil {
+		return
+	}
+
+	atomic.StoreInt64(&stats.last, cl.shedNow().UnixNano())
+	stats.latency.add(float64(latency))
+	cl.latency.add(float64(latency))
+	if err != nil {
+		stats.errorRate.add(1)
+	} else {
+		stats.errorRate.add(0)
+	}
+}
+
+func (cl *Cluster) shed(ctx context.Context, shardID int64, inflight int64) bool {
+	stats := &cl.stats[shardID]
+	load := &ShardLoad{
+		ShardID:        shardID,
+		Priority:       PriorityFromContext(ctx),
+		Inflight:       inflight,
+		Latency:        time.Duration(stats.latency.get()),
+		ErrorRate:      stats.errorRate.get(),
+		ClusterLatency: time.Duration(cl.latency.get()),
+	}
+	if cl.shedPolicy.Shed(load) && !stats.claimProbe(cl.shedNow()) {
+		atomic.AddUint64(&stats.shed, 1)
+		return true
+	}
+	atomic.AddUint64(&cl.shedAllowed, 1)
+	return false
+}
+
+// claimProbe reports whether the shard has not executed queries for
+// shedProbeInterval and records the probe so concurrent queries are
+// still shed.
+func (s *shardStats) claimProbe(now time.Time) bool {
+	last := atomic.LoadInt64(&s.last)
+	if now.UnixNano()-last < int64(shedProbeInterval) {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&s.last, last, now.UnixNano())
+}
@@ -0,0 +1,148 @@
+package sharding_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ShedPolicy", func() {
+	var cluster *shardingtest.Cluster
+	var loads []sharding.ShardLoad
+
+	BeforeEach(func() {
+		loads = nil
+		cluster = shardingtest.NewCluster(2, sharding.WithShedPolicy(
+			sharding.ShedPolicyFunc(func(load *sharding.ShardLoad) bool {
+				loads = append(loads, *load)
+				return load.ShardID == 1 && load.Priority < sharding.PriorityNormal
+			}),
+		))
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("rejects shed queries before they are sent", func() {
+		lowCtx := sharding.WithPriority(ctx, sharding.PriorityLow)
+
+		_, err := cluster.Shard(1).ExecContext(lowCtx, "SELECT 1")
+		Expect(errors.Is(err, sharding.ErrLoadShed)).To(BeTrue())
+		Expect(cluster.Queries(1)).To(BeEmpty())
+
+		_, err = cluster.Shard(0).ExecContext(lowCtx, "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cluster.Shard(1).ExecContext(ctx, "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(loads).To(HaveLen(3))
+		Expect(loads[0].Priority).To(Equal(sharding.PriorityLow))
+		Expect(loads[0].Inflight).To(Equal(int64(1)))
+		Expect(loads[2].Priority).To(Equal(sharding.PriorityNormal))
+
+		stats := cluster.ShedStats()
+		Expect(stats.Allowed).To(Equal(uint64(2)))
+		Expect(stats.Shed).To(Equal(uint64(1)))
+		Expect(stats.ShedByShard).To(Equal(map[int64]uint64{1: 1}))
+	})
+
+	It("tracks shard latency and errors", func() {
+		cluster.SetError(1, &shardingtest.Error{Message: "fake error"})
+		_, err := cluster.Shard(1).ExecContext(ctx, "SELECT 1")
+		Expect(err).To(HaveOccurred())
+
+		_, err = cluster.Shard(1).ExecContext(ctx, "SELECT 1")
+		Expect(err).To(HaveOccurred())
+
+		Expect(loads).To(HaveLen(2))
+		Expect(loads[1].ErrorRate).To(Equal(1.0))
+		Expect(loads[1].Latency).To(BeNumerically(">", 0))
+		Expect(loads[1].ClusterLatency).To(Equal(loads[1].Latency))
+	})
+})
+
+var _ = Describe("HotShardPolicy", func() {
+	It("stops shedding when the shard recovers", func() {
+		cluster := shardingtest.NewCluster(2, sharding.WithShedPolicy(&sharding.HotShardPolicy{
+			ErrorRateSLO: 0.5,
+		}))
+		defer cluster.Close()
+
+		now := time.Now()
+		sharding.SetShedNow(cluster.Cluster, func() time.Time { return now })
+		lowCtx := sharding.WithPriority(ctx, sharding.PriorityLow)
+
+		cluster.SetError(1, &shardingtest.Error{Message: "fake error"})
+		_, err := cluster.Shard(1).ExecContext(ctx, "SELECT 1")
+		Expect(err).To(HaveOccurred())
+		cluster.SetError(1, nil)
+
+		_, err = cluster.Shard(1).ExecContext(lowCtx, "SELECT 1")
+		Expect(errors.Is(err, sharding.ErrLoadShed)).To(BeTrue())
+
+		// Only low priority queries are sent to the shard, so the error
+		// rate is updated only by probes.
+		var probes int
+		for ; probes < 20; probes++ {
+			now = now.Add(time.Second)
+			_, err = cluster.Shard(1).ExecContext(lowCtx, "SELECT 1")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = cluster.Shard(1).ExecContext(lowCtx, "SELECT 1")
+			if err == nil {
+				break
+			}
+			Expect(errors.Is(err, sharding.ErrLoadShed)).To(BeTrue())
+		}
+		Expect(probes).To(BeNumerically("<", 20))
+	})
+})
+
+func TestHotShardPolicy(t *testing.T) {
+	policy := &sharding.HotShardPolicy{
+		LatencySLO:   100 * time.Millisecond,
+		ErrorRateSLO: 0.5,
+	}
+
+	tests := []struct {
+		load sharding.ShardLoad
+		shed bool
+	}{
+		{sharding.ShardLoad{
+			Priority:       sharding.PriorityLow,
+			Latency:        time.Second,
+			ClusterLatency: 50 * time.Millisecond,
+		}, false},
+		{sharding.ShardLoad{
+			Priority:       sharding.PriorityLow,
+			Latency:        300 * time.Millisecond,
+			ClusterLatency: 200 * time.Millisecond,
+		}, true},
+		{sharding.ShardLoad{
+			Priority:       sharding.PriorityLow,
+			Latency:        100 * time.Millisecond,
+			ClusterLatency: 200 * time.Millisecond,
+		}, false},
+		{sharding.ShardLoad{
+			Priority:       sharding.PriorityNormal,
+			Latency:        300 * time.Millisecond,
+			ClusterLatency: 200 * time.Millisecond,
+		}, false},
+		{sharding.ShardLoad{
+			Priority:  sharding.PriorityLow,
+			ErrorRate: 0.8,
+		}, true},
+	}
+	for i, test := range tests {
+		if got := policy.Shed(&test.load); got != test.shed {
+			t.Errorf("#%d: got %v, wanted %v", i, got, test.shed)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+const snapshotDateFormat = "20060102"
+
+// ShardSnapshot is a copy of the shard schema made at a point in time.
+type ShardSnapshot struct {
+	ShardID int64
+	// Schema is the name of the snapshot schema, e.g. shard3_snapshot_20200131.
+	Schema string
+	// Date is the snapshot date in UTC.
+	Date time.Time
+}
+
+// SnapshotSchema returns the name of the snapshot schema for the shard
+// created at the tm for clusters with default shard names.
+func SnapshotSchema(shardID int64, tm time.Time) string {
+	return snapshotSchema(shardName(shardID), tm)
+}
+
+func snapshotSchema(schema string, tm time.Time) string {
+	return snapshotPrefix(schema) + tm.UTC().Format(snapshotDateFormat)
+}
+
+func snapshotPrefix(schema string) string {
+	return schema + "_snapshot_"
+}
+
+func (cl *Cluster) parseSnapshotSchema(shardID int64, schema string) (ShardSnapshot, bool) {
+	prefix := snapshotPrefix(cl.shardName(shardID))
+	if !strings.HasPrefix(schema, prefix) {
+		return ShardSnapshot{}, false
+	}
+	date, err := time.Parse(snapshotDateFormat, schema[len(prefix):])
+	if err != nil {
+		return ShardSnapshot{}, false
+	}
+	return ShardSnapshot{
+		ShardID: shardID,
+		Schema:  schema,
+		Date:    date,
+	}, true
+}
+
+// Snapshot copies every table of the shard with the number into a new
+// schema named after the shard schema and the date, e.g.
+// shard3_snapshot_20200101. Tables are copied in a single
+// REPEATABLE READ transaction so the snapshot is consistent. Only one
+// snapshot per shard per day can be created.
+func (cl *Cluster) Snapshot(ctx context.Context, number int64) (*ShardSnapshot, error) {
+	shardID := cl.shardID(number)
+	shard := cl.Shard(number)
+	date := time.Now().UTC().Truncate(24 * time.Hour)
+	snap := &ShardSnapshot{
+		ShardID: shardID,
+		Schema:  snapshotSchema(cl.shardName(shardID), date),
+		Date:    date,
+	}
+
+	err := shard.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		_, err := tx.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+		if err != nil {
+			return err
+		}
+
+		var tables []string
+		_, err = tx.QueryContext(ctx, &tables, `
+			SELECT table_name FROM information_schema.tables
+			WHERE table_schema = '?SHARD' AND table_type = 'BASE TABLE'
+			ORDER BY table_name
+		`)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "CREATE SCHEMA ?", pg.Ident(snap.Schema)); err != nil {
+			return err
+		}
+		for _, table := range tables {
+			_, err := tx.ExecContext(ctx, "CREATE TABLE ?.? (LIKE ?SHARD.? INCLUDING ALL)",
+				pg.Ident(snap.Schema), pg.Ident(table), pg.Ident(table))
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, "INSERT INTO ?.? SELECT * FROM ?SHARD.?",
+				pg.Ident(snap.Schema), pg.Ident(table), pg.Ident(table))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	err = WrapShardError(shard, err)
+
+	auditErr := cl.audit(ctx, "snapshot_shard", map[string]interface{}{
+		"shard_id": shardID,
+		"schema":   snap.Schema,
+	}, err)
+	if err != nil {
+		return nil, err
+	}
+	if auditErr != nil {
+		return nil, auditErr
+	}
+	return snap, nil
+}
+
+// Snapshots returns snapshots of the shard with the number ordered
+// from oldest to newest.
+func (cl *Cluster) Snapshots(ctx context.Context, number int64) ([]ShardSnapshot, error) {
+	return cl.snapshotsByID(ctx, cl.shardID(number))
+}
+
+func (cl *Cluster) snapshotsByID(ctx context.Context, shardID int64) ([]ShardSnapshot, error) {
+	shard := cl.shardByID(shardID)
+	var schemas []string
+	_, err := shard.QueryContext(ctx, &schemas,
+		"SELECT nspname FROM pg_namespace WHERE nspname LIKE ?",
+		snapshotPrefix(cl.shardName(shardID))+"%")
+	if err != nil {
+		return nil, WrapShardError(shard, err)
+	}
+
+	snaps := make([]ShardSnapshot, 0, len(schemas))
+	for _, schema := range schemas {
+		if snap, ok := cl.parseSnapshotSchema(shardID, schema); ok {
+			snaps = append(snaps, snap)
+		}
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].Date.Before(snaps[j].Date)
+	})
+	return snaps, nil
+}
+
+// SnapshotShard returns the shard of the snapshot. Queries that use
+// ?SHARD (or ?shard) params are executed against the snapshot schema
+// instead of the live shard schema.
+func (cl *Cluster) SnapshotShard(snap *ShardSnapshot) *pg.DB {
+	return cl.shardByID(snap.ShardID).
+		WithParam("shard", pg.Safe(snap.Schema)).
+		WithParam("SHARD", pg.Safe(snap.Schema))
+}
+
+// DropSnapshot drops the snapshot schema with all its tables.
+func (cl *Cluster) DropSnapshot(ctx context.Context, snap *ShardSnapshot) error {
+	if _, ok := cl.parseSnapshotSchema(snap.ShardID, snap.Schema); !ok {
+		return errors.New("sharding: invalid snapshot schema: " + strconv.Quote(snap.Schema))
+	}
+	shard := cl.shardByID(snap.ShardID)
+	_, err := shard.ExecContext(ctx,
+		"DROP SCHEMA IF EXISTS ? CASCADE", pg.Ident(snap.Schema))
+	err = WrapShardError(shard, err)
+
+	auditErr := cl.audit(ctx, "drop_snapshot", map[string]interface{}{
+		"shard_id": snap.ShardID,
+		"schema":   snap.Schema,
+	}, err)
+	if err != nil {
+		return err
+	}
+	return auditErr
+}
+
+// DropSnapshotsBefore drops snapshots of every shard made before the tm
+// and returns the dropped snapshots.
+func (cl *Cluster) DropSnapshotsBefore(ctx context.Context, tm time.Time) ([]ShardSnapshot, error) {
+	var dropped []ShardSnapshot
+	for shardID := int64(0); shardID < int64(cl.nshards); shardID++ {
+		snaps, err := cl.snapshotsByID(ctx, shardID)
+		if err != nil {
+			return dropped, err
+		}
+		for i := range snaps {
+			if !snaps[i].Date.Before(tm) {
+				continue
+			}
+			if err := cl.DropSnapshot(ctx, &snaps[i]); err != nil {
+				return dropped, err
+			}
+			dropped = append(dropped, snaps[i])
+		}
+	}
+	return dropped, nil
+}
@@ -0,0 +1,87 @@
+package sharding_test
+
+import (
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("copies shard tables", func() {
+		cluster.SetResult(1, "information_schema", &shardingtest.Result{
+			Columns: []string{"table_name"},
+			Rows:    [][]interface{}{{"users"}},
+		})
+
+		snap, err := cluster.Snapshot(ctx, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snap.ShardID).To(Equal(int64(1)))
+		Expect(snap.Schema).To(Equal(sharding.SnapshotSchema(1, time.Now())))
+
+		queries := cluster.Queries(1)
+		Expect(queries).To(HaveLen(7))
+		Expect(queries[3]).To(Equal(`CREATE SCHEMA "` + snap.Schema + `"`))
+		Expect(queries[4]).To(Equal(`CREATE TABLE "` + snap.Schema + `"."users" (LIKE shard1."users" INCLUDING ALL)`))
+		Expect(queries[5]).To(Equal(`INSERT INTO "` + snap.Schema + `"."users" SELECT * FROM shard1."users"`))
+		Expect(queries[6]).To(Equal("COMMIT"))
+	})
+
+	It("lists, queries, and drops snapshots", func() {
+		cluster.SetResult(1, "pg_namespace", &shardingtest.Result{
+			Columns: []string{"nspname"},
+			Rows: [][]interface{}{
+				{"shard1_snapshot_20200301"},
+				{"shard1_snapshot_20200101"},
+				{"shard1_snapshot_backup"},
+			},
+		})
+
+		snaps, err := cluster.Snapshots(ctx, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snaps).To(HaveLen(2))
+		Expect(snaps[0].Schema).To(Equal("shard1_snapshot_20200101"))
+		Expect(snaps[1].Schema).To(Equal("shard1_snapshot_20200301"))
+
+		_, err = cluster.SnapshotShard(&snaps[0]).ExecContext(ctx, "DELETE FROM ?SHARD.users")
+		Expect(err).NotTo(HaveOccurred())
+
+		dropped, err := cluster.DropSnapshotsBefore(ctx, time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dropped).To(Equal(snaps[:1]))
+
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"SELECT nspname FROM pg_namespace WHERE nspname LIKE 'shard1_snapshot_%'",
+			"DELETE FROM shard1_snapshot_20200101.users",
+			"SELECT nspname FROM pg_namespace WHERE nspname LIKE 'shard1_snapshot_%'",
+			`DROP SCHEMA IF EXISTS "shard1_snapshot_20200101" CASCADE`,
+		}))
+	})
+
+	It("drops snapshots of every shard once with key scrambling", func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+		cluster = shardingtest.NewCluster(2, sharding.WithKeyScrambling())
+
+		_, err := cluster.DropSnapshotsBefore(ctx, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Queries(0)).To(Equal([]string{
+			"SELECT nspname FROM pg_namespace WHERE nspname LIKE 'shard0_snapshot_%'",
+		}))
+		Expect(cluster.Queries(1)).To(Equal([]string{
+			"SELECT nspname FROM pg_namespace WHERE nspname LIKE 'shard1_snapshot_%'",
+		}))
+	})
+})
@@ -0,0 +1,94 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrShardUnavailable is returned by GetOrStale when the shard server
+// is down and there is no cached value.
+var ErrShardUnavailable = errors.New("sharding: shard is unavailable and there is no cached value")
+
+// StaleCache is an LRU cache of the last values read from shards
+// used by GetOrStale. It is safe for concurrent use.
+type StaleCache struct {
+	lru *lruCache
+}
+
+// NewStaleCache returns a cache that holds up to maxEntries values.
+func NewStaleCache(maxEntries int) *StaleCache {
+	return &StaleCache{
+		lru: newLRUCache(maxEntries),
+	}
+}
+
+// Delete removes the key from the cache.
+func (c *StaleCache) Delete(key string) {
+	c.lru.delete(key)
+}
+
+// StaleValue is a value returned by GetOrStale.
+type StaleValue struct {
+	Value interface{}
+	// Stale is true when the value is returned from the cache because
+	// the shard is unavailable.
+	Stale bool
+	// Age is the time passed since the value was read from the shard.
+	Age time.Duration
+	// Err is the error that caused the stale value to be returned, if any.
+	Err error
+}
+
+// GetOrStale reads a value with the fn from the shard with the number
+// and caches it under the key. When the shard server is marked unhealthy
+// (see SetHealthy and MonitorHealth) or the read fails with a network
+// error, the last cached value is returned tagged as stale instead.
+func (cl *Cluster) GetOrStale(
+	ctx context.Context,
+	cache *StaleCache,
+	number int64,
+	key string,
+	fn func(ctx context.Context, shard *pg.DB) (interface{}, error),
+) (*StaleValue, error) {
+	_, db := cl.DB(number)
+	if !cl.Healthy(db) {
+		return staleValue(cache, key, ErrShardUnavailable)
+	}
+
+	value, err := fn(ctx, cl.Shard(number))
+	if err != nil {
+		if !isNetworkError(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		return staleValue(cache, key, err)
+	}
+
+	cache.lru.set(key, value, time.Now(), 0)
+	return &StaleValue{Value: value}, nil
+}
+
+func isNetworkError(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func staleValue(cache *StaleCache, key string, err error) (*StaleValue, error) {
+	entry, ok := cache.lru.get(key, time.Now())
+	if !ok {
+		return nil, err
+	}
+	return &StaleValue{
+		Value: entry.value,
+		Stale: true,
+		Age:   time.Since(entry.time),
+		Err:   err,
+	}, nil
+}
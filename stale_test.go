@@ -0,0 +1,66 @@
+package sharding_test
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetOrStale", func() {
+	var cluster *shardingtest.Cluster
+	var cache *sharding.StaleCache
+
+	get := func(ctx context.Context, shard *pg.DB) (interface{}, error) {
+		var name string
+		_, err := shard.QueryOneContext(ctx, pg.Scan(&name), "SELECT name FROM ?SHARD.users")
+		return name, err
+	}
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		cache = sharding.NewStaleCache(10)
+		cluster.SetResult(1, "users", &shardingtest.Result{
+			Columns: []string{"name"},
+			Rows:    [][]interface{}{{"alice"}},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("returns cached values when the shard is down", func() {
+		v, err := cluster.GetOrStale(ctx, cache, 1, "user:1", get)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v.Value).To(Equal("alice"))
+		Expect(v.Stale).To(BeFalse())
+
+		_, db := cluster.DB(1)
+		cluster.SetHealthy(db, false)
+
+		v, err = cluster.GetOrStale(ctx, cache, 1, "user:1", get)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v.Value).To(Equal("alice"))
+		Expect(v.Stale).To(BeTrue())
+		Expect(v.Err).To(Equal(sharding.ErrShardUnavailable))
+		Expect(len(cluster.Queries(1))).To(Equal(1))
+
+		_, err = cluster.GetOrStale(ctx, cache, 1, "user:2", get)
+		Expect(err).To(Equal(sharding.ErrShardUnavailable))
+	})
+
+	It("does not hide query errors", func() {
+		_, err := cluster.GetOrStale(ctx, cache, 1, "user:1", get)
+		Expect(err).NotTo(HaveOccurred())
+
+		cluster.SetQueryError(1, "users", &shardingtest.Error{Message: "syntax error"})
+		_, err = cluster.GetOrStale(ctx, cache, 1, "user:1", get)
+		Expect(err).To(MatchError("ERROR #XX000 syntax error"))
+	})
+})
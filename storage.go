@@ -0,0 +1,236 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// StorageSettings are storage parameters of a table.
+type StorageSettings struct {
+	// Params are storage parameters set with ALTER TABLE ... SET, e.g.
+	// fillfactor or autovacuum_vacuum_scale_factor. TOAST parameters
+	// use the toast. prefix, e.g. toast.autovacuum_enabled.
+	Params map[string]string
+	// StatisticsTargets maps column names to statistics targets set with
+	// ALTER TABLE ... ALTER COLUMN ... SET STATISTICS.
+	StatisticsTargets map[string]int
+}
+
+// StorageDrift describes a storage setting that differs from the wanted one.
+type StorageDrift struct {
+	ShardID int64
+	// Setting is the storage parameter or "statistics:column" for
+	// statistics targets.
+	Setting string
+	Wanted  string
+	// Got is empty when the setting is not set.
+	Got string
+}
+
+// StorageDriftError is returned by ApplyStorageSettings when settings
+// don't match after they were applied.
+type StorageDriftError struct {
+	Drift []StorageDrift
+}
+
+func (e *StorageDriftError) Error() string {
+	d := &e.Drift[0]
+	return fmt.Sprintf("sharding: storage settings drift in %d places, e.g. shard %d %s=%q (wanted %q)",
+		len(e.Drift), d.ShardID, d.Setting, d.Got, d.Wanted)
+}
+
+// ApplyStorageSettings applies the settings to the table, e.g. "users",
+// in every shard and verifies that they were applied. It returns
+// *StorageDriftError if settings don't match after applying.
+func (cl *Cluster) ApplyStorageSettings(ctx context.Context, table string, settings *StorageSettings) error {
+	query, params := alterStorageQuery(table, settings)
+	if query == "" {
+		return nil
+	}
+
+	var mu sync.Mutex
+	var drift []StorageDrift
+	err := cl.ForEachShard(func(shard *pg.DB) error {
+		if _, err := shard.ExecContext(ctx, query, params...); err != nil {
+			return WrapShardError(shard, err)
+		}
+
+		d, err := storageDrift(ctx, shard, table, settings)
+		if err != nil {
+			return WrapShardError(shard, err)
+		}
+
+		mu.Lock()
+		drift = append(drift, d...)
+		mu.Unlock()
+		return nil
+	})
+	if err == nil && len(drift) > 0 {
+		sortStorageDrift(drift)
+		err = &StorageDriftError{Drift: drift}
+	}
+
+	auditErr := cl.audit(ctx, "apply_storage_settings", map[string]interface{}{
+		"table":              table,
+		"params":             settings.Params,
+		"statistics_targets": settings.StatisticsTargets,
+	}, err)
+	if err != nil {
+		return err
+	}
+	return auditErr
+}
+
+// StorageDrift returns storage settings of the table in every shard
+// that differ from the settings.
+func (cl *Cluster) StorageDrift(ctx context.Context, table string, settings *StorageSettings) ([]StorageDrift, error) {
+	var mu sync.Mutex
+	var drift []StorageDrift
+	err := cl.ForEachShard(func(shard *pg.DB) error {
+		d, err := storageDrift(ctx, shard, table, settings)
+		if err != nil {
+			return WrapShardError(shard, err)
+		}
+
+		mu.Lock()
+		drift = append(drift, d...)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortStorageDrift(drift)
+	return drift, nil
+}
+
+func alterStorageQuery(table string, settings *StorageSettings) (string, []interface{}) {
+	var actions []string
+	params := []interface{}{pg.Ident(table)}
+
+	if len(settings.Params) > 0 {
+		var b []string
+		for _, name := range sortedKeys(settings.Params) {
+			b = append(b, "? = ?")
+			params = append(params, pg.Ident(name), settings.Params[name])
+		}
+		actions = append(actions, "SET ("+strings.Join(b, ", ")+")")
+	}
+
+	columns := make([]string, 0, len(settings.StatisticsTargets))
+	for column := range settings.StatisticsTargets {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		actions = append(actions, "ALTER COLUMN ? SET STATISTICS ?")
+		params = append(params, pg.Ident(column), settings.StatisticsTargets[column])
+	}
+
+	if len(actions) == 0 {
+		return "", nil
+	}
+	return "ALTER TABLE ?SHARD.? " + strings.Join(actions, ", "), params
+}
+
+func storageDrift(ctx context.Context, shard *pg.DB, table string, settings *StorageSettings) ([]StorageDrift, error) {
+	shardID := shard.Param("SHARD_ID").(int64)
+	var drift []StorageDrift
+
+	if len(settings.Params) > 0 {
+		var relOptions, toastOptions []string
+		_, err := shard.QueryOneContext(ctx, pg.Scan(pg.Array(&relOptions), pg.Array(&toastOptions)), `
+			SELECT c.reloptions, t.reloptions
+			FROM pg_class c
+			LEFT JOIN pg_class t ON t.oid = c.reltoastrelid
+			WHERE c.oid = '?SHARD.?'::regclass
+		`, pg.Ident(table))
+		if err != nil {
+			return nil, err
+		}
+
+		got := parseRelOptions(relOptions, "")
+		for k, v := range parseRelOptions(toastOptions, "toast.") {
+			got[k] = v
+		}
+		for _, name := range sortedKeys(settings.Params) {
+			wanted := settings.Params[name]
+			if got[name] != wanted {
+				drift = append(drift, StorageDrift{
+					ShardID: shardID,
+					Setting: name,
+					Wanted:  wanted,
+					Got:     got[name],
+				})
+			}
+		}
+	}
+
+	if len(settings.StatisticsTargets) > 0 {
+		var columns []struct {
+			Attname       string
+			Attstattarget int
+		}
+		_, err := shard.QueryContext(ctx, &columns, `
+			SELECT attname, attstattarget
+			FROM pg_attribute
+			WHERE attrelid = '?SHARD.?'::regclass AND attnum > 0 AND NOT attisdropped
+		`, pg.Ident(table))
+		if err != nil {
+			return nil, err
+		}
+
+		got := make(map[string]string, len(columns))
+		for _, c := range columns {
+			got[c.Attname] = strconv.Itoa(c.Attstattarget)
+		}
+		for column, target := range settings.StatisticsTargets {
+			wanted := strconv.Itoa(target)
+			if got[column] != wanted {
+				drift = append(drift, StorageDrift{
+					ShardID: shardID,
+					Setting: "statistics:" + column,
+					Wanted:  wanted,
+					Got:     got[column],
+				})
+			}
+		}
+	}
+
+	return drift, nil
+}
+
+func parseRelOptions(options []string, prefix string) map[string]string {
+	m := make(map[string]string, len(options))
+	for _, opt := range options {
+		if ind := strings.IndexByte(opt, '='); ind >= 0 {
+			m[prefix+opt[:ind]] = opt[ind+1:]
+		}
+	}
+	return m
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortStorageDrift(drift []StorageDrift) {
+	sort.Slice(drift, func(i, j int) bool {
+		if drift[i].ShardID != drift[j].ShardID {
+			return drift[i].ShardID < drift[j].ShardID
+		}
+		return drift[i].Setting < drift[j].Setting
+	})
+}
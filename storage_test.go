@@ -0,0 +1,66 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ApplyStorageSettings", func() {
+	var cluster *shardingtest.Cluster
+	var settings *sharding.StorageSettings
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(2)
+		settings = &sharding.StorageSettings{
+			Params: map[string]string{
+				"fillfactor":               "70",
+				"toast.autovacuum_enabled": "false",
+			},
+			StatisticsTargets: map[string]int{"name": 500},
+		}
+
+		cluster.SetResult(shardingtest.AllShards, "pg_class", &shardingtest.Result{
+			Columns: []string{"reloptions", "reloptions"},
+			Rows:    [][]interface{}{{"{fillfactor=70}", "{autovacuum_enabled=false}"}},
+		})
+		cluster.SetResult(shardingtest.AllShards, "pg_attribute", &shardingtest.Result{
+			Columns: []string{"attname", "attstattarget"},
+			Rows:    [][]interface{}{{"id", -1}, {"name", 500}},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("applies and verifies settings in every shard", func() {
+		err := cluster.ApplyStorageSettings(ctx, "users", settings)
+		Expect(err).NotTo(HaveOccurred())
+
+		queries := cluster.Queries(1)
+		Expect(queries).To(HaveLen(3))
+		Expect(queries[0]).To(Equal(`ALTER TABLE shard1."users" SET ("fillfactor" = '70', ` +
+			`"toast"."autovacuum_enabled" = 'false'), ALTER COLUMN "name" SET STATISTICS 500`))
+	})
+
+	It("detects drift", func() {
+		cluster.SetResult(1, "pg_class", &shardingtest.Result{
+			Columns: []string{"reloptions", "reloptions"},
+			Rows:    [][]interface{}{{"{fillfactor=100}", nil}},
+		})
+
+		drift, err := cluster.StorageDrift(ctx, "users", settings)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drift).To(Equal([]sharding.StorageDrift{
+			{ShardID: 1, Setting: "fillfactor", Wanted: "70", Got: "100"},
+			{ShardID: 1, Setting: "toast.autovacuum_enabled", Wanted: "false"},
+		}))
+
+		err = cluster.ApplyStorageSettings(ctx, "users", settings)
+		Expect(err).To(BeAssignableToTypeOf(&sharding.StorageDriftError{}))
+		Expect(err.(*sharding.StorageDriftError).Drift).To(Equal(drift))
+	})
+})
@@ -0,0 +1,76 @@
+package sharding
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrShardIDOutOfRange is returned when an id or a UUID embeds a shard id
+// that is not less than the number of shards in the cluster, which usually
+// means that it was generated with a misconfigured IDGen.
+var ErrShardIDOutOfRange = errors.New("sharding: shard id is out of range")
+
+// WithStrictShardIDs makes SplitShard, ShardByUUID, ShardByID, and
+// ShardResolver report ids and UUIDs with shard ids out of the cluster
+// range instead of silently wrapping them using modulo. The onError is
+// called with an error wrapping ErrShardIDOutOfRange before the shard
+// is returned; nil onError panics with the error.
+func WithStrictShardIDs(onError func(err error)) Option {
+	return func(cl *Cluster) {
+		cl.strictIDs = true
+		cl.onShardIDError = onError
+	}
+}
+
+// SplitShardE is like SplitShard, but returns an error wrapping
+// ErrShardIDOutOfRange when the shard id embedded in the id is out of
+// the cluster range.
+func (cl *Cluster) SplitShardE(id int64) (*pg.DB, error) {
+	_, shardID, _ := cl.gen.SplitID(id)
+	if err := cl.checkShardID("id", id, shardID); err != nil {
+		return nil, err
+	}
+	return cl.route(id, shardID), nil
+}
+
+// ShardByUUIDE is like ShardByUUID, but returns an error wrapping
+// ErrShardIDOutOfRange when the shard id embedded in the uuid is out of
+// the cluster range.
+func (cl *Cluster) ShardByUUIDE(u UUID) (*pg.DB, error) {
+	shardID := u.ShardID()
+	if err := cl.checkShardID("uuid", u, shardID); err != nil {
+		return nil, err
+	}
+	return cl.route(u, shardID), nil
+}
+
+func (cl *Cluster) checkShardID(kind string, key interface{}, shardID int64) error {
+	if shardID >= 0 && shardID < int64(cl.nshards) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %v has shard id %d, but the cluster has %d shards",
+		ErrShardIDOutOfRange, kind, key, shardID, cl.nshards)
+}
+
+// strictShardID reports the shard id out of the cluster range when
+// the cluster uses WithStrictShardIDs.
+func (cl *Cluster) strictShardID(kind string, key interface{}, shardID int64) {
+	if !cl.strictIDs {
+		return
+	}
+	cl.reportShardIDError(cl.checkShardID(kind, key, shardID))
+}
+
+// reportShardIDError calls the WithStrictShardIDs error handler
+// with the err if it is not nil.
+func (cl *Cluster) reportShardIDError(err error) {
+	if err == nil {
+		return
+	}
+	if cl.onShardIDError == nil {
+		panic(err)
+	}
+	cl.onShardIDError(err)
+}
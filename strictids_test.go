@@ -0,0 +1,52 @@
+package sharding_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestStrictShardIDs(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	defer db.Close()
+
+	var reported []error
+	cl := sharding.NewCluster([]*pg.DB{db}, 4, sharding.WithStrictShardIDs(func(err error) {
+		reported = append(reported, err)
+	}))
+
+	tm := time.Now()
+	id := sharding.DefaultIDGen.MakeID(tm, 6, 0)
+
+	if _, err := cl.SplitShardE(id); !errors.Is(err, sharding.ErrShardIDOutOfRange) {
+		t.Errorf("got %v, wanted ErrShardIDOutOfRange", err)
+	}
+	if _, err := cl.ShardByUUIDE(sharding.NewUUID(6, tm)); !errors.Is(err, sharding.ErrShardIDOutOfRange) {
+		t.Errorf("got %v, wanted ErrShardIDOutOfRange", err)
+	}
+
+	if shard, err := cl.SplitShardE(sharding.DefaultIDGen.MakeID(tm, 3, 0)); err != nil || shardID(shard) != 3 {
+		t.Errorf("got (%v, %v), wanted shard 3", shard, err)
+	}
+
+	// The shard is still returned after the error is reported.
+	if got := shardID(cl.SplitShard(id)); got != 2 {
+		t.Errorf("got shard %d, wanted 2", got)
+	}
+	cl.ShardByUUID(sharding.NewUUID(7, tm))
+	if len(reported) != 2 || !errors.Is(reported[0], sharding.ErrShardIDOutOfRange) {
+		t.Errorf("got %v, wanted 2 ErrShardIDOutOfRange errors", reported)
+	}
+
+	strict := sharding.NewCluster([]*pg.DB{db}, 4, sharding.WithStrictShardIDs(nil))
+	defer func() {
+		if v := recover(); v == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	strict.SplitShard(id)
+}
@@ -0,0 +1,296 @@
+package sharding
+
+import (
+	"strings"
+)
+
+// TableCheck controls how queries that reference tables without
+// a schema are handled.
+//
+// There is no mode that rewrites such queries: go-pg formats the query
+// and writes it to the wire buffer before query hooks run, so a hook
+// can inspect the formatted query but can't change what is sent to
+// the server. Use TableCheckError to catch unqualified tables, e.g.
+// in tests and staging, and QualifyTables to rewrite query strings
+// before passing them to the shard.
+type TableCheck int
+
+const (
+	// TableCheckOff does not inspect queries.
+	TableCheckOff TableCheck = iota
+	// TableCheckError makes queries that reference unqualified tables
+	// fail with *UnqualifiedTableError before they are sent to the server.
+	TableCheckError
+)
+
+// WithTableCheck enables inspection of formatted queries for references
+// to tables without a schema, e.g. users instead of ?SHARD.users, that
+// silently hit the public schema. See TableCheck for why queries are
+// rejected rather than rewritten.
+func WithTableCheck(check TableCheck) Option {
+	return func(cl *Cluster) {
+		cl.tableCheck = check
+	}
+}
+
+// UnqualifiedTableError is returned when a query references tables
+// without a schema and TableCheckError is enabled.
+type UnqualifiedTableError struct {
+	ShardID int64
+	Tables  []string
+}
+
+func (e *UnqualifiedTableError) Error() string {
+	return "sharding: query references tables without schema: " + strings.Join(e.Tables, ", ")
+}
+
+// QualifyTables prefixes table references without a schema in the query
+// with the schema, e.g. QualifyTables(q, "?SHARD"). It is the rewriting
+// counterpart of TableCheckError and must be applied to the query
+// before it is executed:
+//
+//	shard.Exec(sharding.QualifyTables("SELECT * FROM users", "?SHARD"))
+func QualifyTables(query, schema string) string {
+	refs := unqualifiedTables(query)
+	if len(refs) == 0 {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + len(refs)*(len(schema)+1))
+	var pos int
+	for _, ref := range refs {
+		b.WriteString(query[pos:ref.pos])
+		b.WriteString(schema)
+		b.WriteByte('.')
+		pos = ref.pos
+	}
+	b.WriteString(query[pos:])
+	return b.String()
+}
+
+type tableRef struct {
+	name string
+	pos  int
+}
+
+type sqlToken struct {
+	s   string
+	pos int
+}
+
+func (t sqlToken) is(keyword string) bool {
+	return strings.EqualFold(t.s, keyword)
+}
+
+// unqualifiedTables returns table references without a schema. It
+// understands common DML and DDL but is not a full SQL parser.
+func unqualifiedTables(query string) []tableRef {
+	toks := tokenizeSQL(query)
+
+	ctes := make(map[string]struct{})
+	for i := 0; i+2 < len(toks); i++ {
+		if toks[i+1].is("AS") && (toks[i+2].s == "(" ||
+			(i+3 < len(toks) && toks[i+3].s == "(" && toks[i+2].is("MATERIALIZED"))) {
+			if i > 0 && (toks[i-1].is("WITH") || toks[i-1].is("RECURSIVE") || toks[i-1].s == ",") {
+				ctes[strings.ToLower(toks[i].s)] = struct{}{}
+			}
+		}
+	}
+
+	var refs []tableRef
+	// check records the table reference at i. Only FROM and JOIN accept
+	// set returning functions, elsewhere a parenthesis starts a column list.
+	check := func(i int, funcs bool) int {
+		for i < len(toks) && (toks[i].is("ONLY") || toks[i].is("LATERAL") ||
+			toks[i].is("IF") || toks[i].is("NOT") || toks[i].is("EXISTS")) {
+			i++
+		}
+		if i >= len(toks) {
+			return i
+		}
+
+		tok := toks[i]
+		if !isIdent(tok.s) || isReservedTableWord(tok.s) {
+			return i
+		}
+		if i+1 < len(toks) && (toks[i+1].s == "." || (funcs && toks[i+1].s == "(")) {
+			return i
+		}
+		name := strings.Trim(tok.s, `"`)
+		if _, ok := ctes[strings.ToLower(name)]; ok {
+			return i
+		}
+		if strings.HasPrefix(strings.ToLower(name), "pg_") {
+			return i
+		}
+		refs = append(refs, tableRef{name: name, pos: tok.pos})
+		return i
+	}
+
+	var parens []string // function names of the open parentheses
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		switch tok.s {
+		case "(":
+			var fn string
+			if i > 0 {
+				fn = strings.ToLower(toks[i-1].s)
+			}
+			parens = append(parens, fn)
+			continue
+		case ")":
+			if len(parens) > 0 {
+				parens = parens[:len(parens)-1]
+			}
+			continue
+		}
+
+		var prev sqlToken
+		if i > 0 {
+			prev = toks[i-1]
+		}
+
+		switch {
+		case tok.is("FROM"):
+			if prev.is("DISTINCT") || (len(parens) > 0 && isFromFunc(parens[len(parens)-1])) {
+				continue
+			}
+			j := check(i+1, true)
+			// FROM a, b
+			for j+1 < len(toks) {
+				k := j + 1
+				if k < len(toks) && toks[k].is("AS") {
+					k++
+				}
+				if k < len(toks) && isIdent(toks[k].s) && !isReservedTableWord(toks[k].s) {
+					k++
+				}
+				if k >= len(toks) || toks[k].s != "," {
+					break
+				}
+				j = check(k+1, true)
+			}
+		case tok.is("UPDATE"):
+			if prev.is("FOR") || prev.is("DO") || prev.is("ON") {
+				continue
+			}
+			check(i+1, false)
+		case tok.is("JOIN"):
+			check(i+1, true)
+		case tok.is("INTO"), tok.is("TABLE"), tok.is("TRUNCATE"), tok.is("REFERENCES"), tok.is("COPY"):
+			check(i+1, false)
+		}
+	}
+	return refs
+}
+
+func isFromFunc(fn string) bool {
+	switch fn {
+	case "extract", "substring", "trim", "overlay", "position":
+		return true
+	}
+	return false
+}
+
+func isReservedTableWord(s string) bool {
+	switch strings.ToUpper(s) {
+	case "SELECT", "VALUES", "WITH", "STDIN", "STDOUT", "TABLE", "ONLY", "LATERAL",
+		"SET", "WHERE", "AS", "ON", "USING", "DEFAULT", "NOWAIT", "OF", "SKIP",
+		"UNNEST":
+		return true
+	}
+	return false
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	c := s[0]
+	return c == '"' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// tokenizeSQL splits the query into identifiers, keywords, numbers, and
+// punctuation skipping string literals and comments.
+func tokenizeSQL(query string) []sqlToken {
+	var toks []sqlToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end == -1 {
+				return toks
+			}
+			i += end + 4
+		case c == '\'':
+			i++
+			for i < len(query) {
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+		case c == '$':
+			end := strings.IndexByte(query[i+1:], '$')
+			if end == -1 {
+				i++
+				continue
+			}
+			tag := query[i : i+end+2]
+			if !isDollarTag(tag) {
+				i++
+				continue
+			}
+			rest := strings.Index(query[i+len(tag):], tag)
+			if rest == -1 {
+				return toks
+			}
+			i += len(tag) + rest + len(tag)
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end == -1 {
+				return toks
+			}
+			toks = append(toks, sqlToken{s: query[i : i+end+2], pos: i})
+			i += end + 2
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9'):
+			start := i
+			for i < len(query) {
+				c := query[i]
+				if c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+					i++
+					continue
+				}
+				break
+			}
+			toks = append(toks, sqlToken{s: query[start:i], pos: start})
+		default:
+			toks = append(toks, sqlToken{s: query[i : i+1], pos: i})
+			i++
+		}
+	}
+	return toks
+}
+
+func isDollarTag(tag string) bool {
+	for i := 1; i < len(tag)-1; i++ {
+		c := tag[i]
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
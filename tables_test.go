@@ -0,0 +1,74 @@
+package sharding_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+)
+
+func TestQualifyTables(t *testing.T) {
+	tests := []struct {
+		query  string
+		wanted string
+	}{
+		{"SELECT * FROM users", "SELECT * FROM ?SHARD.users"},
+		{"SELECT * FROM ?SHARD.users", "SELECT * FROM ?SHARD.users"},
+		{"SELECT * FROM users u, orders AS o", "SELECT * FROM ?SHARD.users u, ?SHARD.orders AS o"},
+		{
+			"SELECT * FROM users JOIN orders ON orders.user_id = users.id",
+			"SELECT * FROM ?SHARD.users JOIN ?SHARD.orders ON orders.user_id = users.id",
+		},
+		{"INSERT INTO users (name) VALUES ('from users')", "INSERT INTO ?SHARD.users (name) VALUES ('from users')"},
+		{"UPDATE users SET name = 'x'", "UPDATE ?SHARD.users SET name = 'x'"},
+		{"DELETE FROM users", "DELETE FROM ?SHARD.users"},
+		{"CREATE TABLE IF NOT EXISTS users (id int)", "CREATE TABLE IF NOT EXISTS ?SHARD.users (id int)"},
+		{"SELECT * FROM users FOR UPDATE", "SELECT * FROM ?SHARD.users FOR UPDATE"},
+		{
+			"INSERT INTO t VALUES (1) ON CONFLICT DO UPDATE SET a = 1",
+			"INSERT INTO ?SHARD.t VALUES (1) ON CONFLICT DO UPDATE SET a = 1",
+		},
+		{"WITH u AS (SELECT 1) SELECT * FROM u", "WITH u AS (SELECT 1) SELECT * FROM u"},
+		{"SELECT extract(epoch FROM tm) FROM s.t", "SELECT extract(epoch FROM tm) FROM s.t"},
+		{"SELECT * FROM (SELECT 1) t", "SELECT * FROM (SELECT 1) t"},
+		{"SELECT * FROM generate_series(1, 10)", "SELECT * FROM generate_series(1, 10)"},
+		{"SELECT 1 FROM pg_namespace", "SELECT 1 FROM pg_namespace"},
+		{"SELECT a IS DISTINCT FROM b FROM \"Users\"", "SELECT a IS DISTINCT FROM b FROM ?SHARD.\"Users\""},
+		{"SELECT 1 -- FROM users", "SELECT 1 -- FROM users"},
+		{"SELECT $$ FROM users $$", "SELECT $$ FROM users $$"},
+		{"COPY users FROM STDIN", "COPY ?SHARD.users FROM STDIN"},
+	}
+	for _, test := range tests {
+		got := sharding.QualifyTables(test.query, "?SHARD")
+		if got != test.wanted {
+			t.Errorf("QualifyTables(%q) = %q, wanted %q", test.query, got, test.wanted)
+		}
+	}
+}
+
+func TestTableCheck(t *testing.T) {
+	cluster := shardingtest.NewCluster(2, sharding.WithTableCheck(sharding.TableCheckError))
+	defer cluster.Close()
+
+	_, err := cluster.Shard(1).ExecContext(context.Background(), "DELETE FROM users")
+	var tableErr *sharding.UnqualifiedTableError
+	if !errors.As(err, &tableErr) {
+		t.Fatalf("got %v, wanted *UnqualifiedTableError", err)
+	}
+	if tableErr.ShardID != 1 || len(tableErr.Tables) != 1 || tableErr.Tables[0] != "users" {
+		t.Fatalf("got %+v", tableErr)
+	}
+	if n := len(cluster.Queries(1)); n != 0 {
+		t.Fatalf("got %d queries, wanted 0", n)
+	}
+
+	_, err = cluster.Shard(1).ExecContext(context.Background(), "DELETE FROM ?SHARD.users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cluster.Queries(1); len(got) != 1 || got[0] != "DELETE FROM shard1.users" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,152 @@
+package sharding
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// shardParams are the params that are substituted by Template.
+var shardParams = map[string]struct{}{
+	"shard_id":   {},
+	"shard":      {},
+	"epoch":      {},
+	"shard_bits": {},
+	"seq_bits":   {},
+	"max_shards": {},
+	"SHARD_ID":   {},
+	"SHARD":      {},
+	"EPOCH":      {},
+	"SHARD_BITS": {},
+	"SEQ_BITS":   {},
+	"MAX_SHARDS": {},
+}
+
+type templateSegment struct {
+	text  string
+	param bool
+}
+
+// Template is a query compiled for repeated execution on shards. Shard
+// params (?SHARD, ?SHARD_ID, ?EPOCH, other IDGen params, and params added
+// with WithShardParam) are substituted once per shard and cached, so go-pg
+// only has to format the rest of the params, if any.
+// It is safe for concurrent use.
+type Template struct {
+	cl       *Cluster
+	query    string
+	segments []templateSegment
+	rendered []atomic.Value // string indexed by shard id
+}
+
+// Compile parses the query and returns a template that can be executed
+// on the cluster shards.
+func (cl *Cluster) Compile(query string) *Template {
+	return &Template{
+		cl:       cl,
+		query:    query,
+		segments: cl.parseTemplate(query),
+		rendered: make([]atomic.Value, cl.nshards),
+	}
+}
+
+func (cl *Cluster) parseTemplate(query string) []templateSegment {
+	var segments []templateSegment
+	var start int
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' || (i > 0 && query[i-1] == '\\') {
+			continue
+		}
+
+		end := i + 1
+		for end < len(query) && isParamChar(query[end]) {
+			end++
+		}
+		name := query[i+1 : end]
+		if _, ok := shardParams[name]; !ok && !cl.hasCustomParam(name) {
+			continue
+		}
+
+		if start < i {
+			segments = append(segments, templateSegment{text: query[start:i]})
+		}
+		segments = append(segments, templateSegment{text: name, param: true})
+		start = end
+		i = end - 1
+	}
+	if start < len(query) {
+		segments = append(segments, templateSegment{text: query[start:]})
+	}
+	return segments
+}
+
+func isParamChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// String returns the query with shard params substituted for the shard.
+// Other params are left as is to be formatted by go-pg.
+func (t *Template) String(shard *pg.DB) string {
+	shardID, ok := shard.Param("SHARD_ID").(int64)
+	if !ok || shardID < 0 || shardID >= int64(len(t.rendered)) {
+		return t.render(shard)
+	}
+
+	// Only shards owned by the cluster are cached. Other shards, e.g.
+	// returned by SnapshotShard, may have different params.
+	info := &t.cl.topology().shards[shardID]
+	if info.shard != shard {
+		return t.render(shard)
+	}
+
+	if s, ok := t.rendered[shardID].Load().(string); ok {
+		return s
+	}
+	s := t.render(shard)
+	t.rendered[shardID].Store(s)
+	return s
+}
+
+func (t *Template) render(shard *pg.DB) string {
+	b := make([]byte, 0, len(t.query)+16)
+	for _, seg := range t.segments {
+		if !seg.param {
+			b = append(b, seg.text...)
+			continue
+		}
+
+		v := shard.Param(seg.text)
+		if v == nil {
+			b = append(b, '?')
+			b = append(b, seg.text...)
+			continue
+		}
+		b = types.Append(b, v, 1)
+	}
+	return string(b)
+}
+
+// ExecContext executes the template on the shard.
+func (t *Template) ExecContext(
+	ctx context.Context, shard *pg.DB, params ...interface{},
+) (pg.Result, error) {
+	return shard.ExecContext(ctx, t.String(shard), params...)
+}
+
+// QueryContext executes the template on the shard and scans rows
+// into the model.
+func (t *Template) QueryContext(
+	ctx context.Context, shard *pg.DB, model interface{}, params ...interface{},
+) (pg.Result, error) {
+	return shard.QueryContext(ctx, model, t.String(shard), params...)
+}
+
+// QueryOneContext executes the template on the shard and scans
+// the single returned row into the model.
+func (t *Template) QueryOneContext(
+	ctx context.Context, shard *pg.DB, model interface{}, params ...interface{},
+) (pg.Result, error) {
+	return shard.QueryOneContext(ctx, model, t.String(shard), params...)
+}
@@ -0,0 +1,41 @@
+package sharding_test
+
+import (
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestTemplate(t *testing.T) {
+	cluster := sharding.NewCluster([]*pg.DB{pg.Connect(&pg.Options{})}, 4)
+	defer cluster.Close()
+
+	queries := []string{
+		"SELECT * FROM ?SHARD.users WHERE id = ? AND shard_id = ?SHARD_ID",
+		"SELECT ?shard_id, ?epoch, ?EPOCH FROM ?shard.t",
+		"SELECT '\\?SHARD', ?unknown, ?",
+		"",
+	}
+	for _, query := range queries {
+		tmpl := cluster.Compile(query)
+		for i := int64(0); i < 4; i++ {
+			shard := cluster.Shard(i)
+			wanted := string(shard.Formatter().FormatQuery(nil, query))
+			for j := 0; j < 2; j++ {
+				got := string(shard.Formatter().FormatQuery(nil, tmpl.String(shard)))
+				if got != wanted {
+					t.Fatalf("got %q, wanted %q", got, wanted)
+				}
+			}
+		}
+	}
+
+	tmpl := cluster.Compile("SELECT * FROM ?SHARD.users")
+	_ = tmpl.String(cluster.Shard(1))
+	shard := cluster.Shard(1).WithParam("SHARD", pg.Safe("shard1_copy"))
+	if got, wanted := tmpl.String(shard), "SELECT * FROM shard1_copy.users"; got != wanted {
+		t.Fatalf("got %q, wanted %q", got, wanted)
+	}
+}
@@ -0,0 +1,368 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrTenantNotFound is returned by TenantRouter when the tenant has no
+// directory entry and the miss policy is MissError.
+var ErrTenantNotFound = errors.New("sharding: tenant not found")
+
+// TenantStore persists tenant id to shard id directory entries.
+type TenantStore interface {
+	// Lookup returns shard id of the tenant or false if the tenant is unknown.
+	Lookup(ctx context.Context, tenantID int64) (shardID int64, ok bool, err error)
+	// Assign atomically stores the entry unless the tenant already has one
+	// and returns the shard id the tenant is assigned to.
+	Assign(ctx context.Context, tenantID, shardID int64) (int64, error)
+}
+
+// MissPolicy controls what TenantRouter does when a tenant is not
+// found in the directory.
+type MissPolicy int
+
+const (
+	// MissError returns ErrTenantNotFound.
+	MissError MissPolicy = iota
+	// MissHash routes the tenant using hash routing, i.e. Cluster.Shard.
+	MissHash
+	// MissProvision assigns the tenant to the least loaded shard and
+	// persists the directory entry.
+	MissProvision
+)
+
+// TenantRouterOptions configures a TenantRouter.
+type TenantRouterOptions struct {
+	Store TenantStore
+	// Miss is the policy for tenants without a directory entry.
+	Miss MissPolicy
+	// Load returns current load of the shards and is used by MissProvision
+	// to pick the least loaded shard. Missing shards have zero load.
+	// Default is the time spent in queries executed on the shards through
+	// the cluster, i.e. ShardWorkload.QueryTime.
+	Load func(ctx context.Context) (map[int64]float64, error)
+	// TenantLoad is the load a provisioned tenant is expected to add to
+	// its shard. It is added to the shard load in memory so tenants
+	// provisioned before Load reflects them are spread across shards.
+	// Default is the average shard load or 1 when shards have no load.
+	TenantLoad float64
+	// CacheTTL is how long resolved tenants are cached in memory.
+	// Default is no caching.
+	CacheTTL time.Duration
+	// CacheSize is the max number of cached tenants. Default is 100000.
+	CacheSize int
+}
+
+// TenantRouter is a directory-based router that resolves tenant id
+// to shard id using a TenantStore, which allows explicit placement
+// of tenants on shards.
+type TenantRouter struct {
+	cl  *Cluster
+	opt *TenantRouterOptions
+
+	mu    sync.RWMutex
+	cache map[int64]tenantCacheEntry
+
+	provisionMu sync.Mutex
+	provisioned map[int64]int // number of provisioned tenants by shard id
+}
+
+type tenantCacheEntry struct {
+	shardID int64
+	expires time.Time
+}
+
+// NewTenantRouter returns a directory-based router for the cluster.
+func NewTenantRouter(cl *Cluster, opt *TenantRouterOptions) *TenantRouter {
+	r := &TenantRouter{
+		cl:          cl,
+		opt:         opt,
+		provisioned: make(map[int64]int),
+	}
+	if opt.CacheTTL > 0 {
+		r.cache = make(map[int64]tenantCacheEntry)
+	}
+	return r
+}
+
+func (r *TenantRouter) cacheSize() int {
+	if r.opt.CacheSize > 0 {
+		return r.opt.CacheSize
+	}
+	return 100000
+}
+
+// ShardID returns shard id of the tenant.
+func (r *TenantRouter) ShardID(ctx context.Context, tenantID int64) (int64, error) {
+	if r.cache == nil {
+		return r.resolve(ctx, tenantID)
+	}
+
+	r.mu.RLock()
+	entry, ok := r.cache[tenantID]
+	r.mu.RUnlock()
+	if ok {
+		if time.Now().Before(entry.expires) {
+			return entry.shardID, nil
+		}
+		r.mu.Lock()
+		if entry, ok := r.cache[tenantID]; ok && !time.Now().Before(entry.expires) {
+			delete(r.cache, tenantID)
+		}
+		r.mu.Unlock()
+	}
+
+	shardID, err := r.resolve(ctx, tenantID)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	if _, ok := r.cache[tenantID]; !ok && len(r.cache) >= r.cacheSize() {
+		r.evict()
+	}
+	r.cache[tenantID] = tenantCacheEntry{
+		shardID: shardID,
+		expires: time.Now().Add(r.opt.CacheTTL),
+	}
+	r.mu.Unlock()
+
+	return shardID, nil
+}
+
+// evict removes a random entry from the full cache like ShardResolver.
+// Expired entries are removed when they are looked up. It must be called
+// with the mu held.
+func (r *TenantRouter) evict() {
+	for tenantID := range r.cache {
+		delete(r.cache, tenantID)
+		return
+	}
+}
+
+// Invalidate removes the tenant from the cache, e.g. after the tenant
+// is moved to another shard.
+func (r *TenantRouter) Invalidate(tenantID int64) {
+	if r.cache == nil {
+		return
+	}
+	r.mu.Lock()
+	delete(r.cache, tenantID)
+	r.mu.Unlock()
+}
+
+func (r *TenantRouter) resolve(ctx context.Context, tenantID int64) (int64, error) {
+	shardID, ok, err := r.opt.Store.Lookup(ctx, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return shardID, nil
+	}
+
+	switch r.opt.Miss {
+	case MissHash:
+		return r.cl.shardID(tenantID), nil
+	case MissProvision:
+		return r.provision(ctx, tenantID)
+	default:
+		return 0, ErrTenantNotFound
+	}
+}
+
+// Shard returns the shard of the tenant. An error wrapping
+// ErrShardIDOutOfRange is returned when the store assigned the tenant
+// to a shard id out of the cluster range.
+func (r *TenantRouter) Shard(ctx context.Context, tenantID int64) (*pg.DB, error) {
+	shardID, err := r.ShardID(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.cl.checkShardID("tenant", tenantID, shardID); err != nil {
+		return nil, err
+	}
+	return r.cl.shardByID(shardID), nil
+}
+
+func (r *TenantRouter) provision(ctx context.Context, tenantID int64) (int64, error) {
+	load := r.opt.Load
+	if load == nil {
+		load = r.cl.queryLoad
+	}
+	shardLoad, err := load(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// The lock serializes provisioning so concurrent tenants see
+	// each other in the provisioned counts.
+	r.provisionMu.Lock()
+	defer r.provisionMu.Unlock()
+
+	tenantLoad := r.opt.TenantLoad
+	if tenantLoad <= 0 {
+		var total float64
+		for shardID := int64(0); shardID < int64(r.cl.nshards); shardID++ {
+			total += shardLoad[shardID]
+		}
+		tenantLoad = total / float64(r.cl.nshards)
+		if tenantLoad <= 0 {
+			tenantLoad = 1
+		}
+	}
+
+	var minShardID int64
+	var minLoad float64
+	for shardID := int64(0); shardID < int64(r.cl.nshards); shardID++ {
+		l := shardLoad[shardID] + float64(r.provisioned[shardID])*tenantLoad
+		if shardID == 0 || l < minLoad {
+			minShardID, minLoad = shardID, l
+		}
+	}
+
+	assigned, err := r.opt.Store.Assign(ctx, tenantID, minShardID)
+	if err != nil {
+		return 0, err
+	}
+	if assigned == minShardID {
+		r.provisioned[assigned]++
+	}
+	return assigned, nil
+}
+
+// queryLoad returns the time spent in queries on every shard.
+func (cl *Cluster) queryLoad(context.Context) (map[int64]float64, error) {
+	load := make(map[int64]float64, len(cl.stats))
+	for i := range cl.stats {
+		load[int64(i)] = float64(atomic.LoadInt64(&cl.stats[i].queryTime))
+	}
+	return load, nil
+}
+
+//------------------------------------------------------------------------------
+
+// MemoryTenantStore is a TenantStore that keeps entries in memory.
+type MemoryTenantStore struct {
+	mu      sync.RWMutex
+	tenants map[int64]int64
+}
+
+var _ TenantStore = (*MemoryTenantStore)(nil)
+
+// NewMemoryTenantStore returns a store populated with the tenants.
+func NewMemoryTenantStore(tenants map[int64]int64) *MemoryTenantStore {
+	s := &MemoryTenantStore{
+		tenants: make(map[int64]int64, len(tenants)),
+	}
+	for tenantID, shardID := range tenants {
+		s.tenants[tenantID] = shardID
+	}
+	return s
+}
+
+func (s *MemoryTenantStore) Lookup(_ context.Context, tenantID int64) (int64, bool, error) {
+	s.mu.RLock()
+	shardID, ok := s.tenants[tenantID]
+	s.mu.RUnlock()
+	return shardID, ok, nil
+}
+
+func (s *MemoryTenantStore) Assign(_ context.Context, tenantID, shardID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if assigned, ok := s.tenants[tenantID]; ok {
+		return assigned, nil
+	}
+	s.tenants[tenantID] = shardID
+	return shardID, nil
+}
+
+//------------------------------------------------------------------------------
+
+// PGTenantStore is a TenantStore that keeps entries in a PostgreSQL table
+// with tenant_id and shard_id columns.
+type PGTenantStore struct {
+	db    *pg.DB
+	table string
+}
+
+var _ TenantStore = (*PGTenantStore)(nil)
+
+// NewPGTenantStore returns a store that uses the table in the db. The db
+// is usually a shard of the cluster dedicated to directory data, in which
+// case the table can be qualified with ?SHARD, e.g. "?SHARD.tenants".
+// The table name is not escaped.
+func NewPGTenantStore(db *pg.DB, table string) *PGTenantStore {
+	return &PGTenantStore{
+		db:    db,
+		table: table,
+	}
+}
+
+// CreateTable creates the directory table.
+func (s *PGTenantStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+s.table+` (
+			tenant_id bigint PRIMARY KEY,
+			shard_id bigint NOT NULL
+		)
+	`)
+	return err
+}
+
+func (s *PGTenantStore) Lookup(ctx context.Context, tenantID int64) (int64, bool, error) {
+	var shardID int64
+	_, err := s.db.QueryOneContext(ctx, pg.Scan(&shardID),
+		"SELECT shard_id FROM "+s.table+" WHERE tenant_id = ?", tenantID)
+	if err == pg.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return shardID, true, nil
+}
+
+func (s *PGTenantStore) Assign(ctx context.Context, tenantID, shardID int64) (int64, error) {
+	// The no-op update makes RETURNING return the existing entry.
+	var assigned int64
+	_, err := s.db.QueryOneContext(ctx, pg.Scan(&assigned), `
+		INSERT INTO `+s.table+` (tenant_id, shard_id) VALUES (?, ?)
+		ON CONFLICT (tenant_id) DO UPDATE SET tenant_id = EXCLUDED.tenant_id
+		RETURNING shard_id
+	`, tenantID, shardID)
+	if err != nil {
+		return 0, err
+	}
+	return assigned, nil
+}
+
+//------------------------------------------------------------------------------
+
+// FuncTenantStore is a TenantStore that delegates to callbacks, e.g. to
+// resolve tenants with an external service.
+type FuncTenantStore struct {
+	LookupFunc func(ctx context.Context, tenantID int64) (int64, bool, error)
+	// AssignFunc is required only by MissProvision.
+	AssignFunc func(ctx context.Context, tenantID, shardID int64) (int64, error)
+}
+
+var _ TenantStore = (*FuncTenantStore)(nil)
+
+func (s *FuncTenantStore) Lookup(ctx context.Context, tenantID int64) (int64, bool, error) {
+	return s.LookupFunc(ctx, tenantID)
+}
+
+func (s *FuncTenantStore) Assign(ctx context.Context, tenantID, shardID int64) (int64, error) {
+	if s.AssignFunc == nil {
+		return 0, errors.New("sharding: FuncTenantStore.AssignFunc is nil")
+	}
+	return s.AssignFunc(ctx, tenantID, shardID)
+}
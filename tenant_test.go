@@ -0,0 +1,186 @@
+package sharding_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	"github.com/go-pg/pg/v10"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TenantRouter", func() {
+	var cluster *sharding.Cluster
+	var store *sharding.MemoryTenantStore
+
+	BeforeEach(func() {
+		db := pg.Connect(&pg.Options{
+			Addr: "db1",
+		})
+		cluster = sharding.NewCluster([]*pg.DB{db}, 4)
+		store = sharding.NewMemoryTenantStore(map[int64]int64{
+			1: 3,
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("uses directory entries", func() {
+		router := sharding.NewTenantRouter(cluster, &sharding.TenantRouterOptions{
+			Store: store,
+		})
+
+		shardID, err := router.ShardID(ctx, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shardID).To(Equal(int64(3)))
+
+		_, err = router.ShardID(ctx, 2)
+		Expect(err).To(Equal(sharding.ErrTenantNotFound))
+	})
+
+	It("falls back to hash routing", func() {
+		router := sharding.NewTenantRouter(cluster, &sharding.TenantRouterOptions{
+			Store: store,
+			Miss:  sharding.MissHash,
+		})
+
+		shardID, err := router.ShardID(ctx, 6)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shardID).To(Equal(int64(2)))
+
+		_, ok, _ := store.Lookup(ctx, 6)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("provisions tenants on the least loaded shard", func() {
+		router := sharding.NewTenantRouter(cluster, &sharding.TenantRouterOptions{
+			Store: store,
+			Miss:  sharding.MissProvision,
+			Load: func(context.Context) (map[int64]float64, error) {
+				return map[int64]float64{0: 10, 1: 5, 2: 1, 3: 7}, nil
+			},
+		})
+
+		shardID, err := router.ShardID(ctx, 6)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shardID).To(Equal(int64(2)))
+
+		shardID, ok, _ := store.Lookup(ctx, 6)
+		Expect(ok).To(BeTrue())
+		Expect(shardID).To(Equal(int64(2)))
+	})
+
+	It("spreads tenants provisioned in a burst using the cluster stats", func() {
+		router := sharding.NewTenantRouter(cluster, &sharding.TenantRouterOptions{
+			Store: store,
+			Miss:  sharding.MissProvision,
+		})
+
+		var shardIDs []int64
+		for tenantID := int64(10); tenantID < 14; tenantID++ {
+			shardID, err := router.ShardID(ctx, tenantID)
+			Expect(err).NotTo(HaveOccurred())
+			shardIDs = append(shardIDs, shardID)
+		}
+		Expect(shardIDs).To(Equal([]int64{0, 1, 2, 3}))
+	})
+
+	It("rejects shard ids out of the cluster range", func() {
+		store = sharding.NewMemoryTenantStore(map[int64]int64{1: 7})
+		router := sharding.NewTenantRouter(cluster, &sharding.TenantRouterOptions{
+			Store: store,
+		})
+
+		_, err := router.Shard(ctx, 1)
+		Expect(err).To(MatchError(sharding.ErrShardIDOutOfRange))
+		Expect(err).To(MatchError(
+			"sharding: shard id is out of range: tenant 1 has shard id 7, but the cluster has 4 shards"))
+	})
+
+	It("bounds the cache", func() {
+		router := sharding.NewTenantRouter(cluster, &sharding.TenantRouterOptions{
+			Store:     store,
+			Miss:      sharding.MissHash,
+			CacheTTL:  time.Hour,
+			CacheSize: 2,
+		})
+
+		for tenantID := int64(1); tenantID <= 5; tenantID++ {
+			_, err := router.ShardID(ctx, tenantID)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(sharding.TenantCacheLen(router)).To(Equal(2))
+	})
+})
+
+var _ = Describe("TenantRouter stores", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("caches lookups", func() {
+		var lookups int
+		router := sharding.NewTenantRouter(cluster.Cluster, &sharding.TenantRouterOptions{
+			Store: &sharding.FuncTenantStore{
+				LookupFunc: func(_ context.Context, tenantID int64) (int64, bool, error) {
+					lookups++
+					return 3, true, nil
+				},
+			},
+			CacheTTL: time.Minute,
+		})
+
+		for i := 0; i < 3; i++ {
+			shardID, err := router.ShardID(ctx, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shardID).To(Equal(int64(3)))
+		}
+		Expect(lookups).To(Equal(1))
+
+		router.Invalidate(1)
+		_, err := router.ShardID(ctx, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lookups).To(Equal(2))
+	})
+
+	It("uses PostgreSQL table", func() {
+		store := sharding.NewPGTenantStore(cluster.Shard(0), "?SHARD.tenants")
+		cluster.SetResult(0, "SELECT shard_id", &shardingtest.Result{
+			Columns: []string{"shard_id"},
+			Rows:    [][]interface{}{{2}},
+		})
+		cluster.SetResult(0, "RETURNING shard_id", &shardingtest.Result{
+			Columns: []string{"shard_id"},
+			Rows:    [][]interface{}{{1}},
+		})
+
+		shardID, ok, err := store.Lookup(ctx, 7)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(shardID).To(Equal(int64(2)))
+
+		shardID, err = store.Assign(ctx, 8, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shardID).To(Equal(int64(1)))
+
+		queries := cluster.Queries(0)
+		Expect(queries).To(HaveLen(2))
+		Expect(queries[0]).To(Equal("SELECT shard_id FROM shard0.tenants WHERE tenant_id = 7"))
+		Expect(queries[1]).To(ContainSubstring("INSERT INTO shard0.tenants (tenant_id, shard_id) VALUES (8, 1)"))
+
+		_, ok, err = sharding.NewPGTenantStore(cluster.Shard(1), "?SHARD.tenants").Lookup(ctx, 7)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,308 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+const drainInterval = 10 * time.Millisecond
+
+// TopologyEventType describes what has changed in the cluster topology.
+type TopologyEventType int
+
+const (
+	// ShardMapChanged is fired when shards are reassigned to databases.
+	ShardMapChanged TopologyEventType = iota + 1
+	// DBAdded is fired when a database is added to the cluster.
+	DBAdded
+	// DBRemoved is fired when a database is removed from the cluster.
+	DBRemoved
+	// DBHealthChanged is fired when a database is marked healthy or unhealthy.
+	DBHealthChanged
+	// DBReplaced is fired when shards of a database are moved to another
+	// database with ReplaceDB, e.g. on failover to a standby.
+	DBReplaced
+)
+
+func (t TopologyEventType) String() string {
+	switch t {
+	case ShardMapChanged:
+		return "shard_map_changed"
+	case DBAdded:
+		return "db_added"
+	case DBRemoved:
+		return "db_removed"
+	case DBHealthChanged:
+		return "db_health_changed"
+	case DBReplaced:
+		return "db_replaced"
+	}
+	return "unknown"
+}
+
+// TopologyEvent is passed to the functions registered with OnTopologyChange.
+type TopologyEvent struct {
+	Type TopologyEventType
+	// DB is the affected database. It is nil for ShardMapChanged.
+	DB *pg.DB
+	// Healthy is the new health state of the DB for DBHealthChanged.
+	Healthy bool
+	// OldDB is the replaced database for DBReplaced.
+	OldDB *pg.DB
+}
+
+// OnTopologyChange registers the fn to be called when the cluster topology
+// changes, i.e. shards are reassigned, databases are added or removed, or
+// database health state changes. The fn is called synchronously by the
+// goroutine that made the change so it should not block. The returned
+// func unregisters the fn.
+func (cl *Cluster) OnTopologyChange(fn func(ev TopologyEvent)) func() {
+	ln := &topologyListener{fn: fn}
+	cl.mu.Lock()
+	cl.listeners = append(cl.listeners, ln)
+	cl.mu.Unlock()
+
+	return func() {
+		cl.mu.Lock()
+		defer cl.mu.Unlock()
+
+		// notify iterates over a snapshot of the slice so it is copied.
+		listeners := make([]*topologyListener, 0, len(cl.listeners))
+		for _, l := range cl.listeners {
+			if l != ln {
+				listeners = append(listeners, l)
+			}
+		}
+		cl.listeners = listeners
+	}
+}
+
+type topologyListener struct {
+	fn func(ev TopologyEvent)
+}
+
+func (cl *Cluster) notify(ev TopologyEvent) {
+	cl.mu.RLock()
+	listeners := cl.listeners
+	cl.mu.RUnlock()
+
+	for _, ln := range listeners {
+		ln.fn(ev)
+	}
+}
+
+// SetHealthy marks the database as healthy or unhealthy. DBHealthChanged
+// event is fired only when the state actually changes. It is
+// SetHealthyContext without an audit actor that ignores audit errors.
+func (cl *Cluster) SetHealthy(db *pg.DB, healthy bool) {
+	_ = cl.SetHealthyContext(context.Background(), db, healthy)
+}
+
+// SetHealthyContext is like SetHealthy, but records health changes in
+// the audit trail attributed to the actor from the ctx. The returned
+// error is always an AuditError.
+func (cl *Cluster) SetHealthyContext(ctx context.Context, db *pg.DB, healthy bool) error {
+	cl.mu.Lock()
+	_, down := cl.down[db]
+	changed := down == healthy
+	if changed {
+		if healthy {
+			delete(cl.down, db)
+		} else {
+			if cl.down == nil {
+				cl.down = make(map[*pg.DB]struct{})
+			}
+			cl.down[db] = struct{}{}
+		}
+	}
+	cl.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	cl.notify(TopologyEvent{
+		Type:    DBHealthChanged,
+		DB:      db,
+		Healthy: healthy,
+	})
+
+	return cl.audit(ctx, "set_healthy", map[string]interface{}{
+		"addr":    db.Options().Addr,
+		"healthy": healthy,
+	}, nil)
+}
+
+// Healthy reports whether the database is healthy. Databases are healthy
+// until they are marked otherwise with SetHealthy.
+func (cl *Cluster) Healthy(db *pg.DB) bool {
+	cl.mu.RLock()
+	_, down := cl.down[db]
+	cl.mu.RUnlock()
+	return !down
+}
+
+// DBOptions configures a database added with AddDB.
+type DBOptions struct {
+	// Weight is the number of times the db is listed in the cluster dbs,
+	// i.e. the relative number of shards it receives. Default is 1.
+	Weight int
+}
+
+// AddDB adds the db to the cluster and reassigns shards using the cluster
+// placement strategy. Shards that stay on the same database keep using
+// the same *pg.DB. An AuditError is returned when the db was added but
+// the audit sink failed.
+func (cl *Cluster) AddDB(ctx context.Context, db *pg.DB, opt *DBOptions) error {
+	weight := 1
+	if opt != nil && opt.Weight > 0 {
+		weight = opt.Weight
+	}
+
+	cl.topoMu.Lock()
+	t := cl.topology()
+	dbs := make([]*pg.DB, len(t.dbs), len(t.dbs)+weight)
+	copy(dbs, t.dbs)
+	for i := 0; i < weight; i++ {
+		dbs = append(dbs, db)
+	}
+	if err := checkTopology(len(dbs), cl.nshards, cl.gen, cl.strict); err != nil {
+		cl.topoMu.Unlock()
+		return err
+	}
+	topo, err := cl.newTopology(dbs, t)
+	if err != nil {
+		cl.topoMu.Unlock()
+		return err
+	}
+	cl.topo.Store(topo)
+	cl.topoMu.Unlock()
+
+	cl.notify(TopologyEvent{Type: DBAdded, DB: db})
+	cl.notify(TopologyEvent{Type: ShardMapChanged})
+
+	return cl.audit(ctx, "add_db", map[string]interface{}{
+		"addr":   db.Options().Addr,
+		"weight": weight,
+	}, nil)
+}
+
+// RemoveDB reassigns shards of the db to the remaining databases, waits
+// until queries already running on the db are finished, and closes the db.
+// When the ctx is done before the queries finish, the shards stay
+// reassigned but the db is left open and the ctx error is returned.
+func (cl *Cluster) RemoveDB(ctx context.Context, db *pg.DB) error {
+	cl.topoMu.Lock()
+	t := cl.topology()
+	dbs := make([]*pg.DB, 0, len(t.dbs))
+	for _, d := range t.dbs {
+		if d != db {
+			dbs = append(dbs, d)
+		}
+	}
+	if len(dbs) == len(t.dbs) {
+		cl.topoMu.Unlock()
+		return fmt.Errorf("sharding: %s is not in the cluster", db)
+	}
+	if err := checkTopology(len(dbs), cl.nshards, cl.gen, cl.strict); err != nil {
+		cl.topoMu.Unlock()
+		return err
+	}
+	topo, err := cl.newTopology(dbs, t)
+	if err != nil {
+		cl.topoMu.Unlock()
+		return err
+	}
+	cl.topo.Store(topo)
+	cl.topoMu.Unlock()
+
+	cl.notify(TopologyEvent{Type: ShardMapChanged})
+
+	err = drain(ctx, t.inflight[db])
+	if err != nil {
+		err = fmt.Errorf("sharding: drain %s: %w", db.Options().Addr, err)
+	} else {
+		cl.mu.Lock()
+		delete(cl.down, db)
+		cl.mu.Unlock()
+
+		err = db.Close()
+		cl.notify(TopologyEvent{Type: DBRemoved, DB: db})
+	}
+
+	auditErr := cl.audit(ctx, "remove_db", map[string]interface{}{
+		"addr": db.Options().Addr,
+	}, err)
+	if err != nil {
+		return err
+	}
+	return auditErr
+}
+
+// drain waits until there are no running queries counted by the inflight.
+func drain(ctx context.Context, inflight *int64) error {
+	if atomic.LoadInt64(inflight) == 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(inflight) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// ReplaceDB moves all shards of the old db to the new db keeping the shard
+// map, e.g. to redirect shards of a failed primary to a promoted standby.
+// Unlike RemoveDB, it does not wait for queries running on the old db and
+// does not close it. An AuditError is returned when the db was replaced
+// but the audit sink failed.
+func (cl *Cluster) ReplaceDB(ctx context.Context, old, db *pg.DB) error {
+	cl.topoMu.Lock()
+	t := cl.topology()
+	dbs := make([]*pg.DB, len(t.dbs))
+	var found bool
+	for i, d := range t.dbs {
+		if d == db {
+			cl.topoMu.Unlock()
+			return fmt.Errorf("sharding: %s is already in the cluster", db)
+		}
+		if d == old {
+			d = db
+			found = true
+		}
+		dbs[i] = d
+	}
+	if !found {
+		cl.topoMu.Unlock()
+		return fmt.Errorf("sharding: %s is not in the cluster", old)
+	}
+	dbInds := make([]int, len(t.shards))
+	for i := range t.shards {
+		dbInds[i] = t.shards[i].dbInd
+	}
+	cl.topo.Store(cl.buildTopology(dbs, dbInds, t))
+	cl.topoMu.Unlock()
+
+	cl.mu.Lock()
+	delete(cl.down, old)
+	cl.mu.Unlock()
+
+	cl.notify(TopologyEvent{Type: DBReplaced, DB: db, OldDB: old})
+	cl.notify(TopologyEvent{Type: ShardMapChanged})
+
+	return cl.audit(ctx, "replace_db", map[string]interface{}{
+		"old_addr": old.Options().Addr,
+		"addr":     db.Options().Addr,
+	}, nil)
+}
@@ -0,0 +1,207 @@
+package sharding_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	"github.com/go-pg/pg/v10"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Topology events", func() {
+	var db1, db2 *pg.DB
+	var cluster *sharding.Cluster
+	var events []sharding.TopologyEvent
+
+	BeforeEach(func() {
+		db1 = pg.Connect(&pg.Options{
+			Addr: "db1",
+		})
+		db2 = pg.Connect(&pg.Options{
+			Addr: "db2",
+		})
+		cluster = sharding.NewCluster([]*pg.DB{db1, db2}, 4, sharding.WithStrictTopology())
+
+		events = nil
+		cluster.OnTopologyChange(func(ev sharding.TopologyEvent) {
+			events = append(events, ev)
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("fires when health state changes", func() {
+		Expect(cluster.Healthy(db1)).To(BeTrue())
+
+		cluster.SetHealthy(db1, false)
+		cluster.SetHealthy(db1, false)
+		Expect(cluster.Healthy(db1)).To(BeFalse())
+		Expect(cluster.Healthy(db2)).To(BeTrue())
+
+		cluster.SetHealthy(db1, true)
+		Expect(cluster.Healthy(db1)).To(BeTrue())
+
+		Expect(events).To(Equal([]sharding.TopologyEvent{
+			{Type: sharding.DBHealthChanged, DB: db1, Healthy: false},
+			{Type: sharding.DBHealthChanged, DB: db1, Healthy: true},
+		}))
+	})
+
+	It("stops calling unregistered listeners", func() {
+		var calls int
+		unregister := cluster.OnTopologyChange(func(sharding.TopologyEvent) {
+			calls++
+		})
+
+		cluster.SetHealthy(db1, false)
+		unregister()
+		cluster.SetHealthy(db1, true)
+
+		Expect(calls).To(Equal(1))
+		Expect(events).To(HaveLen(2))
+	})
+
+	It("adds and removes dbs", func() {
+		db3 := pg.Connect(&pg.Options{
+			Addr: "db3",
+		})
+		db4 := pg.Connect(&pg.Options{
+			Addr: "db4",
+		})
+		Expect(cluster.AddDB(ctx, db3, nil)).To(MatchError("sharding: number of shards must be divideable by number of dbs"))
+		Expect(cluster.AddDB(ctx, db3, &sharding.DBOptions{Weight: 2})).NotTo(HaveOccurred())
+		Expect(cluster.DBs()).To(Equal([]*pg.DB{db1, db2, db3, db3}))
+		Expect(cluster.Shards(db3)).To(HaveLen(2))
+		Expect(events).To(Equal([]sharding.TopologyEvent{
+			{Type: sharding.DBAdded, DB: db3},
+			{Type: sharding.ShardMapChanged},
+		}))
+
+		shard0 := cluster.Shard(0)
+		Expect(cluster.RemoveDB(ctx, db4)).To(MatchError(ContainSubstring("is not in the cluster")))
+		Expect(cluster.RemoveDB(ctx, db3)).NotTo(HaveOccurred())
+		Expect(cluster.DBs()).To(Equal([]*pg.DB{db1, db2}))
+		Expect(cluster.Shards(db1)).To(HaveLen(2))
+		Expect(cluster.Shards(db2)).To(HaveLen(2))
+		Expect(cluster.Shard(0)).To(BeIdenticalTo(shard0))
+		Expect(events[2:]).To(Equal([]sharding.TopologyEvent{
+			{Type: sharding.ShardMapChanged},
+			{Type: sharding.DBRemoved, DB: db3},
+		}))
+	})
+})
+
+var _ = Describe("RemoveDB", func() {
+	It("stops waiting for running queries when the ctx is done", func() {
+		cluster := shardingtest.NewChaosCluster(2, 1)
+		defer cluster.Close()
+
+		cluster.SetChaos(1, &shardingtest.ChaosOptions{Latency: time.Second})
+		dbs := cluster.DBs()
+		db := dbs[1]
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := cluster.Shard(1).Exec("SELECT 1")
+			done <- err
+		}()
+		Eventually(func() int64 {
+			return cluster.PoolStats()[1].Inflight
+		}).Should(Equal(int64(1)))
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		err := cluster.RemoveDB(ctx, db)
+		Expect(err).To(MatchError("sharding: drain shardingtest1: context deadline exceeded"))
+		Expect(cluster.DBs()).To(Equal(dbs[:1]))
+		Expect(<-done).NotTo(HaveOccurred())
+		Expect(db.Close()).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("Uneven topology", func() {
+	It("spreads extra shards over the first dbs", func() {
+		dbs := []*pg.DB{
+			pg.Connect(&pg.Options{Addr: "db1"}),
+			pg.Connect(&pg.Options{Addr: "db2"}),
+			pg.Connect(&pg.Options{Addr: "db3"}),
+		}
+		cluster := sharding.NewCluster(dbs, 8)
+		defer cluster.Close()
+
+		Expect(cluster.Shards(dbs[0])).To(HaveLen(3))
+		Expect(cluster.Shards(dbs[1])).To(HaveLen(3))
+		Expect(cluster.Shards(dbs[2])).To(HaveLen(2))
+
+		db4 := pg.Connect(&pg.Options{Addr: "db4"})
+		Expect(cluster.AddDB(ctx, db4, nil)).NotTo(HaveOccurred())
+		for _, db := range append(dbs, db4) {
+			Expect(cluster.Shards(db)).To(HaveLen(2))
+		}
+	})
+
+	It("moves only the minimum number of shards", func() {
+		dbs := []*pg.DB{
+			pg.Connect(&pg.Options{Addr: "db1"}),
+			pg.Connect(&pg.Options{Addr: "db2"}),
+			pg.Connect(&pg.Options{Addr: "db3"}),
+		}
+		cluster := sharding.NewCluster(dbs, 8)
+		defer cluster.Close()
+
+		before := cluster.ShardMap()
+		db4 := pg.Connect(&pg.Options{Addr: "db4"})
+		Expect(cluster.AddDB(ctx, db4, nil)).NotTo(HaveOccurred())
+
+		var moved int
+		for i, ind := range cluster.ShardMap() {
+			if ind != before[i] {
+				Expect(ind).To(Equal(3))
+				moved++
+			}
+		}
+		Expect(moved).To(Equal(2))
+
+		before = cluster.ShardMap()
+		Expect(cluster.RemoveDB(ctx, db4)).NotTo(HaveOccurred())
+		moved = 0
+		for i, ind := range cluster.ShardMap() {
+			if before[i] != 3 {
+				Expect(ind).To(Equal(before[i]))
+			} else {
+				moved++
+			}
+		}
+		Expect(moved).To(Equal(2))
+	})
+
+	It("panics in strict mode", func() {
+		dbs := []*pg.DB{
+			pg.Connect(&pg.Options{Addr: "db1"}),
+			pg.Connect(&pg.Options{Addr: "db2"}),
+			pg.Connect(&pg.Options{Addr: "db3"}),
+		}
+		Expect(func() {
+			sharding.NewCluster(dbs, 8, sharding.WithStrictTopology())
+		}).To(PanicWith("sharding: number of shards must be divideable by number of dbs"))
+	})
+})
+
+var _ = Describe("StickyPlacement", func() {
+	It("moves only shards of removed dbs", func() {
+		inds := sharding.StickyPlacement.Place(8, 3, []int{0, 1, 2, -1, 0, 1, 2, -1})
+		Expect(inds).To(Equal([]int{0, 1, 2, 0, 0, 1, 2, 1}))
+	})
+
+	It("moves extra shards to new dbs", func() {
+		inds := sharding.StickyPlacement.Place(4, 4, []int{0, 1, 0, 1})
+		Expect(inds).To(Equal([]int{0, 1, 2, 3}))
+	})
+})
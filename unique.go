@@ -0,0 +1,154 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ErrNotUnique is returned by UniqueIndex when the value is already
+// reserved by another shard.
+var ErrNotUnique = errors.New("sharding: value is already reserved by another shard")
+
+// UniqueIndexOptions configures a UniqueIndex.
+type UniqueIndexOptions struct {
+	// Table is the name of the lookup table without the shard schema,
+	// e.g. "user_emails".
+	Table string
+	// DirectoryShard is the number of the shard that stores the lookup table.
+	DirectoryShard int64
+}
+
+// UniqueIndex enforces uniqueness of values across all shards, e.g. user
+// emails, using a lookup table on a designated directory shard that maps
+// every value to the shard owning it.
+type UniqueIndex struct {
+	cl  *Cluster
+	opt *UniqueIndexOptions
+}
+
+// NewUniqueIndex returns a cross-shard unique index.
+func (cl *Cluster) NewUniqueIndex(opt *UniqueIndexOptions) *UniqueIndex {
+	return &UniqueIndex{
+		cl:  cl,
+		opt: opt,
+	}
+}
+
+func (idx *UniqueIndex) directory() *pg.DB {
+	return idx.cl.shardByID(idx.opt.DirectoryShard)
+}
+
+// CreateTable creates the lookup table on the directory shard.
+func (idx *UniqueIndex) CreateTable(ctx context.Context) error {
+	dir := idx.directory()
+	_, err := dir.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS ?SHARD.? (
+			value text PRIMARY KEY,
+			shard_id bigint NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now()
+		)
+	`, pg.Ident(idx.opt.Table))
+	return WrapShardError(dir, err)
+}
+
+// maxReserveAttempts limits the number of times Reserve retries
+// the value that is released concurrently.
+const maxReserveAttempts = 3
+
+// Reserve reserves the value for the shard and reports whether
+// the reservation was created by this call. It returns ErrNotUnique
+// if the value is reserved by another shard. Reserving the value
+// for the same shard again is a no-op that returns false.
+func (idx *UniqueIndex) Reserve(ctx context.Context, value string, shardID int64) (bool, error) {
+	dir := idx.directory()
+	for attempt := 0; attempt < maxReserveAttempts; attempt++ {
+		res, err := dir.ExecContext(ctx, `
+			INSERT INTO ?SHARD.? (value, shard_id) VALUES (?, ?)
+			ON CONFLICT (value) DO NOTHING
+		`, pg.Ident(idx.opt.Table), value, shardID)
+		if err != nil {
+			return false, WrapShardError(dir, err)
+		}
+		if res.RowsAffected() > 0 {
+			return true, nil
+		}
+
+		owner, ok, err := idx.Lookup(ctx, value)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			// Released concurrently.
+			continue
+		}
+		if owner != shardID {
+			return false, ErrNotUnique
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("sharding: can't reserve %q: value is released concurrently (%d attempts)",
+		value, maxReserveAttempts)
+}
+
+// Lookup returns id of the shard that reserved the value or false
+// if the value is not reserved.
+func (idx *UniqueIndex) Lookup(ctx context.Context, value string) (int64, bool, error) {
+	dir := idx.directory()
+	var shardID int64
+	_, err := dir.QueryOneContext(ctx, pg.Scan(&shardID), `
+		SELECT shard_id FROM ?SHARD.? WHERE value = ?
+	`, pg.Ident(idx.opt.Table), value)
+	if err == pg.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, WrapShardError(dir, err)
+	}
+	return shardID, true, nil
+}
+
+// Release removes the reservation of the value made by the shard.
+func (idx *UniqueIndex) Release(ctx context.Context, value string, shardID int64) error {
+	dir := idx.directory()
+	_, err := dir.ExecContext(ctx, `
+		DELETE FROM ?SHARD.? WHERE value = ? AND shard_id = ?
+	`, pg.Ident(idx.opt.Table), value, shardID)
+	return WrapShardError(dir, err)
+}
+
+// ReserveInTransaction reserves the value for the shard and calls the fn
+// in a transaction on the shard, e.g. to insert the row owning the value.
+// The reservation is released when the transaction fails unless
+// the shard already held it before the call.
+func (idx *UniqueIndex) ReserveInTransaction(
+	ctx context.Context, value string, shardID int64, fn func(tx *pg.Tx) error,
+) error {
+	reserved, err := idx.Reserve(ctx, value, shardID)
+	if err != nil {
+		return err
+	}
+
+	err = idx.cl.shardByID(shardID).RunInTransaction(ctx, fn)
+	if err != nil {
+		if reserved {
+			_ = idx.Release(ctx, value, shardID)
+		}
+		return err
+	}
+	return nil
+}
+
+// ReleaseInTransaction calls the fn in a transaction on the shard, e.g.
+// to delete the row owning the value, and releases the value after the
+// transaction is committed.
+func (idx *UniqueIndex) ReleaseInTransaction(
+	ctx context.Context, value string, shardID int64, fn func(tx *pg.Tx) error,
+) error {
+	if err := idx.cl.shardByID(shardID).RunInTransaction(ctx, fn); err != nil {
+		return err
+	}
+	return idx.Release(ctx, value, shardID)
+}
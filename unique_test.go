@@ -0,0 +1,104 @@
+package sharding_test
+
+import (
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UniqueIndex", func() {
+	var cluster *shardingtest.Cluster
+	var idx *sharding.UniqueIndex
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(4)
+		idx = cluster.NewUniqueIndex(&sharding.UniqueIndexOptions{
+			Table: "user_emails",
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("reserves values on the directory shard", func() {
+		cluster.SetResult(0, "INSERT", &shardingtest.Result{
+			Tag:          "INSERT 0",
+			RowsAffected: 1,
+		})
+
+		reserved, err := idx.Reserve(ctx, "me@example.com", 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reserved).To(BeTrue())
+		Expect(cluster.RoutedShards()).To(Equal([]int64{0}))
+	})
+
+	It("gives up when the value keeps being released", func() {
+		_, err := idx.Reserve(ctx, "me@example.com", 2)
+		Expect(err).To(MatchError(
+			`sharding: can't reserve "me@example.com": value is released concurrently (3 attempts)`))
+		Expect(cluster.Queries(0)).To(HaveLen(6))
+	})
+
+	It("rejects values reserved by another shard", func() {
+		cluster.SetResult(0, "SELECT shard_id", &shardingtest.Result{
+			Columns: []string{"shard_id"},
+			Rows:    [][]interface{}{{2}},
+		})
+
+		_, err := idx.Reserve(ctx, "me@example.com", 1)
+		Expect(err).To(Equal(sharding.ErrNotUnique))
+
+		reserved, err := idx.Reserve(ctx, "me@example.com", 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reserved).To(BeFalse())
+
+		shardID, ok, err := idx.Lookup(ctx, "me@example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(shardID).To(Equal(int64(2)))
+	})
+
+	It("releases the value when the transaction fails", func() {
+		cluster.SetResult(0, "INSERT", &shardingtest.Result{
+			Tag:          "INSERT 0",
+			RowsAffected: 1,
+		})
+
+		errFailed := errors.New("failed")
+		err := idx.ReserveInTransaction(ctx, "me@example.com", 3, func(tx *pg.Tx) error {
+			return errFailed
+		})
+		Expect(err).To(Equal(errFailed))
+
+		queries := cluster.Queries(0)
+		Expect(queries).To(HaveLen(2))
+		Expect(queries[1]).To(ContainSubstring(
+			`DELETE FROM shard0."user_emails" WHERE value = 'me@example.com' AND shard_id = 3`))
+		Expect(cluster.Queries(3)).To(Equal([]string{"BEGIN", "ROLLBACK"}))
+	})
+
+	It("keeps the earlier reservation of the shard when the transaction fails", func() {
+		cluster.SetResult(0, "SELECT shard_id", &shardingtest.Result{
+			Columns: []string{"shard_id"},
+			Rows:    [][]interface{}{{3}},
+		})
+
+		errFailed := errors.New("failed")
+		err := idx.ReserveInTransaction(ctx, "me@example.com", 3, func(tx *pg.Tx) error {
+			return errFailed
+		})
+		Expect(err).To(Equal(errFailed))
+
+		for _, q := range cluster.Queries(0) {
+			Expect(q).NotTo(ContainSubstring("DELETE"))
+		}
+		Expect(cluster.Queries(3)).To(Equal([]string{"BEGIN", "ROLLBACK"}))
+	})
+})
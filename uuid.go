@@ -1,12 +1,14 @@
 package sharding
 
 import (
+	"bytes"
 	"database/sql"
 	"database/sql/driver"
 	"encoding"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -18,6 +20,15 @@ import (
 const (
 	uuidLen    = 16
 	uuidHexLen = 36
+	uuidURN    = "urn:uuid:"
+)
+
+// Errors returned when a UUID can't be parsed. Returned errors wrap
+// one of them and can be checked with errors.Is.
+var (
+	ErrBadLength      = errors.New("sharding: invalid UUID length")
+	ErrBadHyphenation = errors.New("sharding: invalid UUID hyphenation")
+	ErrBadHex         = errors.New("sharding: invalid UUID hex")
 )
 
 var (
@@ -40,6 +51,8 @@ func NewUUID(shardID int64, tm time.Time) UUID {
 	return u
 }
 
+// ParseUUID parses UUID in the canonical hyphenated form, as 32 hex digits
+// without hyphens, or either of them prefixed with urn:uuid:.
 func ParseUUID(b []byte) (UUID, error) {
 	var u UUID
 	err := u.UnmarshalText(b)
@@ -86,7 +99,10 @@ func (u UUID) AppendValue(b []byte, quote int) ([]byte, error) {
 	if u.IsZero() {
 		return types.AppendNull(b, quote), nil
 	}
+	return appendUUID(b, u, quote), nil
+}
 
+func appendUUID(b []byte, u UUID, quote int) []byte {
 	if quote == 2 {
 		b = append(b, '"')
 	} else if quote == 1 {
@@ -101,7 +117,7 @@ func (u UUID) AppendValue(b []byte, quote int) ([]byte, error) {
 		b = append(b, '\'')
 	}
 
-	return b, nil
+	return b
 }
 
 var _ driver.Valuer = (*UUID)(nil)
@@ -112,24 +128,26 @@ func (u UUID) Value() (driver.Value, error) {
 
 var _ sql.Scanner = (*UUID)(nil)
 
-func (u *UUID) Scan(b interface{}) error {
-	if b == nil {
-		for i := range u {
-			u[i] = 0
+// Scan scans UUID in the text form, as 16 raw bytes, or NULL as the zero
+// UUID.
+func (u *UUID) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*u = UUID{}
+		return nil
+	case []byte:
+		if len(src) == uuidLen {
+			copy(u[:], src)
+			return nil
 		}
+		return u.UnmarshalText(src)
+	case string:
+		return u.UnmarshalText([]byte(src))
+	case UUID:
+		*u = src
 		return nil
 	}
-
-	uuid, err := ParseUUID(b.([]byte))
-	if err != nil {
-		return err
-	}
-
-	for i, c := range uuid {
-		u[i] = c
-	}
-
-	return nil
+	return fmt.Errorf("sharding: can't scan %T into UUID", src)
 }
 
 var _ encoding.BinaryMarshaler = (*UUID)(nil)
@@ -146,10 +164,9 @@ func (u *UUID) UnmarshalBinary(b []byte) error {
 		copy(u[:], b)
 		return nil
 	case uuidHexLen - 4:
-		_, err := hex.Decode(u[:], b)
-		return err
+		return decodeHex(u[:], b)
 	}
-	return fmt.Errorf("sharding: invalid UUID: %q", b)
+	return fmt.Errorf("%w: %q", ErrBadLength, b)
 }
 
 var _ encoding.TextMarshaler = (*UUID)(nil)
@@ -161,34 +178,39 @@ func (u UUID) MarshalText() ([]byte, error) {
 var _ encoding.TextUnmarshaler = (*UUID)(nil)
 
 func (u *UUID) UnmarshalText(b []byte) error {
+	if len(b) > len(uuidURN) && bytes.EqualFold(b[:len(uuidURN)], []byte(uuidURN)) {
+		b = b[len(uuidURN):]
+	}
+
 	if len(b) == uuidHexLen-4 {
-		_, err := hex.Decode(u[:], b)
-		return err
+		return decodeHex(u[:], b)
 	}
 
 	if len(b) != uuidHexLen {
-		return fmt.Errorf("sharding: invalid UUID: %q", b)
+		return fmt.Errorf("%w: %q", ErrBadLength, b)
 	}
-	_, err := hex.Decode(u[:4], b[:8])
-	if err != nil {
-		return err
+	if b[8] != '-' || b[13] != '-' || b[18] != '-' || b[23] != '-' {
+		return fmt.Errorf("%w: %q", ErrBadHyphenation, b)
 	}
-	_, err = hex.Decode(u[4:6], b[9:13])
-	if err != nil {
+	if err := decodeHex(u[:4], b[:8]); err != nil {
 		return err
 	}
-	_, err = hex.Decode(u[6:8], b[14:18])
-	if err != nil {
+	if err := decodeHex(u[4:6], b[9:13]); err != nil {
 		return err
 	}
-	_, err = hex.Decode(u[8:10], b[19:23])
-	if err != nil {
+	if err := decodeHex(u[6:8], b[14:18]); err != nil {
 		return err
 	}
-	_, err = hex.Decode(u[10:], b[24:])
-	if err != nil {
+	if err := decodeHex(u[8:10], b[19:23]); err != nil {
 		return err
 	}
+	return decodeHex(u[10:], b[24:])
+}
+
+func decodeHex(dst, src []byte) error {
+	if _, err := hex.Decode(dst, src); err != nil {
+		return fmt.Errorf("%w: %s", ErrBadHex, err)
+	}
 	return nil
 }
 
@@ -209,6 +231,10 @@ func (u UUID) MarshalJSON() ([]byte, error) {
 var _ json.Unmarshaler = (*UUID)(nil)
 
 func (u *UUID) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*u = UUID{}
+		return nil
+	}
 	if len(b) >= 2 {
 		b = b[1 : len(b)-1]
 	}
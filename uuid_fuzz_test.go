@@ -0,0 +1,38 @@
+//go:build go1.18
+// +build go1.18
+
+package sharding_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func FuzzParseUUID(f *testing.F) {
+	f.Add("00035d01-3b37-e000-0000-fdc2fa2ffcc0")
+	f.Add("00035d013b37e0000000fdc2fa2ffcc0")
+	f.Add("urn:uuid:00035d01-3b37-e000-0000-fdc2fa2ffcc0")
+	f.Add("00035d01+3b37-e000-0000-fdc2fa2ffcc0")
+
+	f.Fuzz(func(t *testing.T, in string) {
+		uuid, err := sharding.ParseUUID([]byte(in))
+		if err != nil {
+			if !errors.Is(err, sharding.ErrBadLength) &&
+				!errors.Is(err, sharding.ErrBadHyphenation) &&
+				!errors.Is(err, sharding.ErrBadHex) {
+				t.Fatalf("%q: uncategorized error: %s", in, err)
+			}
+			return
+		}
+
+		parsed, err := sharding.ParseUUID([]byte(uuid.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != uuid {
+			t.Fatalf("got %s, wanted %s", parsed, uuid)
+		}
+	})
+}
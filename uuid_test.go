@@ -2,6 +2,8 @@ package sharding_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"math/rand"
 	"testing"
 	"time"
@@ -29,6 +31,47 @@ func TestUUIDParse(t *testing.T) {
 	}
 }
 
+func TestUUIDParseFormats(t *testing.T) {
+	wanted := "00035d01-3b37-e000-0000-fdc2fa2ffcc0"
+	inputs := []string{
+		wanted,
+		"00035D01-3B37-E000-0000-FDC2FA2FFCC0",
+		"00035d013b37e0000000fdc2fa2ffcc0",
+		"urn:uuid:00035d01-3b37-e000-0000-fdc2fa2ffcc0",
+		"URN:UUID:00035d013b37e0000000fdc2fa2ffcc0",
+	}
+	for _, in := range inputs {
+		uuid, err := sharding.ParseUUID([]byte(in))
+		if err != nil {
+			t.Fatalf("%q: %s", in, err)
+		}
+		if got := uuid.String(); got != wanted {
+			t.Fatalf("%q: got %q, wanted %q", in, got, wanted)
+		}
+	}
+}
+
+func TestUUIDParseErrors(t *testing.T) {
+	tests := []struct {
+		in     string
+		wanted error
+	}{
+		{"", sharding.ErrBadLength},
+		{"00035d01-3b37-e000-0000", sharding.ErrBadLength},
+		{"urn:uuid:", sharding.ErrBadLength},
+		{"00035d01+3b37-e000-0000-fdc2fa2ffcc0", sharding.ErrBadHyphenation},
+		{"00035d013-b37-e000-0000-fdc2fa2ffcc0", sharding.ErrBadHyphenation},
+		{"00035d01-3b37-e000-0000-fdc2fa2ffcz0", sharding.ErrBadHex},
+		{"00035d013b37e0000000fdc2fa2ffczz", sharding.ErrBadHex},
+	}
+	for _, test := range tests {
+		_, err := sharding.ParseUUID([]byte(test.in))
+		if !errors.Is(err, test.wanted) {
+			t.Fatalf("%q: got %v, wanted %v", test.in, err, test.wanted)
+		}
+	}
+}
+
 func TestUUIDTime(t *testing.T) {
 	shard := int64(2047)
 	for i := 0; i < 100000; i++ {
@@ -71,3 +114,99 @@ func TestUUIDCollision(t *testing.T) {
 		m[uuid] = struct{}{}
 	}
 }
+
+func TestUUIDScan(t *testing.T) {
+	wanted, _ := sharding.ParseUUID([]byte("00035d01-3b37-e000-0000-fdc2fa2ffcc0"))
+	inputs := []interface{}{
+		[]byte(wanted.String()),
+		wanted.String(),
+		wanted[:],
+		wanted,
+	}
+	for _, in := range inputs {
+		var uuid sharding.UUID
+		if err := uuid.Scan(in); err != nil {
+			t.Fatalf("%T: %s", in, err)
+		}
+		if uuid != wanted {
+			t.Fatalf("%T: got %s, wanted %s", in, uuid, wanted)
+		}
+	}
+
+	uuid := wanted
+	if err := uuid.Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !uuid.IsZero() {
+		t.Fatalf("got %s, wanted zero UUID", uuid)
+	}
+
+	if err := uuid.Scan(int64(1)); err == nil {
+		t.Fatal("got nil error for int64")
+	}
+	if err := uuid.Scan("bad"); !errors.Is(err, sharding.ErrBadLength) {
+		t.Fatalf("got %v, wanted ErrBadLength", err)
+	}
+}
+
+func TestNullUUID(t *testing.T) {
+	var null sharding.NullUUID
+	if err := null.Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if null.Valid {
+		t.Fatal("got valid NullUUID for NULL")
+	}
+	if v, _ := null.Value(); v != nil {
+		t.Fatalf("got %v, wanted nil", v)
+	}
+	if b, _ := null.AppendValue(nil, 1); string(b) != "NULL" {
+		t.Fatalf("got %s, wanted NULL", b)
+	}
+
+	// The zero UUID is a valid value.
+	zero := sharding.NewNullUUID(sharding.UUID{})
+	wanted := "'00000000-0000-0000-0000-000000000000'"
+	if b, _ := zero.AppendValue(nil, 1); string(b) != wanted {
+		t.Fatalf("got %s, wanted %s", b, wanted)
+	}
+
+	var u sharding.NullUUID
+	if err := u.Scan("00035d01-3b37-e000-0000-fdc2fa2ffcc0"); err != nil {
+		t.Fatal(err)
+	}
+	if !u.Valid || u.UUID.String() != "00035d01-3b37-e000-0000-fdc2fa2ffcc0" {
+		t.Fatalf("got %+v", u)
+	}
+	if err := u.Scan("bad"); err == nil || u.Valid {
+		t.Fatalf("got valid NullUUID %+v after error %v", u, err)
+	}
+}
+
+func TestNullUUIDJSON(t *testing.T) {
+	type model struct {
+		ID     sharding.NullUUID
+		Parent sharding.NullUUID
+	}
+
+	in := model{
+		ID: sharding.NewNullUUID(sharding.UUID{1}),
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := `{"ID":"01000000-0000-0000-0000-000000000000","Parent":null}`
+	if string(b) != wanted {
+		t.Fatalf("got %s, wanted %s", b, wanted)
+	}
+
+	var out model
+	out.Parent = sharding.NewNullUUID(sharding.UUID{2})
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Fatalf("got %+v, wanted %+v", out, in)
+	}
+}
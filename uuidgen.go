@@ -0,0 +1,46 @@
+package sharding
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+)
+
+// UUIDGen generates UUIDs for a shard that are strictly ordered as long as
+// the time does not go backwards. Like NewUUID, the UUID starts with the
+// time in microseconds followed by the shard id, but the random low bits
+// are replaced with an auto-incrementing counter, so UUIDs generated
+// within the same microsecond sort in the generation order.
+type UUIDGen struct {
+	shard int64
+	seq   uint64
+
+	fp    byte
+	hasFP bool
+}
+
+// NewUUIDGen returns a UUID generator for the shard.
+func NewUUIDGen(shard int64) *UUIDGen {
+	return &UUIDGen{
+		shard: shard % int64(DefaultIDGen.NumShards()),
+	}
+}
+
+// NextUUID returns the next UUID for the time.
+func (g *UUIDGen) NextUUID(tm time.Time) UUID {
+	seq := atomic.AddUint64(&g.seq, 1) - 1
+
+	var u UUID
+	binary.BigEndian.PutUint64(u[:8], uint64(unixMicrosecond(tm)))
+	u[8] = byte(g.shard>>8) & 0x7
+	u[9] = byte(g.shard)
+
+	// The counter takes the low 48 bits, or 40 bits when the fingerprint
+	// occupies uuidFingerprintByte.
+	binary.BigEndian.PutUint16(u[10:12], uint16(seq>>32))
+	binary.BigEndian.PutUint32(u[12:], uint32(seq))
+	if g.hasFP {
+		u[uuidFingerprintByte] = g.fp
+	}
+	return u
+}
@@ -0,0 +1,58 @@
+package sharding_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/go-pg/sharding/v8"
+)
+
+func TestUUIDGenOrder(t *testing.T) {
+	gen := sharding.NewUUIDGen(2049)
+	tm := time.Now()
+
+	var prev sharding.UUID
+	for i := 0; i < 1000; i++ {
+		u := gen.NextUUID(tm)
+		if bytes.Compare(u[:], prev[:]) <= 0 {
+			t.Fatalf("iter %d: %s <= %s", i, u, prev)
+		}
+		shardID, gotTm := u.Split()
+		if shardID != 1 {
+			t.Fatalf("got shard %d, wanted 1", shardID)
+		}
+		if gotTm.UnixNano()/1000 != tm.UnixNano()/1000 {
+			t.Fatalf("got %s, wanted %s", gotTm, tm)
+		}
+		prev = u
+	}
+
+	next := gen.NextUUID(tm.Add(time.Microsecond))
+	if bytes.Compare(next[:], prev[:]) <= 0 {
+		t.Fatalf("%s <= %s", next, prev)
+	}
+}
+
+func TestClusterUUIDGenFingerprint(t *testing.T) {
+	db := pg.Connect(&pg.Options{Addr: "db1"})
+	defer db.Close()
+
+	cl := sharding.NewCluster([]*pg.DB{db}, 4, sharding.WithFingerprint(8))
+	gen := cl.NewUUIDGen(3)
+
+	tm := time.Now()
+	u1 := gen.NextUUID(tm)
+	u2 := gen.NextUUID(tm)
+	if bytes.Compare(u1[:], u2[:]) >= 0 {
+		t.Fatalf("%s >= %s", u1, u2)
+	}
+	if err := cl.CheckUUID(u2); err != nil {
+		t.Fatal(err)
+	}
+	if got := u2.ShardID(); got != 3 {
+		t.Fatalf("got shard %d, wanted 3", got)
+	}
+}
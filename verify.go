@@ -0,0 +1,126 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// ShardVerification is the result of verifying a shard.
+type ShardVerification struct {
+	ShardID int64
+	Schema  string
+	DBAddr  string
+	// SchemaExists is true when the shard schema exists on its database.
+	SchemaExists bool
+	// MissingTables are the required tables that don't exist in the schema.
+	MissingTables []string
+	// Err is the error encountered while querying the shard.
+	Err error
+}
+
+// OK returns true when the schema and all required tables exist.
+func (v *ShardVerification) OK() bool {
+	return v.Err == nil && v.SchemaExists && len(v.MissingTables) == 0
+}
+
+func (v *ShardVerification) problem() string {
+	switch {
+	case v.Err != nil:
+		return v.Err.Error()
+	case !v.SchemaExists:
+		return fmt.Sprintf("schema %s does not exist", v.Schema)
+	default:
+		return fmt.Sprintf("schema %s is missing tables: %s",
+			v.Schema, strings.Join(v.MissingTables, ", "))
+	}
+}
+
+// VerifyReport is the result of Verify ordered by shard id.
+type VerifyReport struct {
+	Shards []ShardVerification
+}
+
+// Failed returns verifications of shards that are not OK.
+func (r *VerifyReport) Failed() []ShardVerification {
+	var failed []ShardVerification
+	for i := range r.Shards {
+		if !r.Shards[i].OK() {
+			failed = append(failed, r.Shards[i])
+		}
+	}
+	return failed
+}
+
+// Err returns an error describing the first failed shard and the
+// number of failed shards or nil if all shards are OK.
+func (r *VerifyReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	v := &failed[0]
+	err := fmt.Errorf("sharding: shard %d (%s): %s", v.ShardID, v.DBAddr, v.problem())
+	if len(failed) > 1 {
+		err = fmt.Errorf("%w (and %d more shards)", err, len(failed)-1)
+	}
+	return err
+}
+
+// Verify checks that every shard schema and the required tables exist
+// on the database the shard is assigned to. It is meant to be called on
+// startup to catch misconfigured clusters. The returned error is the
+// same as VerifyReport.Err.
+func (cl *Cluster) Verify(ctx context.Context, tables ...string) (*VerifyReport, error) {
+	infos := cl.ShardInfos()
+	report := &VerifyReport{
+		Shards: make([]ShardVerification, len(infos)),
+	}
+
+	_ = cl.ForEachShard(func(shard *pg.DB) error {
+		info := &infos[shard.Param("SHARD_ID").(int64)]
+		report.Shards[info.ID] = verifyShard(ctx, info, tables)
+		return nil
+	})
+	return report, report.Err()
+}
+
+func verifyShard(ctx context.Context, info *ShardInfo, tables []string) ShardVerification {
+	v := ShardVerification{
+		ShardID: info.ID,
+		Schema:  info.Schema,
+		DBAddr:  info.DBAddr,
+	}
+
+	// No rows means there is no schema and a NULL relname means
+	// the schema has no tables.
+	var existing []string
+	_, err := info.Shard.QueryContext(ctx, &existing, `
+		SELECT c.relname
+		FROM pg_namespace AS n
+		LEFT JOIN pg_class AS c
+			ON c.relnamespace = n.oid AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+		WHERE n.nspname = '?SHARD'
+	`)
+	if err != nil {
+		v.Err = err
+		return v
+	}
+	if len(existing) == 0 {
+		return v
+	}
+	v.SchemaExists = true
+
+	set := make(map[string]struct{}, len(existing))
+	for _, table := range existing {
+		set[table] = struct{}{}
+	}
+	for _, table := range tables {
+		if _, ok := set[table]; !ok {
+			v.MissingTables = append(v.MissingTables, table)
+		}
+	}
+	return v
+}
@@ -0,0 +1,67 @@
+package sharding_test
+
+import (
+	"github.com/go-pg/sharding/v8"
+	"github.com/go-pg/sharding/v8/shardingtest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Verify", func() {
+	var cluster *shardingtest.Cluster
+
+	BeforeEach(func() {
+		cluster = shardingtest.NewCluster(3)
+		cluster.SetResult(shardingtest.AllShards, "pg_namespace", &shardingtest.Result{
+			Columns: []string{"relname"},
+			Rows:    [][]interface{}{{"users"}, {"posts"}},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(cluster.Close()).NotTo(HaveOccurred())
+	})
+
+	It("succeeds when schemas and tables exist", func() {
+		report, err := cluster.Verify(ctx, "users", "posts")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Shards).To(HaveLen(3))
+		Expect(report.Shards[2]).To(Equal(sharding.ShardVerification{
+			ShardID:      2,
+			Schema:       "shard2",
+			DBAddr:       "shardingtest2",
+			SchemaExists: true,
+		}))
+		Expect(report.Failed()).To(BeEmpty())
+	})
+
+	It("reports missing schemas and tables", func() {
+		cluster.SetResult(1, "pg_namespace", &shardingtest.Result{
+			Columns: []string{"relname"},
+		})
+		cluster.SetResult(2, "pg_namespace", &shardingtest.Result{
+			Columns: []string{"relname"},
+			Rows:    [][]interface{}{{nil}},
+		})
+
+		report, err := cluster.Verify(ctx, "users")
+		Expect(err).To(MatchError(
+			"sharding: shard 1 (shardingtest1): schema shard1 does not exist (and 1 more shards)"))
+
+		failed := report.Failed()
+		Expect(failed).To(HaveLen(2))
+		Expect(failed[0].SchemaExists).To(BeFalse())
+		Expect(failed[1].SchemaExists).To(BeTrue())
+		Expect(failed[1].MissingTables).To(Equal([]string{"users"}))
+	})
+
+	It("reports query errors", func() {
+		cluster.SetError(0, &shardingtest.Error{Message: "connection lost"})
+
+		report, err := cluster.Verify(ctx)
+		Expect(err).To(MatchError("sharding: shard 0 (shardingtest0): ERROR #XX000 connection lost"))
+		Expect(report.Shards[0].Err).To(HaveOccurred())
+		Expect(report.Shards[1].OK()).To(BeTrue())
+	})
+})